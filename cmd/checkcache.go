@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/spf13/cobra"
+)
+
+// checkCacheCmd verifies a cache's db files, for example before they're
+// copied to a production server, without starting the server.
+var checkCacheCmd = &cobra.Command{
+	Use:   "check-cache",
+	Short: "Verify a block cache without starting the server",
+	Long: `Verify a block cache (the directory holding its lengths and blocks files,
+such as <data-dir>/db/main): its format version, that it begins at the
+network's first cached height, and each block's checksum, height, and link
+to the block before it. Prints a report, and exits nonzero if there's any
+problem. No connection to pirated is needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		chainName, _ := cmd.Flags().GetString("chain-name")
+		startHeight, _ := cmd.Flags().GetInt("start-height")
+		os.Exit(checkCache(path, chainName, startHeight))
+	},
+}
+
+// checkCache runs check-cache, returning the exit status.
+func checkCache(path, chainName string, startHeight int) int {
+	if path == "" {
+		fmt.Println("check-cache: --path is required")
+		return 2
+	}
+	if chainName == "" {
+		chainName = filepath.Base(filepath.Clean(path))
+	}
+	if startHeight == 0 {
+		startHeight = common.SaplingActivationHeight(chainName, 0)
+	}
+	if startHeight == 0 {
+		fmt.Printf("check-cache: the first height of network %q isn't known, use --start-height\n", chainName)
+		return 2
+	}
+	r := common.CheckCache(path, startHeight)
+	fmt.Println("cache:", r.Dir)
+	fmt.Println("network:", chainName)
+	fmt.Println("format version:", r.Version)
+	if r.Blocks > 0 {
+		fmt.Printf("blocks: %d (heights %d to %d, %d compressed)\n",
+			r.Blocks, r.FirstHeight, r.FirstHeight+r.Blocks-1, r.Compressed)
+	} else {
+		fmt.Println("blocks: 0")
+	}
+	if r.OK() {
+		fmt.Println("OK")
+		return 0
+	}
+	for _, problem := range r.Problems {
+		fmt.Println("problem:", problem)
+	}
+	fmt.Println(len(r.Problems), "problems found")
+	return 1
+}
+
+func init() {
+	checkCacheCmd.Flags().String("path", "", "the cache directory to check (holding the lengths and blocks files)")
+	checkCacheCmd.Flags().String("chain-name", "", "the cache's network, as pirated names it (default: the directory's name)")
+	checkCacheCmd.Flags().Int("start-height", 0, "the cache's first height (default: the network's sapling activation height)")
+}
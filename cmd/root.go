@@ -12,7 +12,6 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/rpcclient"
-	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,6 +20,8 @@ import (
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/PirateNetwork/lightwalletd/common"
@@ -46,25 +47,98 @@ var rootCmd = &cobra.Command{
 		opts := &common.Options{
 			GRPCBindAddr:        viper.GetString("grpc-bind-addr"),
 			GRPCLogging:         viper.GetBool("grpc-logging-insecure"),
+			GRPCMaxStreams:      viper.GetInt("grpc-max-concurrent-streams"),
 			HTTPBindAddr:        viper.GetString("http-bind-addr"),
 			TLSCertPath:         viper.GetString("tls-cert"),
 			TLSKeyPath:          viper.GetString("tls-key"),
-			LogLevel:            viper.GetUint64("log-level"),
 			LogFile:             viper.GetString("log-file"),
+			AccessLog:           viper.GetString("access-log"),
+			AccessLogFormat:     viper.GetString("access-log-format"),
+			CaptureDir:          viper.GetString("capture-dir"),
+			CaptureMethods:      viper.GetStringSlice("capture-method"),
+			CaptureRate:         viper.GetFloat64("capture-rate"),
+			CaptureFileSize:     viper.GetInt("capture-file-size"),
+			CaptureFiles:        viper.GetInt("capture-files"),
 			PirateConfPath:      viper.GetString("pirate-conf-path"),
 			RPCUser:             viper.GetString("rpcuser"),
 			RPCPassword:         viper.GetString("rpcpassword"),
 			RPCHost:             viper.GetString("rpchost"),
 			RPCPort:             viper.GetString("rpcport"),
+			RPCCookiePath:       viper.GetString("pirated-cookie"),
+			PiratedProxy:        viper.GetString("pirated-proxy"),
 			NoTLSVeryInsecure:   viper.GetBool("no-tls-very-insecure"),
+			StandbyPrimary:      viper.GetString("standby-primary"),
+			StandbyInsecure:     viper.GetBool("standby-primary-insecure"),
 			GenCertVeryInsecure: viper.GetBool("gen-cert-very-insecure"),
 			DataDir:             viper.GetString("data-dir"),
 			Redownload:          viper.GetBool("redownload"),
 			SyncFromHeight:      viper.GetInt("sync-from-height"),
 			PingEnable:          viper.GetBool("ping-very-insecure"),
+			TreeStateSprout:     viper.GetBool("tree-state-sprout"),
+			StrictTreeState:     viper.GetBool("strict-treestate"),
+			TreeStateRoots:      viper.GetBool("tree-state-root-fallback"),
+			IngestBatchSize:     viper.GetInt("ingest-batch-size"),
+			IngestLagBlocks:     viper.GetInt("ingest-lag-alarm-blocks"),
+			IngestLagDuration:   viper.GetInt("ingest-lag-alarm-duration"),
+			TreeStateIndex:      viper.GetBool("tree-state-index"),
+			TreeStateInterval:   viper.GetInt("tree-state-index-interval"),
+			IngestDebounce:      viper.GetInt("ingest-debounce"),
+			ClockSkewWarning:    viper.GetInt("clock-skew-warning"),
+			MaxBlockElements:    viper.GetInt("max-block-elements"),
+			MaxTaddresses:       viper.GetInt("max-taddresses"),
+			MaxTxSize:           viper.GetInt("max-tx-size"),
+			StreamMemoryBudget:  viper.GetInt("stream-memory-budget"),
+			DeepHistoryHeight:   viper.GetInt("deep-history-height"),
+			VerifyBlocks:        viper.GetBool("verify-blocks"),
+			VerifyInterval:      viper.GetInt("verify-blocks-interval"),
+			CompactBlockCheck:   viper.GetString("compact-block-check"),
+			CoinbaseMarkers:     viper.GetBool("coinbase-markers"),
+			TxOutSetCacheTTL:    viper.GetInt("txoutset-cache-ttl"),
+			LightdInfoCacheTTL:  viper.GetInt("lightdinfo-cache-ttl"),
+			UpgradeWarning:      viper.GetInt("upgrade-warning-blocks"),
+			SendConfirmWait:     viper.GetInt("send-confirm-wait"),
+			MempoolStateTTL:     viper.GetInt("mempool-state-ttl"),
+			ReorgGracePeriod:    viper.GetInt("reorg-grace-period"),
+			NoMempoolLookup:     viper.GetBool("no-mempool-lookup"),
+			BlockExtended:       viper.GetBool("block-extended"),
+			MaxBackendRequests:  viper.GetInt("max-backend-requests"),
+			RPCBatchSize:        viper.GetInt("rpc-batch-size"),
+			MinProtocolVersion:  viper.GetInt("min-protocol-version"),
+			MaxStreamDuration:   viper.GetInt("max-stream-duration"),
+			MaxPeerRequests:     viper.GetInt("max-peer-requests"),
+			ClientQuota:         viper.GetInt("client-quota"),
+			ClientQuotaWindow:   viper.GetInt("client-quota-window"),
+			ClientQuotaAPIKeys:  viper.GetStringSlice("client-quota-api-key"),
+			AllowCIDRs:          viper.GetStringSlice("allow-cidr"),
+			DenyCIDRs:           viper.GetStringSlice("deny-cidr"),
+			Vendor:              viper.GetString("vendor"),
+			InfoExtra:           viper.GetStringSlice("info-extra"),
+			RPCPassthrough:      viper.GetStringSlice("rpc-passthrough"),
+			MemoryCacheBlocks:   viper.GetInt("cache-memory-blocks"),
+			CacheHistoryDirs:    viper.GetStringSlice("cache-history-dirs"),
+			HashIndexBlocks:     viper.GetInt("cache-hash-index-blocks"),
+			CompressionLevel:    viper.GetInt("cache-compression-level"),
+			MemoryCachePolicy:   viper.GetString("cache-memory-policy"),
+			CacheDuplicates:     viper.GetString("cache-duplicate-heights"),
+			CachePrimeBlocks:    viper.GetInt("cache-prime-blocks"),
+			SaplingOnly:         viper.GetBool("sapling-only"),
+			CacheWriteBuffer:    viper.GetInt("cache-write-buffer"),
+			CacheFlushBlocks:    viper.GetInt("cache-flush-blocks"),
+			CacheFlushInterval:  viper.GetInt("cache-flush-interval"),
+			CrashVerifyBlocks:   viper.GetInt("crash-verify-blocks"),
+			ScrubInterval:       viper.GetInt("cache-scrub-interval"),
+			ScrubRate:           viper.GetInt("cache-scrub-rate"),
+			ScrubRefetch:        viper.GetBool("cache-scrub-refetch"),
+			ScrubBusyRequests:   viper.GetInt("cache-scrub-busy-requests"),
+			CacheInMemory:       viper.GetBool("cache-in-memory"),
 			Darkside:            viper.GetBool("darkside-very-insecure"),
 			DarksideTimeout:     viper.GetUint64("darkside-timeout"),
 		}
+		logLevel, err := common.ParseLogLevel(viper.GetString("log-level"))
+		if err != nil {
+			common.Log.Fatal("log-level: ", err)
+		}
+		opts.LogLevel = uint64(logLevel)
 
 		common.Log.Debugf("Options: %#v\n", opts)
 
@@ -74,7 +148,8 @@ var rootCmd = &cobra.Command{
 		if !fileExists(opts.LogFile) {
 			os.OpenFile(opts.LogFile, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 		}
-		if !opts.Darkside && (opts.RPCUser == "" || opts.RPCPassword == "" || opts.RPCHost == "" || opts.RPCPort == "") {
+		haveCredentials := opts.RPCCookiePath != "" || (opts.RPCUser != "" && opts.RPCPassword != "")
+		if !opts.Darkside && (!haveCredentials || opts.RPCHost == "" || opts.RPCPort == "") {
 			filesThatShouldExist = append(filesThatShouldExist, opts.PirateConfPath)
 		}
 		if !opts.NoTLSVeryInsecure && !opts.GenCertVeryInsecure {
@@ -107,6 +182,7 @@ func fileExists(filename string) bool {
 }
 
 func startServer(opts *common.Options) error {
+	common.RunningOptions = opts
 	if opts.LogFile != "" {
 		// instead write parsable logs for logstash/splunk/etc
 		output, err := os.OpenFile(opts.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -120,6 +196,37 @@ func startServer(opts *common.Options) error {
 		logger.SetOutput(output)
 		logger.SetFormatter(&logrus.JSONFormatter{})
 	}
+	if opts.AccessLog != "" {
+		output := os.Stdout
+		if opts.AccessLog != "-" {
+			var err error
+			output, err = os.OpenFile(opts.AccessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				common.Log.WithFields(logrus.Fields{
+					"error": err,
+					"path":  opts.AccessLog,
+				}).Fatal("couldn't open access log file")
+			}
+			defer output.Close()
+		}
+		accessLog, err := logging.NewAccessLogger(output, opts.AccessLogFormat)
+		if err != nil {
+			common.Log.Fatal("access-log-format: ", err)
+		}
+		logging.AccessLog = accessLog
+	}
+	if opts.CaptureDir != "" {
+		capture, err := logging.NewDebugCapture(opts.CaptureDir, opts.CaptureMethods, opts.CaptureRate,
+			int64(opts.CaptureFileSize)*1024*1024, opts.CaptureFiles)
+		if err != nil {
+			common.Log.WithFields(logrus.Fields{
+				"error": err,
+				"path":  opts.CaptureDir,
+			}).Fatal("couldn't start the rpc capture")
+		}
+		defer capture.Close()
+		logging.Capture = capture
+	}
 
 	promRegistry.MustRegister(common.Metrics.LatestBlockCounter)
 	promRegistry.MustRegister(common.Metrics.TotalErrors)
@@ -131,6 +238,19 @@ func startServer(opts *common.Options) error {
 	promRegistry.MustRegister(common.Metrics.ArrrPriceGauge)
 	promRegistry.MustRegister(common.Metrics.ArrrPriceHistoryWebAPICounter)
 	promRegistry.MustRegister(common.Metrics.ArrrPriceHistoryErrors)
+	promRegistry.MustRegister(common.Metrics.RPCErrorsCounter)
+	promRegistry.MustRegister(common.Metrics.CacheCorruptBlocksCounter)
+	promRegistry.MustRegister(common.Metrics.InFlightRequestsGauge)
+	promRegistry.MustRegister(common.Metrics.InFlightMethodGauge)
+	promRegistry.MustRegister(common.Metrics.IngestLagGauge)
+	promRegistry.MustRegister(common.Metrics.IngestLagAlarmGauge)
+	promRegistry.MustRegister(common.Metrics.TipAgeGauge)
+	promRegistry.MustRegister(common.Metrics.SinceLastBlockGauge)
+	promRegistry.MustRegister(common.Metrics.HashIndexBytesGauge)
+	promRegistry.MustRegister(common.Metrics.ShieldedServedCounter)
+	promRegistry.MustRegister(common.Metrics.StreamGoroutinesGauge)
+	promRegistry.MustRegister(common.Metrics.BytesSentCounter)
+	promRegistry.MustRegister(common.Metrics.BadCompactBlockHeightGauge)
 
 	logger.SetLevel(logrus.Level(opts.LogLevel))
 
@@ -142,21 +262,46 @@ func startServer(opts *common.Options) error {
 
 	logging.LogToStderr = opts.GRPCLogging
 
+	if opts.MinProtocolVersion < 0 || opts.MinProtocolVersion > common.ProtocolVersion {
+		common.Log.Fatalf("min-protocol-version must be between 0 and %d", common.ProtocolVersion)
+	}
+	common.MinProtocolVersion = opts.MinProtocolVersion
+	common.MaxStreamDuration = time.Duration(opts.MaxStreamDuration) * time.Second
+	common.MaxPeerRequests = opts.MaxPeerRequests
+	if opts.ClientQuota < 0 {
+		common.Log.Fatal("client-quota must not be negative")
+	}
+	if opts.ClientQuotaWindow <= 0 {
+		common.Log.Fatal("client-quota-window must be positive")
+	}
+	common.QuotaBytes = int64(opts.ClientQuota) * 1024 * 1024
+	common.QuotaWindow = time.Duration(opts.ClientQuotaWindow) * time.Second
+	common.QuotaAPIKeys = make(map[string]bool)
+	for _, key := range opts.ClientQuotaAPIKeys {
+		common.QuotaAPIKeys[key] = true
+	}
+	if nets, err := common.ParseCIDRs(opts.AllowCIDRs); err != nil {
+		common.Log.Fatal("invalid allow-cidr: ", err)
+	} else {
+		common.AllowCIDRs = nets
+	}
+	if nets, err := common.ParseCIDRs(opts.DenyCIDRs); err != nil {
+		common.Log.Fatal("invalid deny-cidr: ", err)
+	} else {
+		common.DenyCIDRs = nets
+	}
+
 	// gRPC initialization
+	if opts.GRPCMaxStreams < 0 {
+		common.Log.Fatal("grpc-max-concurrent-streams must not be negative")
+	}
 	var server *grpc.Server
+	serverOptions := append(grpcLimitOptions(opts), logging.ServerInterceptors()...)
 
 	if opts.NoTLSVeryInsecure {
 		common.Log.Warningln("Starting insecure no-TLS (plaintext) server")
 		fmt.Println("Starting insecure server")
-		server = grpc.NewServer(
-			grpc.StreamInterceptor(
-				grpc_middleware.ChainStreamServer(
-					grpc_prometheus.StreamServerInterceptor),
-			),
-			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-				logging.LogInterceptor,
-				grpc_prometheus.UnaryServerInterceptor),
-			))
+		server = grpc.NewServer(serverOptions...)
 	} else {
 		var transportCreds credentials.TransportCredentials
 		if opts.GenCertVeryInsecure {
@@ -175,16 +320,11 @@ func startServer(opts *common.Options) error {
 				}).Fatal("couldn't load TLS credentials")
 			}
 		}
-		server = grpc.NewServer(
-			grpc.Creds(transportCreds),
-			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-				grpc_prometheus.StreamServerInterceptor),
-			),
-			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-				logging.LogInterceptor,
-				grpc_prometheus.UnaryServerInterceptor),
-			))
+		server = grpc.NewServer(append(serverOptions, grpc.Creds(transportCreds))...)
 	}
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	common.SetServing(healthServer, true)
 	grpc_prometheus.EnableHandlingTimeHistogram()
 	grpc_prometheus.Register(server)
 	go startHTTPServer(opts)
@@ -205,18 +345,47 @@ func startServer(opts *common.Options) error {
 	if opts.Darkside {
 		chainName = "darkside"
 	} else {
-		if opts.RPCUser != "" && opts.RPCPassword != "" && opts.RPCHost != "" && opts.RPCPort != "" {
-			rpcClient, err = frontend.NewZRPCFromFlags(opts)
+		if opts.PiratedProxy != "" {
+			if err := frontend.CheckProxyURL(opts.PiratedProxy); err != nil {
+				common.Log.WithFields(logrus.Fields{
+					"error": err,
+				}).Fatal("invalid pirated-proxy")
+			}
+			common.PiratedProxy = opts.PiratedProxy
+		}
+		if opts.RPCCookiePath != "" {
+			var cookieClient *frontend.CookieClient
+			cookieClient, err = frontend.NewZRPCFromCookie(opts)
+			if err == nil {
+				common.RawRequest = cookieClient.RawRequest
+				common.RawBatchRequest = cookieClient.RawBatchRequest
+			}
 		} else {
-			rpcClient, err = frontend.NewZRPCFromConf(opts.PirateConfPath)
+			var batchClient *frontend.BatchClient
+			if opts.RPCUser != "" && opts.RPCPassword != "" && opts.RPCHost != "" && opts.RPCPort != "" {
+				rpcClient, err = frontend.NewZRPCFromFlags(opts)
+				batchClient = frontend.NewBatchClientFromFlags(opts)
+			} else {
+				rpcClient, err = frontend.NewZRPCFromConf(opts.PirateConfPath)
+				if err == nil {
+					batchClient, err = frontend.NewBatchClientFromConf(opts.PirateConfPath)
+				}
+			}
+			if err == nil {
+				// Indirect function for test mocking (so unit tests can talk to stub functions).
+				common.RawRequest = rpcClient.RawRequest
+				common.RawBatchRequest = batchClient.RawBatchRequest
+			}
 		}
 		if err != nil {
 			common.Log.WithFields(logrus.Fields{
 				"error": err,
 			}).Fatal("setting up RPC connection to pirated")
 		}
-		// Indirect function for test mocking (so unit tests can talk to stub functions).
-		common.RawRequest = rpcClient.RawRequest
+		common.SetMaxBackendRequests(opts.MaxBackendRequests)
+		common.RPCBatchSize = opts.RPCBatchSize
+		common.RawRequest = common.InstrumentRawRequest(common.RawRequest)
+		common.LimitRawRequests()
 
 		// Ensure that we can communicate with pirated
 		common.FirstRPC()
@@ -231,8 +400,13 @@ func startServer(opts *common.Options) error {
 			" block height ", getLightdInfo.BlockHeight,
 			" chain ", getLightdInfo.ChainName,
 			" branchID ", getLightdInfo.ConsensusBranchId)
-		saplingHeight = int(getLightdInfo.SaplingActivationHeight)
 		chainName = getLightdInfo.ChainName
+		saplingHeight = common.SaplingActivationHeight(chainName, int(getLightdInfo.SaplingActivationHeight))
+
+		// Learn (once) which tree-state format pirated serves, so that
+		// GetLightdInfo can advertise it to wallets.
+		common.TreeStateBridgeSupport = common.ProbeTreeState(int(getLightdInfo.BlockHeight))
+		common.Log.Info("Tree state bridge format supported: ", common.TreeStateBridgeSupport)
 	}
 
 	dbPath := filepath.Join(opts.DataDir, "db")
@@ -260,9 +434,191 @@ func startServer(opts *common.Options) error {
 	if opts.Redownload {
 		syncFromHeight = 0
 	}
-	cache := common.NewBlockCache(dbPath, chainName, saplingHeight, syncFromHeight)
+	common.MemoryCacheBlocks = opts.MemoryCacheBlocks
+	switch opts.MemoryCachePolicy {
+	case "lru", "slru":
+		common.MemoryCachePolicy = opts.MemoryCachePolicy
+	default:
+		common.Log.Fatal("cache-memory-policy must be lru or slru")
+	}
+	switch opts.CacheDuplicates {
+	case "error", "overwrite":
+		common.CacheDuplicateHeights = opts.CacheDuplicates
+	default:
+		common.Log.Fatal("cache-duplicate-heights must be error or overwrite")
+	}
+	common.CacheWriteBuffer = opts.CacheWriteBuffer * 1024
+	common.CacheFlushBlocks = opts.CacheFlushBlocks
+	common.CacheFlushInterval = time.Duration(opts.CacheFlushInterval) * time.Millisecond
+	if opts.HashIndexBlocks < 0 {
+		common.Log.Fatal("cache-hash-index-blocks must not be negative")
+	}
+	common.HashIndexBlocks = opts.HashIndexBlocks
+	if opts.CompressionLevel < 0 || opts.CompressionLevel > 9 {
+		common.Log.Fatal("cache-compression-level must be between 0 and 9")
+	}
+	common.CacheCompressionLevel = opts.CompressionLevel
+	if opts.Darkside && opts.StandbyPrimary != "" {
+		common.Log.Fatal("standby-primary can't be used with darkside")
+	}
+	if opts.Darkside && len(opts.CacheHistoryDirs) > 0 {
+		common.Log.Fatal("cache-history-dirs can't be used with darkside")
+	}
+	if opts.CacheInMemory && (opts.Darkside || opts.ScrubInterval > 0) {
+		common.Log.Fatal("cache-in-memory can't be used with darkside or cache-scrub-interval")
+	}
+	// The (live) cache in data-dir begins where the frozen ones end.
+	var frozen []common.Cache
+	liveHeight := saplingHeight
+	for _, dir := range opts.CacheHistoryDirs {
+		c, err := common.OpenFrozenBlockCache(dir, chainName, liveHeight)
+		if err != nil {
+			common.Log.Fatal("cache-history-dirs: ", err)
+		}
+		frozen = append(frozen, c)
+		liveHeight = c.GetNextHeight()
+	}
+	// cache is nil if the live blocks are only in memory; they're then
+	// downloaded again at each startup.
+	var cache *common.BlockCache
+	var blocks common.Cache
+	if opts.CacheInMemory {
+		blocks = common.NewMemoryBlockCache(liveHeight)
+	} else {
+		cache = common.NewBlockCache(dbPath, chainName, liveHeight, syncFromHeight)
+		if opts.CachePrimeBlocks > 0 {
+			go cache.Prime(opts.CachePrimeBlocks)
+		}
+		blocks = cache
+	}
+	if len(frozen) > 0 {
+		union, err := common.NewUnionCache(frozen, blocks)
+		if err != nil {
+			common.Log.Fatal("cache-history-dirs: ", err)
+		}
+		blocks = union
+	}
+	if opts.IngestBatchSize < 1 {
+		common.Log.Fatal("ingest-batch-size must be at least 1")
+	}
+	common.IngestBatchSize = opts.IngestBatchSize
+	common.IngestDebounce = time.Duration(opts.IngestDebounce) * time.Millisecond
+	if opts.ClockSkewWarning < 0 {
+		common.Log.Fatal("clock-skew-warning must not be negative")
+	}
+	common.ClockSkewWarning = time.Duration(opts.ClockSkewWarning) * time.Second
+	common.TxOutSetCacheTTL = time.Duration(opts.TxOutSetCacheTTL) * time.Second
+	common.LightdInfoCacheTTL = time.Duration(opts.LightdInfoCacheTTL) * time.Second
+	if opts.UpgradeWarning < 0 {
+		common.Log.Fatal("upgrade-warning-blocks must not be negative")
+	}
+	common.UpgradeWarningBlocks = opts.UpgradeWarning
+	common.SendConfirmWait = time.Duration(opts.SendConfirmWait) * time.Millisecond
+	common.NoMempoolLookup = opts.NoMempoolLookup
+	if opts.MempoolStateTTL < 0 {
+		common.Log.Fatal("mempool-state-ttl must not be negative")
+	}
+	common.MempoolStateTTL = time.Duration(opts.MempoolStateTTL) * time.Second
+	mempoolState := common.MempoolStateName(filepath.Join(dbPath, chainName))
+	if common.MempoolStateTTL > 0 {
+		common.LoadMempoolState(mempoolState, common.MempoolStateTTL)
+	}
+	if opts.ReorgGracePeriod < 0 {
+		common.Log.Fatal("reorg-grace-period must not be negative")
+	}
+	common.ReorgGracePeriod = time.Duration(opts.ReorgGracePeriod) * time.Second
+	if err := common.SetLightdInfoBranding(opts.Vendor, opts.InfoExtra); err != nil {
+		common.Log.Fatal(err)
+	}
+	common.SetRPCPassthrough(opts.RPCPassthrough)
+	common.BlockExtended = opts.BlockExtended
+	common.MaxBlockElements = opts.MaxBlockElements
+	if opts.MaxTaddresses < 0 {
+		common.Log.Fatal("max-taddresses must not be negative")
+	}
+	common.MaxTaddresses = opts.MaxTaddresses
+	if opts.MaxTxSize < 0 {
+		common.Log.Fatal("max-tx-size must not be negative")
+	}
+	common.MaxTxSize = opts.MaxTxSize
+	common.StrictTreeState = opts.StrictTreeState
+	common.TreeStateRootFallback = opts.TreeStateRoots
+	common.SaplingOnly = opts.SaplingOnly
+	common.StreamMemoryBudget = opts.StreamMemoryBudget * 1024
+	if opts.DeepHistoryHeight < 0 {
+		common.Log.Fatal("deep-history-height must not be negative")
+	}
+	common.DeepHistoryHeight = opts.DeepHistoryHeight
+	if opts.VerifyInterval < 1 {
+		common.Log.Fatal("verify-blocks-interval must be at least 1")
+	}
+	common.VerifyBlocks = opts.VerifyBlocks
+	common.VerifyBlocksInterval = opts.VerifyInterval
+	switch opts.CompactBlockCheck {
+	case "off", "skip", "error":
+		common.CompactBlockCheck = opts.CompactBlockCheck
+	default:
+		common.Log.Fatal("compact-block-check must be off, skip, or error")
+	}
+	common.CoinbaseMarkers = opts.CoinbaseMarkers
+	if opts.TreeStateIndex {
+		if opts.TreeStateInterval < 1 {
+			common.Log.Fatal("tree-state-index-interval must be at least 1")
+		}
+		common.TreeStateIndexInterval = opts.TreeStateInterval
+		common.TreeStates, err = common.OpenTreeStateIndex(filepath.Join(dbPath, "treestates"), opts.TreeStateSprout)
+		if err != nil {
+			common.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("couldn't open the tree state index")
+		}
+		// For operators to backfill the index (only from this host).
+		http.HandleFunc("/treestates/backfill", common.TreeStateBackfillHandler(blocks))
+	}
 	if !opts.Darkside {
-		go common.BlockIngestor(cache, 0 /*loop forever*/)
+		if cache != nil && !cache.CleanShutdown() && opts.CrashVerifyBlocks > 0 {
+			cache.VerifyTail(opts.CrashVerifyBlocks)
+		}
+		if opts.StandbyPrimary != "" {
+			// Follow the primary until promoted (by the operator, at
+			// /standby), rather than ingesting from pirated.
+			creds := grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, ""))
+			if opts.StandbyInsecure {
+				creds = grpc.WithInsecure()
+			}
+			conn, err := grpc.Dial(opts.StandbyPrimary, creds)
+			if err != nil {
+				common.Log.Fatal("standby-primary: ", err)
+			}
+			standby := common.NewStandby(walletrpc.NewCompactTxStreamerClient(conn), blocks, healthServer)
+			http.HandleFunc("/standby", common.StandbyHandler(standby))
+			common.Log.Info("Standby, following the primary at ", opts.StandbyPrimary)
+			go standby.Run(0)
+		} else {
+			common.StartIngestor(blocks)
+		}
+		if opts.ScrubInterval > 0 {
+			if opts.ScrubBusyRequests < 1 {
+				common.Log.Fatal("cache-scrub-busy-requests must be at least 1")
+			}
+			scrubber := &common.CacheScrubber{
+				Cache:          cache,
+				Interval:       time.Duration(opts.ScrubInterval) * time.Minute,
+				BytesPerSecond: opts.ScrubRate * 1024,
+				BusyRequests:   int32(opts.ScrubBusyRequests),
+				Refetch:        opts.ScrubRefetch,
+			}
+			go scrubber.Run()
+		}
+		if opts.IngestLagBlocks > 0 {
+			monitor := &common.LagMonitor{
+				Cache:     blocks,
+				Interval:  10 * time.Second,
+				Threshold: opts.IngestLagBlocks,
+				Duration:  time.Duration(opts.IngestLagDuration) * time.Second,
+			}
+			go monitor.Run()
+		}
 	} else {
 		// Darkside wants to control starting the block ingestor.
 		common.DarksideInit(cache, int(opts.DarksideTimeout))
@@ -270,7 +626,7 @@ func startServer(opts *common.Options) error {
 
 	// Compact transaction service initialization
 	{
-		service, err := frontend.NewLwdStreamer(cache, dbPath, chainName, opts.PingEnable)
+		service, err := frontend.NewLwdStreamer(blocks, dbPath, chainName, opts.PingEnable, opts.TreeStateSprout)
 		if err != nil {
 			common.Log.WithFields(logrus.Fields{
 				"error": err,
@@ -302,11 +658,37 @@ func startServer(opts *common.Options) error {
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		s := <-signals
-		cache.Sync()
 		common.Log.WithFields(logrus.Fields{
 			"signal": s.String(),
 		}).Info("caught signal, stopping gRPC server")
 
+		// Let the block ingestor finish (and flush) the block it's working
+		// on, but don't wait forever (it may be waiting on pirated).
+		stopped := make(chan struct{})
+		go func() {
+			common.StopIngestor()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			// Nothing more will be added to the cache.
+			if cache != nil {
+				if err := cache.MarkCleanShutdown(); err != nil {
+					common.Log.Warning("couldn't mark the cache as shut down cleanly: ", err)
+				}
+			}
+		case <-time.After(10 * time.Second):
+			common.Log.Warning("block ingestor did not stop")
+		}
+		blocks.Sync()
+		if common.MempoolStateTTL > 0 {
+			if err := common.SaveMempoolState(mempoolState); err != nil {
+				common.Log.Warning("couldn't save the mempool state: ", err)
+			}
+		}
+		common.CancelTreeStateBackfill()
+		common.TreeStates.Close()
+
 		os.Exit(1)
 	}()
 
@@ -330,26 +712,96 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(checkCacheCmd)
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is current directory, lightwalletd.yaml)")
 	rootCmd.Flags().String("http-bind-addr", "127.0.0.1:9068", "the address to listen for http on")
 	rootCmd.Flags().String("grpc-bind-addr", "127.0.0.1:9067", "the address to listen for grpc on")
 	rootCmd.Flags().Bool("grpc-logging-insecure", false, "enable grpc logging to stderr")
+	rootCmd.Flags().Int("grpc-max-concurrent-streams", 0, "maximum number of concurrent requests (HTTP/2 streams) on each client connection; more wait for one to finish (0 means gRPC's default, unlimited)")
 	rootCmd.Flags().String("tls-cert", "./cert.pem", "the path to a TLS certificate")
 	rootCmd.Flags().String("tls-key", "./cert.key", "the path to a TLS key file")
-	rootCmd.Flags().Int("log-level", int(logrus.InfoLevel), "log level (logrus 1-7)")
+	rootCmd.Flags().String("log-level", "info", "log level (error, warn, info, debug, or trace; or logrus 0-6), which can be changed at /loglevel on the http server")
 	rootCmd.Flags().String("log-file", "./server.log", "log file to write to")
+	rootCmd.Flags().String("access-log", "", "also write a line for each rpc (in access-log-format) to this file, or to stdout if \"-\"")
+	rootCmd.Flags().String("capture-dir", "", "save a sample of the requests and replies of the capture-method rpcs (for reproducing wallet bugs) to files in this directory; client addresses aren't saved, and secret headers are redacted")
+	rootCmd.Flags().StringSlice("capture-method", nil, "the name of an rpc to capture, such as GetBlockRange (may be repeated)")
+	rootCmd.Flags().Float64("capture-rate", 0.01, "the fraction of the capture-method rpcs to capture, from 0 to 1")
+	rootCmd.Flags().Int("capture-file-size", 10, "size (MB) at which the capture file is rotated")
+	rootCmd.Flags().Int("capture-files", 5, "number of capture files kept, including the current one")
+	rootCmd.Flags().String("access-log-format", "combined", "access log format: common or combined (as Apache's), or an Apache-style format string using %h, %t, %r, %>s, %b, %D (microseconds), %{Header}i, and so on")
 	rootCmd.Flags().String("pirate-conf-path", "./PIRATE.conf", "conf file to pull RPC creds from")
 	rootCmd.Flags().String("rpcuser", "", "RPC user name")
 	rootCmd.Flags().String("rpcpassword", "", "RPC password")
 	rootCmd.Flags().String("rpchost", "", "RPC host")
 	rootCmd.Flags().String("rpcport", "", "RPC host port")
+	rootCmd.Flags().String("pirated-cookie", "", "authenticate using pirated's .cookie file (instead of rpcuser and rpcpassword)")
+	rootCmd.Flags().String("pirated-proxy", "", "send rpcs to pirated through this SOCKS5 proxy, such as socks5://127.0.0.1:9050 (Tor)")
+	rootCmd.Flags().String("standby-primary", "", "run as a warm standby: keep the cache in sync with the primary lightwalletd at this (grpc) address, reporting NOT_SERVING in the health service, until promoted by a POST to /standby on the http server")
+	rootCmd.Flags().Bool("standby-primary-insecure", false, "connect to standby-primary without TLS")
 	rootCmd.Flags().Bool("no-tls-very-insecure", false, "run without the required TLS certificate, only for debugging, DO NOT use in production")
 	rootCmd.Flags().Bool("gen-cert-very-insecure", false, "run with self-signed TLS certificate, only for debugging, DO NOT use in production")
 	rootCmd.Flags().Bool("redownload", false, "re-fetch all blocks from pirated; reinitialize local cache files")
 	rootCmd.Flags().Int("sync-from-height", -1, "re-fetch blocks from pirated start at this height")
+	rootCmd.Flags().Bool("sapling-only", false, "refuse GetBlock and GetBlockRange requests for heights below sapling activation, rather than fetching those blocks from pirated")
 	rootCmd.Flags().String("data-dir", "/var/lib/lightwalletd", "data directory (such as db)")
 	rootCmd.Flags().Bool("ping-very-insecure", false, "allow Ping GRPC for testing")
+	rootCmd.Flags().Int("ingest-batch-size", 1, "number of blocks to request from pirated in parallel while syncing")
+	rootCmd.Flags().Int("ingest-lag-alarm-blocks", 0, "raise an alarm if the cache is more than this many blocks behind pirated (0 disables)")
+	rootCmd.Flags().Int("ingest-lag-alarm-duration", 300, "seconds the cache must lag behind pirated before the alarm is raised")
+	rootCmd.Flags().Bool("tree-state-index", false, "keep tree states fetched from pirated in a local index, to serve them again without an rpc")
+	rootCmd.Flags().Int("tree-state-index-interval", 1000, "index the tree state of every block at a multiple of this height as it's ingested")
+	rootCmd.Flags().Int("ingest-debounce", 0, "milliseconds to wait for a new tip to settle (during reorgs) before updating the cache")
+	rootCmd.Flags().Int("clock-skew-warning", 60, "log a warning for a new block whose time is more than this many seconds ahead of this host's clock (the block is still served)")
+	rootCmd.Flags().Bool("cache-in-memory", false, "keep the cached blocks only in memory, not in data-dir, so they're downloaded again at each startup (for ephemeral servers)")
+	rootCmd.Flags().Int("cache-memory-blocks", 4000, "number of recently-used blocks to also keep in memory (0 means none)")
+	rootCmd.Flags().Int("cache-prime-blocks", 0, "at startup, read this many of the most recent cached blocks into memory (in the background), so the first clients are served quickly (at most cache-memory-blocks; 0 means none)")
+	rootCmd.Flags().String("cache-memory-policy", "lru", "how the memory tier chooses blocks to evict: lru, or slru (protect blocks that are requested repeatedly, such as those near the tip, from scans of old blocks)")
+	rootCmd.Flags().String("cache-duplicate-heights", "error", "what to do if a block is added to the cache at a height that's already cached (which should never happen; it's logged): error (reject it), or overwrite (replace the cached block, and any above it)")
+	rootCmd.Flags().StringSlice("cache-history-dirs", nil, "read-only db directories (laid out as data-dir's db) holding the blocks below those cached in data-dir, oldest first; each must continue where the one before it ends, and data-dir's cache where the last ends (may be repeated)")
+	rootCmd.Flags().Int("cache-hash-index-blocks", 0, "index (by hash) only about this many of the most recent cached blocks, to bound the index's memory (about 40 bytes per block); 0 means all")
+	rootCmd.Flags().Int("cache-compression-level", 0, "compress blocks added to the cache at this level, 1 (fastest) to 9 (smallest), trading CPU for disk space (0 means don't compress)")
+	rootCmd.Flags().Int("cache-write-buffer", 1024, "size (KB) of the buffer for writing blocks to the cache (0 means unbuffered)")
+	rootCmd.Flags().Int("cache-flush-blocks", 100, "commit buffered cache writes to disk after this many blocks")
+	rootCmd.Flags().Int("cache-flush-interval", 1000, "commit buffered cache writes to disk after this many milliseconds")
+	rootCmd.Flags().Int("crash-verify-blocks", 100, "after a crash (no clean shutdown), compare this many of the latest cached blocks with pirated's before serving them (0 means don't)")
+	rootCmd.Flags().Int("cache-scrub-interval", 0, "minutes between checks of the cached blocks for disk corruption (0 means never)")
+	rootCmd.Flags().Int("cache-scrub-rate", 1024, "maximum rate (KB per second) at which the cache is checked")
+	rootCmd.Flags().Bool("cache-scrub-refetch", false, "re-download a block from pirated when the cache check finds it corrupted")
+	rootCmd.Flags().Int("cache-scrub-busy-requests", 4, "pause the cache check while at least this many block requests are in progress")
+	rootCmd.Flags().Int("max-taddresses", 1000, "maximum number of t-addresses in one GetTaddressBalance, GetTaddressBalanceStream, or GetAddressUtxos request (0 means unlimited)")
+	rootCmd.Flags().Int("max-tx-size", 2000000, "maximum size (bytes) of a raw transaction passed to SendTransaction or CheckTransaction; the default is the consensus limit (0 means unlimited)")
+	rootCmd.Flags().Int("max-block-elements", 0, "split blocks with more shielded spends, outputs, and actions than this across GetBlockRange messages (0 means never)")
+	rootCmd.Flags().Int("deep-history-height", 0, "GetBlockRange rejects ranges reaching below this height, so wallets start syncing from a checkpoint above it (0 means serve all heights)")
+	rootCmd.Flags().Int("stream-memory-budget", 4096, "kilobytes of blocks each GetBlockRange stream may read ahead of its client (0 means don't read ahead)")
+	rootCmd.Flags().Bool("verify-blocks", false, "check that each block from pirated hashes to the hash it reports, and meets its proof-of-work target")
+	rootCmd.Flags().Int("verify-blocks-interval", 1, "with --verify-blocks, check only blocks whose height is a multiple of this")
+	rootCmd.Flags().String("compact-block-check", "off", "cross-check each compact block against the block it's converted from: off, skip (log a bad block, don't cache it, and retry; ingestion halts at it meanwhile), or error")
+	rootCmd.Flags().Bool("coinbase-markers", false, "mark each block's coinbase transaction (if it has shielded outputs) in compact blocks, for wallets that apply coinbase maturity; applies to blocks as they're cached")
+	rootCmd.Flags().Int("max-backend-requests", 0, "maximum number of concurrent pirated rpcs (0 means unlimited)")
+	rootCmd.Flags().Int("rpc-batch-size", 100, "maximum number of pirated rpcs to send in one batch request (0 disables batching)")
+	rootCmd.Flags().Int("min-protocol-version", 0, "reject requests (other than GetLightdInfo and GetServerCapabilities) from wallets older than this protocol version (0 means accept all)")
+	rootCmd.Flags().Int("max-stream-duration", 0, "seconds after which a streaming request is ended, asking the wallet to reconnect (0 means unlimited)")
+	rootCmd.Flags().Int("max-peer-requests", 0, "maximum number of requests (unary and streaming together) in progress from one address (0 means unlimited)")
+	rootCmd.Flags().Int("client-quota", 0, "megabytes of replies that one client (by address, or API key) may be sent within client-quota-window; more requests fail until its usage ages out (0 means unlimited)")
+	rootCmd.Flags().Int("client-quota-window", 3600, "seconds over which client-quota applies (a sliding window)")
+	rootCmd.Flags().StringSlice("client-quota-api-key", nil, "API key that clients may send (in the x-api-key header) to have their own quota, rather than their address's (may be repeated)")
+	rootCmd.Flags().StringSlice("allow-cidr", nil, "accept requests only from this CIDR (may be repeated; default all)")
+	rootCmd.Flags().StringSlice("deny-cidr", nil, "reject requests from this CIDR (may be repeated; takes precedence over allow-cidr)")
+	rootCmd.Flags().String("vendor", "", "vendor reported by GetLightdInfo, such as the name of the service (default \"Pirate LightWalletD\")")
+	rootCmd.Flags().StringSlice("info-extra", nil, "key=value reported (informationally) by GetLightdInfo, such as a contact or support URL (may be repeated)")
+	rootCmd.Flags().StringSlice("rpc-passthrough", nil, "pirated rpc that the RawPiratedRPC admin rpc (for clients on this host) may make; allow only ones that change nothing, such as getpeerinfo (may be repeated)")
+	rootCmd.Flags().Int("txoutset-cache-ttl", 600, "seconds to cache the (expensive) gettxoutsetinfo result used by GetChainStats")
+	rootCmd.Flags().Int("lightdinfo-cache-ttl", 0, "seconds to cache the GetLightdInfo reply (0 means don't cache)")
+	rootCmd.Flags().Int("upgrade-warning-blocks", 20160, "blocks before the next network upgrade that GetLightdInfo reports it as imminent, so wallets prompt users to update (0 means never)")
+	rootCmd.Flags().Int("send-confirm-wait", 0, "milliseconds SendTransaction waits for a sent transaction to appear in pirated's mempool, to report whether it did (0 means don't wait)")
+	rootCmd.Flags().Int("mempool-state-ttl", 0, "seconds after a shutdown that the saved mempool state is used at startup, so reconnecting clients can resume their mempool streams (0 means don't save it)")
+	rootCmd.Flags().Int("reorg-grace-period", 0, "seconds that blocks reorged away can still be requested by hash (GetBlock), marked as orphaned (0 means not at all)")
+	rootCmd.Flags().Bool("no-mempool-lookup", false, "GetTransaction returns only confirmed transactions (a transaction only in the mempool is not found)")
+	rootCmd.Flags().Bool("block-extended", false, "enable GetBlockExtended, which returns blocks with their transparent inputs and outputs for explorers (expensive)")
+	rootCmd.Flags().Bool("tree-state-sprout", false, "include the sprout commitment tree state in GetTreeState replies")
+	rootCmd.Flags().Bool("strict-treestate", false, "fail tree state requests when pirated doesn't provide the sprout finalState, instead of falling back to the finalRoot (only with --tree-state-sprout)")
+	rootCmd.Flags().Bool("tree-state-root-fallback", false, "when pirated's z_gettreestate fails, reply to tree state requests with only the block's tree roots (from getblock); wallets can't start syncing from these")
 	rootCmd.Flags().Bool("darkside-very-insecure", false, "run with GRPC-controllable mock pirated for integration testing (shuts down after 30 minutes)")
 	rootCmd.Flags().Int("darkside-timeout", 30, "override 30 minute default darkside timeout")
 
@@ -357,6 +809,8 @@ func init() {
 	viper.SetDefault("grpc-bind-addr", "127.0.0.1:9067")
 	viper.BindPFlag("grpc-logging-insecure", rootCmd.Flags().Lookup("grpc-logging-insecure"))
 	viper.SetDefault("grpc-logging-insecure", false)
+	viper.BindPFlag("grpc-max-concurrent-streams", rootCmd.Flags().Lookup("grpc-max-concurrent-streams"))
+	viper.SetDefault("grpc-max-concurrent-streams", 0)
 	viper.BindPFlag("http-bind-addr", rootCmd.Flags().Lookup("http-bind-addr"))
 	viper.SetDefault("http-bind-addr", "127.0.0.1:9068")
 	viper.BindPFlag("tls-cert", rootCmd.Flags().Lookup("tls-cert"))
@@ -364,27 +818,152 @@ func init() {
 	viper.BindPFlag("tls-key", rootCmd.Flags().Lookup("tls-key"))
 	viper.SetDefault("tls-key", "./cert.key")
 	viper.BindPFlag("log-level", rootCmd.Flags().Lookup("log-level"))
-	viper.SetDefault("log-level", int(logrus.InfoLevel))
+	viper.SetDefault("log-level", "info")
 	viper.BindPFlag("log-file", rootCmd.Flags().Lookup("log-file"))
 	viper.SetDefault("log-file", "./server.log")
+	viper.BindPFlag("access-log", rootCmd.Flags().Lookup("access-log"))
+	viper.BindPFlag("access-log-format", rootCmd.Flags().Lookup("access-log-format"))
+	viper.SetDefault("access-log-format", "combined")
+	viper.BindPFlag("capture-dir", rootCmd.Flags().Lookup("capture-dir"))
+	viper.BindPFlag("capture-method", rootCmd.Flags().Lookup("capture-method"))
+	viper.BindPFlag("capture-rate", rootCmd.Flags().Lookup("capture-rate"))
+	viper.SetDefault("capture-rate", 0.01)
+	viper.BindPFlag("capture-file-size", rootCmd.Flags().Lookup("capture-file-size"))
+	viper.SetDefault("capture-file-size", 10)
+	viper.BindPFlag("capture-files", rootCmd.Flags().Lookup("capture-files"))
+	viper.SetDefault("capture-files", 5)
 	viper.BindPFlag("pirate-conf-path", rootCmd.Flags().Lookup("pirate-conf-path"))
 	viper.SetDefault("pirate-conf-path", "./PIRATE.conf")
 	viper.BindPFlag("rpcuser", rootCmd.Flags().Lookup("rpcuser"))
 	viper.BindPFlag("rpcpassword", rootCmd.Flags().Lookup("rpcpassword"))
 	viper.BindPFlag("rpchost", rootCmd.Flags().Lookup("rpchost"))
 	viper.BindPFlag("rpcport", rootCmd.Flags().Lookup("rpcport"))
+	viper.BindPFlag("pirated-cookie", rootCmd.Flags().Lookup("pirated-cookie"))
+	viper.BindPFlag("pirated-proxy", rootCmd.Flags().Lookup("pirated-proxy"))
 	viper.BindPFlag("no-tls-very-insecure", rootCmd.Flags().Lookup("no-tls-very-insecure"))
 	viper.SetDefault("no-tls-very-insecure", false)
+	viper.BindPFlag("standby-primary", rootCmd.Flags().Lookup("standby-primary"))
+	viper.SetDefault("standby-primary", "")
+	viper.BindPFlag("standby-primary-insecure", rootCmd.Flags().Lookup("standby-primary-insecure"))
+	viper.SetDefault("standby-primary-insecure", false)
 	viper.BindPFlag("gen-cert-very-insecure", rootCmd.Flags().Lookup("gen-cert-very-insecure"))
 	viper.SetDefault("gen-cert-very-insecure", false)
 	viper.BindPFlag("redownload", rootCmd.Flags().Lookup("redownload"))
 	viper.SetDefault("redownload", false)
 	viper.BindPFlag("sync-from-height", rootCmd.Flags().Lookup("sync-from-height"))
 	viper.SetDefault("sync-from-height", -1)
+	viper.BindPFlag("sapling-only", rootCmd.Flags().Lookup("sapling-only"))
+	viper.SetDefault("sapling-only", false)
 	viper.BindPFlag("data-dir", rootCmd.Flags().Lookup("data-dir"))
 	viper.SetDefault("data-dir", "/var/lib/lightwalletd")
 	viper.BindPFlag("ping-very-insecure", rootCmd.Flags().Lookup("ping-very-insecure"))
 	viper.SetDefault("ping-very-insecure", false)
+	viper.BindPFlag("ingest-batch-size", rootCmd.Flags().Lookup("ingest-batch-size"))
+	viper.SetDefault("ingest-batch-size", 1)
+	viper.BindPFlag("ingest-lag-alarm-blocks", rootCmd.Flags().Lookup("ingest-lag-alarm-blocks"))
+	viper.SetDefault("ingest-lag-alarm-blocks", 0)
+	viper.BindPFlag("ingest-lag-alarm-duration", rootCmd.Flags().Lookup("ingest-lag-alarm-duration"))
+	viper.SetDefault("ingest-lag-alarm-duration", 300)
+	viper.BindPFlag("tree-state-index", rootCmd.Flags().Lookup("tree-state-index"))
+	viper.SetDefault("tree-state-index", false)
+	viper.BindPFlag("tree-state-index-interval", rootCmd.Flags().Lookup("tree-state-index-interval"))
+	viper.SetDefault("tree-state-index-interval", 1000)
+	viper.BindPFlag("ingest-debounce", rootCmd.Flags().Lookup("ingest-debounce"))
+	viper.SetDefault("ingest-debounce", 0)
+	viper.BindPFlag("clock-skew-warning", rootCmd.Flags().Lookup("clock-skew-warning"))
+	viper.SetDefault("clock-skew-warning", 60)
+	viper.BindPFlag("cache-in-memory", rootCmd.Flags().Lookup("cache-in-memory"))
+	viper.SetDefault("cache-in-memory", false)
+	viper.BindPFlag("cache-memory-blocks", rootCmd.Flags().Lookup("cache-memory-blocks"))
+	viper.SetDefault("cache-memory-blocks", 4000)
+	viper.BindPFlag("cache-prime-blocks", rootCmd.Flags().Lookup("cache-prime-blocks"))
+	viper.SetDefault("cache-prime-blocks", 0)
+	viper.BindPFlag("cache-memory-policy", rootCmd.Flags().Lookup("cache-memory-policy"))
+	viper.SetDefault("cache-memory-policy", "lru")
+	viper.BindPFlag("cache-duplicate-heights", rootCmd.Flags().Lookup("cache-duplicate-heights"))
+	viper.SetDefault("cache-duplicate-heights", "error")
+	viper.BindPFlag("cache-history-dirs", rootCmd.Flags().Lookup("cache-history-dirs"))
+	viper.BindPFlag("cache-hash-index-blocks", rootCmd.Flags().Lookup("cache-hash-index-blocks"))
+	viper.SetDefault("cache-hash-index-blocks", 0)
+	viper.BindPFlag("cache-compression-level", rootCmd.Flags().Lookup("cache-compression-level"))
+	viper.SetDefault("cache-compression-level", 0)
+	viper.BindPFlag("cache-write-buffer", rootCmd.Flags().Lookup("cache-write-buffer"))
+	viper.SetDefault("cache-write-buffer", 1024)
+	viper.BindPFlag("cache-flush-blocks", rootCmd.Flags().Lookup("cache-flush-blocks"))
+	viper.SetDefault("cache-flush-blocks", 100)
+	viper.BindPFlag("cache-flush-interval", rootCmd.Flags().Lookup("cache-flush-interval"))
+	viper.SetDefault("cache-flush-interval", 1000)
+	viper.BindPFlag("crash-verify-blocks", rootCmd.Flags().Lookup("crash-verify-blocks"))
+	viper.SetDefault("crash-verify-blocks", 100)
+	viper.BindPFlag("cache-scrub-interval", rootCmd.Flags().Lookup("cache-scrub-interval"))
+	viper.SetDefault("cache-scrub-interval", 0)
+	viper.BindPFlag("cache-scrub-rate", rootCmd.Flags().Lookup("cache-scrub-rate"))
+	viper.SetDefault("cache-scrub-rate", 1024)
+	viper.BindPFlag("cache-scrub-refetch", rootCmd.Flags().Lookup("cache-scrub-refetch"))
+	viper.SetDefault("cache-scrub-refetch", false)
+	viper.BindPFlag("cache-scrub-busy-requests", rootCmd.Flags().Lookup("cache-scrub-busy-requests"))
+	viper.SetDefault("cache-scrub-busy-requests", 4)
+	viper.BindPFlag("max-block-elements", rootCmd.Flags().Lookup("max-block-elements"))
+	viper.SetDefault("max-block-elements", 0)
+	viper.BindPFlag("max-taddresses", rootCmd.Flags().Lookup("max-taddresses"))
+	viper.SetDefault("max-taddresses", 1000)
+	viper.BindPFlag("max-tx-size", rootCmd.Flags().Lookup("max-tx-size"))
+	viper.SetDefault("max-tx-size", 2000000)
+	viper.BindPFlag("stream-memory-budget", rootCmd.Flags().Lookup("stream-memory-budget"))
+	viper.SetDefault("stream-memory-budget", 4096)
+	viper.BindPFlag("deep-history-height", rootCmd.Flags().Lookup("deep-history-height"))
+	viper.SetDefault("deep-history-height", 0)
+	viper.BindPFlag("verify-blocks", rootCmd.Flags().Lookup("verify-blocks"))
+	viper.SetDefault("verify-blocks", false)
+	viper.BindPFlag("verify-blocks-interval", rootCmd.Flags().Lookup("verify-blocks-interval"))
+	viper.SetDefault("verify-blocks-interval", 1)
+	viper.BindPFlag("compact-block-check", rootCmd.Flags().Lookup("compact-block-check"))
+	viper.SetDefault("compact-block-check", "off")
+	viper.BindPFlag("coinbase-markers", rootCmd.Flags().Lookup("coinbase-markers"))
+	viper.SetDefault("coinbase-markers", false)
+	viper.BindPFlag("max-backend-requests", rootCmd.Flags().Lookup("max-backend-requests"))
+	viper.SetDefault("max-backend-requests", 0)
+	viper.BindPFlag("rpc-batch-size", rootCmd.Flags().Lookup("rpc-batch-size"))
+	viper.SetDefault("rpc-batch-size", 100)
+	viper.BindPFlag("min-protocol-version", rootCmd.Flags().Lookup("min-protocol-version"))
+	viper.SetDefault("min-protocol-version", 0)
+	viper.BindPFlag("max-stream-duration", rootCmd.Flags().Lookup("max-stream-duration"))
+	viper.SetDefault("max-stream-duration", 0)
+	viper.BindPFlag("max-peer-requests", rootCmd.Flags().Lookup("max-peer-requests"))
+	viper.SetDefault("max-peer-requests", 0)
+	viper.BindPFlag("client-quota", rootCmd.Flags().Lookup("client-quota"))
+	viper.SetDefault("client-quota", 0)
+	viper.BindPFlag("client-quota-window", rootCmd.Flags().Lookup("client-quota-window"))
+	viper.SetDefault("client-quota-window", 3600)
+	viper.BindPFlag("client-quota-api-key", rootCmd.Flags().Lookup("client-quota-api-key"))
+	viper.BindPFlag("allow-cidr", rootCmd.Flags().Lookup("allow-cidr"))
+	viper.BindPFlag("deny-cidr", rootCmd.Flags().Lookup("deny-cidr"))
+	viper.BindPFlag("vendor", rootCmd.Flags().Lookup("vendor"))
+	viper.SetDefault("vendor", "")
+	viper.BindPFlag("info-extra", rootCmd.Flags().Lookup("info-extra"))
+	viper.BindPFlag("rpc-passthrough", rootCmd.Flags().Lookup("rpc-passthrough"))
+	viper.BindPFlag("txoutset-cache-ttl", rootCmd.Flags().Lookup("txoutset-cache-ttl"))
+	viper.SetDefault("txoutset-cache-ttl", 600)
+	viper.BindPFlag("lightdinfo-cache-ttl", rootCmd.Flags().Lookup("lightdinfo-cache-ttl"))
+	viper.SetDefault("lightdinfo-cache-ttl", 0)
+	viper.BindPFlag("upgrade-warning-blocks", rootCmd.Flags().Lookup("upgrade-warning-blocks"))
+	viper.SetDefault("upgrade-warning-blocks", 20160)
+	viper.BindPFlag("send-confirm-wait", rootCmd.Flags().Lookup("send-confirm-wait"))
+	viper.SetDefault("send-confirm-wait", 0)
+	viper.BindPFlag("mempool-state-ttl", rootCmd.Flags().Lookup("mempool-state-ttl"))
+	viper.SetDefault("mempool-state-ttl", 0)
+	viper.BindPFlag("reorg-grace-period", rootCmd.Flags().Lookup("reorg-grace-period"))
+	viper.SetDefault("reorg-grace-period", 0)
+	viper.BindPFlag("no-mempool-lookup", rootCmd.Flags().Lookup("no-mempool-lookup"))
+	viper.SetDefault("no-mempool-lookup", false)
+	viper.BindPFlag("block-extended", rootCmd.Flags().Lookup("block-extended"))
+	viper.SetDefault("block-extended", false)
+	viper.BindPFlag("tree-state-sprout", rootCmd.Flags().Lookup("tree-state-sprout"))
+	viper.SetDefault("tree-state-sprout", false)
+	viper.BindPFlag("strict-treestate", rootCmd.Flags().Lookup("strict-treestate"))
+	viper.SetDefault("strict-treestate", false)
+	viper.BindPFlag("tree-state-root-fallback", rootCmd.Flags().Lookup("tree-state-root-fallback"))
+	viper.SetDefault("tree-state-root-fallback", false)
 	viper.BindPFlag("darkside-very-insecure", rootCmd.Flags().Lookup("darkside-very-insecure"))
 	viper.SetDefault("darkside-very-insecure", false)
 	viper.BindPFlag("darkside-timeout", rootCmd.Flags().Lookup("darkside-timeout"))
@@ -439,6 +1018,16 @@ func initConfig() {
 
 }
 
+// grpcLimitOptions returns the gRPC server's transport limits; zero means
+// gRPC's default.
+func grpcLimitOptions(opts *common.Options) []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if opts.GRPCMaxStreams > 0 {
+		options = append(options, grpc.MaxConcurrentStreams(uint32(opts.GRPCMaxStreams)))
+	}
+	return options
+}
+
 func startHTTPServer(opts *common.Options) {
 	http.Handle("/metrics", promhttp.HandlerFor(
 		promRegistry,
@@ -448,5 +1037,8 @@ func startHTTPServer(opts *common.Options) {
 	// Add the params download handler
 	http.HandleFunc("/params/", common.ParamsHandler)
 
+	// To change the log level while running (only from this host).
+	http.HandleFunc("/loglevel", common.LogLevelHandler(logger))
+
 	http.ListenAndServe(opts.HTTPBindAddr, nil)
 }
@@ -4,7 +4,17 @@
 package cmd
 
 import (
+	"context"
+	"io"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestFileExists(t *testing.T) {
@@ -20,3 +30,67 @@ func TestFileExists(t *testing.T) {
 		t.Fatal("fileExists failed")
 	}
 }
+
+// blockingServer's GetBlockRange streams run until released.
+type blockingServer struct {
+	walletrpc.UnimplementedCompactTxStreamerServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingServer) GetBlockRange(in *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestGRPCMaxConcurrentStreams(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpcLimitOptions(&common.Options{GRPCMaxStreams: 2})...)
+	s := &blockingServer{started: make(chan struct{}, 3), release: make(chan struct{})}
+	walletrpc.RegisterCompactTxStreamerServer(server, s)
+	go server.Serve(l)
+	defer server.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := walletrpc.NewCompactTxStreamerClient(conn)
+
+	// Two streams (the limit) are served at once on the connection ...
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetBlockRange(context.Background(), &walletrpc.BlockRange{}); err != nil {
+			t.Fatal("GetBlockRange failed", err)
+		}
+		<-s.started
+	}
+	// ... but a third isn't, so it times out waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	stream, err := client.GetBlockRange(ctx, &walletrpc.BlockRange{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatal("stream over the limit not refused", err)
+	}
+	select {
+	case <-s.started:
+		t.Fatal("stream over the limit was started")
+	default:
+	}
+
+	// Once the others finish, it can be.
+	close(s.release)
+	stream, err = client.GetBlockRange(context.Background(), &walletrpc.BlockRange{})
+	if err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatal("unexpected error at the end of the stream", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/bech32"
+)
+
+// AddressParams are a network's address encodings. Pirate's (like Komodo's)
+// t-addresses have a one-byte base58check version ("R..." and "b..." on
+// mainnet), where Zcash's have two ("t1...", "t3..."), so Zcash's rules
+// can't be used to check them.
+type AddressParams struct {
+	PubKeyHashVersion byte   // of p2pkh t-addresses
+	ScriptHashVersion byte   // of p2sh t-addresses
+	SaplingHRP        string // bech32 human-readable part of sapling z-addresses
+}
+
+// addressParams is indexed by chain name (as getblockchaininfo reports it).
+// regtest isn't here, since its sapling addresses (hrp "zregtestsapling")
+// are longer than the bech32 decoder allows.
+var addressParams = map[string]*AddressParams{
+	"main": {PubKeyHashVersion: 60, ScriptHashVersion: 85, SaplingHRP: "zs"},
+	"test": {PubKeyHashVersion: 0, ScriptHashVersion: 5, SaplingHRP: "ztestsapling"},
+}
+
+// GetAddressParams returns the address encodings of the given chain, or nil
+// if it isn't known (then addresses can only be checked by pirated).
+func GetAddressParams(chainName string) *AddressParams {
+	return addressParams[chainName]
+}
+
+// TransparentType returns "p2pkh" or "p2sh" if addr is a (correctly encoded)
+// t-address of this network, otherwise "".
+func (p *AddressParams) TransparentType(addr string) string {
+	hash, version, err := base58.CheckDecode(addr)
+	if err != nil || len(hash) != 20 {
+		return ""
+	}
+	switch version {
+	case p.PubKeyHashVersion:
+		return "p2pkh"
+	case p.ScriptHashVersion:
+		return "p2sh"
+	}
+	return ""
+}
+
+// IsSapling reports whether addr is a (correctly encoded) sapling z-address
+// of this network; only pirated can tell if it's a valid key.
+func (p *AddressParams) IsSapling(addr string) bool {
+	hrp, data, err := bech32.Decode(addr)
+	if err != nil || hrp != p.SaplingHRP {
+		return false
+	}
+	// diversifier (11 bytes) and pk_d (32 bytes)
+	decoded, err := bech32.ConvertBits(data, 5, 8, false)
+	return err == nil && len(decoded) == 43
+}
+
+// ScriptAddress returns the t-address that a standard (p2pkh, p2sh, or
+// p2pk, which pays the pubkey's p2pkh address) output script pays to,
+// otherwise "".
+func (p *AddressParams) ScriptAddress(script []byte) string {
+	n := len(script)
+	switch {
+	case n == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 20 &&
+		script[23] == 0x88 && script[24] == 0xac:
+		// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		return base58.CheckEncode(script[3:23], p.PubKeyHashVersion)
+	case n == 23 && script[0] == 0xa9 && script[1] == 20 && script[22] == 0x87:
+		// OP_HASH160 <hash> OP_EQUAL
+		return base58.CheckEncode(script[2:22], p.ScriptHashVersion)
+	case (n == 35 || n == 67) && int(script[0]) == n-2 && script[n-1] == 0xac:
+		// <compressed or uncompressed pubkey> OP_CHECKSIG
+		return base58.CheckEncode(btcutil.Hash160(script[1:n-1]), p.PubKeyHashVersion)
+	}
+	return ""
+}
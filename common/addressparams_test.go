@@ -0,0 +1,93 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+func TestAddressParams(t *testing.T) {
+	main, test := GetAddressParams("main"), GetAddressParams("test")
+	if main == nil || test == nil || GetAddressParams("regtest") != nil {
+		t.Fatal("unexpected address params")
+	}
+	for _, tt := range []struct {
+		params  *AddressParams
+		address string
+		want    string
+	}{
+		{main, "RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyt", "p2pkh"},
+		{main, "bMgEjkFYgdRW5PRgdJLSJAzGRa1NQE8Evs", "p2sh"},
+		{main, "RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyu", ""},  // bad checksum
+		{main, "19wy3Wv4LJ32ZYaKYe2M5WrPvh7BvDdK6b", ""},  // testnet
+		{main, "t1Spa3rLCJcpdABdDV4qUDKxKBMJGfDrUbu", ""}, // zcash
+		{main, "t3TWayPpdrX91FMKecAW4dxKFKsazEnqNQm", ""}, // zcash
+		{main, "zs1a0fgfwvxlva00xfd904a9p9esman4aue95445w5yu6afe33k5t69hs7kztmz39v2kkef5awmlfr", ""},
+		{main, "", ""},
+		{test, "19wy3Wv4LJ32ZYaKYe2M5WrPvh7BvDdK6b", "p2pkh"},
+		{test, "RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyt", ""},
+	} {
+		if got := tt.params.TransparentType(tt.address); got != tt.want {
+			t.Fatal("unexpected transparent type", tt.address, got)
+		}
+	}
+	for _, tt := range []struct {
+		params  *AddressParams
+		address string
+		want    bool
+	}{
+		{main, "zs1a0fgfwvxlva00xfd904a9p9esman4aue95445w5yu6afe33k5t69hs7kztmz39v2kkef5awmlfr", true},
+		{main, "zs1a0fgfwvxlva00xfd904a9p9esman4aue95445w5yu6afe33k5t69hs7kztmz39v2kkef5awmlfq", false},
+		{main, "ztestsapling1a0fgfwvxlva00xfd904a9p9esman4aue95445w5yu6afe33k5t69hs7kztmz39v2kkef54efuwh", false},
+		{main, "RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyt", false},
+		{test, "ztestsapling1a0fgfwvxlva00xfd904a9p9esman4aue95445w5yu6afe33k5t69hs7kztmz39v2kkef54efuwh", true},
+	} {
+		if got := tt.params.IsSapling(tt.address); got != tt.want {
+			t.Fatal("unexpected sapling check", tt.address, got)
+		}
+	}
+}
+
+func TestScriptAddress(t *testing.T) {
+	main := GetAddressParams("main")
+	script := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	hash, _, _ := base58.CheckDecode("RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyt")
+	p2pkh := "76a914" + hex.EncodeToString(hash) + "88ac"
+	if addr := main.ScriptAddress(script(p2pkh)); addr != "RJEA82oLw7qbdYwX1p1UB3BbgxZnXcdjyt" {
+		t.Fatal("unexpected p2pkh address", addr)
+	}
+	hash, _, _ = base58.CheckDecode("bMgEjkFYgdRW5PRgdJLSJAzGRa1NQE8Evs")
+	p2sh := "a914" + hex.EncodeToString(hash) + "87"
+	if addr := main.ScriptAddress(script(p2sh)); addr != "bMgEjkFYgdRW5PRgdJLSJAzGRa1NQE8Evs" {
+		t.Fatal("unexpected p2sh address", addr)
+	}
+	// A p2pk output pays the pubkey's p2pkh address.
+	pubkey := script("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	p2pkh = "76a914" + hex.EncodeToString(btcutil.Hash160(pubkey)) + "88ac"
+	p2pk := "21" + hex.EncodeToString(pubkey) + "ac"
+	if addr := main.ScriptAddress(script(p2pk)); addr == "" || addr != main.ScriptAddress(script(p2pkh)) {
+		t.Fatal("unexpected p2pk address", addr)
+	}
+	for _, s := range []string{
+		"",
+		"6a0401020304",              // OP_RETURN
+		p2pkh[:len(p2pkh)-2] + "87", // wrong final opcode
+		"22" + p2pk[2:],             // wrong pubkey length
+	} {
+		if addr := main.ScriptAddress(script(s)); addr != "" {
+			t.Fatal("unexpected address for nonstandard script", s, addr)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// RunningOptions is the configuration the server was started with (set at
+// startup), as reported by the GetConfig admin rpc.
+var RunningOptions *Options
+
+// redacted replaces secrets in ConfigSettings() (as in url.URL.Redacted()).
+const redacted = "xxxxx"
+
+// ConfigSettings returns the given options as settings named as in the
+// configuration file (by their json tags), sorted by name, with secrets
+// redacted: an option whose field is tagged secret:"true" is redacted
+// (each value, for a list), and one tagged secret:"url" has the password
+// in its URL redacted.
+func ConfigSettings(opts *Options) []*walletrpc.ConfigSetting {
+	settings := make([]*walletrpc.ConfigSetting, 0)
+	if opts == nil {
+		return settings
+	}
+	v := reflect.ValueOf(*opts)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		value := fmt.Sprint(v.Field(i).Interface())
+		switch field.Tag.Get("secret") {
+		case "true":
+			value = redactValue(v.Field(i))
+		case "url":
+			value = redactURL(value)
+		}
+		settings = append(settings, &walletrpc.ConfigSetting{Name: name, Value: value})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// redactValue returns the option's value redacted, unless it's empty; for
+// a list, each value is redacted (so the number of them is shown).
+func redactValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = redacted
+		}
+		return fmt.Sprint(values)
+	}
+	if fmt.Sprint(v.Interface()) == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL replaces the password (if any) in the given URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		// Don't risk showing an unparseable URL that may contain one.
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// backendSlots is a semaphore that limits the number of pirated rpcs in
+// progress at once, so that a burst of cache misses can't overwhelm pirated;
+// nil means no limit.
+var backendSlots chan struct{}
+
+// SetMaxBackendRequests sets the maximum number of concurrent pirated rpcs;
+// zero means unlimited. It should be called before any rpcs are made.
+func SetMaxBackendRequests(max int) {
+	if max <= 0 {
+		backendSlots = nil
+		return
+	}
+	backendSlots = make(chan struct{}, max)
+}
+
+// AcquireBackend waits until a pirated rpc may be made, or the context is
+// done. If it returns no error, the caller must call release() once its rpc
+// has completed.
+func AcquireBackend(ctx context.Context) (release func(), err error) {
+	slots := backendSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+	// A slot may be free, but select chooses at random between ready
+	// cases, and a request that's already done shouldn't take one.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// unlimitedRawRequest, if set (see LimitRawRequests), is RawRequest before
+// it was made to wait for a backend slot; RawRequestContext calls it once
+// it has a slot. Otherwise, RawRequestContext calls RawRequest.
+var unlimitedRawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)
+
+// LimitRawRequests makes RawRequest wait for a backend slot (see
+// SetMaxBackendRequests) before each rpc; RawRequestContext waits for the
+// same slots, but only until its request's context is done, so that a
+// canceled request doesn't keep waiting.
+func LimitRawRequests() {
+	unlimitedRawRequest = RawRequest
+	RawRequest = LimitRawRequest(unlimitedRawRequest)
+}
+
+// LimitRawRequest wraps a RawRequest function so that each call waits for
+// a slot (see SetMaxBackendRequests) before it's sent to pirated.
+func LimitRawRequest(rawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)) func(method string, params []json.RawMessage) (json.RawMessage, error) {
+	return func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		release, err := AcquireBackend(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return rawRequest(method, params)
+	}
+}
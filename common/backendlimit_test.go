@@ -0,0 +1,103 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var inFlight, maxInFlight int32
+
+func slowStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	n := atomic.AddInt32(&inFlight, 1)
+	for {
+		max := atomic.LoadInt32(&maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&inFlight, -1)
+	return []byte("{}"), nil
+}
+
+func TestLimitRawRequest(t *testing.T) {
+	SetMaxBackendRequests(4)
+	rawRequest := LimitRawRequest(slowStub)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rawRequest("getblock", nil); err != nil {
+				t.Error("unexpected error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > 4 {
+		t.Fatal("too many concurrent requests", maxInFlight)
+	}
+	if maxInFlight == 0 {
+		t.Fatal("no requests were made")
+	}
+
+	// With all slots taken, a waiter gives up when its context is done.
+	var releases []func()
+	for i := 0; i < 4; i++ {
+		release, err := AcquireBackend(context.Background())
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		releases = append(releases, release)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := AcquireBackend(ctx); err != context.DeadlineExceeded {
+		t.Fatal("unexpected AcquireBackend result", err)
+	}
+
+	// So does a request's rpc, which then isn't sent.
+	called := false
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		called = true
+		return []byte("{}"), nil
+	}
+	LimitRawRequests()
+	defer func() { unlimitedRawRequest = nil }()
+	if _, err := RawRequestContext(ctx, "getblock", nil); err != context.DeadlineExceeded || called {
+		t.Fatal("unexpected RawRequestContext result", err, called)
+	}
+	// Including the block and tree state rpcs made for a request.
+	if _, err := getBlockFromRPC(ctx, 380640); err == nil || called {
+		t.Fatal("unexpected getBlockFromRPC result", err, called)
+	}
+	if _, err := GetTreeStateFromRPC(ctx, 380640, nil); err != context.DeadlineExceeded || called {
+		t.Fatal("unexpected GetTreeStateFromRPC result", err, called)
+	}
+	if _, err := TreeStateRootsFromRPC(ctx, 380640, nil); err != context.DeadlineExceeded || called {
+		t.Fatal("unexpected TreeStateRootsFromRPC result", err, called)
+	}
+	for _, release := range releases {
+		release()
+	}
+
+	// Even with free slots, a request that's already done doesn't take one.
+	for i := 0; i < 100; i++ {
+		if _, err := AcquireBackend(ctx); err != context.DeadlineExceeded || len(backendSlots) != 0 {
+			t.Fatal("unexpected AcquireBackend result", err, len(backendSlots))
+		}
+	}
+	if _, err := RawRequestContext(context.Background(), "getblock", nil); err != nil || !called {
+		t.Fatal("unexpected RawRequestContext result", err, called)
+	}
+	SetMaxBackendRequests(0)
+}
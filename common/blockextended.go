@@ -0,0 +1,110 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/pkg/errors"
+)
+
+// BlockExtended enables GetBlockExtended, which is expensive: besides the
+// full block, it fetches every transaction whose outputs the block spends.
+var BlockExtended bool
+
+// coinbasePrevTxid is the previous txid of a coinbase input, which spends
+// nothing.
+var coinbasePrevTxid = make([]byte, 32)
+
+// GetBlockExtended returns the compact block at the given height, with the
+// transparent inputs and outputs of its transactions (those having any),
+// for explorers. The address and value of an input are those of the output
+// it spends. Addresses are only known on networks in addressParams. The
+// rpcs to pirated are on behalf of the request ctx belongs to.
+func GetBlockExtended(ctx context.Context, chainName string, height int) (*walletrpc.ExtendedBlock, error) {
+	block, _, err := getFullBlockFromRPC(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		// Block height is too large
+		return nil, errors.New("block requested is newer than latest block")
+	}
+	addressParams := GetAddressParams(chainName)
+	scriptAddress := func(script []byte) string {
+		if addressParams == nil {
+			return ""
+		}
+		return addressParams.ScriptAddress(script)
+	}
+	// Many inputs may spend outputs of the same transaction.
+	prevTxs := make(map[string]*walletrpc.ExtendedTx)
+	extendedBlock := &walletrpc.ExtendedBlock{Block: toCompact(block)}
+	for i, tx := range block.Transactions() {
+		if !tx.HasTransparentElements() {
+			continue
+		}
+		etx := tx.ToExtended(i)
+		for _, in := range etx.Vin {
+			if in.PrevIndex == 0xffffffff && bytes.Equal(in.PrevTxid, coinbasePrevTxid) {
+				continue
+			}
+			prevTx := prevTxs[string(in.PrevTxid)]
+			if prevTx == nil {
+				if prevTx, err = getTransparentTx(ctx, in.PrevTxid); err != nil {
+					return nil, err
+				}
+				prevTxs[string(in.PrevTxid)] = prevTx
+			}
+			if int(in.PrevIndex) >= len(prevTx.Vout) {
+				return nil, fmt.Errorf("transaction %s has no output %d",
+					hex.EncodeToString(parser.Reverse(in.PrevTxid)), in.PrevIndex)
+			}
+			prevOut := prevTx.Vout[in.PrevIndex]
+			in.Address = scriptAddress(prevOut.Script)
+			in.ValueZat = prevOut.ValueZat
+		}
+		for _, out := range etx.Vout {
+			out.Address = scriptAddress(out.Script)
+		}
+		extendedBlock.TransparentTxs = append(extendedBlock.TransparentTxs, etx)
+	}
+	return extendedBlock, nil
+}
+
+// getTransparentTx asks pirated for the transaction with the given
+// (little-endian) txid, and returns its transparent inputs and outputs.
+func getTransparentTx(ctx context.Context, txid []byte) (*walletrpc.ExtendedTx, error) {
+	txidJSON, err := json.Marshal(hex.EncodeToString(parser.Reverse(txid)))
+	if err != nil {
+		return nil, err
+	}
+	params := []json.RawMessage{txidJSON, json.RawMessage("0")}
+	result, rpcErr := RawRequestContext(ctx, "getrawtransaction", params)
+	if rpcErr != nil {
+		return nil, errors.Wrap(rpcErr, "error requesting previous transaction")
+	}
+	var txHex string
+	if err := json.Unmarshal(result, &txHex); err != nil {
+		return nil, err
+	}
+	txBytes, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding getrawtransaction output")
+	}
+	tx := parser.NewTransaction()
+	if _, err := tx.ParseFromSlice(txBytes); err != nil {
+		return nil, errors.Wrap(err, "error parsing previous transaction")
+	}
+	tx.SetTxID(txid)
+	return tx.ToExtended(0), nil
+}
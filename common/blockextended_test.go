@@ -0,0 +1,100 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+)
+
+func TestGetBlockExtended(t *testing.T) {
+	testT = t
+	// blockIngestorBatchStub counts its getblock requests.
+	defer atomic.StoreInt32(&batchRequests, 0)
+	// Block 380643's second transaction spends output 1 of transaction
+	// 41bf...11bd; block 380642's coinbase (whose output 1 is p2sh) stands
+	// in for it.
+	var blockHex string
+	json.Unmarshal(blocks[2], &blockHex)
+	blockData, _ := hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	prevTxJSON, _ := json.Marshal(hex.EncodeToString(block.Transactions()[0].Bytes()))
+	prevTxRequests := 0
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawtransaction" {
+			return blockIngestorBatchStub(method, params)
+		}
+		var txid string
+		json.Unmarshal(params[0], &txid)
+		if txid != "41bf60b7e65f104fc4ebbd9f894c2b3397afd83c9ef943c9dd9bdc74744c11bd" ||
+			string(params[1]) != "0" {
+			t.Fatal("unexpected getrawtransaction", txid, string(params[1]))
+		}
+		prevTxRequests++
+		return prevTxJSON, nil
+	}
+	main := GetAddressParams("main")
+
+	extended, err := GetBlockExtended(context.Background(), "main", 380643)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No transaction has shielded elements, but both have transparent ones.
+	if extended.Block.Height != 380643 || len(extended.Block.Vtx) != 0 ||
+		len(extended.TransparentTxs) != 2 {
+		t.Fatal("unexpected extended block", extended)
+	}
+	coinbase, tx := extended.TransparentTxs[0], extended.TransparentTxs[1]
+	if coinbase.Index != 0 || len(coinbase.Vin) != 1 || len(coinbase.Vout) != 2 {
+		t.Fatal("unexpected coinbase", coinbase)
+	}
+	// A coinbase input spends nothing.
+	if in := coinbase.Vin[0]; in.Address != "" || in.ValueZat != 0 || in.PrevIndex != 0xffffffff {
+		t.Fatal("unexpected coinbase input", in)
+	}
+	if out := coinbase.Vout[0]; out.ValueZat != 1000003848 || main.TransparentType(out.Address) != "p2pkh" {
+		t.Fatal("unexpected coinbase output", out)
+	}
+	if out := coinbase.Vout[1]; out.ValueZat != 250000000 || main.TransparentType(out.Address) != "p2sh" {
+		t.Fatal("unexpected coinbase output", out)
+	}
+	if tx.Index != 1 || !bytes.Equal(tx.Hash, bytes.Repeat([]byte{0x11}, 32)) ||
+		len(tx.Vin) != 1 || len(tx.Vout) != 2 {
+		t.Fatal("unexpected transaction", tx)
+	}
+	if in := tx.Vin[0]; in.PrevIndex != 1 || in.ValueZat != 250000000 ||
+		in.Address != coinbase.Vout[1].Address {
+		t.Fatal("unexpected input", in)
+	}
+	if tx.Vout[0].ValueZat != 310000 || tx.Vout[1].ValueZat != 1404488 ||
+		tx.Vout[0].Address == "" || tx.Vout[1].Address == "" {
+		t.Fatal("unexpected outputs", tx.Vout)
+	}
+	if prevTxRequests != 1 {
+		t.Fatal("unexpected getrawtransaction requests", prevTxRequests)
+	}
+
+	// Addresses aren't known on other networks, but values are.
+	extended, err = GetBlockExtended(context.Background(), unitTestChain, 380643)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in := extended.TransparentTxs[1].Vin[0]; in.Address != "" || in.ValueZat != 250000000 {
+		t.Fatal("unexpected input", in)
+	}
+
+	if _, err := GetBlockExtended(context.Background(), "main", 380644); err == nil {
+		t.Fatal("expected an error for a block pirated doesn't have")
+	}
+}
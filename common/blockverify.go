@@ -0,0 +1,51 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+)
+
+// VerifyBlocks enables checking, as blocks are received from pirated, that
+// the hash of each block's header is the hash pirated reports for it, and
+// meets the header's proof-of-work target; this guards against a
+// compromised pirated serving fabricated blocks. Only blocks whose height
+// is a multiple of VerifyBlocksInterval are checked (1 means every block).
+var (
+	VerifyBlocks         bool
+	VerifyBlocksInterval = 1
+)
+
+// CompactBlockCheck selects whether each block's conversion to a compact
+// block is cross-checked (see parser.Block.CheckCompact): "off", "skip" (a
+// bad block is logged and not cached; since the cache can't have a gap, the
+// block ingestor halts at its height, serving the blocks before it, and
+// tries it again every 10 seconds, see BadCompactBlockHeightGauge), or
+// "error" (a bad block is logged and is an error, which stops the block
+// ingestor).
+var CompactBlockCheck = "off"
+
+// errBadCompactBlock is returned, with CompactBlockCheck "skip", for a block
+// whose compact form fails the check.
+var errBadCompactBlock = errors.New("compact block failed its check")
+
+// verifyBlock returns an error if the given (parsed) block's header hash
+// isn't claimedHash (big-endian hex, as pirated reports it), or doesn't
+// meet its proof-of-work target.
+func verifyBlock(block *parser.Block, claimedHash string) error {
+	hash := hex.EncodeToString(block.GetDisplayHash())
+	if hash != claimedHash {
+		return fmt.Errorf("block header hash %s does not match pirated's hash %s", hash, claimedHash)
+	}
+	if !block.MeetsTarget() {
+		return fmt.Errorf("block hash %s does not meet its proof-of-work target", hash)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+)
+
+func TestVerifyBlocks(t *testing.T) {
+	testT = t
+	VerifyBlocks = true
+	defer func() {
+		VerifyBlocks = false
+		VerifyBlocksInterval = 1
+	}()
+
+	// The hash of the (real) block at 380640
+	var blockHex string
+	json.Unmarshal(blocks[0], &blockHex)
+	blockData, _ := hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	realHash := hex.EncodeToString(block.GetDisplayHash())
+
+	claimedHash := realHash
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblock" {
+			testT.Fatal("unexpected method", method)
+		}
+		if string(params[1]) == "1" {
+			return json.Marshal(&PirateRpcReplyGetblock1{
+				Hash: claimedHash,
+				Tx:   []string{strings.Repeat("00", 32)},
+			})
+		}
+		return blocks[0], nil
+	}
+
+	if _, err := getBlockFromRPC(context.Background(), 380640); err != nil {
+		t.Fatal("verification of a genuine block failed", err)
+	}
+
+	// pirated claims a different hash than the header hashes to.
+	claimedHash = strings.Repeat("00", 32)
+	_, err := getBlockFromRPC(context.Background(), 380640)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatal("expected a hash mismatch error", err)
+	}
+
+	// Blocks outside the sample aren't checked.
+	VerifyBlocksInterval = 7
+	if _, err := getBlockFromRPC(context.Background(), 380640); err != nil {
+		t.Fatal("unsampled block was verified", err)
+	}
+}
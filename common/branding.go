@@ -0,0 +1,62 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits on the branding in GetLightdInfo replies, which every wallet
+// fetches, so they stay small.
+const (
+	maxVendorLength     = 64
+	maxInfoExtraEntries = 16
+	maxInfoExtraKey     = 32
+	maxInfoExtraValue   = 256
+)
+
+// Vendor, if not empty, replaces the default vendor in GetLightdInfo
+// replies, and LightdInfoExtra is added to them, so that a wallet can show
+// who serves it. Both are informational only; see SetLightdInfoBranding.
+var (
+	Vendor          string
+	LightdInfoExtra map[string]string
+)
+
+// SetLightdInfoBranding checks and sets Vendor and LightdInfoExtra; each
+// extra entry is "key=value".
+func SetLightdInfoBranding(vendor string, extra []string) error {
+	if len(vendor) > maxVendorLength {
+		return fmt.Errorf("vendor is longer than %d bytes", maxVendorLength)
+	}
+	if len(extra) > maxInfoExtraEntries {
+		return fmt.Errorf("more than %d info-extra entries", maxInfoExtraEntries)
+	}
+	var extraMap map[string]string
+	for _, entry := range extra {
+		i := strings.Index(entry, "=")
+		if i < 1 {
+			return fmt.Errorf("info-extra entry %q is not key=value", entry)
+		}
+		key, value := entry[:i], entry[i+1:]
+		if len(key) > maxInfoExtraKey {
+			return fmt.Errorf("info-extra key %q is longer than %d bytes", key, maxInfoExtraKey)
+		}
+		if len(value) > maxInfoExtraValue {
+			return fmt.Errorf("info-extra value of %q is longer than %d bytes", key, maxInfoExtraValue)
+		}
+		if extraMap == nil {
+			extraMap = make(map[string]string)
+		}
+		if _, ok := extraMap[key]; ok {
+			return fmt.Errorf("info-extra key %q is repeated", key)
+		}
+		extraMap[key] = value
+	}
+	Vendor, LightdInfoExtra = vendor, extraMap
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLightdInfoBranding(t *testing.T) {
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&PiratedRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&PiratedRpcReplyGetblockchaininfo{Blocks: 9977})
+		}
+		t.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	defer SetLightdInfoBranding("", nil)
+
+	// The defaults.
+	info, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if info.Vendor != "Pirate LightWalletD" || info.Extra != nil {
+		t.Fatal("unexpected branding", info.Vendor, info.Extra)
+	}
+
+	err = SetLightdInfoBranding("Example Wallets", []string{"url=https://example.com", "contact=a=b", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if info.Vendor != "Example Wallets" || len(info.Extra) != 3 || info.Extra["url"] != "https://example.com" ||
+		info.Extra["contact"] != "a=b" || info.Extra["empty"] != "" {
+		t.Fatal("unexpected branding", info.Vendor, info.Extra)
+	}
+
+	tooMany := make([]string, maxInfoExtraEntries+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("key%d=value", i)
+	}
+	for _, tt := range []struct {
+		vendor string
+		extra  []string
+	}{
+		{strings.Repeat("v", 65), nil},
+		{"", []string{"nokey"}},
+		{"", []string{"=value"}},
+		{"", []string{strings.Repeat("k", 33) + "=value"}},
+		{"", []string{"key=" + strings.Repeat("v", 257)}},
+		{"", []string{"key=1", "key=2"}},
+		{"", tooMany},
+	} {
+		if err := SetLightdInfoBranding(tt.vendor, tt.extra); err == nil {
+			t.Fatal("expected an error for", tt.vendor, tt.extra)
+		}
+	}
+	// A rejected configuration doesn't change the branding.
+	if Vendor != "Example Wallets" || len(LightdInfoExtra) != 3 {
+		t.Fatal("branding changed by a rejected configuration", Vendor, LightdInfoExtra)
+	}
+}
@@ -7,30 +7,120 @@
 package common
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
 	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
 )
 
+// Cache is a consecutive set of compact blocks, beginning at its first
+// height (usually Sapling activation), as the block ingestor maintains it
+// and the frontend serves it. BlockCache keeps them in files;
+// MemoryBlockCache, only in memory (for tests, or an ephemeral server).
+type Cache interface {
+	// Add appends the block at the given height, which must be the
+	// cache's next height (see CacheDuplicateHeights for a lower one).
+	Add(height int, block *walletrpc.CompactBlock) error
+	// Get returns the block at the given height, or nil if it's not in the
+	// cache; the caller may modify it.
+	Get(height int) *walletrpc.CompactBlock
+	// GetShared is like Get, but the block may be shared with other
+	// callers, so it must not be modified.
+	GetShared(height int) *walletrpc.CompactBlock
+	// Peek is like GetShared, but doesn't add the block to (or promote it
+	// in) the cache's memory, so that a scan of many blocks doesn't evict
+	// the ones clients are using.
+	Peek(height int) *walletrpc.CompactBlock
+	GetFirstHeight() int
+	GetNextHeight() int
+	// Len returns the number of blocks in the cache.
+	Len() int
+	// GetLatestHeight returns -1 if the cache is empty.
+	GetLatestHeight() int
+	GetLatestHash() []byte
+	// GetLatestHeightHash returns -1 and nil if the cache is empty.
+	GetLatestHeightHash() (int, []byte)
+	// HashMatch reports whether a block with the given previous-block
+	// hash extends the cache.
+	HashMatch(prevhash []byte) bool
+	// GetHeightByHash returns the height of the cached block with the
+	// given hash, or -1 if there's none.
+	GetHeightByHash(hash []byte) int
+	GetLiteWalletBlockGroup(height int) *walletrpc.BlockID
+	// Reorg removes the blocks from the given height on.
+	Reorg(height int)
+	// Sync commits the blocks added so far (to disk, if the cache has one).
+	Sync()
+	Close()
+}
+
 // BlockCache contains a consecutive set of recent compact blocks in marshalled form.
 type BlockCache struct {
 	lengthsName, blocksName string // pathnames
 	lengthsFile, blocksFile *os.File
-	starts                  []int64 // Starting offset of each block within blocksFile
-	firstBlock              int     // height of the first block in the cache (usually Sapling activation)
-	nextBlock               int     // height of the first block not in the cache
-	latestHash              []byte  // hash of the most recent (highest height) block, for detecting reorgs.
+	starts                  []int64   // Starting offset of each block within blocksFile
+	compressed              []bool    // whether each block is compressed in blocksFile
+	firstBlock              int       // height of the first block in the cache (usually Sapling activation)
+	nextBlock               int       // height of the first block not in the cache
+	latestHash              []byte    // hash of the most recent (highest height) block, for detecting reorgs.
+	mem                     *blockLRU // recently-used blocks, checked before the db files
+	hashes                  *hashIndex // heights by hash (prefix)
+	blocksWriter            *bufio.Writer // nil if writes aren't buffered
+	pending                 [][]byte      // blocks (with checksums) not yet committed to the lengths file
+	lastFlush               time.Time
+	cleanShutdown           bool // the clean shutdown marker was present when opened
+	unverified              bool // VerifyTail couldn't verify the tail
+	frozen                  bool // opened read-only by OpenFrozenBlockCache
 	mutex                   sync.RWMutex
 }
 
+// Blocks written to the cache are buffered (if CacheWriteBuffer is nonzero),
+// and committed (flushed and synced to disk) after CacheFlushBlocks blocks,
+// or CacheFlushInterval, whichever comes first, and whenever Sync() is called.
+// A block is committed only when its length is written to the lengths file;
+// after a crash, any block data beyond the committed blocks is discarded.
+// These must be set before NewBlockCache() is called.
+var (
+	CacheWriteBuffer   = 1024 * 1024
+	CacheFlushBlocks   = 100
+	CacheFlushInterval = time.Second
+)
+
+// CacheDuplicateHeights is what Add() does when asked to add a block at a
+// height that's already in the cache. That should never happen (the block
+// ingestor calls Reorg() first), but a bug or a bad refetch could cause
+// it: "error" rejects the block, keeping the cached one, and "overwrite"
+// replaces the cached block (discarding any above it), so that the block
+// written last is the one read. Either way, the anomaly is logged.
+var CacheDuplicateHeights = "error"
+
+// duplicateHeight logs an attempt to add a block at a height below the
+// cache's next height, and returns the error to reject it with, or nil if
+// it should overwrite the cached block (see CacheDuplicateHeights).
+func duplicateHeight(height, next int, block *walletrpc.CompactBlock) error {
+	Log.WithFields(logrus.Fields{
+		"height": height,
+		"next":   next,
+		"hash":   displayHash(block.Hash),
+		"policy": CacheDuplicateHeights,
+	}).Error("cache.Add of a height that's already cached")
+	if CacheDuplicateHeights == "overwrite" {
+		return nil
+	}
+	return fmt.Errorf("cache.Add height %d is already cached (the next height is %d)", height, next)
+}
+
 // GetNextHeight returns the height of the lowest unobtained block.
 func (c *BlockCache) GetNextHeight() int {
 	c.mutex.RLock()
@@ -38,6 +128,13 @@ func (c *BlockCache) GetNextHeight() int {
 	return c.nextBlock
 }
 
+// Len returns the number of blocks in the cache.
+func (c *BlockCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.nextBlock - c.firstBlock
+}
+
 // GetFirstHeight returns the height of the lowest block (usually Sapling activation).
 func (c *BlockCache) GetFirstHeight() int {
 	c.mutex.RLock()
@@ -46,12 +143,25 @@ func (c *BlockCache) GetFirstHeight() int {
 }
 
 // GetLatestHash returns the hash (block ID) of the most recent (highest) known block.
+// The returned slice is never modified by the cache, so the caller may keep it.
 func (c *BlockCache) GetLatestHash() []byte {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	return c.latestHash
 }
 
+// GetLatestHeightHash returns the height and hash of the most recent block
+// as a consistent pair (separate GetLatestHeight() and GetLatestHash() calls
+// can straddle an Add() or Reorg()), or -1 and nil if the cache is empty.
+func (c *BlockCache) GetLatestHeightHash() (int, []byte) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.firstBlock == c.nextBlock {
+		return -1, nil
+	}
+	return c.nextBlock - 1, c.latestHash
+}
+
 // HashMatch indicates if the given prev-hash matches the most recent block's hash
 // so reorgs can be detected.
 func (c *BlockCache) HashMatch(prevhash []byte) bool {
@@ -69,6 +179,8 @@ func (c *BlockCache) setDbFiles(height int) {
 		if height < c.firstBlock {
 			height = c.firstBlock
 		}
+		// Commit any pending blocks so that the files can be truncated.
+		c.flush()
 		index := height - c.firstBlock
 		if err := c.lengthsFile.Truncate(int64(index * 4)); err != nil {
 			Log.Fatal("truncate lengths file failed: ", err)
@@ -76,9 +188,12 @@ func (c *BlockCache) setDbFiles(height int) {
 		if err := c.blocksFile.Truncate(c.starts[index]); err != nil {
 			Log.Fatal("truncate blocks file failed: ", err)
 		}
-		c.Sync()
+		c.sync()
 		c.starts = c.starts[:index+1]
+		c.compressed = c.compressed[:index]
 		c.nextBlock = height
+		c.mem.truncate(height)
+		c.hashes.truncate(height)
 		c.setLatestHash()
 	}
 }
@@ -123,8 +238,9 @@ func (c *BlockCache) recoverFromCorruption(height int) {
 // not including the checksum
 func (c *BlockCache) blockLength(height int) int {
 
-	//Don't check block that will be out of index
-	if height < c.firstBlock || height >= c.nextBlock {
+	// Don't check block that will be out of index (starts[] runs ahead of
+	// nextBlock while NewBlockCache() is verifying the existing blocks).
+	if height < c.firstBlock || height-c.firstBlock+1 >= len(c.starts) {
 		return 0
 	}
 
@@ -147,10 +263,15 @@ func (c *BlockCache) readBlock(height int) *walletrpc.CompactBlock {
 	blockLen := c.blockLength(height)
 	b := make([]byte, blockLen+8)
 	offset := c.starts[height-c.firstBlock]
-	n, err := c.blocksFile.ReadAt(b, offset)
-	if err != nil || n != len(b) {
-		Log.Warning("blocks read offset: ", offset, " failed: ", n, err)
-		return nil
+	if firstPending := c.nextBlock - len(c.pending); len(c.pending) > 0 && height >= firstPending {
+		// This block may not have been written to the blocks file yet.
+		copy(b, c.pending[height-firstPending])
+	} else {
+		n, err := c.blocksFile.ReadAt(b, offset)
+		if err != nil || n != len(b) {
+			Log.Warning("blocks read offset: ", offset, " failed: ", n, err)
+			return nil
+		}
 	}
 	diskcs := b[:8]
 	b = b[8 : blockLen+8]
@@ -158,8 +279,15 @@ func (c *BlockCache) readBlock(height int) *walletrpc.CompactBlock {
 		Log.Warning("bad block checksum at height: ", height, " offset: ", offset)
 		return nil
 	}
+	if c.compressed[height-c.firstBlock] {
+		var err error
+		if b, err = decompressBlock(b); err != nil {
+			Log.Warning("blocks decompress at offset: ", offset, " failed: ", err)
+			return nil
+		}
+	}
 	block := &walletrpc.CompactBlock{}
-	err = proto.Unmarshal(b, block)
+	err := proto.Unmarshal(b, block)
 	if err != nil {
 		// Could be file corruption.
 		Log.Warning("blocks unmarshal at offset: ", offset, " failed: ", err)
@@ -191,6 +319,8 @@ func (c *BlockCache) setLatestHash() {
 
 // Reset is used only for darkside testing.
 func (c *BlockCache) Reset(startHeight int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.setDbFiles(c.firstBlock) // empty the cache
 	c.firstBlock = startHeight
 	c.nextBlock = startHeight
@@ -200,7 +330,8 @@ func (c *BlockCache) Reset(startHeight int) {
 // (No locking here, we assume this is single-threaded.)
 // syncFromHeight < 0 means latest (tip) height.
 func NewBlockCache(dbPath string, chainName string, startHeight int, syncFromHeight int) *BlockCache {
-	c := &BlockCache{}
+	c := &BlockCache{hashes: newHashIndex()}
+	c.mem = newBlockLRU(MemoryCacheBlocks, MemoryCachePolicy)
 	c.firstBlock = startHeight
 	c.nextBlock = startHeight
 	c.lengthsName, c.blocksName = dbFileNames(dbPath, chainName)
@@ -208,6 +339,10 @@ func NewBlockCache(dbPath string, chainName string, startHeight int, syncFromHei
 	if err := os.MkdirAll(filepath.Join(dbPath, chainName), 0755); err != nil {
 		Log.Fatal("mkdir ", dbPath, " failed: ", err)
 	}
+	if err := migrateCache(filepath.Join(dbPath, chainName)); err != nil {
+		Log.Fatal(err)
+	}
+	c.cleanShutdown = openCleanShutdown(filepath.Join(dbPath, chainName))
 	c.blocksFile, err = os.OpenFile(c.blocksName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	if err != nil {
 		Log.Fatal("open ", c.blocksName, " failed: ", err)
@@ -216,6 +351,10 @@ func NewBlockCache(dbPath string, chainName string, startHeight int, syncFromHei
 	if err != nil {
 		Log.Fatal("open ", c.lengthsName, " failed: ", err)
 	}
+	if CacheWriteBuffer > 0 {
+		c.blocksWriter = bufio.NewWriterSize(c.blocksFile, CacheWriteBuffer)
+	}
+	c.lastFlush = time.Now()
 	lengths, err := ioutil.ReadFile(c.lengthsName)
 	if err != nil {
 		Log.Fatal("read ", c.lengthsName, " failed: ", err)
@@ -242,13 +381,16 @@ func NewBlockCache(dbPath string, chainName string, startHeight int, syncFromHei
 			break
 		}
 		length := binary.LittleEndian.Uint32(lengths[i*4 : (i+1)*4])
-		if length < 74 || length > 4*1000*1000 {
+		compressed := length&compressedLengthFlag != 0
+		length &^= compressedLengthFlag
+		if (length < 74 && !compressed) || length == 0 || length > maxBlockLength {
 			Log.Warning("lengths file has impossible value ", length)
 			c.recoverFromCorruption(c.nextBlock)
 			break
 		}
 		offset += int64(length) + 8
 		c.starts = append(c.starts, offset)
+		c.compressed = append(c.compressed, compressed)
 		// Check for corruption.
 		block := c.readBlock(c.nextBlock)
 		if block == nil {
@@ -256,6 +398,7 @@ func NewBlockCache(dbPath string, chainName string, startHeight int, syncFromHei
 			c.recoverFromCorruption(c.nextBlock)
 			break
 		}
+		c.hashes.add(block.Hash, c.nextBlock)
 		c.nextBlock++
 	}
 	c.setDbFiles(c.nextBlock)
@@ -275,6 +418,10 @@ func (c *BlockCache) Add(height int, block *walletrpc.CompactBlock) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	if c.frozen {
+		Log.Fatal("cache.Add to a frozen cache: ", height)
+		return nil
+	}
 	if height > c.nextBlock {
 		// Cache has been reset (for example, checksum error)
 		return nil
@@ -284,11 +431,6 @@ func (c *BlockCache) Add(height int, block *walletrpc.CompactBlock) error {
 		Log.Fatal("cache.Add height below Sapling: ", height)
 		return nil
 	}
-	if height < c.nextBlock {
-		// Should never try to "backup" (call Reorg() instead).
-		Log.Fatal("cache.Add height going backwards: ", height)
-		return nil
-	}
 	bheight := int(block.Height)
 
 	if bheight != height {
@@ -297,49 +439,113 @@ func (c *BlockCache) Add(height int, block *walletrpc.CompactBlock) error {
 		Log.Fatal("cache.Add wrong height: ", bheight, " expecting: ", height)
 		return nil
 	}
+	if height < c.nextBlock {
+		// Should never try to "backup" (call Reorg() instead).
+		if err := duplicateHeight(height, c.nextBlock, block); err != nil {
+			return err
+		}
+		c.reorg(height)
+	}
 
 	// Add the new block and its length to the db files.
 	data, err := proto.Marshal(block)
 	if err != nil {
 		return err
 	}
-	b := append(checksum(height, data), data...)
-	n, err := c.blocksFile.Write(b)
-	if err != nil {
-		Log.Fatal("blocks write failed: ", err)
-	}
-	if n != len(b) {
-		Log.Fatal("blocks write incorrect length: expected: ", len(b), "written: ", n)
-	}
-	b = make([]byte, 4)
-	binary.LittleEndian.PutUint32(b, uint32(len(data)))
-	n, err = c.lengthsFile.Write(b)
-	if err != nil {
-		Log.Fatal("lengths write failed: ", err)
-	}
-	if n != len(b) {
-		Log.Fatal("lengths write incorrect length: expected: ", len(b), "written: ", n)
+	stored := data
+	length := uint32(len(data))
+	if compressed := compressBlock(data); compressed != nil {
+		stored = compressed
+		length = uint32(len(compressed)) | compressedLengthFlag
+	}
+	b := append(checksum(height, stored), stored...)
+	if c.blocksWriter != nil {
+		// The length is written when the pending blocks are committed.
+		if _, err := c.blocksWriter.Write(b); err != nil {
+			Log.Fatal("blocks write failed: ", err)
+		}
+		c.pending = append(c.pending, b)
+	} else {
+		n, err := c.blocksFile.Write(b)
+		if err != nil {
+			Log.Fatal("blocks write failed: ", err)
+		}
+		if n != len(b) {
+			Log.Fatal("blocks write incorrect length: expected: ", len(b), "written: ", n)
+		}
+		b = make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, length)
+		n, err = c.lengthsFile.Write(b)
+		if err != nil {
+			Log.Fatal("lengths write failed: ", err)
+		}
+		if n != len(b) {
+			Log.Fatal("lengths write incorrect length: expected: ", len(b), "written: ", n)
+		}
 	}
 
 	// update the in-memory variables
 	offset := c.starts[len(c.starts)-1]
-	c.starts = append(c.starts, offset+int64(len(data)+8))
+	c.starts = append(c.starts, offset+int64(len(stored)+8))
+	c.compressed = append(c.compressed, length&compressedLengthFlag != 0)
+	c.mem.add(height, data)
 
-	if c.latestHash == nil {
-		c.latestHash = make([]byte, len(block.Hash))
-	}
+	// Don't overwrite the previous hash in place; GetLatestHash() callers
+	// may still be reading it after we've released the lock.
+	c.latestHash = make([]byte, len(block.Hash))
 	copy(c.latestHash, block.Hash)
+	c.hashes.add(c.latestHash, height)
 	c.nextBlock++
+	if len(c.pending) >= CacheFlushBlocks || time.Since(c.lastFlush) >= CacheFlushInterval {
+		c.flush()
+	}
 	// Invariant: m[firstBlock..nextBlock) are valid.
 	return nil
 }
 
+// flush commits the pending blocks: their data is written and synced to the
+// blocks file before their lengths are written to the lengths file, so that
+// a crash can't leave a length without its block.
+// Caller should hold c.mutex.Lock().
+func (c *BlockCache) flush() {
+	c.lastFlush = time.Now()
+	if len(c.pending) == 0 {
+		return
+	}
+	if err := c.blocksWriter.Flush(); err != nil {
+		Log.Fatal("blocks write failed: ", err)
+	}
+	c.blocksFile.Sync()
+	lengths := make([]byte, 4*len(c.pending))
+	firstPending := c.nextBlock - len(c.pending) - c.firstBlock
+	for i, b := range c.pending {
+		length := uint32(len(b) - 8)
+		if c.compressed[firstPending+i] {
+			length |= compressedLengthFlag
+		}
+		binary.LittleEndian.PutUint32(lengths[i*4:], length)
+	}
+	n, err := c.lengthsFile.Write(lengths)
+	if err != nil {
+		Log.Fatal("lengths write failed: ", err)
+	}
+	if n != len(lengths) {
+		Log.Fatal("lengths write incorrect length: expected: ", len(lengths), "written: ", n)
+	}
+	c.lengthsFile.Sync()
+	c.pending = nil
+}
+
 // Reorg resets nextBlock (the block that should be Add()ed next)
 // downward to the given height.
 func (c *BlockCache) Reorg(height int) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.reorg(height)
+}
 
+// Caller should hold c.mutex.Lock().
+func (c *BlockCache) reorg(height int) {
 	// Allow the caller not to have to worry about Sapling start height.
 	if height < c.firstBlock {
 		height = c.firstBlock
@@ -348,10 +554,13 @@ func (c *BlockCache) Reorg(height int) {
 		// Timing window, ignore this request
 		return
 	}
+	// Commit any pending blocks so that the files can be truncated.
+	c.flush()
 	// Remove the end of the cache.
 	c.nextBlock = height
 	newCacheLen := height - c.firstBlock
 	c.starts = c.starts[:newCacheLen+1]
+	c.compressed = c.compressed[:newCacheLen]
 
 	if err := c.lengthsFile.Truncate(int64(4 * newCacheLen)); err != nil {
 		Log.Fatal("truncate failed: ", err)
@@ -359,6 +568,8 @@ func (c *BlockCache) Reorg(height int) {
 	if err := c.blocksFile.Truncate(c.starts[newCacheLen]); err != nil {
 		Log.Fatal("truncate failed: ", err)
 	}
+	c.mem.truncate(height)
+	c.hashes.truncate(height)
 	c.setLatestHash()
 }
 
@@ -371,7 +582,17 @@ func (c *BlockCache) Get(height int) *walletrpc.CompactBlock {
 	if height < c.firstBlock || height >= c.nextBlock {
 		return nil
 	}
+	if data := c.mem.get(height); data != nil {
+		block := &walletrpc.CompactBlock{}
+		if err := proto.Unmarshal(data, block); err == nil {
+			return block
+		}
+	}
 	block := c.readBlock(height)
+	if block == nil && c.frozen {
+		// It can't be redownloaded into a frozen cache.
+		return nil
+	}
 	if block == nil {
 		go func() {
 			// We hold only the read lock, need the exclusive lock.
@@ -381,9 +602,52 @@ func (c *BlockCache) Get(height int) *walletrpc.CompactBlock {
 		}()
 		return nil
 	}
+	if data, err := proto.Marshal(block); err == nil {
+		c.mem.add(height, data)
+	}
 	return block
 }
 
+// GetShared is like Get(), but avoids unmarshalling the block for each call
+// by returning the same block to all callers (while it's in the memory
+// cache), so the caller must not modify it (or anything it refers to).
+func (c *BlockCache) GetShared(height int) *walletrpc.CompactBlock {
+	c.mutex.RLock()
+	if height < c.firstBlock || height >= c.nextBlock {
+		c.mutex.RUnlock()
+		return nil
+	}
+	block := c.mem.getShared(height)
+	c.mutex.RUnlock()
+	if block != nil {
+		return block
+	}
+	// Get() adds the block to the memory cache (if enabled); without one,
+	// its private copy is as good as a shared one.
+	if block = c.Get(height); block == nil {
+		return nil
+	}
+	if shared := c.mem.getShared(height); shared != nil {
+		return shared
+	}
+	return block
+}
+
+// Peek is like GetShared(), but a block that's not in the memory cache is
+// read from the db files without adding it there, and one that is isn't
+// promoted. An unreadable block is left for Get() to recover from.
+func (c *BlockCache) Peek(height int) *walletrpc.CompactBlock {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if height < c.firstBlock || height >= c.nextBlock {
+		return nil
+	}
+	if block := c.mem.peek(height); block != nil {
+		return block
+	}
+	return c.readBlock(height)
+}
+
 // GetLatestHeight returns the height of the most recent block, or -1
 // if the cache is empty.
 func (c *BlockCache) GetLiteWalletBlockGroup(height int) *walletrpc.BlockID {
@@ -424,12 +688,21 @@ func (c *BlockCache) GetLatestHeight() int {
 
 // Sync ensures that the db files are flushed to disk, can be called unnecessarily.
 func (c *BlockCache) Sync() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sync()
+}
+
+// Caller should hold c.mutex.Lock().
+func (c *BlockCache) sync() {
+	c.flush()
 	c.lengthsFile.Sync()
 	c.blocksFile.Sync()
 }
 
 // Close is Currently used only for testing.
 func (c *BlockCache) Close() {
+	c.Sync()
 	// Some operating system require you to close files before you can remove them.
 	if c.lengthsFile != nil {
 		c.lengthsFile.Close()
@@ -439,4 +712,7 @@ func (c *BlockCache) Close() {
 		c.blocksFile.Close()
 		c.blocksFile = nil
 	}
+	c.mutex.Lock()
+	c.hashes.clear()
+	c.mutex.Unlock()
 }
@@ -5,14 +5,20 @@
 package common
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/PirateNetwork/lightwalletd/parser"
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
 )
 
 var compacts []*walletrpc.CompactBlock
@@ -183,3 +189,530 @@ func fillCache(t *testing.T) {
 		}
 	}
 }
+
+// Run with -race: a writer appends blocks while readers query the tip.
+func TestCacheConcurrentTip(t *testing.T) {
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+
+	// Each block's hash encodes its height, so readers can check that
+	// the height and hash they get back belong together.
+	hashAt := func(height int) []byte {
+		hash := make([]byte, 32)
+		binary.LittleEndian.PutUint64(hash, uint64(height))
+		return hash
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				height, hash := c.GetLatestHeightHash()
+				if height != -1 && !bytes.Equal(hash, hashAt(height)) {
+					t.Error("inconsistent tip height and hash at height ", height)
+					return
+				}
+				if c.GetLatestHeight() < height {
+					t.Error("latest height went backwards")
+					return
+				}
+				if hash = c.GetLatestHash(); hash != nil && binary.LittleEndian.Uint64(hash) < uint64(height) {
+					t.Error("latest hash went backwards")
+					return
+				}
+			}
+		}()
+	}
+	for height := 1000; height < 1500; height++ {
+		block := &walletrpc.CompactBlock{Height: uint64(height), Hash: hashAt(height)}
+		if err := c.Add(height, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if c.GetLatestHeight() != 1499 {
+		t.Fatal("unexpected GetLatestHeight")
+	}
+
+	c.Close()
+	os.RemoveAll(unitTestPath)
+}
+
+// testBlock returns a synthetic compact block whose hash encodes its height
+// and the given version (so a block replaced by a reorg can be detected).
+func testBlock(height int, version byte) *walletrpc.CompactBlock {
+	hash := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hash, uint64(height))
+	hash[31] = version
+	block := &walletrpc.CompactBlock{Height: uint64(height), Hash: hash}
+	for i := 0; i < 10; i++ {
+		block.Vtx = append(block.Vtx, &walletrpc.CompactTx{
+			Index:   uint64(i),
+			Hash:    hash,
+			Spends:  []*walletrpc.CompactSaplingSpend{{Nf: make([]byte, 32)}},
+			Outputs: []*walletrpc.CompactSaplingOutput{{Cmu: make([]byte, 32), Epk: make([]byte, 32), Ciphertext: make([]byte, 52)}},
+		})
+	}
+	return block
+}
+
+func TestCacheMemoryEviction(t *testing.T) {
+	MemoryCacheBlocks = 3
+	defer func() { MemoryCacheBlocks = 4000 }()
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+
+	for height := 1000; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.mem.order.Len() != 3 {
+		t.Fatal("unexpected number of blocks in memory", c.mem.order.Len())
+	}
+	// Every block is correct, whether it comes from memory or (evicted) disk.
+	for height := 1000; height < 1010; height++ {
+		block := c.Get(height)
+		if block == nil || !bytes.Equal(block.Hash, testBlock(height, 0).Hash) {
+			t.Fatal("unexpected block at height", height)
+		}
+		if c.mem.get(height) == nil {
+			t.Fatal("block not added to memory after Get", height)
+		}
+	}
+	if c.mem.order.Len() != 3 || c.mem.get(1000) != nil || c.mem.get(1009) == nil {
+		t.Fatal("unexpected blocks in memory")
+	}
+
+	// Callers (for example, GetBlockRange) may modify the returned block.
+	c.Get(1009).Vtx = nil
+	if len(c.Get(1009).Vtx) != 10 {
+		t.Fatal("block in memory was modified")
+	}
+
+	// After a reorg, replaced blocks must not be served from memory.
+	c.Reorg(1008)
+	if c.Get(1008) != nil || c.Get(1009) != nil {
+		t.Fatal("block beyond the reorg height still present")
+	}
+	for height := 1008; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height := 1006; height < 1010; height++ {
+		version := byte(0)
+		if height >= 1008 {
+			version = 1
+		}
+		if !bytes.Equal(c.Get(height).Hash, testBlock(height, version).Hash) {
+			t.Fatal("unexpected block after reorg at height", height)
+		}
+	}
+
+	c.Close()
+	os.RemoveAll(unitTestPath)
+}
+
+func TestCacheMemoryPolicy(t *testing.T) {
+	MemoryCacheBlocks = 10
+	defer func() {
+		MemoryCacheBlocks = 4000
+		MemoryCachePolicy = "lru"
+	}()
+	for _, policy := range []string{"lru", "slru"} {
+		MemoryCachePolicy = policy
+		os.RemoveAll(unitTestPath)
+		c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+		for height := 1000; height < 1100; height++ {
+			if err := c.Add(height, testBlock(height, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Wallets request the blocks near the tip, then one scans
+		// (once) through old blocks.
+		for i := 0; i < 3; i++ {
+			for height := 1095; height < 1100; height++ {
+				c.GetShared(height)
+			}
+		}
+		for height := 1000; height < 1090; height++ {
+			if c.Get(height) == nil {
+				t.Fatal("Get failed at height", height)
+			}
+		}
+		if c.mem.len() != 10 {
+			t.Fatal("unexpected number of blocks in memory", c.mem.len())
+		}
+		// Only slru keeps the tip blocks.
+		for height := 1095; height < 1100; height++ {
+			if (c.mem.get(height) != nil) != (policy == "slru") {
+				t.Fatal("unexpected tip block in memory", policy, height)
+			}
+		}
+		// The most recent scanned blocks are also kept.
+		if c.mem.get(1089) == nil {
+			t.Fatal("most recently scanned block not in memory", policy)
+		}
+
+		// A reorg removes blocks from both segments.
+		c.Reorg(1089)
+		for height := 1089; height < 1100; height++ {
+			if c.mem.get(height) != nil {
+				t.Fatal("block beyond the reorg height still in memory", policy, height)
+			}
+		}
+		if c.mem.len() != 10-6 && policy == "slru" {
+			t.Fatal("unexpected number of blocks in memory after reorg", c.mem.len())
+		}
+		c.Close()
+	}
+	os.RemoveAll(unitTestPath)
+}
+
+func TestCacheDuplicateHeights(t *testing.T) {
+	defer func() { CacheDuplicateHeights = "error" }()
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	for _, policy := range []string{"error", "overwrite"} {
+		CacheDuplicateHeights = policy
+		os.RemoveAll(unitTestPath)
+		caches := map[string]Cache{
+			"file":   NewBlockCache(unitTestPath, unitTestChain, 1000, 0),
+			"memory": NewMemoryBlockCache(1000),
+		}
+		for name, c := range caches {
+			for height := 1000; height < 1010; height++ {
+				if err := c.Add(height, testBlock(height, 0)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The same height twice (the tip), then one further down.
+			for _, height := range []int{1009, 1005} {
+				err := c.Add(height, testBlock(height, 1))
+				if (err == nil) != (policy == "overwrite") {
+					t.Fatal("unexpected result of duplicate add", name, policy, height, err)
+				}
+				latest := 1009
+				version := byte(0)
+				if policy == "overwrite" {
+					latest = height
+					version = 1
+				}
+				block := c.Get(height)
+				if c.GetLatestHeight() != latest || block == nil || block.Hash[31] != version ||
+					!bytes.Equal(c.GetLatestHash(), testBlock(latest, version).Hash) {
+					t.Fatal("unexpected cache after duplicate add", name, policy, height)
+				}
+			}
+			if c.GetHeightByHash(testBlock(1006, 0).Hash) != map[string]int{"error": 1006, "overwrite": -1}[policy] {
+				t.Fatal("unexpected hash index after duplicate add", name, policy)
+			}
+			// A height below the first isn't a duplicate, whatever the
+			// policy (the file cache treats it as fatal).
+			if name == "memory" {
+				latest := c.GetLatestHeight()
+				if err := c.Add(999, testBlock(999, 1)); err == nil || strings.Contains(err.Error(), "already cached") ||
+					c.GetLatestHeight() != latest || c.Get(999) != nil {
+					t.Fatal("unexpected result of adding below the first height", policy, err)
+				}
+			}
+			c.Close()
+		}
+		// The file cache's blocks are as read back after a restart.
+		c := NewBlockCache(unitTestPath, unitTestChain, 1000, -1)
+		latest, version := 1009, byte(0)
+		if policy == "overwrite" {
+			latest, version = 1005, 1
+		}
+		if c.GetLatestHeight() != latest || c.Get(latest).Hash[31] != version || c.Get(1004).Hash[31] != 0 {
+			t.Fatal("unexpected cache after a restart", policy)
+		}
+		c.Close()
+	}
+}
+
+func TestCachePrime(t *testing.T) {
+	MemoryCacheBlocks = 8
+	defer func() { MemoryCacheBlocks = 4000 }()
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	for height := 1000; height < 1020; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	// After a restart, the memory tier starts out empty.
+	c = NewBlockCache(unitTestPath, unitTestChain, 1000, -1)
+	defer c.Close()
+	if c.mem.len() != 0 {
+		t.Fatal("unexpected blocks in memory after a restart", c.mem.len())
+	}
+	c.Prime(5)
+	if c.mem.len() != 5 {
+		t.Fatal("unexpected number of blocks in memory after priming", c.mem.len())
+	}
+	for height := 1015; height < 1020; height++ {
+		data := c.mem.get(height)
+		block := &walletrpc.CompactBlock{}
+		if data == nil || proto.Unmarshal(data, block) != nil || !bytes.Equal(block.Hash, testBlock(height, 0).Hash) {
+			t.Fatal("block not primed", height)
+		}
+	}
+	// No more than fit in memory.
+	c.Prime(100)
+	if c.mem.len() != 8 || c.mem.get(1012) == nil || c.mem.get(1011) != nil {
+		t.Fatal("unexpected blocks in memory after priming", c.mem.len())
+	}
+}
+
+func TestCacheGetShared(t *testing.T) {
+	MemoryCacheBlocks = 3
+	defer func() { MemoryCacheBlocks = 4000 }()
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	for height := 1000; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.GetShared(999) != nil || c.GetShared(1010) != nil {
+		t.Fatal("unexpected shared block outside the cache")
+	}
+	// The same block is returned each time, whether it starts in memory or
+	// (evicted) on disk.
+	for _, height := range []int{1009, 1000} {
+		shared := c.GetShared(height)
+		if shared == nil || !proto.Equal(shared, testBlock(height, 0)) {
+			t.Fatal("unexpected shared block at height", height)
+		}
+		if c.GetShared(height) != shared {
+			t.Fatal("shared block not reused at height", height)
+		}
+		// Get() still returns private copies, which callers may modify,
+		// without affecting the shared block.
+		block := c.Get(height)
+		if block == shared {
+			t.Fatal("Get returned the shared block")
+		}
+		block.Vtx[0].Outputs[0].Ciphertext = nil
+		block.Vtx = nil
+		if !proto.Equal(shared, testBlock(height, 0)) || !proto.Equal(c.Get(height), shared) {
+			t.Fatal("shared block was modified at height", height)
+		}
+	}
+
+	// After a reorg, the replaced block must not be shared.
+	shared := c.GetShared(1009)
+	c.Reorg(1009)
+	if c.GetShared(1009) != nil {
+		t.Fatal("block beyond the reorg height still shared")
+	}
+	if err := c.Add(1009, testBlock(1009, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if replaced := c.GetShared(1009); replaced == shared || !proto.Equal(replaced, testBlock(1009, 1)) {
+		t.Fatal("unexpected shared block after reorg")
+	}
+
+	// Peek reads a block that's not in memory without adding it (evicting
+	// another), and doesn't count as a use of one that is.
+	inMemory := func() map[int]bool {
+		heights := make(map[int]bool)
+		for height := range c.mem.entries {
+			heights[height] = true
+		}
+		return heights
+	}
+	c.mem = newBlockLRU(3, "lru")
+	for _, height := range []int{1007, 1008, 1009} {
+		c.GetShared(height)
+	}
+	before := inMemory()
+	for height := 1000; height < 1010; height++ {
+		version := byte(0)
+		if height == 1009 {
+			version = 1 // (since the reorg)
+		}
+		if !proto.Equal(c.Peek(height), testBlock(height, version)) {
+			t.Fatal("unexpected peeked block at height", height)
+		}
+	}
+	if after := inMemory(); len(after) != len(before) || !after[1007] || !after[1008] || !after[1009] ||
+		c.mem.order.Back().Value.(*lruEntry).height != 1007 {
+		t.Fatal("Peek changed the memory cache", before, after)
+	}
+
+	// Without the memory tier, each call returns a new copy.
+	c.Close()
+	os.RemoveAll(unitTestPath)
+	MemoryCacheBlocks = 0
+	c = NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	if err := c.Add(1000, testBlock(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if shared = c.GetShared(1000); shared == nil || shared == c.GetShared(1000) {
+		t.Fatal("unexpected shared block without the memory tier")
+	}
+	c.Close()
+	os.RemoveAll(unitTestPath)
+}
+
+// Serve the most recent 100 blocks (as wallets near the tip request them)
+// with and without the memory tier.
+func BenchmarkCacheGetTip(b *testing.B) {
+	for _, memBlocks := range []int{0, 4000} {
+		name := "disk"
+		if memBlocks > 0 {
+			name = "memory"
+		}
+		b.Run(name, func(b *testing.B) {
+			MemoryCacheBlocks = memBlocks
+			defer func() { MemoryCacheBlocks = 4000 }()
+			os.RemoveAll(unitTestPath)
+			c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+			for height := 1000; height < 2000; height++ {
+				if err := c.Add(height, testBlock(height, 0)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if c.Get(1900+i%100) == nil {
+					b.Fatal("Get failed")
+				}
+			}
+			b.StopTimer()
+			c.Close()
+			os.RemoveAll(unitTestPath)
+		})
+	}
+}
+
+// Compare the (per-request) allocations of Get() and GetShared() for hot
+// blocks; GetShared() should need none.
+func BenchmarkCacheGetShared(b *testing.B) {
+	for _, shared := range []bool{false, true} {
+		name := "Get"
+		get := (*BlockCache).Get
+		if shared {
+			name = "GetShared"
+			get = (*BlockCache).GetShared
+		}
+		b.Run(name, func(b *testing.B) {
+			os.RemoveAll(unitTestPath)
+			c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+			for height := 1000; height < 1100; height++ {
+				if err := c.Add(height, testBlock(height, 0)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if get(c, 1000+i%100) == nil {
+					b.Fatal("Get failed")
+				}
+			}
+			b.StopTimer()
+			c.Close()
+			os.RemoveAll(unitTestPath)
+		})
+	}
+}
+
+func TestCacheBufferedCrash(t *testing.T) {
+	// Commit only when asked to (by Sync()).
+	CacheFlushBlocks = 1000
+	CacheFlushInterval = time.Hour
+	defer func() {
+		CacheFlushBlocks = 100
+		CacheFlushInterval = time.Second
+	}()
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	for height := 1000; height < 1005; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Sync()
+	for height := 1005; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Blocks not yet committed to disk are still served.
+	for height := 1000; height < 1010; height++ {
+		block := c.Get(height)
+		if block == nil || !bytes.Equal(block.Hash, testBlock(height, 0).Hash) {
+			t.Fatal("unexpected block at height", height)
+		}
+	}
+
+	// Crash: the uncommitted block data reaches the disk, but not their lengths.
+	c.blocksWriter.Flush()
+	c.lengthsFile.Close()
+	c.blocksFile.Close()
+
+	c = NewBlockCache(unitTestPath, unitTestChain, 1000, -1)
+	if c.GetNextHeight() != 1005 {
+		t.Fatal("unexpected next height after crash", c.GetNextHeight())
+	}
+	if err := c.Add(1005, testBlock(1005, 1)); err != nil {
+		t.Fatal(err)
+	}
+	c.Sync()
+	for height := 1000; height < 1006; height++ {
+		version := byte(0)
+		if height == 1005 {
+			version = 1
+		}
+		block := c.Get(height)
+		if block == nil || !bytes.Equal(block.Hash, testBlock(height, version).Hash) {
+			t.Fatal("unexpected block after crash at height", height)
+		}
+	}
+	c.Close()
+	os.RemoveAll(unitTestPath)
+}
+
+// Add blocks (as the ingestor does during the initial sync), committing
+// each one or coalescing them.
+func BenchmarkCacheAdd(b *testing.B) {
+	for _, buffer := range []int{0, 1024 * 1024} {
+		name := "unbuffered"
+		if buffer > 0 {
+			name = "buffered"
+		}
+		b.Run(name, func(b *testing.B) {
+			CacheWriteBuffer = buffer
+			defer func() { CacheWriteBuffer = 1024 * 1024 }()
+			os.RemoveAll(unitTestPath)
+			c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+			block := testBlock(1000, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				block.Height = uint64(1000 + i)
+				if err := c.Add(1000+i, block); err != nil {
+					b.Fatal(err)
+				}
+			}
+			c.Sync()
+			b.StopTimer()
+			c.Close()
+			os.RemoveAll(unitTestPath)
+		})
+	}
+}
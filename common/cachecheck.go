@@ -0,0 +1,179 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// CacheCheckReport is the result of CheckCache().
+type CacheCheckReport struct {
+	Dir         string
+	Version     int // the format version, 0 if unknown
+	FirstHeight int
+	Blocks      int // the number of blocks checked
+	Compressed  int // of which this many are compressed
+	Problems    []string
+}
+
+// OK returns whether the cache has no problems.
+func (r *CacheCheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *CacheCheckReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// CheckCache verifies the db files in the given directory (laid out as
+// NewBlockCache's, for one chain), which must begin at firstHeight: the
+// header (format) version, that the lengths and blocks files agree, and
+// each block's checksum, height, and previous-block hash. Unlike
+// NewBlockCache(), it modifies nothing, and it continues after a bad
+// block (as far as the lengths allow), so that the report is complete.
+// It needs no connection to pirated.
+func CheckCache(dir string, firstHeight int) *CacheCheckReport {
+	r := &CacheCheckReport{Dir: dir, FirstHeight: firstHeight}
+	lengthsName := filepath.Join(dir, "lengths")
+	blocksName := filepath.Join(dir, "blocks")
+	for _, name := range []string{lengthsName, blocksName} {
+		if _, err := os.Stat(name); err != nil {
+			r.problem("%v", err)
+		}
+	}
+	if !r.OK() {
+		return r
+	}
+	version, err := readCacheVersion(dir)
+	if err != nil {
+		r.problem("%v", err)
+	} else if version < 1 || version > CacheFormatVersion {
+		r.problem("format version %d is not supported (this lightwalletd supports versions 1 to %d)",
+			version, CacheFormatVersion)
+	} else {
+		r.Version = version
+	}
+
+	lengths, err := ioutil.ReadFile(lengthsName)
+	if err != nil {
+		r.problem("%v", err)
+		return r
+	}
+	if len(lengths)%4 != 0 {
+		r.problem("%s has a partial entry (%d extra bytes)", lengthsName, len(lengths)%4)
+	}
+	blocksFile, err := os.Open(blocksName)
+	if err != nil {
+		r.problem("%v", err)
+		return r
+	}
+	defer blocksFile.Close()
+	fi, err := blocksFile.Stat()
+	if err != nil {
+		r.problem("%v", err)
+		return r
+	}
+
+	var offset int64
+	var prevHash []byte
+	for i := 0; i < len(lengths)/4; i++ {
+		height := firstHeight + i
+		length := binary.LittleEndian.Uint32(lengths[i*4 : (i+1)*4])
+		compressed := length&compressedLengthFlag != 0
+		length &^= compressedLengthFlag
+		if length == 0 || length > maxBlockLength || (compressed && r.Version > 0 && r.Version < 3) {
+			// The following blocks' offsets are unknown.
+			r.problem("height %d: impossible length %d in the lengths file", height, length)
+			return r
+		}
+		if offset+int64(length)+8 > fi.Size() {
+			r.problem("height %d: the blocks file is truncated (%d bytes, the lengths file needs %d)",
+				height, fi.Size(), offset+int64(length)+8)
+			return r
+		}
+		r.Blocks++
+		if compressed {
+			r.Compressed++
+		}
+		b := make([]byte, int(length)+8)
+		if _, err := blocksFile.ReadAt(b, offset); err != nil {
+			r.problem("height %d: %v", height, err)
+			return r
+		}
+		offset += int64(length) + 8
+		block, err := checkCacheBlock(height, b, compressed)
+		if err != nil {
+			if i == 0 {
+				if first := storedBlockHeight(b, compressed); first >= 0 && first != firstHeight {
+					r.problem("the cache begins at height %d, not %d (is it for another network?)",
+						first, firstHeight)
+					return r
+				}
+			}
+			r.problem("height %d: %v", height, err)
+			prevHash = nil
+			continue
+		}
+		if prevHash != nil && !bytes.Equal(block.PrevHash, prevHash) {
+			r.problem("height %d: the previous-block hash doesn't match the block at height %d",
+				height, height-1)
+		}
+		prevHash = block.Hash
+	}
+	if offset < fi.Size() {
+		r.problem("the blocks file has %d bytes after the last block", fi.Size()-offset)
+	}
+	return r
+}
+
+// checkCacheBlock verifies and decodes a block as stored in the blocks
+// file (with its checksum), which should be at the given height.
+func checkCacheBlock(height int, b []byte, compressed bool) (*walletrpc.CompactBlock, error) {
+	diskcs, b := b[:8], b[8:]
+	if !bytes.Equal(checksum(height, b), diskcs) {
+		return nil, errors.New("bad checksum")
+	}
+	if compressed {
+		var err error
+		if b, err = decompressBlock(b); err != nil {
+			return nil, fmt.Errorf("can't decompress: %v", err)
+		}
+	}
+	block := &walletrpc.CompactBlock{}
+	if err := proto.Unmarshal(b, block); err != nil {
+		return nil, fmt.Errorf("can't unmarshal: %v", err)
+	}
+	if int(block.Height) != height {
+		return nil, fmt.Errorf("the block is for height %d", block.Height)
+	}
+	return block, nil
+}
+
+// storedBlockHeight returns the height of a block as stored in the blocks
+// file, without verifying its checksum, or -1 if it can't be decoded.
+func storedBlockHeight(b []byte, compressed bool) int {
+	b = b[8:]
+	if compressed {
+		var err error
+		if b, err = decompressBlock(b); err != nil {
+			return -1
+		}
+	}
+	block := &walletrpc.CompactBlock{}
+	if err := proto.Unmarshal(b, block); err != nil {
+		return -1
+	}
+	return int(block.Height)
+}
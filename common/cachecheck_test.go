@@ -0,0 +1,121 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckCache(t *testing.T) {
+	testT = t
+	defer os.RemoveAll(unitTestPath)
+	dir := filepath.Join(unitTestPath, unitTestChain)
+	lengthsName, blocksName := dbFileNames(unitTestPath, unitTestChain)
+	// newCache writes a cache of 10 blocks from height 1000; the block at
+	// breakAt (if any) doesn't link to the one before it.
+	newCache := func(compression, breakAt int) {
+		os.RemoveAll(unitTestPath)
+		CacheCompressionLevel = compression
+		defer func() { CacheCompressionLevel = 0 }()
+		c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+		var prevHash []byte
+		for height := 1000; height < 1010; height++ {
+			block := testBlock(height, 0)
+			block.PrevHash = prevHash
+			if height == breakAt {
+				block.PrevHash = testBlock(height-1, 1).Hash
+			}
+			if err := c.Add(height, block); err != nil {
+				t.Fatal(err)
+			}
+			prevHash = block.Hash
+		}
+		c.Sync()
+		c.Close()
+	}
+	// expectProblem checks for exactly one problem, containing the given text.
+	expectProblem := func(r *CacheCheckReport, text string) {
+		t.Helper()
+		if r.OK() || len(r.Problems) != 1 || !strings.Contains(r.Problems[0], text) {
+			t.Fatalf("expected a problem containing %q, got %q", text, r.Problems)
+		}
+	}
+	modify := func(name string, f func(b []byte) []byte) {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, f(b), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Healthy caches, with and without compression.
+	for _, compression := range []int{0, 6} {
+		newCache(compression, 0)
+		r := CheckCache(dir, 1000)
+		if !r.OK() || r.Version != CacheFormatVersion || r.Blocks != 10 {
+			t.Fatal("unexpected report for a healthy cache", compression, r)
+		}
+		if (compression == 0) != (r.Compressed == 0) {
+			t.Fatal("unexpected number of compressed blocks", compression, r.Compressed)
+		}
+	}
+
+	// The cache is for another network (it begins at another height).
+	expectProblem(CheckCache(dir, 2000), "begins at height 1000, not 2000")
+
+	// A corrupted block; the rest are still checked.
+	newCache(0, 0)
+	modify(blocksName, func(b []byte) []byte {
+		b[len(b)/2] ^= 0xff
+		return b
+	})
+	if r := CheckCache(dir, 1000); r.Blocks != 10 {
+		t.Fatal("not all blocks checked", r.Blocks)
+	} else {
+		expectProblem(r, "bad checksum")
+	}
+
+	// A block that doesn't link to the one before it.
+	newCache(0, 1005)
+	expectProblem(CheckCache(dir, 1000), "height 1005: the previous-block hash doesn't match")
+
+	// The blocks file is truncated, or has extra bytes.
+	newCache(0, 0)
+	modify(blocksName, func(b []byte) []byte { return b[:len(b)-10] })
+	expectProblem(CheckCache(dir, 1000), "height 1009: the blocks file is truncated")
+	newCache(0, 0)
+	modify(blocksName, func(b []byte) []byte { return append(b, 1, 2, 3) })
+	expectProblem(CheckCache(dir, 1000), "3 bytes after the last block")
+
+	// The lengths file has a partial entry, or an impossible length.
+	newCache(0, 0)
+	modify(lengthsName, func(b []byte) []byte { return append(b, 0) })
+	expectProblem(CheckCache(dir, 1000), "partial entry")
+	newCache(0, 0)
+	modify(lengthsName, func(b []byte) []byte {
+		copy(b[8:12], []byte{0, 0, 0, 0})
+		return b
+	})
+	expectProblem(CheckCache(dir, 1000), "height 1002: impossible length 0")
+
+	// The header is for an unknown format version.
+	newCache(0, 0)
+	if err := writeCacheVersion(dir, CacheFormatVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	expectProblem(CheckCache(dir, 1000), "is not supported")
+
+	// There's no cache.
+	os.RemoveAll(unitTestPath)
+	if r := CheckCache(dir, 1000); r.OK() || len(r.Problems) != 2 {
+		t.Fatal("unexpected report for a missing cache", r.Problems)
+	}
+}
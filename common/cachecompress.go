@@ -0,0 +1,81 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// CacheCompressionLevel, if not zero, is the flate (deflate) level, 1 (the
+// fastest) to 9 (the smallest), at which blocks added to the cache are
+// compressed in the db files; a block that doesn't get smaller is stored as
+// it is. Blocks are decompressed as they're read, and the memory tier holds
+// them decompressed. A cache may have both kinds of blocks, so the level
+// can be changed (or compression disabled) at any time. It must be set
+// before NewBlockCache() is called.
+var CacheCompressionLevel int
+
+// compressedLengthFlag is set in a block's lengths-file entry if the block
+// is compressed (format version 3); lengths are otherwise under 4 MB.
+const compressedLengthFlag = 1 << 31
+
+// maxBlockLength limits a (decompressed) block, as NewBlockCache() does.
+const maxBlockLength = 4 * 1000 * 1000
+
+// blockCompressors holds a pool of flate writers for each level, since a
+// writer's level is fixed when it's created.
+var blockCompressors [flate.BestCompression + 1]sync.Pool
+
+func getBlockCompressor(level int) *flate.Writer {
+	if w, ok := blockCompressors[level].Get().(*flate.Writer); ok {
+		return w
+	}
+	w, err := flate.NewWriter(nil, level)
+	if err != nil {
+		Log.Fatal("cache compression level ", level, ": ", err)
+	}
+	return w
+}
+
+// compressBlock returns the compressed (marshalled) block, or nil if
+// compression is disabled or wouldn't make it smaller.
+func compressBlock(data []byte) []byte {
+	level := CacheCompressionLevel
+	if level == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	w := getBlockCompressor(level)
+	defer blockCompressors[level].Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil
+	}
+	if err := w.Close(); err != nil || buf.Len() >= len(data) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// decompressBlock returns the (marshalled) block that compressBlock()
+// compressed.
+func decompressBlock(compressed []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxBlockLength+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBlockLength {
+		return nil, errors.New("decompressed block is too long")
+	}
+	return data, nil
+}
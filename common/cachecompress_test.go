@@ -0,0 +1,167 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestCacheCompression(t *testing.T) {
+	for _, buffer := range []int{0, 1024 * 1024} {
+		CacheWriteBuffer = buffer
+		os.RemoveAll(unitTestPath)
+		CacheCompressionLevel = 6
+		c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+		for height := 380640; height < 380645; height++ {
+			if err := c.Add(height, testBlock(height, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Compression can be disabled (or enabled) for later blocks.
+		CacheCompressionLevel = 0
+		for height := 380645; height < 380650; height++ {
+			if err := c.Add(height, testBlock(height, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for height := 380640; height < 380650; height++ {
+			if c.compressed[height-380640] != (height < 380645) {
+				t.Fatal("unexpected compression", buffer, height)
+			}
+			// testBlock()'s blocks are mostly zeros.
+			if length := c.blockLength(height); (length < proto.Size(testBlock(height, 0))/2) != (height < 380645) {
+				t.Fatal("unexpected stored length", buffer, height, length)
+			}
+			if !proto.Equal(c.Get(height), testBlock(height, 0)) {
+				t.Fatal("unexpected block", buffer, height)
+			}
+		}
+		c.Close()
+
+		// The blocks are decompressed from disk, not the memory tier.
+		MemoryCacheBlocks = 0
+		c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+		if c.GetNextHeight() != 380650 {
+			t.Fatal("unexpected next height after reopening", buffer, c.GetNextHeight())
+		}
+		for height := 380640; height < 380650; height++ {
+			if !proto.Equal(c.Get(height), testBlock(height, 0)) {
+				t.Fatal("unexpected block after reopening", buffer, height)
+			}
+		}
+		c.Reorg(380643)
+		if c.GetNextHeight() != 380643 || !proto.Equal(c.Get(380642), testBlock(380642, 0)) {
+			t.Fatal("unexpected cache after reorg", buffer, c.GetNextHeight())
+		}
+		c.Close()
+
+		// A frozen cache can also have compressed blocks.
+		frozen, err := OpenFrozenBlockCache(unitTestPath, unitTestChain, 380640)
+		if err != nil || frozen.GetNextHeight() != 380643 || !proto.Equal(frozen.Get(380641), testBlock(380641, 0)) {
+			t.Fatal("unexpected frozen cache", buffer, err)
+		}
+		frozen.Close()
+		MemoryCacheBlocks = 4000
+	}
+	CacheWriteBuffer = 1024 * 1024
+	os.RemoveAll(unitTestPath)
+}
+
+// The pooled compressors use the level in effect for each block.
+func TestCacheCompressionLevels(t *testing.T) {
+	defer func() { CacheCompressionLevel = 0 }()
+	var data []byte
+	for _, block := range testCompactBlocks(t) {
+		b, err := proto.Marshal(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+	}
+	for _, level := range []int{1, 9, 1, 6} {
+		CacheCompressionLevel = level
+		var want bytes.Buffer
+		w, _ := flate.NewWriter(&want, level)
+		w.Write(data)
+		w.Close()
+		if !bytes.Equal(compressBlock(data), want.Bytes()) {
+			t.Fatal("block not compressed at level", level)
+		}
+	}
+}
+
+// testCompactBlocks returns the (real) blocks in compact_blocks.json.
+func testCompactBlocks(tb testing.TB) []*walletrpc.CompactBlock {
+	var compactTests []struct {
+		Full string `json:"full"`
+	}
+	blockJSON, err := ioutil.ReadFile("../testdata/compact_blocks.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := json.Unmarshal(blockJSON, &compactTests); err != nil {
+		tb.Fatal(err)
+	}
+	var blocks []*walletrpc.CompactBlock
+	for _, test := range compactTests {
+		blockData, _ := hex.DecodeString(test.Full)
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockData); err != nil {
+			tb.Fatal(err)
+		}
+		blocks = append(blocks, block.ToCompact())
+	}
+	return blocks
+}
+
+// Compare the disk space (reported as disk-bytes/block) and the latency of
+// reading blocks from disk (without the memory tier) at each compression
+// level, with the blocks in compact_blocks.json (repeated, at consecutive
+// heights). Compact blocks are mostly hashes, keys and ciphertexts, so
+// these (small) ones don't get smaller, and are stored uncompressed.
+func BenchmarkCacheCompression(b *testing.B) {
+	blocks := testCompactBlocks(b)
+	for _, level := range []int{0, 1, 6, 9} {
+		b.Run(fmt.Sprintf("level%d", level), func(b *testing.B) {
+			CacheCompressionLevel = level
+			MemoryCacheBlocks = 0
+			defer func() {
+				CacheCompressionLevel = 0
+				MemoryCacheBlocks = 4000
+			}()
+			os.RemoveAll(unitTestPath)
+			c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+			for height := 1000; height < 2000; height++ {
+				block := proto.Clone(blocks[height%len(blocks)]).(*walletrpc.CompactBlock)
+				block.Height = uint64(height)
+				if err := c.Add(height, block); err != nil {
+					b.Fatal(err)
+				}
+			}
+			c.Sync()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if c.Get(1000+i%1000) == nil {
+					b.Fatal("Get failed")
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(c.starts[len(c.starts)-1])/1000, "disk-bytes/block")
+			c.Close()
+			os.RemoveAll(unitTestPath)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// testCacheContract checks the behavior every Cache must have, given an
+// empty one whose first height is 380640.
+func testCacheContract(t *testing.T, c Cache) {
+	if c.GetFirstHeight() != 380640 || c.GetNextHeight() != 380640 || c.GetLatestHeight() != -1 || c.Len() != 0 {
+		t.Fatal("unexpected heights of an empty cache", c.GetFirstHeight(), c.GetNextHeight(), c.GetLatestHeight(), c.Len())
+	}
+	if height, hash := c.GetLatestHeightHash(); height != -1 || hash != nil || c.GetLatestHash() != nil {
+		t.Fatal("unexpected latest block of an empty cache", height, hash)
+	}
+	if c.Get(380640) != nil || c.GetShared(380640) != nil || c.Peek(380640) != nil ||
+		c.GetLiteWalletBlockGroup(380640) != nil {
+		t.Fatal("unexpected block in an empty cache")
+	}
+	if !c.HashMatch([]byte{1}) {
+		t.Fatal("any block extends an empty cache")
+	}
+	if c.GetHeightByHash(testBlock(380640, 0).Hash) != -1 {
+		t.Fatal("unexpected block by hash in an empty cache")
+	}
+
+	for height := 380640; height < 380650; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A height beyond the next one is ignored.
+	if err := c.Add(380660, testBlock(380660, 0)); err != nil || c.GetNextHeight() != 380650 {
+		t.Fatal("unexpected add beyond the next height", err, c.GetNextHeight())
+	}
+	if c.GetNextHeight() != 380650 || c.GetLatestHeight() != 380649 || c.Len() != 10 {
+		t.Fatal("unexpected heights", c.GetNextHeight(), c.GetLatestHeight(), c.Len())
+	}
+	tip := testBlock(380649, 0)
+	if height, hash := c.GetLatestHeightHash(); height != 380649 || !bytes.Equal(hash, tip.Hash) ||
+		!bytes.Equal(c.GetLatestHash(), tip.Hash) {
+		t.Fatal("unexpected latest block", height, hash)
+	}
+	if !c.HashMatch(tip.Hash) || c.HashMatch(testBlock(380648, 0).Hash) {
+		t.Fatal("unexpected HashMatch")
+	}
+	for height := 380640; height < 380650; height++ {
+		if !proto.Equal(c.Get(height), testBlock(height, 0)) || !proto.Equal(c.GetShared(height), testBlock(height, 0)) ||
+			!proto.Equal(c.Peek(height), testBlock(height, 0)) {
+			t.Fatal("unexpected block", height)
+		}
+	}
+	if c.Get(380639) != nil || c.Get(380650) != nil || c.GetShared(380650) != nil || c.Peek(380650) != nil {
+		t.Fatal("unexpected block outside the cache")
+	}
+	for height := 380640; height < 380650; height++ {
+		if c.GetHeightByHash(testBlock(height, 0).Hash) != height {
+			t.Fatal("unexpected height by hash", height)
+		}
+	}
+	if c.GetHeightByHash(testBlock(380645, 1).Hash) != -1 || c.GetHeightByHash([]byte{1}) != -1 {
+		t.Fatal("unexpected height of an unknown hash")
+	}
+	// Get returns the caller's own copy.
+	c.Get(380645).Vtx[0].Index = 99
+	if c.Get(380645).Vtx[0].Index != 0 || c.GetShared(380645).Vtx[0].Index != 0 {
+		t.Fatal("cached block was modified")
+	}
+	// These blocks are small, so a group is all the rest of them.
+	if group := c.GetLiteWalletBlockGroup(380642); group == nil || group.Height != 380649 {
+		t.Fatal("unexpected block group", group)
+	}
+
+	c.Reorg(380645)
+	if c.GetNextHeight() != 380645 || c.Len() != 5 || !bytes.Equal(c.GetLatestHash(), testBlock(380644, 0).Hash) ||
+		c.Get(380645) != nil || c.GetHeightByHash(testBlock(380645, 0).Hash) != -1 ||
+		c.GetHeightByHash(testBlock(380644, 0).Hash) != 380644 {
+		t.Fatal("unexpected cache after reorg", c.GetNextHeight())
+	}
+	// A reorg beyond the cache does nothing.
+	c.Reorg(380700)
+	if c.GetNextHeight() != 380645 {
+		t.Fatal("unexpected cache after reorg beyond it", c.GetNextHeight())
+	}
+	// Replacement blocks can then be added.
+	if err := c.Add(380645, testBlock(380645, 1)); err != nil {
+		t.Fatal(err)
+	}
+	c.Sync()
+	if !proto.Equal(c.Get(380645), testBlock(380645, 1)) || !c.HashMatch(testBlock(380645, 1).Hash) ||
+		c.GetHeightByHash(testBlock(380645, 1).Hash) != 380645 {
+		t.Fatal("unexpected replacement block")
+	}
+	// A reorg below the first height empties the cache.
+	c.Reorg(0)
+	if c.GetNextHeight() != 380640 || c.GetLatestHeight() != -1 || c.GetLatestHash() != nil || c.Len() != 0 {
+		t.Fatal("unexpected cache after reorg below it", c.GetNextHeight())
+	}
+}
+
+func TestCacheContract(t *testing.T) {
+	t.Run("BlockCache", func(t *testing.T) {
+		os.RemoveAll(unitTestPath)
+		defer os.RemoveAll(unitTestPath)
+		c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+		defer c.Close()
+		testCacheContract(t, c)
+	})
+	t.Run("MemoryBlockCache", func(t *testing.T) {
+		c := NewMemoryBlockCache(380640)
+		defer c.Close()
+		testCacheContract(t, c)
+	})
+}
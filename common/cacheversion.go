@@ -0,0 +1,104 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CacheFormatVersion is the version of the db files format that this
+// lightwalletd writes. Version 1 is the original format, which has no
+// header (version) file; version 2 adds the header, and is otherwise the
+// same as version 1; version 3 allows compressed blocks (see
+// CacheCompressionLevel), flagged in their lengths-file entries.
+const CacheFormatVersion = 3
+
+// The header file holds this magic followed by the (uint32, little-endian)
+// format version.
+var cacheHeaderMagic = []byte("lwdcache")
+
+// cacheMigrations[i] migrates the db files in the given directory from
+// format version i+1 to version i+2, in place.
+var cacheMigrations = []func(dir string) error{
+	// 1 -> 2: nothing to change but the header, which the caller writes.
+	func(dir string) error { return nil },
+	// 2 -> 3: nothing to change; the existing blocks aren't compressed.
+	func(dir string) error { return nil },
+}
+
+func cacheHeaderName(dir string) string {
+	return filepath.Join(dir, "version")
+}
+
+// readCacheVersion returns the format version of the db files in the given
+// directory. An empty (new) cache is in the current format.
+func readCacheVersion(dir string) (int, error) {
+	header, err := ioutil.ReadFile(cacheHeaderName(dir))
+	if os.IsNotExist(err) {
+		lengthsName := filepath.Join(dir, "lengths")
+		if fi, err := os.Stat(lengthsName); err == nil && fi.Size() > 0 {
+			return 1, nil
+		}
+		return CacheFormatVersion, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(header) != len(cacheHeaderMagic)+4 || !bytes.HasPrefix(header, cacheHeaderMagic) {
+		return 0, errors.New("invalid cache header " + cacheHeaderName(dir))
+	}
+	return int(binary.LittleEndian.Uint32(header[len(cacheHeaderMagic):])), nil
+}
+
+// writeCacheVersion (atomically) writes the header file with the given
+// format version.
+func writeCacheVersion(dir string, version int) error {
+	header := make([]byte, len(cacheHeaderMagic)+4)
+	copy(header, cacheHeaderMagic)
+	binary.LittleEndian.PutUint32(header[len(cacheHeaderMagic):], uint32(version))
+	tmpName := cacheHeaderName(dir) + ".tmp"
+	if err := ioutil.WriteFile(tmpName, header, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, cacheHeaderName(dir))
+}
+
+// migrateCache brings the db files in the given directory to the current
+// format version, one version at a time, so that a cache written by an
+// older lightwalletd needn't be downloaded again. A cache written by a
+// newer lightwalletd (in a format we don't know) is an error.
+func migrateCache(dir string) error {
+	version, err := readCacheVersion(dir)
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > CacheFormatVersion {
+		return fmt.Errorf("cache %s has format version %d, but this lightwalletd supports versions 1 to %d; "+
+			"upgrade lightwalletd, or remove the cache to download it again",
+			dir, version, CacheFormatVersion)
+	}
+	for ; version < CacheFormatVersion; version++ {
+		Log.Info("Migrating cache ", dir, " from format version ", version, " to ", version+1)
+		if err := cacheMigrations[version-1](dir); err != nil {
+			return fmt.Errorf("cache migration from version %d failed: %v", version, err)
+		}
+		// Record each step, so that an interrupted migration resumes
+		// where it left off.
+		if err := writeCacheVersion(dir, version+1); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(cacheHeaderName(dir)); os.IsNotExist(err) {
+		return writeCacheVersion(dir, CacheFormatVersion)
+	}
+	return nil
+}
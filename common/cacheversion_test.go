@@ -0,0 +1,67 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheMigration(t *testing.T) {
+	dir := filepath.Join(unitTestPath, unitTestChain)
+
+	// Write a version 1 (headerless) cache.
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	for height := 1000; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+	if version, err := readCacheVersion(dir); err != nil || version != CacheFormatVersion {
+		t.Fatal("new cache not in the current format", version, err)
+	}
+	os.Remove(cacheHeaderName(dir))
+	if version, err := readCacheVersion(dir); err != nil || version != 1 {
+		t.Fatal("unexpected version of headerless cache", version, err)
+	}
+
+	// Opening it migrates it, keeping its blocks.
+	c = NewBlockCache(unitTestPath, unitTestChain, 1000, -1)
+	if version, err := readCacheVersion(dir); err != nil || version != CacheFormatVersion {
+		t.Fatal("cache not migrated", version, err)
+	}
+	if c.GetNextHeight() != 1010 {
+		t.Fatal("blocks lost by migration", c.GetNextHeight())
+	}
+	for height := 1000; height < 1010; height++ {
+		block := c.Get(height)
+		if block == nil || !bytes.Equal(block.Hash, testBlock(height, 0).Hash) {
+			t.Fatal("unexpected block after migration at height", height)
+		}
+	}
+	c.Close()
+
+	// A cache from a newer lightwalletd can't be used.
+	if err := writeCacheVersion(dir, CacheFormatVersion+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateCache(dir); err == nil || !strings.Contains(err.Error(), "format version 4") {
+		t.Fatal("expected a format version error", err)
+	}
+	// Nor can one with a damaged header.
+	if err := ioutil.WriteFile(cacheHeaderName(dir), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateCache(dir); err == nil {
+		t.Fatal("expected an invalid header error")
+	}
+	os.RemoveAll(unitTestPath)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// TxOutSetCacheTTL is how long a gettxoutsetinfo result is reused; this rpc
+// scans the entire utxo set, so it's too expensive to make on every request.
+var TxOutSetCacheTTL = 10 * time.Minute
+
+var txOutSetCache struct {
+	mutex     sync.Mutex
+	reply     *PiratedRpcReplyGettxoutsetinfo
+	fetchedAt time.Time
+}
+
+// getTxOutSetInfo returns the (possibly cached) gettxoutsetinfo reply.
+func getTxOutSetInfo() (*PiratedRpcReplyGettxoutsetinfo, error) {
+	txOutSetCache.mutex.Lock()
+	defer txOutSetCache.mutex.Unlock()
+	if txOutSetCache.reply != nil && Time.Now().Sub(txOutSetCache.fetchedAt) < TxOutSetCacheTTL {
+		return txOutSetCache.reply, nil
+	}
+	result, rpcErr := RawRequest("gettxoutsetinfo", []json.RawMessage{})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	reply := &PiratedRpcReplyGettxoutsetinfo{}
+	if err := json.Unmarshal(result, reply); err != nil {
+		return nil, err
+	}
+	txOutSetCache.reply = reply
+	txOutSetCache.fetchedAt = Time.Now()
+	return reply, nil
+}
+
+// GetChainStats returns chain-level statistics from getblockchaininfo and,
+// where available, getchaintxstats and gettxoutsetinfo.
+func GetChainStats() (*walletrpc.ChainStats, error) {
+	result, rpcErr := RawRequest("getblockchaininfo", []json.RawMessage{})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var getblockchaininfoReply PiratedRpcReplyGetblockchaininfo
+	err := json.Unmarshal(result, &getblockchaininfoReply)
+	if err != nil {
+		return nil, err
+	}
+	stats := &walletrpc.ChainStats{
+		Height:     uint64(getblockchaininfoReply.Blocks),
+		Difficulty: getblockchaininfoReply.Difficulty,
+	}
+	// The number of transactions in the chain (gettxoutsetinfo's counts
+	// only those with unspent outputs).
+	result, rpcErr = RawRequest("getchaintxstats", []json.RawMessage{})
+	if rpcErr != nil {
+		Log.Warning("getchaintxstats failed: ", rpcErr)
+	} else {
+		var getchaintxstatsReply PiratedRpcReplyGetchaintxstats
+		if err := json.Unmarshal(result, &getchaintxstatsReply); err != nil {
+			return nil, err
+		}
+		stats.Transactions = getchaintxstatsReply.Txcount
+	}
+	txOutSetInfo, err := getTxOutSetInfo()
+	if err != nil {
+		// Not all pirated configurations can serve this, return what we have.
+		Log.Warning("gettxoutsetinfo failed: ", err)
+		return stats, nil
+	}
+	stats.CoinSupplyZat = int64(math.Round(txOutSetInfo.TotalAmount * 1e8))
+	return stats, nil
+}
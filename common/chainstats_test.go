@@ -0,0 +1,87 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	txOutSetInfoCalls int
+	txOutSetInfoFails bool
+	chainTxStatsFails bool
+)
+
+func chainStatsStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	switch method {
+	case "getblockchaininfo":
+		return []byte(`{"chain":"main","blocks":1234567,"difficulty":98765.25}`), nil
+	case "getchaintxstats":
+		if chainTxStatsFails {
+			return nil, errors.New("-8: Invalid block count")
+		}
+		return []byte(`{"time":1600000000,"txcount":87654,"window_final_block_hash":"00aa"}`), nil
+	case "gettxoutsetinfo":
+		txOutSetInfoCalls++
+		if txOutSetInfoFails {
+			return nil, errors.New("-1: gettxoutsetinfo not available")
+		}
+		return []byte(`{"height":1234567,"transactions":4321,"total_amount":12345.6789}`), nil
+	}
+	testT.Fatal("unexpected method", method)
+	return nil, nil
+}
+
+func TestGetChainStats(t *testing.T) {
+	testT = t
+	RawRequest = chainStatsStub
+	Time.Now = nowStub
+
+	for i := 0; i < 2; i++ {
+		stats, err := GetChainStats()
+		if err != nil {
+			t.Fatal("GetChainStats failed:", err)
+		}
+		if stats.Height != 1234567 || stats.Difficulty != 98765.25 {
+			t.Fatal("GetChainStats unexpected chain info", stats)
+		}
+		if stats.Transactions != 87654 || stats.CoinSupplyZat != 1234567890000 {
+			t.Fatal("GetChainStats unexpected utxo set info", stats)
+		}
+	}
+	// the second call should have used the cached gettxoutsetinfo reply
+	if txOutSetInfoCalls != 1 {
+		t.Fatal("unexpected gettxoutsetinfo calls", txOutSetInfoCalls)
+	}
+
+	// Once the cache expires, a failing gettxoutsetinfo leaves the coin
+	// supply zero, and a failing getchaintxstats the transactions.
+	sleepDuration += TxOutSetCacheTTL + time.Second
+	txOutSetInfoFails = true
+	stats, err := GetChainStats()
+	if err != nil {
+		t.Fatal("GetChainStats failed:", err)
+	}
+	if txOutSetInfoCalls != 2 {
+		t.Fatal("unexpected gettxoutsetinfo calls", txOutSetInfoCalls)
+	}
+	if stats.Height != 1234567 || stats.Transactions != 87654 || stats.CoinSupplyZat != 0 {
+		t.Fatal("GetChainStats unexpected stats", stats)
+	}
+	chainTxStatsFails = true
+	stats, err = GetChainStats()
+	if err != nil || stats.Height != 1234567 || stats.Transactions != 0 {
+		t.Fatal("GetChainStats unexpected stats", stats, err)
+	}
+
+	txOutSetCache.reply = nil
+	txOutSetInfoFails = false
+	chainTxStatsFails = false
+	txOutSetInfoCalls = 0
+	sleepDuration = 0
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// The clean shutdown marker is a file, next to the cache's header (version)
+// file, that exists only while the cache isn't in use and was last closed
+// cleanly: it's removed when the cache is opened, and written (by
+// MarkCleanShutdown) on a graceful stop, unless the blocks written before
+// an earlier crash couldn't be verified (see VerifyTail). Its absence at
+// startup means the last blocks written before a crash may not have
+// reached the disk intact.
+func cleanShutdownName(dir string) string {
+	return filepath.Join(dir, "clean-shutdown")
+}
+
+// openCleanShutdown removes the clean shutdown marker from the given
+// cache directory, and reports whether it was there.
+func openCleanShutdown(dir string) bool {
+	err := os.Remove(cleanShutdownName(dir))
+	if err != nil && !os.IsNotExist(err) {
+		// It would be there again at the next startup, even after a crash.
+		Log.Fatal("remove ", cleanShutdownName(dir), " failed: ", err)
+	}
+	return err == nil
+}
+
+// CleanShutdown reports whether the cache was closed cleanly (see
+// MarkCleanShutdown) the last time it was used, so its blocks can be
+// trusted without checking them against pirated.
+func (c *BlockCache) CleanShutdown() bool {
+	return c.cleanShutdown
+}
+
+// MarkCleanShutdown commits all blocks to disk and records that the cache
+// was closed cleanly; nothing may be added to the cache after this. If
+// VerifyTail couldn't verify the tail, nothing is recorded, so it's
+// verified at the next startup.
+func (c *BlockCache) MarkCleanShutdown() error {
+	c.Sync()
+	if c.unverified {
+		Log.Warning("Cache tail not verified, not marking the cache as shut down cleanly")
+		return nil
+	}
+	dir := filepath.Dir(c.lengthsName)
+	return ioutil.WriteFile(cleanShutdownName(dir), nil, 0644)
+}
+
+// VerifyTail compares the last n blocks in the cache with pirated's (after
+// a crash), and discards the first that differs (or that pirated no longer
+// has), and all blocks after it; the block ingestor will download them
+// again. If a block can't be fetched, the rest can't be verified, and are
+// kept (and verified at the next startup, see MarkCleanShutdown). It
+// returns the number of blocks discarded.
+func (c *BlockCache) VerifyTail(n int) int {
+	next := c.GetNextHeight()
+	height := next - n
+	if height < c.GetFirstHeight() {
+		height = c.GetFirstHeight()
+	}
+	if height >= next {
+		return 0
+	}
+	Log.Info("Cache was not shut down cleanly, verifying blocks ", height, " to ", next-1)
+	for ; height < next; height++ {
+		block, err := getBlockFromRPC(context.Background(), height)
+		if err != nil {
+			Log.Warning("couldn't fetch block ", height, " to verify the cache, blocks ",
+				height, " to ", next-1, " not verified: ", err)
+			c.unverified = true
+			return 0
+		}
+		if block == nil || !sameCompactBlock(block, c.Get(height)) {
+			Log.Warning("cached block ", height, " differs from pirated's")
+			break
+		}
+	}
+	c.unverified = false
+	if height < next {
+		c.Reorg(height)
+		Log.Warning("Discarded cached blocks ", height, " to ", next-1)
+	}
+	return next - height
+}
+
+// sameCompactBlock reports whether the two compact blocks are the same,
+// other than their coinbase markers, which depend on whether --coinbase-markers
+// was set when each was made, and their chain metadata if either lacks it
+// (as blocks cached before pirated provided it do).
+func sameCompactBlock(a, b *walletrpc.CompactBlock) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	noMetadata := a.ChainMetadata == nil || b.ChainMetadata == nil
+	unmarked := func(block *walletrpc.CompactBlock) *walletrpc.CompactBlock {
+		block = proto.Clone(block).(*walletrpc.CompactBlock)
+		for _, tx := range block.Vtx {
+			tx.Coinbase = false
+		}
+		if noMetadata {
+			block.ChainMetadata = nil
+		}
+		return block
+	}
+	return proto.Equal(unmarked(a), unmarked(b))
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+func TestCleanShutdown(t *testing.T) {
+	testT = t
+	RawRequest = blockIngestorBatchStub
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+	if c.CleanShutdown() {
+		t.Fatal("a new cache should not have been shut down cleanly")
+	}
+	for height := 380640; height < 380644; height++ {
+		block, err := getBlockFromRPC(context.Background(), height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height == 380643 {
+			// As if this block hadn't reached the disk intact.
+			block.Time++
+		}
+		if err := c.Add(height, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.MarkCleanShutdown(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// The marker is cleared at startup, so only the first reopening
+	// finds it.
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	if !c.CleanShutdown() {
+		t.Fatal("clean shutdown not detected")
+	}
+	c.Close()
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	defer func() { c.Close() }()
+	if c.CleanShutdown() {
+		t.Fatal("crash not detected")
+	}
+
+	// If pirated can't be reached, the tail can't be verified, and is kept.
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("connection refused")
+	}
+	if discarded := c.VerifyTail(2); discarded != 0 || c.GetNextHeight() != 380644 {
+		t.Fatal("unverified blocks discarded", discarded)
+	}
+	RawRequest = blockIngestorBatchStub
+	// They're verified at the next startup, even after a graceful stop.
+	if err := c.MarkCleanShutdown(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	if c.CleanShutdown() {
+		t.Fatal("unverified tail trusted after a restart")
+	}
+
+	// After the crash, the tail is compared with pirated's blocks, and
+	// discarded from the first that differs.
+	atomic.StoreInt32(&batchRequests, 0)
+	defer atomic.StoreInt32(&batchRequests, 0)
+	if discarded := c.VerifyTail(2); discarded != 1 {
+		t.Fatal("unexpected number of blocks discarded", discarded)
+	}
+	if c.GetNextHeight() != 380643 || c.Get(380642) == nil {
+		t.Fatal("unexpected cache after verification", c.GetNextHeight())
+	}
+	// Two getblock rpcs for each of the two blocks.
+	if n := atomic.LoadInt32(&batchRequests); n != 4 {
+		t.Fatal("unexpected getblock requests", n)
+	}
+	if discarded := c.VerifyTail(10); discarded != 0 {
+		t.Fatal("unexpected number of blocks discarded", discarded)
+	}
+	// Now a graceful stop is recorded.
+	if err := c.MarkCleanShutdown(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	if !c.CleanShutdown() {
+		t.Fatal("clean shutdown not detected after verification")
+	}
+
+	// Blocks cached with or without coinbase markers are the same.
+	marked := &walletrpc.CompactBlock{Height: 380640, Vtx: []*walletrpc.CompactTx{{Index: 0, Coinbase: true}}}
+	unmarked := &walletrpc.CompactBlock{Height: 380640, Vtx: []*walletrpc.CompactTx{{Index: 0}}}
+	if !sameCompactBlock(marked, unmarked) || !marked.Vtx[0].Coinbase {
+		t.Fatal("coinbase marker treated as a difference")
+	}
+
+	// So are blocks cached with and without chain metadata, but not blocks
+	// with different metadata.
+	marked.ChainMetadata = &walletrpc.ChainMetadata{SaplingCommitmentTreeSize: 100}
+	if !sameCompactBlock(marked, unmarked) || !sameCompactBlock(unmarked, marked) {
+		t.Fatal("missing chain metadata treated as a difference")
+	}
+	unmarked.ChainMetadata = &walletrpc.ChainMetadata{SaplingCommitmentTreeSize: 101}
+	if sameCompactBlock(marked, unmarked) {
+		t.Fatal("different chain metadata treated as the same")
+	}
+	unmarked.ChainMetadata = nil
+
+	unmarked.Vtx[0].Index = 1
+	if sameCompactBlock(marked, unmarked) || sameCompactBlock(marked, nil) {
+		t.Fatal("different blocks treated as the same")
+	}
+}
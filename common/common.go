@@ -6,14 +6,18 @@
 package common
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PirateNetwork/lightwalletd/parser"
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -28,26 +32,95 @@ var (
 )
 
 type Options struct {
-	GRPCBindAddr        string `json:"grpc_bind_address,omitempty"`
-	GRPCLogging         bool   `json:"grpc_logging_insecure,omitempty"`
-	HTTPBindAddr        string `json:"http_bind_address,omitempty"`
-	TLSCertPath         string `json:"tls_cert_path,omitempty"`
-	TLSKeyPath          string `json:"tls_cert_key,omitempty"`
-	LogLevel            uint64 `json:"log_level,omitempty"`
-	LogFile             string `json:"log_file,omitempty"`
-	PirateConfPath      string `json:"pirate_conf,omitempty"`
-	RPCUser             string `json:"rpcuser"`
-	RPCPassword         string `json:"rpcpassword"`
-	RPCHost             string `json:"rpchost"`
-	RPCPort             string `json:"rpcport"`
-	NoTLSVeryInsecure   bool   `json:"no_tls_very_insecure,omitempty"`
-	GenCertVeryInsecure bool   `json:"gen_cert_very_insecure,omitempty"`
-	Redownload          bool   `json:"redownload"`
-	SyncFromHeight      int    `json:"sync_from_height"`
-	DataDir             string `json:"data_dir"`
-	PingEnable          bool   `json:"ping_enable"`
-	Darkside            bool   `json:"darkside"`
-	DarksideTimeout     uint64 `json:"darkside_timeout"`
+	GRPCBindAddr        string   `json:"grpc_bind_address,omitempty"`
+	GRPCLogging         bool     `json:"grpc_logging_insecure,omitempty"`
+	GRPCMaxStreams      int      `json:"grpc_max_concurrent_streams"`
+	HTTPBindAddr        string   `json:"http_bind_address,omitempty"`
+	TLSCertPath         string   `json:"tls_cert_path,omitempty"`
+	TLSKeyPath          string   `json:"tls_cert_key,omitempty"`
+	LogLevel            uint64   `json:"log_level,omitempty"`
+	LogFile             string   `json:"log_file,omitempty"`
+	AccessLog           string   `json:"access_log,omitempty"`
+	AccessLogFormat     string   `json:"access_log_format,omitempty"`
+	CaptureDir          string   `json:"capture_dir,omitempty"`
+	CaptureMethods      []string `json:"capture_methods,omitempty"`
+	CaptureRate         float64  `json:"capture_rate,omitempty"`
+	CaptureFileSize     int      `json:"capture_file_size,omitempty"`
+	CaptureFiles        int      `json:"capture_files,omitempty"`
+	PirateConfPath      string   `json:"pirate_conf,omitempty"`
+	RPCUser             string   `json:"rpcuser"`
+	RPCPassword         string   `json:"rpcpassword" secret:"true"`
+	RPCHost             string   `json:"rpchost"`
+	RPCPort             string   `json:"rpcport"`
+	RPCCookiePath       string   `json:"rpccookie"`
+	PiratedProxy        string   `json:"pirated_proxy,omitempty" secret:"url"`
+	NoTLSVeryInsecure   bool     `json:"no_tls_very_insecure,omitempty"`
+	StandbyPrimary      string   `json:"standby_primary"`
+	StandbyInsecure     bool     `json:"standby_primary_insecure"`
+	GenCertVeryInsecure bool     `json:"gen_cert_very_insecure,omitempty"`
+	Redownload          bool     `json:"redownload"`
+	SyncFromHeight      int      `json:"sync_from_height"`
+	DataDir             string   `json:"data_dir"`
+	PingEnable          bool     `json:"ping_enable"`
+	TreeStateSprout     bool     `json:"tree_state_sprout"`
+	StrictTreeState     bool     `json:"strict_treestate"`
+	TreeStateRoots      bool     `json:"tree_state_root_fallback"`
+	IngestBatchSize     int      `json:"ingest_batch_size"`
+	IngestLagBlocks     int      `json:"ingest_lag_alarm_blocks"`
+	IngestLagDuration   int      `json:"ingest_lag_alarm_duration"`
+	TreeStateIndex      bool     `json:"tree_state_index"`
+	TreeStateInterval   int      `json:"tree_state_index_interval"`
+	IngestDebounce      int      `json:"ingest_debounce"`
+	ClockSkewWarning    int      `json:"clock_skew_warning"`
+	MaxBlockElements    int      `json:"max_block_elements"`
+	StreamMemoryBudget  int      `json:"stream_memory_budget"`
+	DeepHistoryHeight   int      `json:"deep_history_height"`
+	VerifyBlocks        bool     `json:"verify_blocks"`
+	VerifyInterval      int      `json:"verify_blocks_interval"`
+	CompactBlockCheck   string   `json:"compact_block_check"`
+	CoinbaseMarkers     bool     `json:"coinbase_markers"`
+	TxOutSetCacheTTL    int      `json:"txoutset_cache_ttl"`
+	LightdInfoCacheTTL  int      `json:"lightdinfo_cache_ttl"`
+	UpgradeWarning      int      `json:"upgrade_warning_blocks"`
+	SendConfirmWait     int      `json:"send_confirm_wait"`
+	MempoolStateTTL     int      `json:"mempool_state_ttl"`
+	ReorgGracePeriod    int      `json:"reorg_grace_period"`
+	NoMempoolLookup     bool     `json:"no_mempool_lookup"`
+	MaxTaddresses       int      `json:"max_taddresses"`
+	MaxTxSize           int      `json:"max_tx_size"`
+	BlockExtended       bool     `json:"block_extended"`
+	MaxBackendRequests  int      `json:"max_backend_requests"`
+	RPCBatchSize        int      `json:"rpc_batch_size"`
+	MinProtocolVersion  int      `json:"min_protocol_version"`
+	MaxStreamDuration   int      `json:"max_stream_duration"`
+	MaxPeerRequests     int      `json:"max_peer_requests"`
+	ClientQuota         int      `json:"client_quota"`
+	ClientQuotaWindow   int      `json:"client_quota_window"`
+	ClientQuotaAPIKeys  []string `json:"client_quota_api_key" secret:"true"`
+	AllowCIDRs          []string `json:"allow_cidr"`
+	DenyCIDRs           []string `json:"deny_cidr"`
+	Vendor              string   `json:"vendor"`
+	InfoExtra           []string `json:"info_extra"`
+	RPCPassthrough      []string `json:"rpc_passthrough"`
+	MemoryCacheBlocks   int      `json:"cache_memory_blocks"`
+	CacheHistoryDirs    []string `json:"cache_history_dirs"`
+	HashIndexBlocks     int      `json:"cache_hash_index_blocks"`
+	CompressionLevel    int      `json:"cache_compression_level"`
+	MemoryCachePolicy   string   `json:"cache_memory_policy"`
+	CacheDuplicates     string   `json:"cache_duplicate_heights"`
+	CachePrimeBlocks    int      `json:"cache_prime_blocks"`
+	SaplingOnly         bool     `json:"sapling_only"`
+	CacheWriteBuffer    int      `json:"cache_write_buffer"`
+	CacheFlushBlocks    int      `json:"cache_flush_blocks"`
+	CacheFlushInterval  int      `json:"cache_flush_interval"`
+	CrashVerifyBlocks   int      `json:"crash_verify_blocks"`
+	ScrubInterval       int      `json:"cache_scrub_interval"`
+	ScrubRate           int      `json:"cache_scrub_rate"`
+	ScrubRefetch        bool     `json:"cache_scrub_refetch"`
+	ScrubBusyRequests   int      `json:"cache_scrub_busy_requests"`
+	CacheInMemory       bool     `json:"cache_in_memory"`
+	Darkside            bool     `json:"darkside"`
+	DarksideTimeout     uint64   `json:"darkside_timeout"`
 }
 
 // RawRequest points to the function to send a an RPC request to pirated;
@@ -55,6 +128,11 @@ type Options struct {
 // in unit tests it points to a function to mock RPCs to pirated.
 var RawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)
 
+// PiratedProxy, if not empty, is the SOCKS5 proxy URL (such as Tor's) that
+// all rpcs to pirated are sent through; the proxy also resolves pirated's
+// host name, so it doesn't leak through local DNS lookups.
+var PiratedProxy string
+
 // Time allows time-related functions to be mocked for testing,
 // so that tests can be deterministic and so they don't require
 // real time to elapse. In production, these point to the standard
@@ -69,6 +147,72 @@ var Time struct {
 // Log as a global variable simplifies logging
 var Log *logrus.Entry
 
+// TreeStateBridgeSupport is true if pirated's z_gettreestate returns the
+// bridge (Orchard) format; it's determined once, at startup, by ProbeTreeState().
+var TreeStateBridgeSupport bool
+
+// IngestBatchSize is the number of blocks the block ingestor requests from
+// pirated concurrently while it's behind the tip (1 means one at a time).
+var IngestBatchSize = 1
+
+// MaxBlockElements limits the number of spends, outputs, and actions sent in
+// one CompactBlock message; larger blocks are split by GetBlockRange (and
+// rejected by GetBlock). Zero means unlimited.
+var MaxBlockElements int
+
+// CoinbaseMarkers, if true, marks each block's coinbase transaction (if it
+// has shielded outputs, so it's in the compact block) as such, for wallets
+// that apply the coinbase maturity rule. It's off by default, so that
+// compact blocks are unchanged; it applies to blocks as they're cached
+// (--redownload marks the blocks already cached).
+var CoinbaseMarkers bool
+
+// StreamMemoryBudget is the most memory (in bytes of blocks) that one
+// GetBlockRange stream may use to read ahead of its client; reading pauses
+// while the client falls this far behind. Zero disables reading ahead.
+var StreamMemoryBudget int
+
+// DeepHistoryHeight, if not zero, is the lowest height GetBlockRange
+// serves; a wallet should start syncing (from a checkpoint's tree state)
+// above it rather than download the whole chain. It's a policy, not a
+// limit of the cache (which still has those blocks).
+var DeepHistoryHeight int
+
+// IngestDebounce is how long the block ingestor waits for a new tip to stop
+// changing (as it may during reorg churn) before updating the cache; zero
+// disables the wait.
+var IngestDebounce time.Duration
+
+// ClockSkewWarning is how far in the future (by this host's clock) a
+// block's time may be before a warning is logged; miners' clocks (and ours)
+// are never exactly right. It's only a warning threshold: such blocks are
+// still ingested and served (consensus allows them).
+var ClockSkewWarning time.Duration
+
+// SendConfirmWait is how long SendTransaction() waits (polling pirated's
+// mempool) for a transaction it sent to appear in the mempool, to report
+// whether it did; zero disables the wait.
+var SendConfirmWait time.Duration
+
+// MaxTaddresses limits the number of t-addresses in one balance or UTXO
+// request (including the addresses streamed to GetTaddressBalanceStream),
+// since each costs pirated an index lookup. Zero means unlimited.
+var MaxTaddresses = 1000
+
+// MaxTxSize limits the size (in bytes) of a raw transaction that
+// SendTransaction() or CheckTransaction() passes to pirated; the default is
+// the consensus limit (since Sapling), so no valid transaction is larger.
+// Zero means unlimited.
+var MaxTxSize = 2000000
+
+// NoMempoolLookup makes GetTransaction() serve only confirmed transactions
+// (those in a block on the best chain); others are NotFound.
+var NoMempoolLookup bool
+
+// maxDebounceWaits limits how long a continually-changing tip can delay
+// ingestion; after this many waits, the latest tip is ingested regardless.
+const maxDebounceWaits = 10
+
 // Metrics as a global object to simplify things
 var Metrics *PrometheusMetrics
 
@@ -77,8 +221,9 @@ type (
 	// pirated rpc "getblockchaininfo"
 	Upgradeinfo struct {
 		// unneeded fields can be omitted
+		Name             string // example: "Sapling"
 		ActivationHeight int
-		Status           string // "active"
+		Status           string // "active", "pending"
 	}
 	ConsensusInfo struct { // consensus branch IDs
 		Nextblock string // example: "e9ff75a6" (canopy)
@@ -91,6 +236,19 @@ type (
 		BestBlockHash   string
 		Consensus       ConsensusInfo
 		EstimatedHeight int
+		Difficulty      float64
+	}
+
+	// pirated rpc "gettxoutsetinfo"
+	PiratedRpcReplyGettxoutsetinfo struct {
+		Height       int
+		Transactions uint64
+		TotalAmount  float64 `json:"total_amount"`
+	}
+
+	// pirated rpc "getchaintxstats"
+	PiratedRpcReplyGetchaintxstats struct {
+		Txcount uint64
 	}
 
 	// pirated rpc "getinfo"
@@ -108,16 +266,25 @@ type (
 
 	// pirated rpc "z_gettreestate"
 	PiratedRpcReplyGettreestate struct {
-		Height  int
-		Hash    string
-		Time    uint32
+		Height int
+		Hash   string
+		Time   uint32
+		Sprout struct {
+			Commitments struct {
+				FinalState string
+				FinalRoot  string
+			}
+			SkipHash string
+		}
 		Sapling struct {
+			Active      *bool // absent in the legacy format (sapling is active)
 			Commitments struct {
 				FinalState string
 			}
 			SkipHash string
 		}
 		Orchard struct {
+			Active      *bool
 			Commitments struct {
 				FinalState string
 			}
@@ -127,8 +294,9 @@ type (
 
 	// pirated rpc "getrawtransaction txid 1" (1 means verbose), there are
 	PiratedRpcReplyGetrawtransaction struct {
-		Hex    string
-		Height int
+		Hex           string
+		Height        int  // see ConfirmedHeight()
+		Confirmations *int // absent in some replies for unconfirmed transactions
 	}
 
 	// pirated rpc "getaddressbalance"
@@ -152,9 +320,43 @@ type (
 		Height      int
 	}
 
-	// reply to getblock verbose=1 (json includes txid list)
+	// pirated rpc "testmempoolaccept [rawtx]", one reply per transaction
+	PiratedRpcReplyTestmempoolaccept struct {
+		Txid         string
+		Allowed      bool
+		RejectReason string `json:"reject-reason"`
+	}
+
+	// pirated rpc "validateaddress taddr"
+	PiratedRpcReplyValidateaddress struct {
+		IsValid  bool `json:"isvalid"`
+		IsScript bool `json:"isscript"`
+	}
+
+	// pirated rpc "z_validateaddress zaddr"
+	PiratedRpcReplyZValidateaddress struct {
+		IsValid bool `json:"isvalid"`
+		Type    string
+	}
+
+	// reply to getblock verbose=1 (json includes txid list, and in newer
+	// versions, the note commitment tree sizes as of the block)
 	PirateRpcReplyGetblock1 struct {
-		Tx []string
+		Hash             string
+		Height           int
+		Confirmations    int // -1 if the block isn't on the best chain
+		Time             uint32
+		Tx               []string
+		FinalSaplingRoot string
+		FinalOrchardRoot string
+		Trees            struct {
+			Sapling struct {
+				Size uint32
+			}
+			Orchard struct {
+				Size uint32
+			}
+		}
 	}
 )
 
@@ -162,12 +364,16 @@ type (
 // interface. The specific RPC used here is not important.
 func FirstRPC() {
 	retryCount := 0
+	warmupDelay := time.Duration(0)
 	for {
 		result, rpcErr := RawRequest("getblockchaininfo", []json.RawMessage{})
 		if rpcErr == nil {
 			if retryCount > 0 {
 				Log.Warn("getblockchaininfo RPC successful")
 			}
+			if warmupDelay > 0 {
+				Log.Info("pirated warmup complete")
+			}
 			var getblockchaininfo PiratedRpcReplyGetblockchaininfo
 			err := json.Unmarshal(result, &getblockchaininfo)
 			if err != nil {
@@ -175,6 +381,19 @@ func FirstRPC() {
 			}
 			break
 		}
+		if isWarmupError(rpcErr) {
+			// pirated has just started and is still loading (which can take
+			// a long time), so wait for as long as it takes, quietly.
+			if warmupDelay == 0 {
+				Log.Warn("waiting for pirated warmup: ", rpcErr.Error())
+				warmupDelay = time.Second
+			}
+			Time.Sleep(warmupDelay)
+			if warmupDelay < 30*time.Second {
+				warmupDelay *= 2
+			}
+			continue
+		}
 		retryCount++
 		if retryCount > 10 {
 			Log.WithFields(logrus.Fields{
@@ -189,7 +408,122 @@ func FirstRPC() {
 	}
 }
 
+// isWarmupError returns true if pirated replied with RPC_IN_WARMUP (-28),
+// meaning it has started but isn't ready (for example, loading the block index).
+func isWarmupError(rpcErr error) bool {
+	return (strings.Split(rpcErr.Error(), ":"))[0] == "-28"
+}
+
+// ProbeTreeState issues a single z_gettreestate at the given height to learn
+// which tree-state format pirated serves. The bridge format includes an
+// orchard section; the legacy format has only sapling (and sprout).
+func ProbeTreeState(height int) bool {
+	heightJSON, err := json.Marshal(strconv.Itoa(height))
+	if err != nil {
+		Log.Fatal("ProbeTreeState bad height argument", height, err)
+	}
+	result, rpcErr := RawRequest("z_gettreestate", []json.RawMessage{heightJSON})
+	if rpcErr != nil {
+		Log.WithFields(logrus.Fields{
+			"error":  rpcErr.Error(),
+			"height": height,
+		}).Warn("z_gettreestate probe failed, assuming legacy tree-state format")
+		return false
+	}
+	var reply struct {
+		Orchard json.RawMessage
+	}
+	if err := json.Unmarshal(result, &reply); err != nil {
+		Log.Warn("error parsing JSON z_gettreestate probe response: ", err)
+		return false
+	}
+	return len(reply.Orchard) > 0 && string(reply.Orchard) != "null"
+}
+
+// UpgradeWarningBlocks is how many blocks before the next network upgrade
+// activates that GetLightdInfo() reports it as imminent, so that wallets
+// can prompt their users to update in time; zero disables the warning.
+var UpgradeWarningBlocks = 20160 // two weeks
+
+// nextUpgrade returns the network upgrade that activates soonest after the
+// tip, if any (otherwise a zero height).
+func nextUpgrade(info *PiratedRpcReplyGetblockchaininfo) (name string, height int) {
+	for _, upgrade := range info.Upgrades {
+		if upgrade.ActivationHeight <= info.Blocks {
+			continue
+		}
+		if height == 0 || upgrade.ActivationHeight < height {
+			name, height = upgrade.Name, upgrade.ActivationHeight
+		}
+	}
+	return name, height
+}
+
+// LightdInfoCacheTTL is how long a GetLightdInfo() reply is reused (status
+// pages poll it often, and it changes slowly); zero disables the cache. The
+// cached reply is discarded whenever the block ingestor changes the tip.
+var LightdInfoCacheTTL time.Duration
+
+var lightdInfoCache struct {
+	mutex     sync.Mutex
+	info      *walletrpc.LightdInfo
+	fetchedAt time.Time
+	last      *walletrpc.LightdInfo // the most recent reply, even if expired
+}
+
+// GetLightdInfo returns information about this lightwalletd and pirated,
+// from the cache if it's recent enough.
+// If pirated is unreachable, the most recent reply is returned, marked as
+// degraded.
 func GetLightdInfo() (*walletrpc.LightdInfo, error) {
+	if LightdInfoCacheTTL <= 0 {
+		info, err := getLightdInfo()
+		lightdInfoCache.mutex.Lock()
+		defer lightdInfoCache.mutex.Unlock()
+		if err != nil {
+			return degradedLightdInfo(err)
+		}
+		lightdInfoCache.last = info
+		return info, nil
+	}
+	lightdInfoCache.mutex.Lock()
+	defer lightdInfoCache.mutex.Unlock()
+	if lightdInfoCache.info != nil && Time.Now().Sub(lightdInfoCache.fetchedAt) < LightdInfoCacheTTL {
+		return lightdInfoCache.info, nil
+	}
+	info, err := getLightdInfo()
+	if err != nil {
+		return degradedLightdInfo(err)
+	}
+	lightdInfoCache.info = info
+	lightdInfoCache.fetchedAt = Time.Now()
+	lightdInfoCache.last = info
+	return info, nil
+}
+
+// degradedLightdInfo returns (a copy of) the most recent GetLightdInfo()
+// reply, marked as degraded, if pirated is unreachable, else the error.
+// lightdInfoCache must be locked.
+func degradedLightdInfo(err error) (*walletrpc.LightdInfo, error) {
+	down, stale := BackendUnavailable()
+	if !down || lightdInfoCache.last == nil {
+		return nil, err
+	}
+	info := proto.Clone(lightdInfoCache.last).(*walletrpc.LightdInfo)
+	info.Degraded = true
+	info.StaleSeconds = uint64(stale.Seconds())
+	return info, nil
+}
+
+// invalidateLightdInfoCache discards the cached GetLightdInfo() reply, so
+// that its tip-dependent fields (such as the block height) are current.
+func invalidateLightdInfoCache() {
+	lightdInfoCache.mutex.Lock()
+	defer lightdInfoCache.mutex.Unlock()
+	lightdInfoCache.info = nil
+}
+
+func getLightdInfo() (*walletrpc.LightdInfo, error) {
 	result, rpcErr := RawRequest("getinfo", []json.RawMessage{})
 	if rpcErr != nil {
 		return nil, rpcErr
@@ -216,9 +550,13 @@ func GetLightdInfo() (*walletrpc.LightdInfo, error) {
 	}
 
 	vendor := "Pirate LightWalletD"
+	if Vendor != "" {
+		vendor = Vendor
+	}
 	if DarksideEnabled {
 		vendor = "Pirate DarksideWalletD"
 	}
+	upgradeName, upgradeHeight := nextUpgrade(&getblockchaininfoReply)
 	return &walletrpc.LightdInfo{
 		Version:                 Version,
 		Vendor:                  vendor,
@@ -234,6 +572,15 @@ func GetLightdInfo() (*walletrpc.LightdInfo, error) {
 		EstimatedHeight:         uint64(getblockchaininfoReply.EstimatedHeight),
 		PiratedBuild:            getinfoReply.Build,
 		PiratedSubversion:       getinfoReply.Subversion,
+		TreeStateBridgeSupport:  TreeStateBridgeSupport,
+		MinProtocolVersion:      uint32(MinProtocolVersion),
+		MaxProtocolVersion:      ProtocolVersion,
+		Extra:                   LightdInfoExtra,
+		DeepHistoryHeight:       uint64(DeepHistoryHeight),
+		NextUpgradeName:         upgradeName,
+		NextUpgradeHeight:       uint64(upgradeHeight),
+		UpgradeImminent: upgradeHeight > 0 && UpgradeWarningBlocks > 0 &&
+			upgradeHeight-getblockchaininfoReply.Blocks <= UpgradeWarningBlocks,
 	}, nil
 }
 
@@ -255,115 +602,250 @@ func getBestBlockHash() ([]byte, error) {
 	return parser.Reverse(hashbytes), nil
 }
 
-func getBlockFromRPC(height int) (*walletrpc.CompactBlock, error) {
+// getFullBlockFromRPC requests the (full) block at the given height from
+// pirated (on behalf of the request ctx belongs to, see RawRequestContext),
+// and returns it (with its txids) and pirated's verbose reply (with its
+// hash, in big-endian hex), or nil if pirated doesn't have that height yet.
+func getFullBlockFromRPC(ctx context.Context, height int) (*parser.Block, *PirateRpcReplyGetblock1, error) {
 	params := make([]json.RawMessage, 2)
 	heightJSON, err := json.Marshal(strconv.Itoa(height))
 	if err != nil {
-		Log.Fatal("getBlockFromRPC bad height argument", height, err)
+		Log.Fatal("getFullBlockFromRPC bad height argument", height, err)
 	}
 	params[0] = heightJSON
 	params[1] = json.RawMessage("0") // non-verbose (raw hex)
-	result, rpcErr := RawRequest("getblock", params)
+	result, rpcErr := RawRequestContext(ctx, "getblock", params)
 
 	// For some reason, the error responses are not JSON
 	if rpcErr != nil {
 		// Check to see if we are requesting a height the pirated doesn't have yet
 		if (strings.Split(rpcErr.Error(), ":"))[0] == "-8" {
-			return nil, nil
+			return nil, nil, nil
 		}
-		return nil, errors.Wrap(rpcErr, "error requesting block")
+		return nil, nil, errors.Wrap(rpcErr, "error requesting block")
 	}
 
 	var blockDataHex string
 	err = json.Unmarshal(result, &blockDataHex)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading JSON response")
+		return nil, nil, errors.Wrap(err, "error reading JSON response")
 	}
 
 	blockData, err := hex.DecodeString(blockDataHex)
 	if err != nil {
-		return nil, errors.Wrap(err, "error decoding getblock output")
+		return nil, nil, errors.Wrap(err, "error decoding getblock output")
 	}
 
 	block := parser.NewBlock()
 	rest, err := block.ParseFromSlice(blockData)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing block")
+		return nil, nil, errors.Wrap(err, "error parsing block")
 	}
 	if len(rest) != 0 {
-		return nil, errors.New("received overlong message")
+		return nil, nil, errors.New("received overlong message")
 	}
 
 	if block.GetHeight() != height {
-		return nil, errors.New("received unexpected height block")
+		return nil, nil, errors.New("received unexpected height block")
 	}
 
 	// `block.ParseFromSlice` correctly parses blocks containing v5 transactions, but
 	// incorrectly computes the IDs of the v5 transactions. We temporarily paper over this
 	// bug by fetching the correct txids via a second getblock RPC call.
 	// https://github.com/zcash/lightwalletd/issues/392
-	{
-		params[1] = json.RawMessage("1") // JSON with list of txids
-		result, rpcErr := RawRequest("getblock", params)
-		if rpcErr != nil {
-			return nil, errors.Wrap(rpcErr, "error requesting verbose block")
-		}
-		var block1 PirateRpcReplyGetblock1
-		err = json.Unmarshal(result, &block1)
+	params[1] = json.RawMessage("1") // JSON with list of txids
+	result, rpcErr = RawRequestContext(ctx, "getblock", params)
+	if rpcErr != nil {
+		return nil, nil, errors.Wrap(rpcErr, "error requesting verbose block")
+	}
+	var block1 PirateRpcReplyGetblock1
+	err = json.Unmarshal(result, &block1)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, t := range block.Transactions() {
+		txid, err := hex.DecodeString(block1.Tx[i])
 		if err != nil {
+			return nil, nil, errors.Wrap(err, "error decoding getblock txid")
+		}
+		// convert from big-endian
+		t.SetTxID(parser.Reverse(txid))
+	}
+	return block, &block1, nil
+}
+
+func getBlockFromRPC(ctx context.Context, height int) (*walletrpc.CompactBlock, error) {
+	block, reply, err := getFullBlockFromRPC(ctx, height)
+	if block == nil {
+		return nil, err
+	}
+	if VerifyBlocks && height%VerifyBlocksInterval == 0 {
+		if err := verifyBlock(block, reply.Hash); err != nil {
+			Log.WithFields(logrus.Fields{
+				"height": height,
+				"error":  err,
+			}).Error("BLOCK VERIFICATION FAILED, pirated may be serving fabricated blocks")
 			return nil, err
 		}
-		for i, t := range block.Transactions() {
-			txid, err := hex.DecodeString(block1.Tx[i])
-			if err != nil {
-				return nil, errors.Wrap(err, "error decoding getblock txid")
+	}
+
+	compactBlock := toCompact(block)
+	// Older pirated versions don't report the tree sizes.
+	if trees := reply.Trees; trees.Sapling.Size > 0 || trees.Orchard.Size > 0 {
+		compactBlock.ChainMetadata = &walletrpc.ChainMetadata{
+			SaplingCommitmentTreeSize: trees.Sapling.Size,
+			OrchardCommitmentTreeSize: trees.Orchard.Size,
+		}
+	}
+	if CompactBlockCheck != "off" {
+		if err := block.CheckCompact(compactBlock); err != nil {
+			Log.WithFields(logrus.Fields{
+				"height": height,
+				"error":  err,
+			}).Error("COMPACT BLOCK CHECK FAILED, not serving this block")
+			if CompactBlockCheck == "skip" {
+				return nil, errBadCompactBlock
 			}
-			// convert from big-endian
-			t.SetTxID(parser.Reverse(txid))
+			return nil, err
+		}
+	}
+	return compactBlock, nil
+}
+
+// toCompact returns the compact form of the given (full) block, with its
+// coinbase transaction marked if CoinbaseMarkers is set.
+func toCompact(block *parser.Block) *walletrpc.CompactBlock {
+	compactBlock := block.ToCompact()
+	if CoinbaseMarkers {
+		txs := block.Transactions()
+		for _, ctx := range compactBlock.Vtx {
+			ctx.Coinbase = txs[ctx.Index].IsCoinbase()
 		}
 	}
+	return compactBlock
+}
 
-	return block.ToCompact(), nil
+// getBlocksFromRPC requests up to count consecutive blocks starting at the
+// given height from pirated in parallel. The result stops short at the first
+// height pirated doesn't have yet, so it may be empty.
+func getBlocksFromRPC(height int, count int) ([]*walletrpc.CompactBlock, error) {
+	if count <= 1 {
+		block, err := getBlockFromRPC(context.Background(), height)
+		if err != nil || block == nil {
+			return nil, err
+		}
+		return []*walletrpc.CompactBlock{block}, nil
+	}
+	blocks := make([]*walletrpc.CompactBlock, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = getBlockFromRPC(context.Background(), height+i)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < count; i++ {
+		if errs[i] == errBadCompactBlock && i > 0 {
+			// The blocks before it can still be cached; the ingestor
+			// stops at this one on its next round.
+			return blocks[:i], nil
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if blocks[i] == nil {
+			return blocks[:i], nil
+		}
+	}
+	return blocks, nil
 }
 
 var (
-	ingestorRunning  bool
-	stopIngestorChan = make(chan struct{})
+	ingestorRunning     bool
+	stopIngestorChan    = make(chan struct{})
+	ingestorStoppedChan = make(chan struct{})
 )
 
-func startIngestor(c *BlockCache) {
+// StartIngestor starts the block ingestor (if it's not already running).
+func StartIngestor(c Cache) {
 	if !ingestorRunning {
 		ingestorRunning = true
 		go BlockIngestor(c, 0)
 	}
 }
-func stopIngestor() {
+
+// StopIngestor stops the block ingestor (if it's running), returning after
+// it has flushed the cache to disk.
+func StopIngestor() {
 	if ingestorRunning {
 		ingestorRunning = false
 		stopIngestorChan <- struct{}{}
+		<-ingestorStoppedChan
 	}
 }
 
+// waitForStableTip waits until pirated's best block hash (in internal byte
+// order) has been unchanged for IngestDebounce, and returns it.
+func waitForStableTip(hash []byte) ([]byte, error) {
+	for i := 0; i < maxDebounceWaits; i++ {
+		Time.Sleep(IngestDebounce)
+		latest, err := getBestBlockHash()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(latest, hash) {
+			break
+		}
+		hash = latest
+	}
+	return hash, nil
+}
+
 // BlockIngestor runs as a goroutine and polls pirated for new blocks, adding them
 // to the cache. The repetition count, rep, is nonzero only for unit-testing.
-func BlockIngestor(c *BlockCache, rep int) {
+func BlockIngestor(c Cache, rep int) {
 	lastLog := Time.Now()
 	lastHeightLogged := 0
+	synced := false
+	behindLogged := false
+	setIngestTip(c.GetShared(c.GetLatestHeight()), false)
+	// An rpc to pirated that fails (most likely because it's unreachable,
+	// restarting perhaps) is retried, after a delay that grows while the
+	// failures continue; meanwhile, the cache is served (see
+	// BackendUnavailable()).
+	unreachable := Backoff{Min: time.Second, Max: 30 * time.Second}
+	retry := func(msg string, err error) {
+		Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warning(msg, ", will retry")
+		Time.Sleep(unreachable.Next())
+	}
 
 	// Start listening for new blocks
 	for i := 0; rep == 0 || i < rep; i++ {
 		// stop if requested
 		select {
 		case <-stopIngestorChan:
+			// Record where we stopped, so the next start can be checked
+			// against a known-good (flushed) tip.
+			c.Sync()
+			height, hash := c.GetLatestHeightHash()
+			Log.WithFields(logrus.Fields{
+				"height": height,
+				"hash":   displayHash(hash),
+			}).Info("Block ingestor stopped, cache flushed")
+			ingestorStoppedChan <- struct{}{}
 			return
 		default:
 		}
 
 		result, err := RawRequest("getbestblockhash", []json.RawMessage{})
 		if err != nil {
-			Log.WithFields(logrus.Fields{
-				"error": err,
-			}).Fatal("error pirated getbestblockhash rpc")
+			retry("error pirated getbestblockhash rpc", err)
+			continue
 		}
 		var hashHex string
 		err = json.Unmarshal(result, &hashHex)
@@ -379,6 +861,8 @@ func BlockIngestor(c *BlockCache, rep int) {
 		height := c.GetNextHeight()
 		if string(lastBestBlockHash) == string(parser.Reverse(c.GetLatestHash())) {
 			// Synced
+			synced = true
+			unreachable.Reset()
 			c.Sync()
 			if lastHeightLogged != height-1 {
 				lastHeightLogged = height - 1
@@ -388,19 +872,85 @@ func BlockIngestor(c *BlockCache, rep int) {
 			lastLog = Time.Now()
 			continue
 		}
-		var block *walletrpc.CompactBlock
-		block, err = getBlockFromRPC(height)
+		if synced && IngestDebounce > 0 {
+			// A new tip has appeared; let the chain settle before changing
+			// the cache, so that rapid reorgs don't cause repeated rollbacks.
+			// The ingest below follows whatever the tip is by then.
+			tip, err := waitForStableTip(parser.Reverse(lastBestBlockHash))
+			if err != nil {
+				retry("error pirated getbestblockhash rpc", err)
+				continue
+			}
+			if bytes.Equal(tip, c.GetLatestHash()) {
+				// pirated has gone back to the chain we already have
+				continue
+			}
+		}
+		synced = false
+		var blocks []*walletrpc.CompactBlock
+		blocks, err = getBlocksFromRPC(height, IngestBatchSize)
+		if err == errBadCompactBlock {
+			// Already logged; the ingestor can't skip over a height, so
+			// it halts here, serving what's cached, and tries again.
+			if Metrics != nil {
+				Metrics.BadCompactBlockHeightGauge.Set(float64(height))
+			}
+			Time.Sleep(10 * time.Second)
+			continue
+		}
 		if err != nil {
-			Log.Fatal("getblock failed, will retry", err)
+			retry("getblock failed", err)
+			continue
 		}
-		if block != nil && c.HashMatch(block.PrevHash) {
-			if err = c.Add(height, block); err != nil {
+		if len(blocks) == 0 && height > c.GetFirstHeight() {
+			behind, err := piratedBehind(c)
+			if err != nil {
+				retry("getblockcount failed", err)
+				continue
+			}
+			if behind {
+				if !behindLogged {
+					behindLogged = true
+					Log.Warning("pirated's height is below the cache's (reindexing?), waiting for it to catch up")
+				}
+				Time.Sleep(10 * time.Second)
+				continue
+			}
+			if c.GetNextHeight() != height {
+				// Rolled back to the common ancestor with pirated's chain.
+				continue
+			}
+		}
+		behindLogged = false
+		unreachable.Reset()
+		// Each block must extend the one before it, so a reorg is detected
+		// even if it happens within (or at the start of) a batch.
+		added := 0
+		for _, block := range blocks {
+			if !c.HashMatch(block.PrevHash) {
+				break
+			}
+			if err = c.Add(height+added, block); err != nil {
 				Log.Fatal("Cache add failed:", err)
 			}
+			setIngestTip(block, true)
+			if TreeStates != nil && (height+added)%TreeStateIndexInterval == 0 {
+				indexTreeState(c, height+added)
+			}
+			added++
 			// Don't log these too often.
 			if DarksideEnabled || Time.Now().Sub(lastLog).Seconds() >= 4 {
 				lastLog = Time.Now()
-				Log.Info("Adding block to cache ", height, " ", displayHash(block.Hash))
+				Log.Info("Adding block to cache ", block.Height, " ", displayHash(block.Hash))
+			}
+		}
+		if added > 0 {
+			if Metrics != nil {
+				Metrics.BadCompactBlockHeightGauge.Set(0)
+			}
+			invalidateLightdInfoCache()
+			if len(blocks) > 1 {
+				c.Sync()
 			}
 			continue
 		}
@@ -412,14 +962,16 @@ func BlockIngestor(c *BlockCache, rep int) {
 			return
 		}
 		Log.Info("REORG: dropping block ", height-1, " ", displayHash(c.GetLatestHash()))
-		c.Reorg(height - 1)
+		reorgKeepingOrphans(c, height-1)
+		invalidateLightdInfoCache()
+		setIngestTip(c.GetShared(c.GetLatestHeight()), false)
 	}
 }
 
 // GetBlock returns the compact block at the requested height, first by querying
-// the cache, then, if not found, will request the block from pirated. It returns
-// nil if no block exists at this height.
-func GetBlock(cache *BlockCache, height int) (*walletrpc.CompactBlock, error) {
+// the cache, then, if not found, will request the block from pirated (on behalf
+// of the request ctx belongs to). It returns nil if no block exists at this height.
+func GetBlock(ctx context.Context, cache Cache, height int) (*walletrpc.CompactBlock, error) {
 	// First, check the cache to see if we have the block
 	block := cache.Get(height)
 	if block != nil {
@@ -427,7 +979,7 @@ func GetBlock(cache *BlockCache, height int) (*walletrpc.CompactBlock, error) {
 	}
 
 	// Not in the cache, ask pirated
-	block, err := getBlockFromRPC(height)
+	block, err := getBlockFromRPC(ctx, height)
 	if err != nil {
 		return nil, err
 	}
@@ -438,29 +990,103 @@ func GetBlock(cache *BlockCache, height int) (*walletrpc.CompactBlock, error) {
 	return block, nil
 }
 
-// GetBlockRange returns a sequence of consecutive blocks in the given range.
-func GetBlockRange(cache *BlockCache, blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
-	// Go over [start, end] inclusive
-	low := start
-	high := end
-	if start > end {
-		// reverse the order
-		low, high = end, start
+// GetSharedBlock is like GetBlock, but a block from the cache may be shared
+// with other requests (see BlockCache.GetShared()), so it must not be modified.
+func GetSharedBlock(ctx context.Context, cache Cache, height int) (*walletrpc.CompactBlock, error) {
+	if block := cache.GetShared(height); block != nil {
+		return block, nil
+	}
+	return GetBlock(ctx, cache, height)
+}
+
+// BlockHeightFromRPC returns the height of the block with the given hash
+// (in internal order), according to pirated, and whether it's on the best
+// chain. The height is -1 if pirated doesn't know the block.
+func BlockHeightFromRPC(hash []byte) (int, bool, error) {
+	hashJSON, err := json.Marshal(hex.EncodeToString(parser.Reverse(hash)))
+	if err != nil {
+		return 0, false, err
 	}
-	for i := low; i <= high; i++ {
-		j := i
-		if start > end {
-			// reverse the order
-			j = high - (i - low)
+	params := []json.RawMessage{hashJSON, json.RawMessage("1")}
+	result, rpcErr := RawRequest("getblock", params)
+	if rpcErr != nil {
+		if rpcErrorCategory(rpcErr) == "rpc-error" {
+			// Most likely "Block not found".
+			return -1, false, nil
 		}
-		block, err := GetBlock(cache, j)
-		if err != nil {
+		return 0, false, rpcErr
+	}
+	var block PirateRpcReplyGetblock1
+	if err := json.Unmarshal(result, &block); err != nil {
+		return 0, false, err
+	}
+	return block.Height, block.Confirmations >= 0, nil
+}
+
+// ConfirmedHeight returns the height of the block containing the
+// transaction on the best chain, or zero if it's unconfirmed: in the
+// mempool, or only in a block that's no longer on the best chain. pirated
+// versions report that differently; the height may be absent, 0, or -1, or
+// given along with zero confirmations.
+func (r *PiratedRpcReplyGetrawtransaction) ConfirmedHeight() int {
+	if r.Height <= 0 || (r.Confirmations != nil && *r.Confirmations <= 0) {
+		return 0
+	}
+	return r.Height
+}
+
+// BlockRangeReader returns the blocks in a range one at a time, each
+// fetched (from the cache, or pirated) and unmarshalled only when Next() is
+// called, so that a stream converts blocks no faster than its client reads
+// them.
+type BlockRangeReader struct {
+	ctx       context.Context
+	cache     Cache
+	next, end int
+	step      int // 1, or -1 if descending
+	done      bool
+}
+
+// NewBlockRangeReader returns a reader of the blocks in [start, end]
+// inclusive, descending if start > end; so there's always at least one
+// block (the GetBlockRange rpc handles the empty range itself). Blocks not
+// in the cache are fetched on behalf of the request ctx belongs to.
+func NewBlockRangeReader(ctx context.Context, cache Cache, start, end int) *BlockRangeReader {
+	r := &BlockRangeReader{ctx: ctx, cache: cache, next: start, end: end, step: 1}
+	if start > end {
+		r.step = -1
+	}
+	return r
+}
+
+// Next returns the next block in the range, or nil (and a nil error) after
+// the last one; after an error, there are no more blocks.
+func (r *BlockRangeReader) Next() (*walletrpc.CompactBlock, error) {
+	if r.done {
+		return nil, nil
+	}
+	block, err := GetBlock(r.ctx, r.cache, r.next)
+	if err != nil || r.next == r.end {
+		r.done = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.next += r.step
+	return block, nil
+}
+
+// GetBlockRange returns a sequence of consecutive blocks in the given range.
+func GetBlockRange(cache Cache, blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
+	r := NewBlockRangeReader(context.Background(), cache, start, end)
+	for {
+		block, err := r.Next()
+		if block == nil {
 			errOut <- err
 			return
 		}
 		blockOut <- block
 	}
-	errOut <- nil
 }
 
 func displayHash(hash []byte) string {
@@ -7,16 +7,23 @@ package common
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/PirateNetwork/lightwalletd/parser"
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 )
 
@@ -162,6 +169,221 @@ func TestGetLightdInfo(t *testing.T) {
 	sleepDuration = 0
 }
 
+func TestGetLightdInfoCache(t *testing.T) {
+	testT = t
+	calls := 0
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		calls++
+		switch method {
+		case "getinfo":
+			return json.Marshal(&PiratedRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&PiratedRpcReplyGetblockchaininfo{Blocks: 9977 + calls})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	LightdInfoCacheTTL = 10 * time.Second
+	defer func() {
+		LightdInfoCacheTTL = 0
+		invalidateLightdInfoCache()
+		sleepCount = 0
+		sleepDuration = 0
+	}()
+
+	first, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if calls != 2 {
+		t.Fatal("unexpected backend calls", calls)
+	}
+	// Within the TTL, no backend calls are made.
+	for i := 0; i < 5; i++ {
+		Time.Sleep(time.Second)
+		info, err := GetLightdInfo()
+		if err != nil {
+			t.Fatal("GetLightdInfo failed", err)
+		}
+		if info.BlockHeight != first.BlockHeight {
+			t.Fatal("unexpected block height", info.BlockHeight)
+		}
+	}
+	if calls != 2 {
+		t.Fatal("unexpected backend calls within the TTL", calls)
+	}
+	// A new block discards the cached reply.
+	invalidateLightdInfoCache()
+	info, _ := GetLightdInfo()
+	if calls != 4 || info.BlockHeight == first.BlockHeight {
+		t.Fatal("cached reply not discarded", calls, info.BlockHeight)
+	}
+	// So does the passage of time.
+	Time.Sleep(10 * time.Second)
+	GetLightdInfo()
+	if calls != 6 {
+		t.Fatal("cached reply not expired", calls)
+	}
+}
+
+func TestGetLightdInfoUpgradeImminent(t *testing.T) {
+	testT = t
+	tip := 0
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&PiratedRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return []byte(fmt.Sprintf(`{"blocks":%d,"upgrades":{`+
+				`"76b809bb":{"name":"Sapling","activationheight":152855,"status":"active"},`+
+				`"c2d6d0b4":{"name":"NU5","activationheight":3000000,"status":"pending"},`+
+				`"e9ff75a6":{"name":"Canopy","activationheight":2000000,"status":"pending"}}}`, tip)), nil
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	defer func() { UpgradeWarningBlocks = 20160 }()
+	for _, tt := range []struct {
+		tip      int
+		window   int
+		name     string
+		height   uint64
+		imminent bool
+	}{
+		{1900000, 20160, "Canopy", 2000000, false},
+		{1979840, 20160, "Canopy", 2000000, true},
+		{1999999, 20160, "Canopy", 2000000, true},
+		{1999999, 0, "Canopy", 2000000, false},
+		{2000000, 20160, "NU5", 3000000, false},
+		{2999000, 1000, "NU5", 3000000, true},
+		{3000000, 20160, "", 0, false},
+	} {
+		tip = tt.tip
+		UpgradeWarningBlocks = tt.window
+		info, err := GetLightdInfo()
+		if err != nil {
+			t.Fatal("GetLightdInfo failed", err)
+		}
+		if info.SaplingActivationHeight != 152855 || info.NextUpgradeName != tt.name ||
+			info.NextUpgradeHeight != tt.height || info.UpgradeImminent != tt.imminent {
+			t.Fatal("unexpected next upgrade at tip", tt.tip, info.NextUpgradeName, info.NextUpgradeHeight, info.UpgradeImminent)
+		}
+	}
+}
+
+func firstRPCWarmupStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "getblockchaininfo" {
+		testT.Fatal("unexpected method", method)
+	}
+	step++
+	if step <= 3 {
+		return nil, errors.New("-28: Loading block index...")
+	}
+	r, _ := json.Marshal(&PiratedRpcReplyGetblockchaininfo{Blocks: 9977})
+	return r, nil
+}
+
+func TestFirstRPCWarmup(t *testing.T) {
+	testT = t
+	RawRequest = firstRPCWarmupStub
+	Time.Sleep = sleepStub
+	FirstRPC()
+
+	// backing off: 1, 2, 4 seconds
+	if step != 4 || sleepCount != 3 || sleepDuration != 7*time.Second {
+		t.Error("unexpected retries", step, sleepCount, sleepDuration)
+	}
+	logFile, err := ioutil.ReadFile("test-log")
+	if err != nil {
+		t.Fatal("Cannot read test-log", err)
+	}
+	if strings.Count(string(logFile), "waiting for pirated warmup") != 1 {
+		t.Fatal("expected one warmup message in test-log")
+	}
+	if !strings.Contains(string(logFile), "pirated warmup complete") {
+		t.Fatal("Cannot find warmup complete in test-log")
+	}
+	step = 0
+	sleepCount = 0
+	sleepDuration = 0
+}
+
+// ------------------------------------------ ProbeTreeState()
+
+func treeStateProbeStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	switch method {
+	case "getinfo":
+		r, _ := json.Marshal(&PiratedRpcReplyGetinfo{})
+		return r, nil
+	case "getblockchaininfo":
+		r, _ := json.Marshal(&PiratedRpcReplyGetblockchaininfo{})
+		return r, nil
+	case "z_gettreestate":
+		step++
+		var height string
+		err := json.Unmarshal(params[0], &height)
+		if err != nil {
+			testT.Fatal("could not unmarshal height")
+		}
+		if height != "1000" {
+			testT.Fatal("unexpected z_gettreestate height", height)
+		}
+		switch step {
+		case 1:
+			// bridge format, includes the orchard pool
+			return []byte(`{"height":1000,"hash":"aabb","time":1,` +
+				`"sapling":{"commitments":{"finalState":"01"}},` +
+				`"orchard":{"commitments":{"finalState":"02"}}}`), nil
+		case 2:
+			// legacy format, sapling only
+			return []byte(`{"height":1000,"hash":"aabb","time":1,` +
+				`"sapling":{"commitments":{"finalState":"01"}}}`), nil
+		case 3:
+			return nil, errors.New("-32601: Method not found")
+		}
+	}
+	testT.Fatal("unexpected call to treeStateProbeStub")
+	return nil, nil
+}
+
+func TestProbeTreeState(t *testing.T) {
+	testT = t
+	RawRequest = treeStateProbeStub
+	defer func() { TreeStateBridgeSupport = false }()
+
+	TreeStateBridgeSupport = ProbeTreeState(1000)
+	if !TreeStateBridgeSupport {
+		t.Fatal("bridge-capable backend not detected")
+	}
+	getLightdInfo, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if !getLightdInfo.TreeStateBridgeSupport {
+		t.Fatal("GetLightdInfo should advertise bridge tree-state support")
+	}
+
+	TreeStateBridgeSupport = ProbeTreeState(1000)
+	if TreeStateBridgeSupport {
+		t.Fatal("legacy backend reported as bridge-capable")
+	}
+	getLightdInfo, err = GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if getLightdInfo.TreeStateBridgeSupport {
+		t.Fatal("GetLightdInfo should not advertise bridge tree-state support")
+	}
+
+	// A backend that doesn't know z_gettreestate can't serve the bridge format.
+	if ProbeTreeState(1000) {
+		t.Fatal("failed probe reported as bridge-capable")
+	}
+	step = 0
+}
+
 // ------------------------------------------ BlockIngestor()
 
 func checkSleepMethod(count int, duration time.Duration, expected string, method string) {
@@ -178,6 +400,17 @@ func checkSleepMethod(count int, duration time.Duration, expected string, method
 
 // There are four test blocks, 0..3
 func blockIngestorStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case method == "getblock" && string(params[1]) == "1":
+		// The verbose getblock (for the txids) that follows each block
+		// isn't a step; each test block has one transaction.
+		r, _ := json.Marshal(&PirateRpcReplyGetblock1{Tx: []string{strings.Repeat("00", 32)}})
+		return r, nil
+	case method == "getblockcount":
+		// Nor is checking that pirated isn't behind the cache (it's
+		// ahead of it, so a missing block is a reorg).
+		return json.Marshal(380700)
+	}
 	step++
 	// request the first two blocks very quickly (syncing),
 	// then next block isn't yet available
@@ -367,6 +600,486 @@ func TestBlockIngestor(t *testing.T) {
 	os.RemoveAll(unitTestPath)
 }
 
+// Serves test blocks 380640..380643 by height, safe for concurrent calls
+// (unlike the step-sequenced stubs).
+var batchRequests int32
+
+func blockIngestorBatchStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	switch method {
+	case "getbestblockhash":
+		// Synced once all four test blocks are in the cache
+		if testcache.GetLatestHeight() == 380643 {
+			r, _ := json.Marshal(displayHash(testcache.GetLatestHash()))
+			return r, nil
+		}
+		r, _ := json.Marshal("010101")
+		return r, nil
+	case "getblock":
+		atomic.AddInt32(&batchRequests, 1)
+		var height string
+		err := json.Unmarshal(params[0], &height)
+		if err != nil {
+			testT.Fatal("could not unmarshal height")
+		}
+		h, _ := strconv.Atoi(height)
+		if h < 380640 || h > 380643 {
+			return nil, errors.New("-8: Block height out of range")
+		}
+		if string(params[1]) == "1" {
+			// verbose, only the number of txids matters here; blocks
+			// 380640-2 have one transaction, 380643 has two.
+			txids := []string{strings.Repeat("00", 32)}
+			if h == 380643 {
+				txids = append(txids, strings.Repeat("11", 32))
+			}
+			r, _ := json.Marshal(&PirateRpcReplyGetblock1{Tx: txids})
+			return r, nil
+		}
+		return blocks[h-380640], nil
+	}
+	testT.Error("unexpected method", method)
+	return nil, nil
+}
+
+func TestBlockIngestorBatch(t *testing.T) {
+	testT = t
+	RawRequest = blockIngestorBatchStub
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	IngestBatchSize = 3
+	batchRequests = 0
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+
+	// Start with a stale version of 380640, so the first batch (380641-3)
+	// doesn't extend the cache; that must be detected as a reorg.
+	var blockHex string
+	json.Unmarshal(blocks[0], &blockHex)
+	blockData, _ := hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	stale := block.ToCompact()
+	stale.Hash = make([]byte, 32)
+	if err := testcache.Add(380640, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// reorg, batch 380640-2, batch 380643 (only one available), synced
+	BlockIngestor(testcache, 4)
+	if testcache.GetLatestHeight() != 380643 {
+		t.Fatal("unexpected latest height", testcache.GetLatestHeight())
+	}
+	if bytes.Equal(testcache.Get(380640).Hash, stale.Hash) {
+		t.Fatal("stale block was not replaced")
+	}
+	// 380641-3, 380640-2, 380643; two getblock calls per existing block,
+	// plus one each for 380644 and 380645, which don't exist yet
+	if batchRequests != 2*7+2 {
+		t.Fatal("unexpected number of getblock requests", batchRequests)
+	}
+	if sleepCount != 1 {
+		t.Fatal("unexpected sleep count", sleepCount)
+	}
+	IngestBatchSize = 1
+	sleepCount = 0
+	sleepDuration = 0
+	os.RemoveAll(unitTestPath)
+}
+
+func TestChainMetadata(t *testing.T) {
+	testT = t
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var height string
+		json.Unmarshal(params[0], &height)
+		h, _ := strconv.Atoi(height)
+		if method != "getblock" || h < 380640 || h > 380641 {
+			t.Fatal("unexpected rpc", method, height)
+		}
+		if string(params[1]) == "1" {
+			tx := strings.Repeat("00", 32)
+			if h == 380641 {
+				// An older pirated, which doesn't report the tree sizes.
+				return []byte(`{"hash":"00","tx":["` + tx + `"]}`), nil
+			}
+			return []byte(`{"hash":"00","tx":["` + tx + `"],"trees":{"sapling":{"size":1234567},"orchard":{"size":89}}}`), nil
+		}
+		return blocks[h-380640], nil
+	}
+	block, err := getBlockFromRPC(context.Background(), 380640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := block.ChainMetadata; m == nil || m.SaplingCommitmentTreeSize != 1234567 || m.OrchardCommitmentTreeSize != 89 {
+		t.Fatal("unexpected chain metadata", m)
+	}
+	// The sizes are kept in the cache.
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+	defer c.Close()
+	if err := c.Add(380640, block); err != nil {
+		t.Fatal(err)
+	}
+	if c.Get(380640).GetChainMetadata().GetSaplingCommitmentTreeSize() != 1234567 {
+		t.Fatal("chain metadata not cached")
+	}
+
+	block, err = getBlockFromRPC(context.Background(), 380641)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.ChainMetadata != nil {
+		t.Fatal("unexpected chain metadata", block.ChainMetadata)
+	}
+}
+
+// Restarted (with the same cache), the ingestor resumes after the last
+// cached block; it doesn't fetch any cached block again.
+func TestBlockIngestorResume(t *testing.T) {
+	testT = t
+	RawRequest = blockIngestorBatchStub
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	batchRequests = 0
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+
+	// 380640 and 380641, then interrupted
+	BlockIngestor(testcache, 2)
+	if testcache.GetLatestHeight() != 380641 {
+		t.Fatal("unexpected latest height", testcache.GetLatestHeight())
+	}
+	testcache.Close()
+
+	batchRequests = 0
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	if testcache.GetNextHeight() != 380642 {
+		t.Fatal("cache not resumed", testcache.GetNextHeight())
+	}
+	// 380642, 380643, synced
+	BlockIngestor(testcache, 3)
+	if testcache.GetLatestHeight() != 380643 {
+		t.Fatal("unexpected latest height", testcache.GetLatestHeight())
+	}
+	// two getblock calls each for 380642 and 380643
+	if batchRequests != 4 {
+		t.Fatal("unexpected number of getblock requests", batchRequests)
+	}
+	batchRequests = 0
+	sleepCount = 0
+	sleepDuration = 0
+	os.RemoveAll(unitTestPath)
+}
+
+func TestBlockIngestorTipAge(t *testing.T) {
+	testT = t
+	Metrics = GetPrometheusMetrics()
+	RawRequest = blockIngestorBatchStub
+	now := time.Unix(1600000000, 0)
+	Time.Sleep = func(d time.Duration) { now = now.Add(d) }
+	Time.Now = func() time.Time { return now }
+	IngestBatchSize = 3
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	defer func() {
+		IngestBatchSize = 1
+		Time.Sleep = sleepStub
+		Time.Now = nowStub
+		os.RemoveAll(unitTestPath)
+	}()
+
+	// batch 380640-2, batch 380643, synced (sleeps 2 seconds)
+	BlockIngestor(testcache, 3)
+	tip := testcache.Get(380643)
+	if tip == nil {
+		t.Fatal("block 380643 not ingested")
+	}
+	if since := testutil.ToFloat64(Metrics.SinceLastBlockGauge); since != 2 {
+		t.Fatal("unexpected time since last block", since)
+	}
+	if age := testutil.ToFloat64(Metrics.TipAgeGauge); age != float64(now.Unix()-int64(tip.Time)) {
+		t.Fatal("unexpected tip age", age)
+	}
+	// Both keep growing while no blocks arrive.
+	now = now.Add(10 * time.Minute)
+	if since := testutil.ToFloat64(Metrics.SinceLastBlockGauge); since != 602 {
+		t.Fatal("unexpected time since last block", since)
+	}
+	if age := testutil.ToFloat64(Metrics.TipAgeGauge); age != float64(now.Unix()-int64(tip.Time)) {
+		t.Fatal("unexpected tip age", age)
+	}
+}
+
+// A tip block whose time is a little ahead of ours (miners' clocks aren't
+// exact) has no age, rather than a negative one.
+func TestTipAgeFutureBlock(t *testing.T) {
+	Metrics = GetPrometheusMetrics()
+	now := time.Unix(1600000000, 0)
+	Time.Now = func() time.Time { return now }
+	ClockSkewWarning = time.Minute
+	defer func() {
+		Time.Now = nowStub
+		ClockSkewWarning = 0
+		setIngestTip(nil, false)
+	}()
+
+	for _, ahead := range []int64{30, 3600} {
+		setIngestTip(&walletrpc.CompactBlock{Height: 380640, Time: uint32(now.Unix() + ahead)}, true)
+		if age := testutil.ToFloat64(Metrics.TipAgeGauge); age != 0 {
+			t.Fatal("unexpected tip age", age, "of a block", ahead, "seconds ahead")
+		}
+	}
+	// It ages normally once its time has passed.
+	now = now.Add(2 * time.Hour)
+	if age := testutil.ToFloat64(Metrics.TipAgeGauge); age != 3600 {
+		t.Fatal("unexpected tip age", age)
+	}
+}
+
+// The sequence of (display-order) best block hashes returned by
+// blockIngestorDebounceStub; "" means the hash of the given test block.
+var debounceTips []string
+
+func blockIngestorDebounceStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method == "getblock" {
+		return blockIngestorBatchStub(method, params)
+	}
+	if method != "getbestblockhash" {
+		testT.Fatal("unexpected method", method)
+	}
+	if len(debounceTips) == 0 {
+		testT.Fatal("unexpected call to getbestblockhash")
+	}
+	r, _ := json.Marshal(debounceTips[0])
+	debounceTips = debounceTips[1:]
+	return r, nil
+}
+
+func TestBlockIngestorDebounce(t *testing.T) {
+	testT = t
+	RawRequest = blockIngestorDebounceStub
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	IngestDebounce = 300 * time.Millisecond
+	batchRequests = 0
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+
+	var compact []*walletrpc.CompactBlock
+	for _, b := range blocks[:2] {
+		var blockHex string
+		json.Unmarshal(b, &blockHex)
+		blockData, _ := hex.DecodeString(blockHex)
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockData); err != nil {
+			t.Fatal(err)
+		}
+		compact = append(compact, block.ToCompact())
+	}
+	if err := testcache.Add(380640, compact[0]); err != nil {
+		t.Fatal(err)
+	}
+	tip0, tip1 := displayHash(compact[0].Hash), displayHash(compact[1].Hash)
+	debounceTips = []string{
+		tip0,             // synced
+		"aa", tip0, tip0, // brief reorg that reverts; nothing to do
+		tip0,                   // synced
+		"bb", "cc", tip1, tip1, // churn, then settles on 380641
+		tip1, // synced
+	}
+	BlockIngestor(testcache, 5)
+	if len(debounceTips) != 0 {
+		t.Fatal("unexpected number of getbestblockhash calls", len(debounceTips))
+	}
+	if testcache.GetLatestHeight() != 380641 ||
+		!bytes.Equal(testcache.GetLatestHash(), compact[1].Hash) {
+		t.Fatal("unexpected latest block", testcache.GetLatestHeight())
+	}
+	// Only the stable block was fetched (twice, plain and verbose).
+	if batchRequests != 2 {
+		t.Fatal("unexpected number of getblock requests", batchRequests)
+	}
+	// three synced waits and five debounce waits
+	if sleepDuration != 3*2*time.Second+5*IngestDebounce {
+		t.Fatal("unexpected sleep duration", sleepDuration)
+	}
+	IngestDebounce = 0
+	batchRequests = 0
+	sleepCount = 0
+	sleepDuration = 0
+	os.RemoveAll(unitTestPath)
+}
+
+// While pirated is unreachable (or failing), the block ingestor backs off
+// (on the injected clock, without sleeping) and retries, rather than exiting.
+func TestBlockIngestorUnreachable(t *testing.T) {
+	start := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	restore := SetDeterministic(42, start)
+	b := Backoff{Min: time.Second, Max: 30 * time.Second}
+	var expected time.Duration
+	for i := 0; i < 5; i++ {
+		expected += b.Next()
+	}
+	restore()
+	restore = SetDeterministic(42, start)
+	defer restore()
+	defer func() { RawRequest = nil }()
+	var calls []string
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		calls = append(calls, method)
+		switch {
+		case method == "getbestblockhash" && len(calls) <= 2:
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		case method == "getbestblockhash" && len(calls) == 3:
+			return nil, errors.New("-28: Loading block index...")
+		case method == "getbestblockhash":
+			return json.Marshal(strings.Repeat("ab", 32))
+		case method == "getblock":
+			return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+		}
+		t.Fatal("unexpected rpc", method)
+		return nil, nil
+	}
+	IngestBatchSize = 1
+	BlockIngestor(NewMemoryBlockCache(380640), 5)
+	if len(calls) != 7 || Time.Now().Sub(start) != expected {
+		t.Fatal("unexpected ingestor backoff", calls, Time.Now().Sub(start), expected)
+	}
+}
+
+// unreadableCache is a cache whose block at the given height can't be read.
+type unreadableCache struct {
+	Cache
+	height int
+}
+
+func (c unreadableCache) Get(height int) *walletrpc.CompactBlock {
+	if height == c.height {
+		return nil
+	}
+	return c.Cache.Get(height)
+}
+
+func TestBlockIngestorPiratedBehind(t *testing.T) {
+	testT = t
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	for i, b := range blocks {
+		var blockHex string
+		json.Unmarshal(b, &blockHex)
+		blockData, _ := hex.DecodeString(blockHex)
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockData); err != nil {
+			t.Fatal(err)
+		}
+		if err := testcache.Add(380640+i, block.ToCompact()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pirated (reindexing) is at 380641, and agrees with the cache up to
+	// there; blockHashes (in display order) are its blocks' hashes.
+	bestHeight := 380641
+	blockHashes := map[int]string{
+		380640: displayHash(testcache.Get(380640).Hash),
+		380641: displayHash(testcache.Get(380641).Hash),
+	}
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getbestblockhash":
+			return json.Marshal(blockHashes[bestHeight])
+		case "getblockcount":
+			return json.Marshal(bestHeight)
+		case "getblockhash":
+			var height int
+			json.Unmarshal(params[0], &height)
+			return json.Marshal(blockHashes[height])
+		case "getblock":
+			var height string
+			json.Unmarshal(params[0], &height)
+			if h, _ := strconv.Atoi(height); h <= bestHeight {
+				return blockIngestorBatchStub(method, params)
+			}
+			return nil, errors.New("-8: Block height out of range")
+		}
+		t.Fatal("unexpected method", method)
+		return nil, nil
+	}
+
+	// The cache is kept while pirated catches up.
+	BlockIngestor(testcache, 2)
+	if testcache.GetLatestHeight() != 380643 {
+		t.Fatal("cache rolled back while pirated is behind", testcache.GetLatestHeight())
+	}
+	if sleepCount != 2 || sleepDuration != 2*10*time.Second {
+		t.Fatal("unexpected sleeps", sleepCount, sleepDuration)
+	}
+
+	// pirated's 380641 is now a different block, so the cache is rolled
+	// back to the common ancestor, 380640, and then follows pirated.
+	tip := blockHashes[380641]
+	blockHashes[380641] = "aa"
+	BlockIngestor(testcache, 1)
+	if testcache.GetLatestHeight() != 380640 {
+		t.Fatal("unexpected latest height", testcache.GetLatestHeight())
+	}
+	// (The stub serves the original block.)
+	blockHashes[380641] = tip
+	BlockIngestor(testcache, 1)
+	if testcache.GetLatestHeight() != 380641 || displayHash(testcache.GetLatestHash()) != tip {
+		t.Fatal("unexpected latest height", testcache.GetLatestHeight())
+	}
+
+	// A cached block that can't be read is compared again later.
+	bestHeight = 380640
+	behind, err := piratedBehind(unreadableCache{testcache, 380640})
+	if err != nil || !behind || testcache.GetLatestHeight() != 380641 {
+		t.Fatal("unexpected result for an unreadable block", behind, err, testcache.GetLatestHeight())
+	}
+	sleepCount = 0
+	sleepDuration = 0
+	os.RemoveAll(unitTestPath)
+}
+
+func TestBlockIngestorStop(t *testing.T) {
+	testT = t
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	os.RemoveAll(unitTestPath)
+	testcache = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	block := testBlock(380640, 0)
+	if err := testcache.Add(380640, block); err != nil {
+		t.Fatal(err)
+	}
+	// The ingestor is synced, so it just polls until it's stopped.
+	tip, _ := json.Marshal(displayHash(block.Hash))
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return tip, nil
+	}
+
+	StartIngestor(testcache)
+	StopIngestor()
+	if ingestorRunning {
+		t.Fatal("ingestor still running")
+	}
+	logFile, err := ioutil.ReadFile("test-log")
+	if err != nil {
+		t.Fatal("Cannot read test-log", err)
+	}
+	if !strings.Contains(string(logFile), "Block ingestor stopped, cache flushed") ||
+		!strings.Contains(string(logFile), "hash="+displayHash(block.Hash)) ||
+		!strings.Contains(string(logFile), "height=380640") {
+		t.Fatal("Cannot find the final ingestor state in test-log")
+	}
+	sleepCount = 0
+	sleepDuration = 0
+	testcache.Close()
+	os.RemoveAll(unitTestPath)
+}
+
 // ------------------------------------------ GetBlockRange()
 
 // There are four test blocks, 0..3
@@ -380,6 +1093,11 @@ func getblockStub(method string, params []json.RawMessage) (json.RawMessage, err
 	if err != nil {
 		testT.Fatal("could not unmarshal height")
 	}
+	if string(params[1]) == "1" {
+		// The verbose getblock (for the txids) that follows each block
+		// isn't a step; each test block has one transaction.
+		return json.Marshal(&PirateRpcReplyGetblock1{Tx: []string{strings.Repeat("00", 32)}})
+	}
 
 	step++
 	switch step {
@@ -538,6 +1256,11 @@ func getblockStubReverse(method string, params []json.RawMessage) (json.RawMessa
 	if err != nil {
 		testT.Fatal("could not unmarshal height")
 	}
+	if string(params[1]) == "1" {
+		// The verbose getblock (for the txids) that follows each block
+		// isn't a step; each test block has one transaction.
+		return json.Marshal(&PirateRpcReplyGetblock1{Tx: []string{strings.Repeat("00", 32)}})
+	}
 
 	step++
 	switch step {
@@ -724,7 +1447,7 @@ func TestMempoolStream(t *testing.T) {
 
 	var replies []*walletrpc.RawTransaction
 	// The first request after startup immediately returns an empty list.
-	err := GetMempool(func(tx *walletrpc.RawTransaction) error {
+	err := GetMempool(context.Background(), 0, func(tx *walletrpc.RawTransaction) error {
 		t.Fatal("send to client function called on initial GetMempool call")
 		return nil
 	})
@@ -733,7 +1456,7 @@ func TestMempoolStream(t *testing.T) {
 	}
 
 	// This should return two transactions.
-	err = GetMempool(func(tx *walletrpc.RawTransaction) error {
+	err = GetMempool(context.Background(), 0, func(tx *walletrpc.RawTransaction) error {
 		replies = append(replies, tx)
 		return nil
 	})
@@ -771,3 +1494,140 @@ func TestMempoolStream(t *testing.T) {
 	sleepCount = 0
 	sleepDuration = 0
 }
+
+// A new block arrives, which ends the stream.
+func mempoolCursorStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "getblockchaininfo" {
+		testT.Fatal("unexpected method", method)
+	}
+	r, _ := json.Marshal(&PiratedRpcReplyGetblockchaininfo{
+		BestBlockHash: "d1d2d3",
+		Blocks:        201,
+	})
+	return r, nil
+}
+
+func TestMempoolStreamCursor(t *testing.T) {
+	testT = t
+	RawRequest = mempoolCursorStub
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	sleepDuration = 1000 * time.Second
+
+	// the current block interval has three transactions, 1000-1002
+	setup := func() {
+		g_lastBlockChainInfo = &PiratedRpcReplyGetblockchaininfo{BestBlockHash: "010203", Blocks: 200}
+		g_lastTime = nowStub()
+		g_txList = nil
+		for i := 0; i < 3; i++ {
+			g_txList = append(g_txList, &walletrpc.RawTransaction{Data: []byte{byte(i)}, Sequence: uint64(1000 + i)})
+		}
+		g_firstSequence = 1000
+		g_nextSequence = 1003
+	}
+	for _, tt := range []struct {
+		name     string
+		cursor   uint64
+		reset    bool
+		expected []uint64
+	}{
+		{"fresh", 0, false, []uint64{1000, 1001, 1002}},
+		{"resume", 1000, false, []uint64{1001, 1002}},
+		{"resume at the end", 1002, false, nil},
+		{"stale", 990, true, []uint64{1000, 1001, 1002}},
+		{"just before the interval", 999, true, []uint64{1000, 1001, 1002}},
+		{"unknown", 2000, true, []uint64{1000, 1001, 1002}},
+	} {
+		setup()
+		var replies []*walletrpc.RawTransaction
+		err := GetMempool(context.Background(), tt.cursor, func(tx *walletrpc.RawTransaction) error {
+			replies = append(replies, tx)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(tt.name, "GetMempool failed", err)
+		}
+		if tt.reset {
+			if len(replies) == 0 || !replies[0].CursorReset || replies[0].Data != nil {
+				t.Fatal(tt.name, "expected a reset marker")
+			}
+			replies = replies[1:]
+		}
+		if len(replies) != len(tt.expected) {
+			t.Fatal(tt.name, "unexpected number of tx", len(replies))
+		}
+		for i, tx := range replies {
+			if tx.CursorReset || tx.Sequence != tt.expected[i] {
+				t.Fatal(tt.name, "unexpected tx", tx)
+			}
+		}
+	}
+	// After the new block, the old cursors are stale.
+	if g_firstSequence != 1003 || len(g_txList) != 0 {
+		t.Fatal("unexpected mempool state after new block")
+	}
+	// Until there's one, the sequence starts from the (current) time.
+	restore := SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	g_firstSequence, g_nextSequence = 0, 0
+	startSequence()
+	if g_nextSequence != 1614834367000000 || g_firstSequence != g_nextSequence {
+		t.Fatal("unexpected first sequence", g_nextSequence)
+	}
+	Time.Sleep(time.Second)
+	startSequence()
+	if g_nextSequence != 1614834367000000 {
+		t.Fatal("sequence restarted", g_nextSequence)
+	}
+	restore()
+	sleepCount = 0
+	sleepDuration = 0
+}
+
+func TestCoinbaseMarkers(t *testing.T) {
+	testT = t
+	defer func() {
+		CoinbaseMarkers = false
+		RawRequest = nil
+	}()
+	// The block at 380640, its coinbase given a (dummy) Sapling output: the
+	// transaction ends with no spends, no outputs, and no JoinSplits; it
+	// becomes one output (948 bytes), no JoinSplits, and a binding signature.
+	var blockHex string
+	json.Unmarshal(blocks[0], &blockHex)
+	blockData, _ := hex.DecodeString(blockHex)
+	if !bytes.HasSuffix(blockData, []byte{0, 0, 0}) {
+		t.Fatal("unexpected test block")
+	}
+	blockData = append(blockData[:len(blockData)-2], 1)
+	blockData = append(blockData, make([]byte, 948)...)
+	blockData = append(blockData, 0)
+	blockData = append(blockData, make([]byte, 64)...)
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if string(params[1]) == "1" {
+			return json.Marshal(&PirateRpcReplyGetblock1{Tx: []string{strings.Repeat("00", 32)}})
+		}
+		return json.Marshal(hex.EncodeToString(blockData))
+	}
+
+	for _, markers := range []bool{false, true} {
+		CoinbaseMarkers = markers
+		block, err := getBlockFromRPC(context.Background(), 380640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Vtx) != 1 || len(block.Vtx[0].Outputs) != 1 || block.Vtx[0].Coinbase != markers {
+			t.Fatal("unexpected coinbase marker", markers, block.Vtx)
+		}
+	}
+
+	// Other transactions aren't coinbase.
+	json.Unmarshal(blocks[3], &blockHex)
+	blockData, _ = hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	if txs := block.Transactions(); len(txs) != 2 || !txs[0].IsCoinbase() || txs[1].IsCoinbase() {
+		t.Fatal("unexpected coinbase transactions")
+	}
+}
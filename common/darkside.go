@@ -78,7 +78,7 @@ func DarksideInit(c *BlockCache, timeout int) {
 // that are returned by GetLightdInfo().
 func DarksideReset(sa int, bi, cn string) error {
 	Log.Info("DarksideReset(saplingActivation=", sa, ")")
-	stopIngestor()
+	StopIngestor()
 	state = darksideState{
 		resetted:             true,
 		startHeight:          sa,
@@ -92,6 +92,7 @@ func DarksideReset(sa int, bi, cn string) error {
 		stagedTransactions:   make([]stagedTx, 0),
 	}
 	state.cache.Reset(sa)
+	invalidateLightdInfoCache()
 	return nil
 }
 
@@ -224,9 +225,9 @@ func DarksideApplyStaged(height int) error {
 
 	// The block ingestor can only run if there are blocks
 	if len(state.activeBlocks) > 0 {
-		startIngestor(state.cache)
+		StartIngestor(state.cache)
 	} else {
-		stopIngestor()
+		StopIngestor()
 	}
 	return nil
 }
@@ -459,6 +460,28 @@ func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessag
 
 		return []byte(hex.EncodeToString(tx.GetDisplayHash())), nil
 
+	case "testmempoolaccept":
+		var rawtxs []string
+		err := json.Unmarshal(params[0], &rawtxs)
+		if err != nil || len(rawtxs) != 1 {
+			return nil, errors.New("failed to parse testmempoolaccept JSON")
+		}
+		txBytes, err := hex.DecodeString(rawtxs[0])
+		if err != nil {
+			return nil, errors.New("failed to parse testmempoolaccept value as a hex string")
+		}
+		// Any transaction that parses would be accepted.
+		reply := PiratedRpcReplyTestmempoolaccept{Allowed: true}
+		tx := parser.NewTransaction()
+		if rest, err := tx.ParseFromSlice(txBytes); err != nil {
+			reply = PiratedRpcReplyTestmempoolaccept{RejectReason: err.Error()}
+		} else if len(rest) != 0 {
+			reply = PiratedRpcReplyTestmempoolaccept{RejectReason: "transaction serialization is too long"}
+		} else {
+			reply.Txid = hex.EncodeToString(tx.GetDisplayHash())
+		}
+		return json.Marshal([]PiratedRpcReplyTestmempoolaccept{reply})
+
 	case "getrawmempool":
 		reply := make([]string, 0)
 		addTxToReply := func(txBytes []byte) {
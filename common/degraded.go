@@ -0,0 +1,116 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// StaleHeader is the grpc header added to replies while pirated is
+// unreachable (the server is degraded); they're served from the cache,
+// whose tip isn't advancing, so may be stale. Its value is the number of
+// seconds since pirated was last reached.
+const StaleHeader = "x-lightwalletd-stale"
+
+// backendState is whether pirated is reachable, according to the most
+// recent rpc (of any kind, including the block ingestor's polling).
+var backendState struct {
+	mutex       sync.Mutex
+	down        bool
+	lastReached time.Time // or when it was first found down, if never
+}
+
+// recordBackendResult updates backendState after an rpc; an error reply
+// from pirated shows that it's reachable.
+func recordBackendResult(err error) {
+	backendState.mutex.Lock()
+	defer backendState.mutex.Unlock()
+	now := Time.Now()
+	if err != nil && rpcErrorCategory(err) != "rpc-error" {
+		if !backendState.down && backendState.lastReached.IsZero() {
+			backendState.lastReached = now
+		}
+		if !backendState.down {
+			Log.Warning("pirated is unreachable, serving cached data only: ", err)
+		}
+		backendState.down = true
+		return
+	}
+	if backendState.down {
+		Log.Info("pirated is reachable again")
+	}
+	backendState.down = false
+	backendState.lastReached = now
+}
+
+// BackendUnavailable returns whether pirated is unreachable, and if so,
+// for how long (since it was last reached).
+func BackendUnavailable() (bool, time.Duration) {
+	backendState.mutex.Lock()
+	defer backendState.mutex.Unlock()
+	if !backendState.down {
+		return false, 0
+	}
+	return true, Time.Now().Sub(backendState.lastReached)
+}
+
+// degradedError returns the (non-status) error an rpc failed with as
+// Unavailable, if pirated is unreachable, since it's likely the reason.
+func degradedError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if down, _ := BackendUnavailable(); !down {
+		return err
+	}
+	return status.Error(codes.Unavailable, "pirated is unreachable: "+err.Error())
+}
+
+func staleHeader(stale time.Duration) metadata.MD {
+	return metadata.Pairs(StaleHeader, strconv.Itoa(int(stale.Seconds())))
+}
+
+// DegradedUnaryInterceptor marks replies served while pirated is
+// unreachable as possibly stale (see StaleHeader), and returns failures
+// (of rpcs that needed pirated) as Unavailable.
+func DegradedUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if down, stale := BackendUnavailable(); down {
+		// This fails only if there's no grpc transport (unit tests).
+		grpc.SetHeader(ctx, staleHeader(stale))
+	}
+	resp, err := handler(ctx, req)
+	return resp, degradedError(err)
+}
+
+// DegradedStreamInterceptor is the streaming equivalent of
+// DegradedUnaryInterceptor.
+func DegradedStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if down, stale := BackendUnavailable(); down {
+		ss.SetHeader(staleHeader(stale))
+	}
+	return degradedError(handler(srv, ss))
+}
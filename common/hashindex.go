@@ -0,0 +1,125 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// HashIndexBlocks, if not zero, limits the hash index (see hashIndex) to
+// about this many of the most recent blocks, to bound its memory; older
+// blocks then can't be found by hash. It must be set before the cache is
+// created.
+var HashIndexBlocks int
+
+// hashIndexEntryBytes estimates the memory an index entry takes: its key
+// and value, and the map's overhead.
+const hashIndexEntryBytes = 40
+
+// hashIndexEntries is the number of entries in all the caches' indexes,
+// for the lightwalletd_cache_hash_index_bytes metric.
+var hashIndexEntries int64
+
+// hashIndexBytes estimates the memory used by the hash indexes.
+func hashIndexBytes() float64 {
+	return float64(atomic.LoadInt64(&hashIndexEntries) * hashIndexEntryBytes)
+}
+
+// hashIndex maps the blocks' hashes to their heights, so a block can be
+// found by hash (for example, a client's resume point). To keep it small,
+// it's keyed by only the first 8 bytes of each hash (in internal order, so
+// not the proof-of-work zeros), and a lookup must check the block's full
+// hash. In the unlikely event that two blocks share a key, only the later
+// is found.
+type hashIndex struct {
+	heights map[uint64]int
+	limit   int // HashIndexBlocks
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{heights: make(map[uint64]int), limit: HashIndexBlocks}
+}
+
+func hashIndexKey(hash []byte) (uint64, bool) {
+	if len(hash) < 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(hash), true
+}
+
+// add indexes the block at the given height, which must be the highest.
+func (h *hashIndex) add(hash []byte, height int) {
+	key, ok := hashIndexKey(hash)
+	if !ok {
+		return
+	}
+	if _, ok := h.heights[key]; !ok {
+		atomic.AddInt64(&hashIndexEntries, 1)
+	}
+	h.heights[key] = height
+	// Trim the oldest blocks only once there are an eighth too many, so
+	// that (visiting every entry) costs little per block.
+	if h.limit > 0 && len(h.heights) > h.limit+h.limit/8 {
+		h.remove(func(blockHeight int) bool { return blockHeight <= height-h.limit })
+	}
+}
+
+// lookup returns the height of the block that may have the given hash, or
+// -1 if none can.
+func (h *hashIndex) lookup(hash []byte) int {
+	key, ok := hashIndexKey(hash)
+	if !ok {
+		return -1
+	}
+	height, ok := h.heights[key]
+	if !ok {
+		return -1
+	}
+	return height
+}
+
+// truncate removes the blocks from the given height on. It visits every
+// entry, but is needed only after a reorg (or corruption).
+func (h *hashIndex) truncate(height int) {
+	h.remove(func(blockHeight int) bool { return blockHeight >= height })
+}
+
+// clear removes all the blocks (when the cache is closed).
+func (h *hashIndex) clear() {
+	h.remove(func(int) bool { return true })
+}
+
+func (h *hashIndex) remove(match func(height int) bool) {
+	for key, blockHeight := range h.heights {
+		if match(blockHeight) {
+			delete(h.heights, key)
+			atomic.AddInt64(&hashIndexEntries, -1)
+		}
+	}
+}
+
+// len returns the number of blocks indexed.
+func (h *hashIndex) len() int {
+	return len(h.heights)
+}
+
+// GetHeightByHash returns the height of the cached block with the given
+// hash, or -1 if there's none (it may never have been on the best chain,
+// or have been reorged away).
+func (c *BlockCache) GetHeightByHash(hash []byte) int {
+	c.mutex.RLock()
+	height := c.hashes.lookup(hash)
+	c.mutex.RUnlock()
+	if height < 0 {
+		return -1
+	}
+	if block := c.GetShared(height); block == nil || !bytes.Equal(block.Hash, hash) {
+		return -1
+	}
+	return height
+}
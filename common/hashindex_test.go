@@ -0,0 +1,76 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHashIndex(t *testing.T) {
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	before := hashIndexBytes()
+	c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+	for height := 380640; height < 380650; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.hashes.len() != 10 || hashIndexBytes()-before != 10*hashIndexEntryBytes {
+		t.Fatal("unexpected index size", c.hashes.len(), hashIndexBytes()-before)
+	}
+	for height := 380640; height < 380650; height++ {
+		if c.GetHeightByHash(testBlock(height, 0).Hash) != height {
+			t.Fatal("unexpected height by hash", height)
+		}
+	}
+
+	// Reorged-away blocks are removed from the index, not just unreachable.
+	c.Reorg(380647)
+	if c.hashes.len() != 7 || hashIndexBytes()-before != 7*hashIndexEntryBytes {
+		t.Fatal("unexpected index size after reorg", c.hashes.len(), hashIndexBytes()-before)
+	}
+	for height := 380647; height < 380650; height++ {
+		if c.hashes.lookup(testBlock(height, 0).Hash) != -1 {
+			t.Fatal("reorged-away block still indexed", height)
+		}
+	}
+	if err := c.Add(380647, testBlock(380647, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetHeightByHash(testBlock(380647, 1).Hash) != 380647 || c.GetHeightByHash(testBlock(380647, 0).Hash) != -1 {
+		t.Fatal("unexpected replacement block by hash")
+	}
+	c.Close()
+	if hashIndexBytes() != before {
+		t.Fatal("index not released by Close", hashIndexBytes()-before)
+	}
+
+	// The index is rebuilt when the cache is opened ...
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	if c.hashes.len() != 8 || c.GetHeightByHash(testBlock(380644, 0).Hash) != 380644 {
+		t.Fatal("unexpected index after reopening", c.hashes.len())
+	}
+	c.Close()
+
+	// ... and can be limited to the most recent blocks.
+	HashIndexBlocks = 4
+	defer func() { HashIndexBlocks = 0 }()
+	c = NewBlockCache(unitTestPath, unitTestChain, 380640, -1)
+	defer c.Close()
+	for height := 380648; height < 380660; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+		if c.hashes.len() > 4+4/8+1 {
+			t.Fatal("index not limited", height, c.hashes.len())
+		}
+	}
+	if c.GetHeightByHash(testBlock(380659, 0).Hash) != 380659 || c.GetHeightByHash(testBlock(380656, 0).Hash) != 380656 ||
+		c.GetHeightByHash(testBlock(380650, 0).Hash) != -1 {
+		t.Fatal("unexpected limited index")
+	}
+}
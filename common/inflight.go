@@ -0,0 +1,63 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// requestStarted increments the in-flight gauges for the given method; the
+// returned function decrements them, and should be deferred so that it runs
+// even if the handler panics.
+func requestStarted(method string) func() {
+	Metrics.InFlightRequestsGauge.Inc()
+	Metrics.InFlightMethodGauge.WithLabelValues(method).Inc()
+	return func() {
+		Metrics.InFlightRequestsGauge.Dec()
+		Metrics.InFlightMethodGauge.WithLabelValues(method).Dec()
+	}
+}
+
+// StreamGoroutineStarted increments the stream goroutines gauge, for a
+// goroutine that runs a streaming request's handler, or a helper on its
+// behalf; the returned function decrements it, and should be deferred by
+// the goroutine. A gauge that doesn't return to zero when there are no
+// streams shows that goroutines are leaking (not stopping when their
+// client goes away).
+func StreamGoroutineStarted() func() {
+	if Metrics == nil {
+		return func() {}
+	}
+	gauge := Metrics.StreamGoroutinesGauge
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// InFlightUnaryInterceptor tracks the number of unary requests in progress.
+func InFlightUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	defer requestStarted(info.FullMethod)()
+	return handler(ctx, req)
+}
+
+// InFlightStreamInterceptor tracks the number of streaming requests in
+// progress (until the stream is closed).
+func InFlightStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	defer requestStarted(info.FullMethod)()
+	defer StreamGoroutineStarted()()
+	return handler(srv, ss)
+}
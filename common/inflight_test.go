@@ -0,0 +1,67 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+)
+
+func TestInFlightInterceptor(t *testing.T) {
+	Metrics = GetPrometheusMetrics()
+	const method = "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlock"
+	inFlight := func() (float64, float64) {
+		return testutil.ToFloat64(Metrics.InFlightRequestsGauge),
+			testutil.ToFloat64(Metrics.InFlightMethodGauge.WithLabelValues(method))
+	}
+
+	// Hold a slow handler open and observe the gauges.
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	slowHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		close(entered)
+		<-release
+		return nil, nil
+	}
+	go func() {
+		InFlightUnaryInterceptor(context.Background(), nil,
+			&grpc.UnaryServerInfo{FullMethod: method}, slowHandler)
+		close(done)
+	}()
+	<-entered
+	if total, byMethod := inFlight(); total != 1 || byMethod != 1 {
+		t.Fatal("unexpected in-flight requests", total, byMethod)
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not finish")
+	}
+	if total, byMethod := inFlight(); total != 0 || byMethod != 0 {
+		t.Fatal("unexpected in-flight requests", total, byMethod)
+	}
+
+	// The gauges are decremented even if the (stream) handler panics.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		InFlightStreamInterceptor(nil, nil, &grpc.StreamServerInfo{FullMethod: method},
+			func(srv interface{}, ss grpc.ServerStream) error {
+				panic("handler panic")
+			})
+	}()
+	if total, byMethod := inFlight(); total != 0 || byMethod != 0 {
+		t.Fatal("unexpected in-flight requests after panic", total, byMethod)
+	}
+}
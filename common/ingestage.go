@@ -0,0 +1,65 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// lastIngest is what the tip age metrics (which are computed when they're
+// scraped, so they keep growing while no blocks arrive) are based on.
+var lastIngest struct {
+	mutex      sync.Mutex
+	ingestedAt time.Time // when a block was last added (or the ingestor started)
+	tipTime    time.Time // the cache tip's block (header) time; zero if unknown
+}
+
+// setIngestTip records the cache's new tip block (which may be nil), and if
+// ingested, that it was just added by the block ingestor.
+func setIngestTip(tip *walletrpc.CompactBlock, ingested bool) {
+	lastIngest.mutex.Lock()
+	defer lastIngest.mutex.Unlock()
+	now := Time.Now()
+	if ingested || lastIngest.ingestedAt.IsZero() {
+		lastIngest.ingestedAt = now
+	}
+	lastIngest.tipTime = time.Time{}
+	if tip != nil {
+		lastIngest.tipTime = time.Unix(int64(tip.Time), 0)
+		if ahead := lastIngest.tipTime.Sub(now); ingested && ahead > ClockSkewWarning {
+			Log.Warning("block ", tip.Height, " time is ", ahead, " in the future; is this host's clock right?")
+		}
+	}
+}
+
+// tipAgeSeconds is the wall-clock age of the cache's tip block, or zero if
+// its time is in the future (however far ahead it is).
+func tipAgeSeconds() float64 {
+	lastIngest.mutex.Lock()
+	defer lastIngest.mutex.Unlock()
+	if lastIngest.tipTime.IsZero() {
+		return 0
+	}
+	age := Time.Now().Sub(lastIngest.tipTime).Seconds()
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// secondsSinceLastBlock is how long ago the block ingestor last added a
+// block to the cache.
+func secondsSinceLastBlock() float64 {
+	lastIngest.mutex.Lock()
+	defer lastIngest.mutex.Unlock()
+	if lastIngest.ingestedAt.IsZero() {
+		return 0
+	}
+	return Time.Now().Sub(lastIngest.ingestedAt).Seconds()
+}
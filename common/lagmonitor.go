@@ -0,0 +1,95 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LagMonitor periodically compares the cache's tip with pirated's best
+// height, and raises an alarm (an error log and the ingest lag alarm metric)
+// if the cache stays too far behind for too long, which usually means the
+// block ingestor is stuck. A lag that recovers within Duration (as when new
+// blocks arrive faster than usual) is ignored.
+type LagMonitor struct {
+	Cache     Cache
+	Interval  time.Duration // time between checks
+	Threshold int           // blocks behind pirated that count as lagging
+	Duration  time.Duration // how long the lag must last to raise the alarm
+
+	laggingSince time.Time // zero if not lagging
+	alarmed      bool
+}
+
+// Run checks the lag forever, every m.Interval.
+func (m *LagMonitor) Run() {
+	for {
+		Time.Sleep(m.Interval)
+		m.check()
+	}
+}
+
+// check updates the lag metrics and alarm state once.
+func (m *LagMonitor) check() {
+	result, err := RawRequest("getblockcount", []json.RawMessage{})
+	if err != nil {
+		// pirated's own problems are reported elsewhere.
+		return
+	}
+	var bestHeight int
+	if err := json.Unmarshal(result, &bestHeight); err != nil {
+		Log.Warning("bad getblockcount return: ", err)
+		return
+	}
+	cacheHeight := m.Cache.GetLatestHeight()
+	lag := bestHeight - cacheHeight
+	if lag < 0 {
+		// The cache is ahead of pirated (which may be reorging).
+		lag = 0
+	}
+	if Metrics != nil {
+		Metrics.IngestLagGauge.Set(float64(lag))
+	}
+	now := Time.Now()
+	if lag <= m.Threshold {
+		if m.alarmed {
+			Log.WithFields(logrus.Fields{
+				"lag":    lag,
+				"height": cacheHeight,
+				"lasted": now.Sub(m.laggingSince).String(),
+			}).Info("Block ingestion has caught up")
+		}
+		m.laggingSince = time.Time{}
+		m.setAlarm(false)
+		return
+	}
+	if m.laggingSince.IsZero() {
+		m.laggingSince = now
+	}
+	if !m.alarmed && now.Sub(m.laggingSince) >= m.Duration {
+		Log.WithFields(logrus.Fields{
+			"lag":         lag,
+			"height":      cacheHeight,
+			"pirated_tip": bestHeight,
+			"lagging_for": now.Sub(m.laggingSince).String(),
+		}).Error("Block ingestion is falling behind pirated")
+		m.setAlarm(true)
+	}
+}
+
+func (m *LagMonitor) setAlarm(alarmed bool) {
+	m.alarmed = alarmed
+	if Metrics != nil {
+		value := 0.0
+		if alarmed {
+			value = 1
+		}
+		Metrics.IngestLagAlarmGauge.Set(value)
+	}
+}
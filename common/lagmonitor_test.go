@@ -0,0 +1,85 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLagMonitor(t *testing.T) {
+	Metrics = GetPrometheusMetrics()
+	Time.Sleep = sleepStub
+	Time.Now = nowStub
+	sleepCount, sleepDuration = 0, 0
+	defer func() { sleepCount, sleepDuration = 0, 0 }()
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	defer func() {
+		c.Close()
+		os.RemoveAll(unitTestPath)
+	}()
+	for height := 1000; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bestHeight := 1009
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblockcount" {
+			t.Fatal("unexpected rpc", method)
+		}
+		if bestHeight < 0 {
+			return nil, errors.New("connection refused")
+		}
+		return json.RawMessage(strconv.Itoa(bestHeight)), nil
+	}
+	m := &LagMonitor{Cache: c, Interval: 10 * time.Second, Threshold: 5, Duration: time.Minute}
+	// step advances time by one interval and checks the lag.
+	step := func(expectedLag, expectedAlarm float64) {
+		t.Helper()
+		sleepStub(m.Interval)
+		m.check()
+		if lag := testutil.ToFloat64(Metrics.IngestLagGauge); lag != expectedLag {
+			t.Fatal("unexpected lag", lag)
+		}
+		if alarm := testutil.ToFloat64(Metrics.IngestLagAlarmGauge); alarm != expectedAlarm {
+			t.Fatal("unexpected alarm", alarm)
+		}
+	}
+
+	step(0, 0)
+	// A brief lag (shorter than the duration) is not an alarm.
+	bestHeight = 1020
+	for i := 0; i < 3; i++ {
+		step(11, 0)
+	}
+	bestHeight = 1012
+	step(3, 0)
+	// A sustained lag is, once it has lasted the duration.
+	bestHeight = 1020
+	for i := 0; i < 6; i++ {
+		step(11, 0)
+	}
+	step(11, 1)
+	bestHeight = 1030
+	step(21, 1)
+	// An rpc failure doesn't change anything.
+	bestHeight = -1
+	step(21, 1)
+	// Recovery clears the alarm.
+	bestHeight = 1012
+	step(3, 0)
+	// The cache ahead of pirated (during a reorg) isn't lag.
+	bestHeight = 1005
+	step(0, 0)
+}
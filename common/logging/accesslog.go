@@ -0,0 +1,294 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AccessLogFormats are the predefined access log formats, as in Apache's
+// configuration; a format can also be given explicitly (see
+// NewAccessLogger()).
+var AccessLogFormats = map[string]string{
+	"common":   `%h %l %u %t "%r" %>s %b`,
+	"combined": `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+}
+
+// AccessLog, if not nil, receives a line for each (completed) rpc.
+var AccessLog *AccessLogger
+
+// AccessLogger writes Apache-style access log lines, for log pipelines
+// that expect them.
+type AccessLogger struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	format []accessLogField
+}
+
+// accessLogRecord is what's known of a completed rpc.
+type accessLogRecord struct {
+	peer     string
+	method   string
+	md       metadata.MD
+	start    time.Time
+	duration time.Duration
+	code     codes.Code
+	bytes    int
+}
+
+type accessLogField func(buf *bytes.Buffer, r *accessLogRecord)
+
+// NewAccessLogger returns an access logger that writes to w, in the given
+// format: the name of one of AccessLogFormats, or a format string with
+// these (Apache) directives:
+//
+//	%h   the peer's address
+//	%l   "-" (the remote logname)
+//	%u   "-" (the remote user)
+//	%t   the time the rpc started, as [02/Jan/2006:15:04:05 -0700]
+//	%r   the request line, "POST /<service>/<method> HTTP/2.0"
+//	%m   the request method, POST
+//	%U   the rpc's path, /<service>/<method>
+//	%H   the protocol, HTTP/2.0
+//	%s   the http equivalent of the rpc's status (as %>s)
+//	%b   the size of the reply (the total for a stream), or "-" if empty
+//	%B   the size of the reply, or 0
+//	%D   the rpc's duration in microseconds
+//	%T   the rpc's duration in seconds
+//	%{Name}i  the request header (grpc metadata) Name, or "-"
+//	%%   a percent sign
+func NewAccessLogger(w io.Writer, format string) (*AccessLogger, error) {
+	if f, ok := AccessLogFormats[format]; ok {
+		format = f
+	}
+	fields, err := parseAccessLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLogger{w: w, format: fields}, nil
+}
+
+func parseAccessLogFormat(format string) ([]accessLogField, error) {
+	fields := make([]accessLogField, 0)
+	literal := func(s string) accessLogField {
+		return func(buf *bytes.Buffer, r *accessLogRecord) { buf.WriteString(s) }
+	}
+	for len(format) > 0 {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			fields = append(fields, literal(format))
+			break
+		}
+		if i > 0 {
+			fields = append(fields, literal(format[:i]))
+		}
+		format = format[i+1:]
+		if strings.HasPrefix(format, ">") {
+			// The final status (there are no internal redirects).
+			format = format[1:]
+		}
+		if format == "" {
+			return nil, errors.New("access log format ends with %")
+		}
+		if format[0] == '{' {
+			end := strings.IndexByte(format, '}')
+			if end < 0 || end+1 >= len(format) || format[end+1] != 'i' {
+				return nil, errors.New("unsupported access log directive %" + format)
+			}
+			name := strings.ToLower(format[1:end])
+			fields = append(fields, func(buf *bytes.Buffer, r *accessLogRecord) {
+				if values := r.md.Get(name); len(values) > 0 && values[0] != "" {
+					// As Apache does, so the line can be parsed.
+					buf.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(values[0]))
+				} else {
+					buf.WriteString("-")
+				}
+			})
+			format = format[end+2:]
+			continue
+		}
+		var field accessLogField
+		switch format[0] {
+		case 'h':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) { buf.WriteString(r.peer) }
+		case 'l', 'u':
+			field = literal("-")
+		case 't':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				buf.WriteString(r.start.Format("[02/Jan/2006:15:04:05 -0700]"))
+			}
+		case 'r':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				buf.WriteString("POST " + r.method + " HTTP/2.0")
+			}
+		case 'm':
+			field = literal("POST")
+		case 'U':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) { buf.WriteString(r.method) }
+		case 'H':
+			field = literal("HTTP/2.0")
+		case 's':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				buf.WriteString(strconv.Itoa(httpStatus(r.code)))
+			}
+		case 'b':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				if r.bytes == 0 {
+					buf.WriteString("-")
+				} else {
+					buf.WriteString(strconv.Itoa(r.bytes))
+				}
+			}
+		case 'B':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) { buf.WriteString(strconv.Itoa(r.bytes)) }
+		case 'D':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				buf.WriteString(strconv.FormatInt(int64(r.duration/time.Microsecond), 10))
+			}
+		case 'T':
+			field = func(buf *bytes.Buffer, r *accessLogRecord) {
+				buf.WriteString(strconv.FormatInt(int64(r.duration/time.Second), 10))
+			}
+		case '%':
+			field = literal("%")
+		default:
+			return nil, errors.New("unsupported access log directive %" + format[:1])
+		}
+		fields = append(fields, field)
+		format = format[1:]
+	}
+	return fields, nil
+}
+
+// httpStatus returns the http status equivalent to a grpc status code (as
+// grpc-gateway maps them).
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request (nginx)
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// log writes the (completed) rpc's line.
+func (l *AccessLogger) log(r *accessLogRecord) {
+	var buf bytes.Buffer
+	for _, field := range l.format {
+		field(&buf, r)
+	}
+	buf.WriteByte('\n')
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+func newAccessLogRecord(ctx context.Context, method string) *accessLogRecord {
+	r := &accessLogRecord{peer: "-", method: method, start: common.Time.Now()}
+	if peerInfo, ok := peer.FromContext(ctx); ok && peerInfo.Addr != nil {
+		r.peer = peerInfo.Addr.String()
+		if host, _, err := net.SplitHostPort(r.peer); err == nil {
+			r.peer = host
+		}
+	}
+	r.md, _ = metadata.FromIncomingContext(ctx)
+	return r
+}
+
+func (r *accessLogRecord) finish(err error) {
+	r.duration = common.Time.Now().Sub(r.start)
+	r.code = status.Code(err)
+}
+
+// AccessLogUnaryInterceptor writes a unary rpc's line to AccessLog.
+func AccessLogUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	accessLog := AccessLog
+	if accessLog == nil {
+		return handler(ctx, req)
+	}
+	r := newAccessLogRecord(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	if m, ok := resp.(proto.Message); ok && err == nil {
+		r.bytes = proto.Size(m)
+	}
+	r.finish(err)
+	accessLog.log(r)
+	return resp, err
+}
+
+// accessLogStream counts the bytes sent on a stream.
+type accessLogStream struct {
+	grpc.ServerStream
+	r *accessLogRecord
+}
+
+func (s *accessLogStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if msg, ok := m.(proto.Message); ok && err == nil {
+		s.r.bytes += proto.Size(msg)
+	}
+	return err
+}
+
+// AccessLogStreamInterceptor writes a streaming rpc's line to AccessLog
+// when the stream ends.
+func AccessLogStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	accessLog := AccessLog
+	if accessLog == nil {
+		return handler(srv, ss)
+	}
+	r := newAccessLogRecord(ss.Context(), info.FullMethod)
+	err := handler(srv, &accessLogStream{ServerStream: ss, r: r})
+	r.finish(err)
+	accessLog.log(r)
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package logging
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testAccessLogStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testAccessLogStream) Context() context.Context    { return s.ctx }
+func (s *testAccessLogStream) SendMsg(m interface{}) error { return nil }
+
+func TestAccessLog(t *testing.T) {
+	// Each call to Now() is 1.5 ms after the one before.
+	now := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.FixedZone("", -7*3600))
+	common.Time.Now = func() time.Time {
+		t := now
+		now = now.Add(1500 * time.Microsecond)
+		return t
+	}
+	defer func() { common.Time.Now = time.Now }()
+	var output bytes.Buffer
+	defer func() { AccessLog = nil }()
+	if _, err := NewAccessLogger(&output, "%h %q"); err == nil {
+		t.Fatal("expected an error for an unsupported directive")
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4321},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", `grpc-go/1.44.0 "test"`))
+	reply := &walletrpc.BlockID{Height: 380640, Hash: make([]byte, 32)}
+
+	var err error
+	AccessLog, err = NewAccessLogger(&output, "combined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AccessLogUnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlock"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return reply, nil })
+	expected := `192.0.2.1 - - [04/Mar/2021:05:06:07 -0700] "POST /cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlock HTTP/2.0" 200 ` +
+		`38 "-" "grpc-go/1.44.0 \"test\""` + "\n"
+	if proto.Size(reply) != 38 || output.String() != expected {
+		t.Fatal("unexpected combined log line", output.String())
+	}
+
+	// A failed rpc, with the duration.
+	output.Reset()
+	AccessLog, err = NewAccessLogger(&output, "common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AccessLogUnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/s/GetBlock"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "no such block")
+		})
+	if output.String() != `- - - [04/Mar/2021:05:06:07 -0700] "POST /s/GetBlock HTTP/2.0" 404 -`+"\n" {
+		t.Fatal("unexpected common log line", output.String())
+	}
+
+	// A stream's bytes are its replies' total.
+	output.Reset()
+	AccessLog, err = NewAccessLogger(&output, `%h %m %U %H %>s %B %D %T %{User-Agent}i 100%%`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AccessLogStreamInterceptor(nil, &testAccessLogStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/s/GetBlockRange"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for i := 0; i < 3; i++ {
+				stream.SendMsg(reply)
+			}
+			return nil
+		})
+	if output.String() != `192.0.2.1 POST /s/GetBlockRange HTTP/2.0 200 114 1500 0 grpc-go/1.44.0 \"test\" 100%`+"\n" {
+		t.Fatal("unexpected custom log line", output.String())
+	}
+
+	// Nothing is logged when disabled.
+	output.Reset()
+	AccessLog = nil
+	AccessLogUnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/s/GetLatestBlock"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return reply, nil })
+	if output.Len() != 0 {
+		t.Fatal("unexpected log line", output.String())
+	}
+}
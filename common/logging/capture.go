@@ -0,0 +1,345 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Capture, if not nil, saves a sample of the requests and replies of the
+// rpcs it's configured for (see NewDebugCapture()), so that wallet bugs
+// can be reproduced by replaying them.
+var Capture *DebugCapture
+
+// CaptureFileName is the file in the capture directory that captured rpcs
+// are appended to; when it's full, it's renamed CaptureFileName.1, the
+// one before that .2, and so on.
+const CaptureFileName = "capture.jsonl"
+
+// captureExcluded are the (admin) rpcs that are never captured, since their
+// requests or replies may contain secrets.
+var captureExcluded = map[string]bool{"GetConfig": true, "RawPiratedRPC": true}
+
+// captureHeaders are the request headers (grpc metadata) that are captured;
+// the values of those that are true are secret, and so are redacted. Others,
+// such as the proxy headers with the client's address, are left out.
+var captureHeaders = map[string]bool{
+	"user-agent":                 false,
+	"content-type":               false,
+	common.ProtocolVersionHeader: false,
+	common.APIKeyHeader:          true,
+	"authorization":              true,
+}
+
+const captureRedacted = "xxxxx"
+
+// captureMaxMessages is the most requests, and the most replies, captured
+// from one stream; the rest are counted only.
+const captureMaxMessages = 100
+
+// DebugCapture samples rpcs to files in a directory, one JSON object (a
+// captureRecord) per line. The files are rotated, so it uses at most
+// about maxFiles times maxFileBytes of disk.
+type DebugCapture struct {
+	dir          string
+	methods      map[string]bool
+	rate         float64
+	maxFileBytes int64
+	maxFiles     int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// captureRecord is a captured rpc; the requests and replies are as jsonpb
+// marshals them.
+type captureRecord struct {
+	Time      time.Time           `json:"time"`
+	Method    string              `json:"method"`
+	RequestID string              `json:"request_id,omitempty"`
+	Metadata  map[string][]string `json:"metadata,omitempty"`
+	Requests  []json.RawMessage   `json:"requests"`
+	Replies   []json.RawMessage   `json:"replies"`
+	Truncated bool                `json:"truncated,omitempty"` // there were more than captureMaxMessages
+	Code      string              `json:"code"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// NewDebugCapture returns a capture of the given fraction (rate, from 0 to
+// 1) of the rpcs to the given methods (by name, such as "GetBlockRange"),
+// chosen at random, in files of at most maxFileBytes in dir, of which the
+// most recent maxFiles are kept. The client's address is not captured, nor
+// are request headers other than captureHeaders.
+func NewDebugCapture(dir string, methods []string, rate float64, maxFileBytes int64, maxFiles int) (*DebugCapture, error) {
+	if len(methods) == 0 {
+		return nil, errors.New("no methods to capture")
+	}
+	if rate <= 0 || rate > 1 {
+		return nil, errors.New("the capture rate must be more than 0, and at most 1")
+	}
+	if maxFileBytes <= 0 || maxFiles < 1 {
+		return nil, errors.New("the capture file size and number of files must be positive")
+	}
+	c := &DebugCapture{
+		dir:          dir,
+		methods:      make(map[string]bool),
+		rate:         rate,
+		maxFileBytes: maxFileBytes,
+		maxFiles:     maxFiles,
+	}
+	for _, method := range methods {
+		method = path.Base(method)
+		if captureExcluded[method] {
+			return nil, fmt.Errorf("%s can't be captured (its requests or replies may contain secrets)", method)
+		}
+		c.methods[method] = true
+	}
+	// Captured requests may identify wallets; only the owner may read them.
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *DebugCapture) open() error {
+	file, err := os.OpenFile(filepath.Join(c.dir, CaptureFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	c.file, c.size = file, fi.Size()
+	return nil
+}
+
+// Close closes the capture file.
+func (c *DebugCapture) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+}
+
+// sampled decides whether to capture an rpc to the given (full) method;
+// it's cheap for the methods that aren't captured.
+func (c *DebugCapture) sampled(fullMethod string) bool {
+	if !c.methods[path.Base(fullMethod)] {
+		return false
+	}
+	const precision = 1 << 30
+	return c.rate >= 1 || float64(common.Rand.Int63n(precision)) < c.rate*precision
+}
+
+// rotate renames the full capture file (and the older ones), removing the
+// oldest, and starts a new one; the caller must hold c.mutex.
+func (c *DebugCapture) rotate() error {
+	c.file.Close()
+	c.file = nil
+	name := filepath.Join(c.dir, CaptureFileName)
+	numbered := func(i int) string { return name + "." + strconv.Itoa(i) }
+	if c.maxFiles == 1 {
+		os.Remove(name)
+	} else {
+		os.Remove(numbered(c.maxFiles - 1))
+		for i := c.maxFiles - 2; i >= 1; i-- {
+			os.Rename(numbered(i), numbered(i+1))
+		}
+		if err := os.Rename(name, numbered(1)); err != nil {
+			return err
+		}
+	}
+	return c.open()
+}
+
+// write appends the record to the capture file, rotating it first if the
+// record wouldn't fit. A record too large for a file is dropped.
+func (c *DebugCapture) write(r *captureRecord) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		common.Log.Warning("couldn't marshal a captured rpc: ", err)
+		return
+	}
+	line = append(line, '\n')
+	if int64(len(line)) > c.maxFileBytes {
+		common.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"bytes":  len(line),
+		}).Warning("captured rpc is larger than a capture file, dropped")
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file == nil {
+		return
+	}
+	if c.size+int64(len(line)) > c.maxFileBytes {
+		if err := c.rotate(); err != nil {
+			common.Log.Warning("couldn't rotate the capture file, capture stopped: ", err)
+			return
+		}
+	}
+	n, err := c.file.Write(line)
+	c.size += int64(n)
+	if err != nil {
+		common.Log.Warning("couldn't write the capture file: ", err)
+	}
+}
+
+// captureMessage returns the message as JSON (null if it's not a protobuf
+// message).
+func captureMessage(m interface{}) json.RawMessage {
+	if pm, ok := m.(proto.Message); ok && pm != nil {
+		if s, err := (&jsonpb.Marshaler{}).MarshalToString(pm); err == nil {
+			return json.RawMessage(s)
+		}
+	}
+	return json.RawMessage("null")
+}
+
+// captureMetadata returns the captured request headers (captureHeaders),
+// with the values of secret ones redacted.
+func captureMetadata(ctx context.Context) map[string][]string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md) == 0 {
+		return nil
+	}
+	var headers map[string][]string
+	for name, values := range md {
+		secret, captured := captureHeaders[name]
+		if !captured {
+			continue
+		}
+		if secret {
+			values = []string{captureRedacted}
+		}
+		if headers == nil {
+			headers = make(map[string][]string)
+		}
+		headers[name] = values
+	}
+	return headers
+}
+
+func newCaptureRecord(ctx context.Context, fullMethod string) *captureRecord {
+	return &captureRecord{
+		Time:      common.Time.Now(),
+		Method:    fullMethod,
+		RequestID: common.RequestID(ctx),
+		Metadata:  captureMetadata(ctx),
+		Requests:  make([]json.RawMessage, 0),
+		Replies:   make([]json.RawMessage, 0),
+	}
+}
+
+func (r *captureRecord) finish(err error) *captureRecord {
+	s := status.Convert(err)
+	r.Code = s.Code().String()
+	if err != nil {
+		r.Error = s.Message()
+	}
+	return r
+}
+
+// CaptureUnaryInterceptor captures a sample of unary rpcs (see Capture).
+func CaptureUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	capture := Capture
+	if capture == nil || !capture.sampled(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	r := newCaptureRecord(ctx, info.FullMethod)
+	r.Requests = append(r.Requests, captureMessage(req))
+	resp, err := handler(ctx, req)
+	if err == nil {
+		r.Replies = append(r.Replies, captureMessage(resp))
+	}
+	capture.write(r.finish(err))
+	return resp, err
+}
+
+// captureStream records the messages received and sent on a stream.
+type captureStream struct {
+	grpc.ServerStream
+	mutex sync.Mutex
+	r     *captureRecord
+}
+
+func (s *captureStream) add(messages *[]json.RawMessage, m interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(*messages) >= captureMaxMessages {
+		s.r.Truncated = true
+		return
+	}
+	*messages = append(*messages, captureMessage(m))
+}
+
+func (s *captureStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.add(&s.r.Requests, m)
+	}
+	return err
+}
+
+func (s *captureStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.add(&s.r.Replies, m)
+	}
+	return err
+}
+
+// CaptureStreamInterceptor captures a sample of streaming rpcs (see
+// Capture), up to captureMaxMessages of their requests and of their
+// replies.
+func CaptureStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	capture := Capture
+	if capture == nil || !capture.sampled(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	cs := &captureStream{ServerStream: ss, r: newCaptureRecord(ss.Context(), info.FullMethod)}
+	err := handler(srv, cs)
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	capture.write(cs.r.finish(err))
+	return err
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package logging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testCaptureStream struct {
+	testAccessLogStream
+	requests []*walletrpc.Address
+}
+
+func (s *testCaptureStream) RecvMsg(m interface{}) error {
+	if len(s.requests) == 0 {
+		return io.EOF
+	}
+	*m.(*walletrpc.Address) = *s.requests[0]
+	s.requests = s.requests[1:]
+	return nil
+}
+
+// readCapture returns the records in a capture file.
+func readCapture(t *testing.T, name string) []*captureRecord {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records := make([]*captureRecord, 0)
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		r := &captureRecord{}
+		if err := json.Unmarshal(scan.Bytes(), r); err != nil {
+			t.Fatal("bad capture record", scan.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestDebugCapture(t *testing.T) {
+	restore := common.SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	defer restore()
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { Capture = nil }()
+	for _, methods := range [][]string{nil, {"GetConfig"}} {
+		if _, err := NewDebugCapture(dir, methods, 1, 1000, 1); err == nil {
+			t.Fatal("expected an error for capturing", methods)
+		}
+	}
+
+	Capture, err = NewDebugCapture(dir, []string{"GetLatestBlock", "GetTaddressBalanceStream"}, 0.1, 1<<20, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("user-agent", "test", "x-api-key", "secret1", "authorization", "Bearer secret2",
+			"x-forwarded-for", "192.0.2.1", "x-real-ip", "192.0.2.1", "forwarded", "for=192.0.2.1", "cookie", "c"))
+	unary := func(method string, err error) {
+		CaptureUnaryInterceptor(ctx, &walletrpc.ChainSpec{}, &grpc.UnaryServerInfo{FullMethod: "/s/" + method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				if err != nil {
+					return nil, err
+				}
+				return &walletrpc.BlockID{Height: 380640}, nil
+			})
+	}
+	// About a tenth of the rpcs to the given methods are captured.
+	for i := 0; i < 1000; i++ {
+		unary("GetLatestBlock", nil)
+		unary("GetLightdInfo", nil)
+	}
+	records := readCapture(t, filepath.Join(dir, CaptureFileName))
+	if len(records) < 80 || len(records) > 120 {
+		t.Fatal("unexpected number of captured rpcs", len(records))
+	}
+	r := records[0]
+	if r.Method != "/s/GetLatestBlock" || len(r.Requests) != 1 || string(r.Requests[0]) != "{}" ||
+		len(r.Replies) != 1 || string(r.Replies[0]) != `{"height":"380640"}` || r.Code != "OK" {
+		t.Fatal("unexpected captured rpc", r)
+	}
+	if r.Metadata["user-agent"][0] != "test" || r.Metadata["x-api-key"][0] != captureRedacted ||
+		r.Metadata["authorization"][0] != captureRedacted || len(r.Metadata) != 3 {
+		t.Fatal("unexpected captured metadata", r.Metadata)
+	}
+
+	// Failed rpcs and streams are captured too.
+	os.Remove(filepath.Join(dir, CaptureFileName))
+	Capture.Close()
+	Capture, err = NewDebugCapture(dir, []string{"GetLatestBlock", "GetTaddressBalanceStream"}, 1, 1<<20, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary("GetLatestBlock", status.Error(codes.Unavailable, "no pirated"))
+	stream := &testCaptureStream{testAccessLogStream: testAccessLogStream{ctx: ctx}}
+	for i := 0; i < captureMaxMessages+1; i++ {
+		stream.requests = append(stream.requests, &walletrpc.Address{Address: "t1"})
+	}
+	CaptureStreamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/s/GetTaddressBalanceStream"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				if err := stream.RecvMsg(&walletrpc.Address{}); err != nil {
+					break
+				}
+			}
+			return stream.SendMsg(&walletrpc.Balance{ValueZat: 5})
+		})
+	records = readCapture(t, filepath.Join(dir, CaptureFileName))
+	if len(records) != 2 || records[0].Code != "Unavailable" || records[0].Error != "no pirated" ||
+		len(records[0].Replies) != 0 {
+		t.Fatal("unexpected captured failed rpc", records)
+	}
+	if r := records[1]; len(r.Requests) != captureMaxMessages || string(r.Requests[0]) != `{"address":"t1"}` ||
+		!r.Truncated || len(r.Replies) != 1 || string(r.Replies[0]) != `{"valueZat":"5"}` {
+		t.Fatal("unexpected captured stream", r)
+	}
+
+	// The files are rotated, and only the latest 3 kept.
+	Capture.Close()
+	Capture, err = NewDebugCapture(dir, []string{"GetLatestBlock"}, 1, 2000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		common.Time.Sleep(time.Second)
+		unary("GetLatestBlock", nil)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatal("unexpected capture files", names)
+	}
+	var last time.Time
+	for _, suffix := range []string{".2", ".1", ""} {
+		name := filepath.Join(dir, CaptureFileName+suffix)
+		if fi, err := os.Stat(name); err != nil || fi.Size() > 2000 {
+			t.Fatal("unexpected capture file", name, err)
+		}
+		for _, r := range readCapture(t, name) {
+			if !r.Time.After(last) {
+				t.Fatal("capture files out of order", name)
+			}
+			last = r.Time
+		}
+	}
+	if !last.Equal(common.Time.Now()) {
+		t.Fatal("latest rpc not captured", last)
+	}
+
+	// Nothing is captured when disabled.
+	Capture.Close()
+	Capture = nil
+	os.RemoveAll(dir)
+	unary("GetLatestBlock", nil)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("unexpected capture", err)
+	}
+}
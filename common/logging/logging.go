@@ -4,6 +4,9 @@ import (
 	"context"
 	"time"
 
+	"github.com/PirateNetwork/lightwalletd/common"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -16,12 +19,50 @@ func LoggingInterceptor() grpc.ServerOption {
 	return grpc.UnaryInterceptor(LogInterceptor)
 }
 
+// ServerInterceptors returns the chains of interceptors (stream and unary)
+// that every request goes through, in order, as server options; the tests
+// use the same chains as the servers.
+func ServerInterceptors() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+			common.RequestIDStreamInterceptor,
+			AccessLogStreamInterceptor,
+			common.PeerFilterStreamInterceptor,
+			common.PeerLimitStreamInterceptor,
+			CaptureStreamInterceptor,
+			common.QuotaStreamInterceptor,
+			common.InFlightStreamInterceptor,
+			common.DegradedStreamInterceptor,
+			common.ProtocolVersionStreamInterceptor,
+			common.MaxStreamDurationInterceptor,
+			grpc_prometheus.StreamServerInterceptor),
+		),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+			common.RequestIDUnaryInterceptor,
+			AccessLogUnaryInterceptor,
+			common.PeerFilterUnaryInterceptor,
+			common.PeerLimitUnaryInterceptor,
+			CaptureUnaryInterceptor,
+			common.QuotaUnaryInterceptor,
+			common.InFlightUnaryInterceptor,
+			common.DegradedUnaryInterceptor,
+			LogInterceptor,
+			common.ProtocolVersionUnaryInterceptor,
+			grpc_prometheus.UnaryServerInterceptor),
+		),
+	}
+}
+
 func loggerFromContext(ctx context.Context) *logrus.Entry {
+	fields := logrus.Fields{"peer_addr": "unknown"}
 	// TODO: anonymize the addresses. cryptopan?
 	if peerInfo, ok := peer.FromContext(ctx); ok {
-		return log.WithFields(logrus.Fields{"peer_addr": peerInfo.Addr})
+		fields["peer_addr"] = peerInfo.Addr
+	}
+	if id := common.RequestID(ctx); id != "" {
+		fields["request_id"] = id
 	}
-	return log.WithFields(logrus.Fields{"peer_addr": "unknown"})
+	return log.WithFields(fields)
 }
 
 func LogInterceptor(
@@ -0,0 +1,88 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ParseLogLevel parses a log level, by name ("error", "warn", "info",
+// "debug", and so on) or, as in earlier versions, by logrus number (for
+// example, 4 is info; anything above 6, trace, logs everything, as it
+// did).
+func ParseLogLevel(s string) (logrus.Level, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < int(logrus.PanicLevel) {
+			return 0, errors.New("log level out of range: " + s)
+		}
+		if n > int(logrus.TraceLevel) {
+			n = int(logrus.TraceLevel)
+		}
+		return logrus.Level(n), nil
+	}
+	return logrus.ParseLevel(s)
+}
+
+// checkLocalHTTPRequest returns an error unless the request comes from the
+// same host (a loopback address), and hasn't been relayed (by a proxy on
+// this host) on behalf of another, as CheckLocalPeer() does for rpcs.
+func checkLocalHTTPRequest(req *http.Request) error {
+	denied := errors.New("only allowed from the server's host")
+	if req.Header.Get("X-Real-IP") != "" || req.Header.Get("X-Forwarded-For") != "" {
+		return denied
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return denied
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return denied
+	}
+	return nil
+}
+
+// LogLevelHandler is the (admin) http interface to the given logger's
+// level, for requests from the server's host: GET reports it, and POST
+// sets it to the "level" parameter (see ParseLogLevel()), taking effect
+// immediately (logrus changes the level atomically, so it's safe while
+// other goroutines log).
+func LogLevelHandler(logger *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := checkLocalHTTPRequest(req); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			level, err := ParseLogLevel(req.FormValue("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if old := logger.GetLevel(); level != old {
+				logger.SetLevel(level)
+				logger.WithFields(logrus.Fields{
+					"from": old.String(),
+					"to":   level.String(),
+				}).Warn("Log level changed")
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Level string `json:"level"`
+		}{logger.GetLevel().String()})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for s, expected := range map[string]logrus.Level{
+		"error": logrus.ErrorLevel,
+		"warn":  logrus.WarnLevel,
+		"info":  logrus.InfoLevel,
+		"debug": logrus.DebugLevel,
+		"4":     logrus.InfoLevel,
+		"10":    logrus.TraceLevel,
+	} {
+		if level, err := ParseLogLevel(s); err != nil || level != expected {
+			t.Fatal("unexpected level", s, level, err)
+		}
+	}
+	for _, s := range []string{"", "verbose", "-1"} {
+		if _, err := ParseLogLevel(s); err == nil {
+			t.Fatal("expected an error", s)
+		}
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	var output bytes.Buffer
+	var outputMutex sync.Mutex
+	logger := logrus.New()
+	logger.SetOutput(&lockedWriter{&output, &outputMutex})
+	logger.SetLevel(logrus.InfoLevel)
+	handler := LogLevelHandler(logger)
+	request := func(method, level, remoteAddr string) (int, string) {
+		req := httptest.NewRequest(method, "/loglevel?level="+level, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var reply struct{ Level string }
+		json.NewDecoder(w.Body).Decode(&reply)
+		return w.Code, reply.Level
+	}
+	logged := func(message string) bool {
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		return strings.Contains(output.String(), message)
+	}
+
+	// Only from this host.
+	if code, _ := request(http.MethodPost, "debug", "192.0.2.1:1234"); code != http.StatusForbidden {
+		t.Fatal("unexpected status for a remote request", code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/loglevel?level=debug", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusForbidden || logger.GetLevel() != logrus.InfoLevel {
+		t.Fatal("unexpected status for a relayed request", w.Code)
+	}
+	if code, level := request(http.MethodGet, "", "127.0.0.1:1234"); code != http.StatusOK || level != "info" {
+		t.Fatal("unexpected level", code, level)
+	}
+	if code, _ := request(http.MethodPost, "verbose", "[::1]:1234"); code != http.StatusBadRequest {
+		t.Fatal("unexpected status for an invalid level", code)
+	}
+
+	// Other goroutines log while the level changes.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logger.Debug("background")
+				}
+			}
+		}()
+	}
+
+	logger.Debug("before")
+	if logged("before") {
+		t.Fatal("debug message logged at info level")
+	}
+	if code, level := request(http.MethodPost, "debug", "127.0.0.1:1234"); code != http.StatusOK || level != "debug" {
+		t.Fatal("unexpected reply setting debug level", code, level)
+	}
+	logger.Debug("during")
+	if !logged("during") {
+		t.Fatal("debug message not logged at debug level")
+	}
+	if code, level := request(http.MethodPost, "info", "[::1]:1234"); code != http.StatusOK || level != "info" {
+		t.Fatal("unexpected reply setting info level", code, level)
+	}
+	logger.Debug("after")
+	if logged("after") {
+		t.Fatal("debug message logged after returning to info level")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// lockedWriter serializes writes (and reads, by the test) of the log.
+type lockedWriter struct {
+	w     *bytes.Buffer
+	mutex *sync.Mutex
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// MemoryCacheBlocks is the number of recently-used blocks that a BlockCache
+// keeps in memory (in front of the db files); zero disables the memory tier.
+// It must be set before NewBlockCache() is called.
+var MemoryCacheBlocks = 4000
+
+// MemoryCachePolicy is how the memory tier chooses blocks to evict: "lru"
+// (the least recently used), or "slru" (segmented LRU), which protects
+// blocks that have been requested again since they were added (such as
+// those near the tip, which every wallet requests) from being evicted by a
+// scan of old blocks that won't be requested again. It must be set before
+// NewBlockCache() is called.
+var MemoryCachePolicy = "lru"
+
+// slruProtectedPercent is the part of an slru memory tier that's for
+// blocks that have been requested again.
+const slruProtectedPercent = 80
+
+// blockLRU holds the marshalled form of recently-used blocks, so that hot
+// blocks (near the tip) are served without reading the db files. Blocks
+// are kept marshalled so that each Get() returns a private copy that the
+// caller may modify; the unmarshalled form is also kept, once needed, for
+// callers that promise not to modify it (see GetShared()). A nil *blockLRU
+// is a valid, always-empty cache.
+//
+// New blocks go into the probationary segment (order); if protectedSize is
+// nonzero (slru), a block that's requested there moves to the protected
+// segment, whose least recently used block moves back to probation when
+// it's full. Blocks are evicted from probation first.
+type blockLRU struct {
+	mutex         sync.Mutex
+	size          int
+	protectedSize int
+	order         *list.List // probation; front is the most recently used
+	protected     *list.List // front is the most recently used
+	entries       map[int]*list.Element
+}
+
+type lruEntry struct {
+	height    int
+	data      []byte
+	block     *walletrpc.CompactBlock // shared, immutable; nil until needed
+	protected bool                    // in the protected segment
+}
+
+func newBlockLRU(size int, policy string) *blockLRU {
+	if size <= 0 {
+		return nil
+	}
+	l := &blockLRU{
+		size:      size,
+		order:     list.New(),
+		protected: list.New(),
+		entries:   make(map[int]*list.Element),
+	}
+	if policy == "slru" {
+		l.protectedSize = size * slruProtectedPercent / 100
+	}
+	return l
+}
+
+// len returns the number of blocks in the cache.
+func (l *blockLRU) len() int {
+	return l.order.Len() + l.protected.Len()
+}
+
+// touch moves the (just requested) entry to the front of its segment, or
+// promotes it from probation to the protected segment. The caller must
+// hold the mutex.
+func (l *blockLRU) touch(e *list.Element) *list.Element {
+	entry := e.Value.(*lruEntry)
+	if entry.protected {
+		l.protected.MoveToFront(e)
+		return e
+	}
+	if l.protectedSize == 0 {
+		l.order.MoveToFront(e)
+		return e
+	}
+	l.order.Remove(e)
+	entry.protected = true
+	e = l.protected.PushFront(entry)
+	l.entries[entry.height] = e
+	if l.protected.Len() > l.protectedSize {
+		oldest := l.protected.Back()
+		l.protected.Remove(oldest)
+		demoted := oldest.Value.(*lruEntry)
+		demoted.protected = false
+		l.entries[demoted.height] = l.order.PushFront(demoted)
+	}
+	return e
+}
+
+// remove removes the entry from its segment. The caller must hold the mutex.
+func (l *blockLRU) remove(e *list.Element) {
+	entry := e.Value.(*lruEntry)
+	if entry.protected {
+		l.protected.Remove(e)
+	} else {
+		l.order.Remove(e)
+	}
+	delete(l.entries, entry.height)
+}
+
+// get returns the marshalled block at the given height, or nil.
+func (l *blockLRU) get(height int) []byte {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e, ok := l.entries[height]
+	if !ok {
+		return nil
+	}
+	return l.touch(e).Value.(*lruEntry).data
+}
+
+// getShared returns the (unmarshalled) block at the given height, or nil;
+// the block is shared by all callers, so it must not be modified.
+func (l *blockLRU) getShared(height int) *walletrpc.CompactBlock {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e, ok := l.entries[height]
+	if !ok {
+		return nil
+	}
+	entry := l.touch(e).Value.(*lruEntry)
+	if entry.block == nil {
+		block := &walletrpc.CompactBlock{}
+		if err := proto.Unmarshal(entry.data, block); err != nil {
+			return nil
+		}
+		entry.block = block
+	}
+	return entry.block
+}
+
+// peek is like getShared, but doesn't count as a use of the block, so it
+// isn't moved to the front of its segment (or promoted).
+func (l *blockLRU) peek(height int) *walletrpc.CompactBlock {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e, ok := l.entries[height]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*lruEntry)
+	if entry.block == nil {
+		block := &walletrpc.CompactBlock{}
+		if err := proto.Unmarshal(entry.data, block); err != nil {
+			return nil
+		}
+		entry.block = block
+	}
+	return entry.block
+}
+
+// add inserts (or replaces) the block at the given height, evicting the
+// least recently used (probationary) block if the cache is full.
+func (l *blockLRU) add(height int, data []byte) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if e, ok := l.entries[height]; ok {
+		l.remove(e)
+	}
+	l.entries[height] = l.order.PushFront(&lruEntry{height: height, data: data})
+	if l.len() > l.size {
+		// The protected segment is smaller than the cache, so
+		// probation can't be empty.
+		l.remove(l.order.Back())
+	}
+}
+
+// truncate removes the blocks at the given height and above (after a
+// reorg, these are no longer valid).
+func (l *blockLRU) truncate(height int) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for h, e := range l.entries {
+		if h >= height {
+			l.remove(e)
+		}
+	}
+}
+
+// Prime reads (up to) the given number of the most recent blocks into the
+// memory tier, so that the first clients after a restart (which usually
+// want the blocks near the tip) don't wait for the db files. It's meant to
+// run in the background; other requests aren't held up meanwhile.
+func (c *BlockCache) Prime(blocks int) {
+	if c.mem == nil {
+		return
+	}
+	if blocks > c.mem.size {
+		blocks = c.mem.size
+	}
+	c.mutex.RLock()
+	start, end := c.nextBlock-blocks, c.nextBlock
+	if start < c.firstBlock {
+		start = c.firstBlock
+	}
+	c.mutex.RUnlock()
+	// Oldest first, so that the tip is the most recently used.
+	primed := 0
+	for height := start; height < end; height++ {
+		if c.Get(height) != nil {
+			primed++
+		}
+	}
+	Log.Info("Primed the memory cache with ", primed, " blocks")
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// MemoryBlockCache is a Cache that keeps its blocks only in memory, so they
+// don't survive a restart; it's for tests, and for ephemeral deployments
+// (such as a short-lived server over a small range of blocks).
+type MemoryBlockCache struct {
+	blocks     []*walletrpc.CompactBlock // at firstBlock onward; never modified
+	firstBlock int
+	latestHash []byte
+	mutex      sync.RWMutex
+}
+
+// NewMemoryBlockCache returns an empty cache whose first block will be at
+// startHeight.
+func NewMemoryBlockCache(startHeight int) *MemoryBlockCache {
+	return &MemoryBlockCache{firstBlock: startHeight}
+}
+
+// Add adds the given block to the cache at the given height; as for
+// BlockCache, a height beyond the next one is ignored, and one already
+// cached is handled per CacheDuplicateHeights. A height below the first
+// is an error.
+func (c *MemoryBlockCache) Add(height int, block *walletrpc.CompactBlock) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	next := c.firstBlock + len(c.blocks)
+	if height > next {
+		return nil
+	}
+	if height < c.firstBlock {
+		return fmt.Errorf("cache.Add height %d is below the first height %d", height, c.firstBlock)
+	}
+	if int(block.Height) != height {
+		return fmt.Errorf("cache.Add wrong height: %d expecting: %d", block.Height, height)
+	}
+	if height < next {
+		if err := duplicateHeight(height, next, block); err != nil {
+			return err
+		}
+		for i := height - c.firstBlock; i < len(c.blocks); i++ {
+			c.blocks[i] = nil
+		}
+		c.blocks = c.blocks[:height-c.firstBlock]
+	}
+	block = proto.Clone(block).(*walletrpc.CompactBlock)
+	c.blocks = append(c.blocks, block)
+	c.latestHash = block.Hash
+	return nil
+}
+
+// Get returns (a copy of) the compact block at the requested height if
+// it's in the cache, else nil.
+func (c *MemoryBlockCache) Get(height int) *walletrpc.CompactBlock {
+	block := c.GetShared(height)
+	if block == nil {
+		return nil
+	}
+	return proto.Clone(block).(*walletrpc.CompactBlock)
+}
+
+// GetShared is like Get(), but returns the cache's own block, which the
+// caller must not modify.
+func (c *MemoryBlockCache) GetShared(height int) *walletrpc.CompactBlock {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if height < c.firstBlock || height >= c.firstBlock+len(c.blocks) {
+		return nil
+	}
+	return c.blocks[height-c.firstBlock]
+}
+
+// Peek is the same as GetShared(), since all the blocks are in memory.
+func (c *MemoryBlockCache) Peek(height int) *walletrpc.CompactBlock {
+	return c.GetShared(height)
+}
+
+// GetFirstHeight returns the height of the lowest block.
+func (c *MemoryBlockCache) GetFirstHeight() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.firstBlock
+}
+
+// GetNextHeight returns the height of the lowest unobtained block.
+func (c *MemoryBlockCache) GetNextHeight() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.firstBlock + len(c.blocks)
+}
+
+// Len returns the number of blocks in the cache.
+func (c *MemoryBlockCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.blocks)
+}
+
+// GetLatestHeight returns the height of the most recent block, or -1
+// if the cache is empty.
+func (c *MemoryBlockCache) GetLatestHeight() int {
+	height, _ := c.GetLatestHeightHash()
+	return height
+}
+
+// GetLatestHash returns the hash of the most recent block (nil if the
+// cache is empty), which the caller must not modify.
+func (c *MemoryBlockCache) GetLatestHash() []byte {
+	_, hash := c.GetLatestHeightHash()
+	return hash
+}
+
+// GetLatestHeightHash returns the height and hash of the most recent block,
+// or -1 and nil if the cache is empty.
+func (c *MemoryBlockCache) GetLatestHeightHash() (int, []byte) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if len(c.blocks) == 0 {
+		return -1, nil
+	}
+	return c.firstBlock + len(c.blocks) - 1, c.latestHash
+}
+
+// HashMatch indicates if the given prev-hash matches the most recent
+// block's hash (or the cache is empty).
+func (c *MemoryBlockCache) HashMatch(prevhash []byte) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.latestHash == nil || bytes.Equal(c.latestHash, prevhash)
+}
+
+// GetHeightByHash returns the height of the block with the given hash, or
+// -1; it searches down from the tip, where resume points usually are.
+func (c *MemoryBlockCache) GetHeightByHash(hash []byte) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if bytes.Equal(c.blocks[i].Hash, hash) {
+			return c.firstBlock + i
+		}
+	}
+	return -1
+}
+
+// GetLiteWalletBlockGroup returns the block at which a group of (about
+// 4 MB of) blocks starting at the given height ends, as BlockCache does.
+func (c *MemoryBlockCache) GetLiteWalletBlockGroup(height int) *walletrpc.BlockID {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	next := c.firstBlock + len(c.blocks)
+	if height < c.firstBlock || height >= next {
+		return nil
+	}
+	for groupLength := 0; groupLength < 4000000; {
+		groupLength += proto.Size(c.blocks[height-c.firstBlock])
+		height++
+		if height >= next {
+			height--
+			break
+		}
+	}
+	block := c.blocks[height-c.firstBlock]
+	return &walletrpc.BlockID{Height: uint64(height), Hash: append([]byte(nil), block.Hash...)}
+}
+
+// Reorg removes the blocks from the given height on.
+func (c *MemoryBlockCache) Reorg(height int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if height < c.firstBlock {
+		height = c.firstBlock
+	}
+	if height >= c.firstBlock+len(c.blocks) {
+		return
+	}
+	for i := height - c.firstBlock; i < len(c.blocks); i++ {
+		c.blocks[i] = nil
+	}
+	c.blocks = c.blocks[:height-c.firstBlock]
+	c.latestHash = nil
+	if len(c.blocks) > 0 {
+		c.latestHash = c.blocks[len(c.blocks)-1].Hash
+	}
+}
+
+// Sync does nothing; the blocks are never written anywhere.
+func (c *MemoryBlockCache) Sync() {}
+
+// Close releases the blocks.
+func (c *MemoryBlockCache) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.blocks = nil
+	c.latestHash = nil
+}
+
+// The caches implement Cache.
+var (
+	_ Cache = (*BlockCache)(nil)
+	_ Cache = (*MemoryBlockCache)(nil)
+	_ Cache = (*UnionCache)(nil)
+)
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"sync"
@@ -23,6 +24,15 @@ var (
 	// map allows this list to not contain duplicates.
 	g_txList []*walletrpc.RawTransaction
 
+	// Each transaction in g_txList is assigned the next sequence number, which
+	// clients can use as a cursor to resume GetMempoolStream() after
+	// reconnecting; g_firstSequence is the sequence of g_txList[0] (if any).
+	// Sequence numbers start (see startSequence()) from the time of the
+	// first GetMempool() so that a cursor from before a restart isn't
+	// mistaken for a current one.
+	g_nextSequence  uint64
+	g_firstSequence uint64
+
 	// The most recent absolute time that we fetched the mempool and the latest
 	// (tip) block hash (so we know when a new block has been mined).
 	g_lastTime time.Time
@@ -35,9 +45,30 @@ var (
 	g_lock sync.Mutex
 )
 
-func GetMempool(sendToClient func(*walletrpc.RawTransaction) error) error {
+// GetMempool sends the mempool transactions that follow the given cursor (the
+// sequence number of the last transaction the client received, or zero for
+// all of them) to the client, and continues sending new mempool transactions
+// until a new block is mined. If the cursor isn't from the current block
+// interval (or is unknown), a cursorReset marker is sent, followed by all
+// mempool transactions. It returns early (with the context's error) if the
+// context is canceled, such as when the client goes away.
+func GetMempool(ctx context.Context, cursor uint64, sendToClient func(*walletrpc.RawTransaction) error) error {
 	g_lock.Lock()
+	startSequence()
 	index := 0
+	if cursor != 0 {
+		// The transaction before g_txList[0] is from an earlier block
+		// interval, so that cursor is stale too.
+		if cursor >= g_firstSequence && cursor < g_nextSequence {
+			index = int(cursor-g_firstSequence) + 1
+		} else {
+			g_lock.Unlock()
+			if err := sendToClient(&walletrpc.RawTransaction{CursorReset: true}); err != nil {
+				return err
+			}
+			g_lock.Lock()
+		}
+	}
 	// Stay in this function until the tip block hash changes.
 	stayHash := g_lastBlockChainInfo.BestBlockHash
 
@@ -58,6 +89,7 @@ func GetMempool(sendToClient func(*walletrpc.RawTransaction) error) error {
 				// We're the first thread to notice, clear cached state.
 				g_txidSeen = map[txid]struct{}{}
 				g_txList = []*walletrpc.RawTransaction{}
+				g_firstSequence = g_nextSequence
 				g_lastTime = time.Time{}
 				break
 			}
@@ -78,6 +110,11 @@ func GetMempool(sendToClient func(*walletrpc.RawTransaction) error) error {
 			}
 		}
 		Time.Sleep(200 * time.Millisecond)
+		// Without this, a client that went away wouldn't be noticed until
+		// there was a transaction to send it (or a new block).
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		g_lock.Lock()
 		if g_lastBlockChainInfo.BestBlockHash != stayHash {
 			break
@@ -87,6 +124,16 @@ func GetMempool(sendToClient func(*walletrpc.RawTransaction) error) error {
 	return nil
 }
 
+// startSequence sets the first sequence number from the current time (in
+// microseconds), if it's not yet set (or restored by LoadMempoolState());
+// the caller must hold g_lock.
+func startSequence() {
+	if g_nextSequence == 0 {
+		g_nextSequence = uint64(Time.Now().UnixNano() / 1000)
+		g_firstSequence = g_nextSequence
+	}
+}
+
 // RefreshMempoolTxns gets all new mempool txns and sends any new ones to waiting clients
 func refreshMempoolTxns() error {
 	Log.Infoln("Refreshing mempool")
@@ -102,7 +149,10 @@ func refreshMempoolTxns() error {
 		return err
 	}
 
-	// Fetch all new mempool txns and add them into `newTxns`
+	// Fetch all new mempool txns (in as few batches as possible) and add
+	// them into `newTxns`
+	var newTxids []string
+	var calls []RPCCall
 	for _, txidstr := range mempoolList {
 		if _, ok := g_txidSeen[txid(txidstr)]; ok {
 			// We've already fetched this transaction
@@ -117,14 +167,18 @@ func refreshMempoolTxns() error {
 		// The "0" is because we only need the raw hex, which is returned as
 		// just a hex string, and not even a json string (with quotes).
 		params := []json.RawMessage{txidJSON, json.RawMessage("0")}
-		result, rpcErr := RawRequest("getrawtransaction", params)
-		if rpcErr != nil {
+		newTxids = append(newTxids, txidstr)
+		calls = append(calls, RPCCall{Method: "getrawtransaction", Params: params})
+	}
+	for i, reply := range BatchRequest(context.Background(), calls) {
+		txidstr := newTxids[i]
+		if reply.Err != nil {
 			// Not an error; mempool transactions can disappear
 			continue
 		}
 		// strip the quotes
 		var txStr string
-		err = json.Unmarshal(result, &txStr)
+		err = json.Unmarshal(reply.Result, &txStr)
 		if err != nil {
 			return err
 		}
@@ -134,9 +188,11 @@ func refreshMempoolTxns() error {
 		}
 		Log.Infoln("appending", txidstr)
 		newRtx := &walletrpc.RawTransaction{
-			Data:   txBytes,
-			Height: uint64(g_lastBlockChainInfo.Blocks),
+			Data:     txBytes,
+			Height:   uint64(g_lastBlockChainInfo.Blocks),
+			Sequence: g_nextSequence,
 		}
+		g_nextSequence++
 		g_txList = append(g_txList, newRtx)
 	}
 	return nil
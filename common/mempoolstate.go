@@ -0,0 +1,113 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// MempoolStateTTL is how old the mempool state saved at shutdown (see
+// SaveMempoolState) may be and still be loaded at startup; zero disables
+// saving it.
+var MempoolStateTTL time.Duration
+
+// mempoolState is the mempool tracking state (see mempool.go) as saved
+// across a restart, so that clients that reconnect with a cursor can
+// resume GetMempoolStream() rather than receive the entire mempool again.
+type mempoolState struct {
+	Saved         time.Time
+	BestBlockHash string
+	Blocks        int
+	TxidSeen      []txid
+	TxList        []*walletrpc.RawTransaction
+	FirstSequence uint64
+	NextSequence  uint64
+}
+
+// MempoolStateName returns the mempool state file's path; it's kept with
+// the cache, in the given (cache) directory.
+func MempoolStateName(dir string) string {
+	return filepath.Join(dir, "mempool-state")
+}
+
+// SaveMempoolState writes the mempool tracking state to the given file
+// (replacing it atomically), to be loaded by LoadMempoolState() after a
+// restart.
+func SaveMempoolState(path string) error {
+	g_lock.Lock()
+	state := mempoolState{
+		Saved:         Time.Now(),
+		BestBlockHash: g_lastBlockChainInfo.BestBlockHash,
+		Blocks:        g_lastBlockChainInfo.Blocks,
+		TxidSeen:      make([]txid, 0, len(g_txidSeen)),
+		TxList:        g_txList,
+		FirstSequence: g_firstSequence,
+		NextSequence:  g_nextSequence,
+	}
+	for id := range g_txidSeen {
+		state.TxidSeen = append(state.TxidSeen, id)
+	}
+	b, err := json.Marshal(&state)
+	g_lock.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadMempoolState restores the mempool tracking state saved by
+// SaveMempoolState(), if it was saved no more than ttl ago; the file is
+// removed, since it's valid only until the mempool next changes. Stale or
+// unreadable state is discarded (the mempool is fetched from pirated anew,
+// as it would be without it). It returns whether the state was restored.
+func LoadMempoolState(path string, ttl time.Duration) bool {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Log.Warning("couldn't read the saved mempool state: ", err)
+		}
+		return false
+	}
+	os.Remove(path)
+	var state mempoolState
+	if err := json.Unmarshal(b, &state); err != nil {
+		Log.Warning("discarding the saved mempool state: ", err)
+		return false
+	}
+	age := Time.Now().Sub(state.Saved)
+	if age < 0 || age > ttl {
+		Log.Info("discarding the saved mempool state, saved ", age, " ago")
+		return false
+	}
+	g_lock.Lock()
+	defer g_lock.Unlock()
+	g_txidSeen = make(map[txid]struct{}, len(state.TxidSeen))
+	for _, id := range state.TxidSeen {
+		g_txidSeen[id] = struct{}{}
+	}
+	g_txList = state.TxList
+	g_firstSequence = state.FirstSequence
+	g_nextSequence = state.NextSequence
+	// The first GetMempool() will refresh it, and start over if there's
+	// been a new block since.
+	g_lastBlockChainInfo = &PiratedRpcReplyGetblockchaininfo{
+		BestBlockHash: state.BestBlockHash,
+		Blocks:        state.Blocks,
+	}
+	g_lastTime = time.Time{}
+	Log.Info("restored the saved mempool state, ", len(g_txList), " transactions")
+	return true
+}
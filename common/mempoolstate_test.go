@@ -0,0 +1,109 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+func TestMempoolState(t *testing.T) {
+	testT = t
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	if err := os.MkdirAll(unitTestPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := MempoolStateName(unitTestPath)
+	restore := SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	defer restore()
+
+	setup := func() {
+		g_lastBlockChainInfo = &PiratedRpcReplyGetblockchaininfo{BestBlockHash: "010203", Blocks: 200}
+		g_lastTime = Time.Now()
+		g_txidSeen = map[txid]struct{}{"aa": {}, "bb": {}, "cc": {}}
+		g_txList = nil
+		for i := 0; i < 3; i++ {
+			g_txList = append(g_txList, &walletrpc.RawTransaction{Data: []byte{byte(i)}, Height: 200, Sequence: uint64(1000 + i)})
+		}
+		g_firstSequence = 1000
+		g_nextSequence = 1003
+	}
+	// As if lightwalletd had restarted (see mempool.go's initial values).
+	restart := func() {
+		g_lastBlockChainInfo = &PiratedRpcReplyGetblockchaininfo{}
+		g_lastTime = time.Time{}
+		g_txidSeen = map[txid]struct{}{}
+		g_txList = nil
+		g_firstSequence = 5000
+		g_nextSequence = 5000
+	}
+
+	// Nothing saved.
+	restart()
+	if LoadMempoolState(path, time.Minute) {
+		t.Fatal("unexpected mempool state loaded")
+	}
+
+	setup()
+	if err := SaveMempoolState(path); err != nil {
+		t.Fatal(err)
+	}
+	restart()
+	Time.Sleep(30 * time.Second)
+	if !LoadMempoolState(path, time.Minute) {
+		t.Fatal("mempool state not loaded")
+	}
+	if g_lastBlockChainInfo.BestBlockHash != "010203" || g_lastBlockChainInfo.Blocks != 200 ||
+		!g_lastTime.IsZero() || len(g_txidSeen) != 3 || g_firstSequence != 1000 || g_nextSequence != 1003 {
+		t.Fatal("unexpected mempool state after loading")
+	}
+	if _, ok := g_txidSeen["bb"]; !ok {
+		t.Fatal("unexpected seen txids after loading", g_txidSeen)
+	}
+	if len(g_txList) != 3 {
+		t.Fatal("unexpected number of mempool tx after loading", len(g_txList))
+	}
+	for i, tx := range g_txList {
+		if len(tx.Data) != 1 || tx.Data[0] != byte(i) || tx.Height != 200 || tx.Sequence != uint64(1000+i) {
+			t.Fatal("unexpected mempool tx after loading", tx)
+		}
+	}
+	// It's loaded only once.
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("mempool state file not removed")
+	}
+
+	// Stale state is discarded.
+	setup()
+	if err := SaveMempoolState(path); err != nil {
+		t.Fatal(err)
+	}
+	restart()
+	Time.Sleep(2 * time.Minute)
+	if LoadMempoolState(path, time.Minute) {
+		t.Fatal("stale mempool state loaded")
+	}
+	if len(g_txList) != 0 || g_nextSequence != 5000 {
+		t.Fatal("stale mempool state restored")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("stale mempool state file not removed")
+	}
+
+	// So is unreadable state.
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if LoadMempoolState(path, time.Minute) {
+		t.Fatal("corrupt mempool state loaded")
+	}
+	restart()
+	g_firstSequence, g_nextSequence = 0, 0
+}
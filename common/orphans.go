@@ -0,0 +1,79 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// ReorgGracePeriod is how long blocks that were reorged away remain
+// available by hash (see GetOrphanedBlock), for wallets still catching up
+// on the old chain; zero disables keeping them.
+var ReorgGracePeriod time.Duration
+
+// orphans are the recently reorged-away blocks, by hash.
+var orphans struct {
+	mutex  sync.Mutex
+	blocks map[string]orphan
+}
+
+type orphan struct {
+	block    *walletrpc.CompactBlock
+	orphaned time.Time
+}
+
+// reorgKeepingOrphans removes the cache's blocks from the given height on
+// (see Cache.Reorg()), first keeping them, if ReorgGracePeriod is set, so
+// they can still be served by hash for a while.
+func reorgKeepingOrphans(c Cache, height int) {
+	if ReorgGracePeriod > 0 {
+		now := Time.Now()
+		orphans.mutex.Lock()
+		pruneOrphans(now)
+		if orphans.blocks == nil {
+			orphans.blocks = make(map[string]orphan)
+		}
+		for h := height; h <= c.GetLatestHeight(); h++ {
+			if block := c.GetShared(h); block != nil {
+				orphans.blocks[string(block.Hash)] = orphan{block: block, orphaned: now}
+			}
+		}
+		orphans.mutex.Unlock()
+	}
+	c.Reorg(height)
+}
+
+// pruneOrphans removes the orphaned blocks whose grace period has ended;
+// the caller must hold orphans.mutex.
+func pruneOrphans(now time.Time) {
+	for hash, o := range orphans.blocks {
+		if now.Sub(o.orphaned) >= ReorgGracePeriod {
+			delete(orphans.blocks, hash)
+		}
+	}
+}
+
+// GetOrphanedBlock returns the block with the given hash if it was reorged
+// away less than ReorgGracePeriod ago, marked as orphaned, or nil.
+func GetOrphanedBlock(hash []byte) *walletrpc.CompactBlock {
+	if ReorgGracePeriod == 0 {
+		return nil
+	}
+	orphans.mutex.Lock()
+	defer orphans.mutex.Unlock()
+	pruneOrphans(Time.Now())
+	o, ok := orphans.blocks[string(hash)]
+	if !ok {
+		return nil
+	}
+	block := proto.Clone(o.block).(*walletrpc.CompactBlock)
+	block.Orphaned = true
+	return block
+}
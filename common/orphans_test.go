@@ -0,0 +1,65 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestReorgGracePeriod(t *testing.T) {
+	restore := SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	defer restore()
+	ReorgGracePeriod = time.Minute
+	defer func() { ReorgGracePeriod = 0 }()
+	c := NewMemoryBlockCache(1000)
+	for height := 1000; height < 1005; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orphaned := testBlock(1003, 0).Hash
+	reorgKeepingOrphans(c, 1003)
+	if err := c.Add(1003, testBlock(1003, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetHeightByHash(orphaned) >= 0 {
+		t.Fatal("reorged block still in the cache")
+	}
+
+	// Within the grace period, the reorged-away blocks can be found by hash.
+	Time.Sleep(30 * time.Second)
+	block := GetOrphanedBlock(orphaned)
+	if block == nil || block.Height != 1003 || !bytes.Equal(block.Hash, orphaned) || !block.Orphaned {
+		t.Fatal("unexpected orphaned block", block)
+	}
+	if block := GetOrphanedBlock(testBlock(1004, 0).Hash); block == nil || block.Height != 1004 {
+		t.Fatal("unexpected orphaned block", block)
+	}
+	// The block's on the best chain, not orphaned.
+	if GetOrphanedBlock(testBlock(1003, 1).Hash) != nil {
+		t.Fatal("unexpected orphaned block on the best chain")
+	}
+	if c.GetShared(1003).Orphaned {
+		t.Fatal("cached block marked orphaned")
+	}
+
+	// After it, they're purged.
+	Time.Sleep(30 * time.Second)
+	if block := GetOrphanedBlock(orphaned); block != nil {
+		t.Fatal("orphaned block not purged", block)
+	}
+	if len(orphans.blocks) != 0 {
+		t.Fatal("unexpected orphaned blocks", len(orphans.blocks))
+	}
+
+	// Without a grace period, they're not kept.
+	ReorgGracePeriod = 0
+	reorgKeepingOrphans(c, 1003)
+	if GetOrphanedBlock(testBlock(1003, 1).Hash) != nil || len(orphans.blocks) != 0 {
+		t.Fatal("orphaned block kept without a grace period")
+	}
+}
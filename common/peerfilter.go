@@ -0,0 +1,132 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AllowCIDRs and DenyCIDRs restrict which peers (by source address) may
+// make requests. A peer within any of DenyCIDRs is rejected; otherwise, if
+// AllowCIDRs isn't empty, a peer must be within one of them. By default
+// (both empty), all peers are allowed.
+var (
+	AllowCIDRs []*net.IPNet
+	DenyCIDRs  []*net.IPNet
+)
+
+// ParseCIDRs parses a list of CIDRs (such as "10.0.0.0/8" or "::1/128").
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func cidrsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAllowed returns true if the given source IP may make requests.
+func peerAllowed(ip net.IP) bool {
+	if cidrsContain(DenyCIDRs, ip) {
+		return false
+	}
+	return len(AllowCIDRs) == 0 || cidrsContain(AllowCIDRs, ip)
+}
+
+// peerIP returns the (source) IP address of the request's peer, or nil if
+// it's unknown.
+func peerIP(ctx context.Context) net.IP {
+	if peerInfo, ok := peer.FromContext(ctx); ok && peerInfo.Addr != nil {
+		host, _, err := net.SplitHostPort(peerInfo.Addr.String())
+		if err == nil {
+			return net.ParseIP(host)
+		}
+	}
+	return nil
+}
+
+// checkPeer returns an error if the request's peer isn't allowed.
+func checkPeer(ctx context.Context) error {
+	if len(AllowCIDRs) == 0 && len(DenyCIDRs) == 0 {
+		return nil
+	}
+	ip := peerIP(ctx)
+	if ip == nil || !peerAllowed(ip) {
+		// A peer whose address is unknown can't be allowed.
+		return status.Error(codes.PermissionDenied, "requests from this address are not allowed")
+	}
+	return nil
+}
+
+// PeerFilterUnaryInterceptor rejects requests from peers that aren't
+// allowed by AllowCIDRs and DenyCIDRs.
+func PeerFilterUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := checkPeer(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// PeerFilterStreamInterceptor is the streaming equivalent of
+// PeerFilterUnaryInterceptor.
+func PeerFilterStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := checkPeer(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// CheckLocalPeer returns an error unless the request comes from the same
+// host (a loopback address), and hasn't been relayed (by a proxy on this
+// host) on behalf of another; it guards admin rpcs.
+func CheckLocalPeer(ctx context.Context) error {
+	denied := status.Error(codes.PermissionDenied, "only allowed from the server's host")
+	if md, ok := metadata.FromIncomingContext(ctx); ok &&
+		(len(md.Get("x-real-ip")) > 0 || len(md.Get("x-forwarded-for")) > 0) {
+		return denied
+	}
+	peerInfo, ok := peer.FromContext(ctx)
+	if !ok || peerInfo.Addr == nil {
+		return denied
+	}
+	host, _, err := net.SplitHostPort(peerInfo.Addr.String())
+	if err != nil {
+		return denied
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return denied
+	}
+	return nil
+}
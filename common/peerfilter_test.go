@@ -0,0 +1,80 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func peerContext(address string) context.Context {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		testT.Fatal(err)
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+}
+
+func TestPeerFilterInterceptor(t *testing.T) {
+	testT = t
+	defer func() {
+		AllowCIDRs = nil
+		DenyCIDRs = nil
+	}()
+	if _, err := ParseCIDRs([]string{"10.0.0.0/8", "bogus"}); err == nil {
+		t.Fatal("ParseCIDRs should reject an invalid CIDR")
+	}
+	var err error
+	if AllowCIDRs, err = ParseCIDRs([]string{"10.0.0.0/8", "::1/128"}); err != nil {
+		t.Fatal(err)
+	}
+	if DenyCIDRs, err = ParseCIDRs([]string{"10.1.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlock"}
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return "ok", nil
+	}
+
+	for _, tt := range []struct {
+		ctx     context.Context
+		allowed bool
+	}{
+		{peerContext("10.2.3.4:9067"), true},
+		{peerContext("[::1]:9067"), true},
+		{peerContext("10.1.2.3:9067"), false},    // denied, although within an allowed CIDR
+		{peerContext("192.168.1.1:9067"), false}, // not allowed
+		{context.Background(), false},            // unknown peer
+	} {
+		calls = 0
+		resp, err := PeerFilterUnaryInterceptor(tt.ctx, nil, info, handler)
+		if tt.allowed {
+			if err != nil || resp != "ok" || calls != 1 {
+				t.Fatal("peer should be allowed", err)
+			}
+		} else {
+			if status.Code(err) != codes.PermissionDenied || calls != 0 {
+				t.Fatal("peer should be denied", err)
+			}
+		}
+	}
+
+	// Without an allow list, everything that isn't denied is allowed.
+	AllowCIDRs = nil
+	if _, err := PeerFilterUnaryInterceptor(peerContext("192.168.1.1:9067"), nil, info, handler); err != nil {
+		t.Fatal("peer should be allowed", err)
+	}
+	if _, err := PeerFilterUnaryInterceptor(peerContext("10.1.2.3:9067"), nil, info, handler); err == nil {
+		t.Fatal("peer should be denied")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxPeerRequests is the most requests, unary and streaming together, that
+// one peer (by source IP address) may have in progress at once; more are
+// rejected with codes.ResourceExhausted. Zero means unlimited. Behind a
+// proxy, all clients share the proxy's address.
+var MaxPeerRequests int
+
+// peerRequests counts the requests in progress, by peer IP address. A
+// peer's entry is removed when its last request finishes, so there's never
+// more than one entry per request in progress.
+var peerRequests = struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// startPeerRequest counts a new request from the context's peer, returning
+// the function to call when it finishes, or an error if the peer already
+// has MaxPeerRequests in progress. Peers whose address is unknown share
+// one count.
+func startPeerRequest(ctx context.Context) (func(), error) {
+	if MaxPeerRequests <= 0 {
+		return func() {}, nil
+	}
+	key := ""
+	if ip := peerIP(ctx); ip != nil {
+		key = ip.String()
+	}
+	p := &peerRequests
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.counts[key] >= MaxPeerRequests {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"too many requests in progress from this address (the limit is %d)", MaxPeerRequests)
+	}
+	p.counts[key]++
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.counts[key]--; p.counts[key] <= 0 {
+			delete(p.counts, key)
+		}
+	}, nil
+}
+
+// PeerLimitUnaryInterceptor enforces MaxPeerRequests (counting this peer's
+// unary and streaming requests).
+func PeerLimitUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	finished, err := startPeerRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer finished()
+	return handler(ctx, req)
+}
+
+// PeerLimitStreamInterceptor is the streaming equivalent of
+// PeerLimitUnaryInterceptor; a stream counts until it's closed.
+func PeerLimitStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	finished, err := startPeerRequest(ss.Context())
+	if err != nil {
+		return err
+	}
+	defer finished()
+	return handler(srv, ss)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPeerLimitInterceptor(t *testing.T) {
+	testT = t
+	MaxPeerRequests = 2
+	defer func() { MaxPeerRequests = 0 }()
+	unaryInfo := &grpc.UnaryServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlock"}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange"}
+
+	// Handlers that run until released.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	unaryHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return "ok", nil
+	}
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	quickUnary := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	quickStream := func(srv interface{}, ss grpc.ServerStream) error {
+		return nil
+	}
+	done := make(chan error, 2)
+
+	// One stream and one unary call in progress from the same peer ...
+	peer := peerContext("10.2.3.4:9067")
+	go func() {
+		done <- PeerLimitStreamInterceptor(nil, &testServerStream{ctx: peer}, streamInfo, streamHandler)
+	}()
+	<-started
+	go func() {
+		_, err := PeerLimitUnaryInterceptor(peerContext("10.2.3.4:9068"), nil, unaryInfo, unaryHandler)
+		done <- err
+	}()
+	<-started
+
+	// ... use up its limit, whichever type the next call is.
+	if _, err := PeerLimitUnaryInterceptor(peer, nil, unaryInfo, quickUnary); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unary call over the limit not rejected", err)
+	}
+	if err := PeerLimitStreamInterceptor(nil, &testServerStream{ctx: peer}, streamInfo, quickStream); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("stream over the limit not rejected", err)
+	}
+	// Other peers aren't affected.
+	if _, err := PeerLimitUnaryInterceptor(peerContext("10.2.3.5:9067"), nil, unaryInfo, quickUnary); err != nil {
+		t.Fatal("another peer's call rejected", err)
+	}
+
+	// Once they finish, the peer may make requests again, and (being idle)
+	// it's no longer tracked.
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := PeerLimitUnaryInterceptor(peer, nil, unaryInfo, quickUnary); err != nil {
+		t.Fatal("call rejected after the others finished", err)
+	}
+	peerRequests.mutex.Lock()
+	defer peerRequests.mutex.Unlock()
+	if len(peerRequests.counts) != 0 {
+		t.Fatal("idle peers still tracked", peerRequests.counts)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// getBlockCount returns pirated's best height.
+func getBlockCount() (int, error) {
+	result, err := RawRequest("getblockcount", []json.RawMessage{})
+	if err != nil {
+		return 0, err
+	}
+	var height int
+	if err := json.Unmarshal(result, &height); err != nil {
+		return 0, errors.Wrap(err, "bad getblockcount return")
+	}
+	return height, nil
+}
+
+// getBlockHash returns the hash (in internal byte order) of pirated's block
+// at the given height.
+func getBlockHash(height int) ([]byte, error) {
+	heightJSON, _ := json.Marshal(height)
+	result, err := RawRequest("getblockhash", []json.RawMessage{heightJSON})
+	if err != nil {
+		return nil, err
+	}
+	var hashHex string
+	if err := json.Unmarshal(result, &hashHex); err != nil {
+		return nil, errors.Wrap(err, "bad getblockhash return")
+	}
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding getblockhash output")
+	}
+	return parser.Reverse(hash), nil
+}
+
+// piratedBehind is called by the block ingestor when pirated has no block
+// at the cache's next height. Usually that's a reorg at the cache's tip,
+// but pirated's best height may also have dropped below the cache's, most
+// likely because it was restarted with -reindex (or a block was
+// invalidated). Rolling the cache back to pirated's height would throw
+// away blocks that a reindexing pirated will soon have again, so instead
+// this discards only the cached blocks after the highest one pirated
+// agrees with (none, while pirated is simply catching up), and reports
+// whether pirated is still behind the cache. Cached blocks above pirated's
+// height are verified this way as pirated reaches them.
+func piratedBehind(c Cache) (bool, error) {
+	bestHeight, err := getBlockCount()
+	if err != nil {
+		return false, err
+	}
+	cacheHeight := c.GetLatestHeight()
+	if bestHeight >= cacheHeight {
+		return false, nil
+	}
+	// Find the common ancestor, the highest block pirated agrees with.
+	height := bestHeight
+	for ; height >= c.GetFirstHeight(); height-- {
+		hash, err := getBlockHash(height)
+		if err != nil {
+			// pirated may not be able to serve it yet; try again later.
+			Log.Warning("couldn't fetch pirated's block hash at ", height, ": ", err)
+			return true, nil
+		}
+		block := c.Get(height)
+		if block == nil {
+			// Unreadable (or being repaired); try again later.
+			Log.Warning("couldn't read cached block ", height, " to compare with pirated's")
+			return true, nil
+		}
+		if bytes.Equal(block.Hash, hash) {
+			break
+		}
+	}
+	if height == bestHeight {
+		return true, nil
+	}
+	Log.WithFields(logrus.Fields{
+		"pirated_height": bestHeight,
+		"cache_height":   cacheHeight,
+		"ancestor":       height,
+	}).Warning("pirated is behind the cache on another chain, discarding blocks after the common ancestor")
+	reorgKeepingOrphans(c, height+1)
+	invalidateLightdInfoCache()
+	setIngestTip(c.GetShared(c.GetLatestHeight()), false)
+	return false, nil
+}
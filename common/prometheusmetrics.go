@@ -14,6 +14,19 @@ type PrometheusMetrics struct {
 	ArrrPriceGauge                prometheus.Gauge
 	ArrrPriceHistoryWebAPICounter prometheus.Counter
 	ArrrPriceHistoryErrors        prometheus.Counter
+	RPCErrorsCounter              *prometheus.CounterVec
+	CacheCorruptBlocksCounter     prometheus.Counter
+	InFlightRequestsGauge         prometheus.Gauge
+	InFlightMethodGauge           *prometheus.GaugeVec
+	IngestLagGauge                prometheus.Gauge
+	IngestLagAlarmGauge           prometheus.Gauge
+	TipAgeGauge                   prometheus.GaugeFunc
+	SinceLastBlockGauge           prometheus.GaugeFunc
+	ShieldedServedCounter         *prometheus.CounterVec
+	HashIndexBytesGauge           prometheus.GaugeFunc
+	StreamGoroutinesGauge         prometheus.Gauge
+	BytesSentCounter              prometheus.Counter
+	BadCompactBlockHeightGauge    prometheus.Gauge
 }
 
 func GetPrometheusMetrics() *PrometheusMetrics {
@@ -73,5 +86,70 @@ func GetPrometheusMetrics() *PrometheusMetrics {
 		Help: "Counter for number of errors seen in the history price API",
 	})
 
+	m.RPCErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lightwalletd_rpc_errors",
+		Help: "Number of failed pirated rpcs, by method and category (timeout, connection, rpc-error)",
+	}, []string{"method", "category"})
+
+	m.CacheCorruptBlocksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "lightwalletd_cache_corrupt_blocks",
+		Help: "Number of corrupt blocks found in the cache by the scrubber",
+	})
+
+	m.InFlightRequestsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lightwalletd_inflight_requests",
+		Help: "Number of gRPC requests currently being handled",
+	})
+
+	m.InFlightMethodGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lightwalletd_inflight_method_requests",
+		Help: "Number of gRPC requests currently being handled, by method",
+	}, []string{"method"})
+
+	m.IngestLagGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lightwalletd_ingest_lag_blocks",
+		Help: "Number of blocks the cache is behind pirated's best height",
+	})
+
+	m.IngestLagAlarmGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lightwalletd_ingest_lag_alarm",
+		Help: "1 if block ingestion has been falling behind pirated for too long, else 0",
+	})
+
+	m.TipAgeGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lightwalletd_tip_age_seconds",
+		Help: "Age (wall-clock time minus block time) of the cache's tip block",
+	}, tipAgeSeconds)
+
+	m.SinceLastBlockGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lightwalletd_seconds_since_last_block",
+		Help: "Seconds since the block ingestor last added a block to the cache",
+	}, secondsSinceLastBlock)
+
+	m.ShieldedServedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lightwalletd_shielded_elements_served",
+		Help: "Number of shielded spends and outputs sent in streamed blocks, by protocol (sapling, orchard) and kind (spend, output); an orchard action is one of each",
+	}, []string{"protocol", "kind"})
+
+	m.HashIndexBytesGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "lightwalletd_cache_hash_index_bytes",
+		Help: "Estimated memory used by the cache's index of block hashes",
+	}, hashIndexBytes)
+
+	m.StreamGoroutinesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lightwalletd_stream_goroutines",
+		Help: "Number of goroutines running streaming request handlers, or helpers (such as prefetchers) on their behalf",
+	})
+
+	m.BytesSentCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "lightwalletd_bytes_sent",
+		Help: "Total size of the reply messages sent to clients, in bytes",
+	})
+
+	m.BadCompactBlockHeightGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lightwalletd_bad_compact_block_height",
+		Help: "Height at which block ingestion is halted by a block that fails the compact block check (with --compact-block-check=skip), or 0",
+	})
+
 	return m
 }
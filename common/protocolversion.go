@@ -0,0 +1,93 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"path"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersion is the wallet protocol version this server implements;
+// increment it when the CompactBlock format (or anything else clients
+// depend on) changes incompatibly.
+const ProtocolVersion = 1
+
+// ProtocolVersionHeader is the gRPC metadata key that clients use to send
+// their protocol version. Clients that don't send it are version 0.
+const ProtocolVersionHeader = "lightwalletd-protocol-version"
+
+// MinProtocolVersion is the oldest client protocol version accepted; the
+// default (zero) accepts all clients.
+var MinProtocolVersion int
+
+// protocolVersionExempt are the rpcs (by method name) that clients of any
+// protocol version may call, so that an old wallet can still learn about
+// the server (including that it's no longer supported).
+var protocolVersionExempt = map[string]bool{
+	"GetLightdInfo":         true,
+	"GetServerCapabilities": true,
+}
+
+// checkProtocolVersion returns an error if the client's protocol version
+// (from the request metadata) is less than MinProtocolVersion, unless the
+// method (gRPC's full method name) is exempt.
+func checkProtocolVersion(ctx context.Context, fullMethod string) error {
+	if MinProtocolVersion == 0 || protocolVersionExempt[path.Base(fullMethod)] {
+		return nil
+	}
+	version := 0
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ProtocolVersionHeader); len(values) > 0 {
+			var err error
+			version, err = strconv.Atoi(values[0])
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument,
+					"invalid %s: %s", ProtocolVersionHeader, values[0])
+			}
+		}
+	}
+	if version < MinProtocolVersion {
+		return status.Errorf(codes.FailedPrecondition,
+			"wallet protocol version %d is no longer supported (minimum %d), please upgrade your wallet",
+			version, MinProtocolVersion)
+	}
+	return nil
+}
+
+// ProtocolVersionUnaryInterceptor rejects requests from clients whose
+// protocol version is too old, except for GetLightdInfo and
+// GetServerCapabilities.
+func ProtocolVersionUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := checkProtocolVersion(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// ProtocolVersionStreamInterceptor is the streaming equivalent of
+// ProtocolVersionUnaryInterceptor.
+func ProtocolVersionStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := checkProtocolVersion(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var protocolHandlerCalls int
+
+func protocolHandler(ctx context.Context, req interface{}) (interface{}, error) {
+	protocolHandlerCalls++
+	return "ok", nil
+}
+
+func versionContext(version string) context.Context {
+	return metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(ProtocolVersionHeader, version))
+}
+
+func TestProtocolVersionInterceptor(t *testing.T) {
+	MinProtocolVersion = 1
+	defer func() { MinProtocolVersion = 0 }()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlock"}
+
+	// accepted
+	resp, err := ProtocolVersionUnaryInterceptor(versionContext("1"), nil, info, protocolHandler)
+	if err != nil {
+		t.Fatal("ProtocolVersionUnaryInterceptor failed:", err)
+	}
+	if resp != "ok" || protocolHandlerCalls != 1 {
+		t.Fatal("unexpected response", resp, protocolHandlerCalls)
+	}
+
+	// rejected, both explicitly too old and (older) clients that don't send a version
+	for _, ctx := range []context.Context{versionContext("0"), context.Background()} {
+		_, err = ProtocolVersionUnaryInterceptor(ctx, nil, info, protocolHandler)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	if protocolHandlerCalls != 1 {
+		t.Fatal("handler should not have been called", protocolHandlerCalls)
+	}
+
+	// Old clients can still get the server's information.
+	for _, method := range []string{"GetLightdInfo", "GetServerCapabilities"} {
+		exempt := &grpc.UnaryServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/" + method}
+		if _, err = ProtocolVersionUnaryInterceptor(context.Background(), nil, exempt, protocolHandler); err != nil {
+			t.Fatal("exempt method rejected", method, err)
+		}
+	}
+	if protocolHandlerCalls != 3 {
+		t.Fatal("unexpected handler calls", protocolHandlerCalls)
+	}
+
+	// The default minimum accepts everyone.
+	MinProtocolVersion = 0
+	_, err = ProtocolVersionUnaryInterceptor(context.Background(), nil, info, protocolHandler)
+	if err != nil {
+		t.Fatal("ProtocolVersionUnaryInterceptor failed:", err)
+	}
+	protocolHandlerCalls = 0
+}
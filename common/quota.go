@@ -0,0 +1,225 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// QuotaBytes, if not zero, is the most reply data (the size of the reply
+// messages, in bytes) that one client may be sent within any QuotaWindow;
+// once it's reached, its requests (including streams in progress) fail
+// with codes.ResourceExhausted until enough of its usage is older than
+// the window.
+var QuotaBytes int64
+
+// QuotaWindow is the sliding window over which QuotaBytes applies.
+var QuotaWindow = time.Hour
+
+// QuotaAPIKeys are the API keys that clients may send (in APIKeyHeader)
+// to be accounted for by key rather than by address, so that clients
+// behind one proxy or NAT needn't share a quota. Other keys are ignored,
+// so that a client can't escape its quota by changing its key.
+var QuotaAPIKeys map[string]bool
+
+// APIKeyHeader is the gRPC metadata key in which clients send their API key.
+const APIKeyHeader = "x-api-key"
+
+// QuotaRemainingTrailer is the grpc trailer in which the number of bytes
+// left in the client's quota is returned, if there's a quota.
+const QuotaRemainingTrailer = "x-lightwalletd-quota-remaining"
+
+// quotaSlots is how many parts the window is divided into; usage expires
+// a slot (a tenth of the window) at a time.
+const quotaSlots = 10
+
+// clientUsage is a client's bytes sent in each slot of the window; slot
+// number n (counting from the Unix epoch) is in slots[n%quotaSlots].
+type clientUsage struct {
+	slots [quotaSlots]int64
+	last  int64 // the most recent slot number
+}
+
+// advance moves the window forward to the given slot number, clearing the
+// slots that have left it, and returns the total in the window.
+func (u *clientUsage) advance(slot int64) int64 {
+	for s := u.last + 1; s <= slot && s <= u.last+quotaSlots; s++ {
+		u.slots[s%quotaSlots] = 0
+	}
+	if slot > u.last {
+		u.last = slot
+	}
+	var total int64
+	for _, n := range u.slots {
+		total += n
+	}
+	return total
+}
+
+// clientUsages tracks the clients with usage in the window, by clientKey().
+var clientUsages = struct {
+	mutex     sync.Mutex
+	usage     map[string]*clientUsage
+	lastPrune int64
+}{usage: make(map[string]*clientUsage)}
+
+// quotaSlot returns the current slot number.
+func quotaSlot() int64 {
+	slotLength := int64(QuotaWindow / quotaSlots)
+	if slotLength <= 0 {
+		slotLength = 1
+	}
+	return Time.Now().UnixNano() / slotLength
+}
+
+// chargeClient adds n bytes to the client's usage, returning how much of
+// its quota remains (negative if it's been exceeded).
+func chargeClient(key string, n int64) int64 {
+	c := &clientUsages
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	slot := quotaSlot()
+	if slot != c.lastPrune {
+		// Forget the clients with no usage left in the window.
+		c.lastPrune = slot
+		for k, u := range c.usage {
+			if u.advance(slot) == 0 {
+				delete(c.usage, k)
+			}
+		}
+	}
+	u := c.usage[key]
+	if u == nil {
+		if n == 0 {
+			return QuotaBytes
+		}
+		u = &clientUsage{last: slot}
+		c.usage[key] = u
+	}
+	total := u.advance(slot)
+	u.slots[slot%quotaSlots] += n
+	return QuotaBytes - total - n
+}
+
+// clientKey identifies the request's client for its quota: by its API key,
+// if it's one of QuotaAPIKeys, else by its address. Clients whose address
+// is unknown share one quota.
+func clientKey(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(APIKeyHeader); len(values) > 0 && QuotaAPIKeys[values[0]] {
+			return "key:" + values[0]
+		}
+	}
+	if ip := peerIP(ctx); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// countBytesSent records a reply message's size, for the metric and the
+// client's quota, returning how much of its quota remains.
+func countBytesSent(key string, m interface{}) int64 {
+	var n int64
+	if pm, ok := m.(proto.Message); ok {
+		n = int64(proto.Size(pm))
+	}
+	if Metrics != nil {
+		Metrics.BytesSentCounter.Add(float64(n))
+	}
+	if QuotaBytes <= 0 {
+		return 0
+	}
+	return chargeClient(key, n)
+}
+
+func quotaExceeded() error {
+	return status.Errorf(codes.ResourceExhausted,
+		"this client's data quota (%d bytes per %v) is used up, try again later", QuotaBytes, QuotaWindow)
+}
+
+func quotaTrailer(remaining int64) metadata.MD {
+	if remaining < 0 {
+		remaining = 0
+	}
+	return metadata.Pairs(QuotaRemainingTrailer, strconv.FormatInt(remaining, 10))
+}
+
+// QuotaUnaryInterceptor counts the bytes sent to each client, and enforces
+// QuotaBytes: a client that has used up its quota is refused. The quota
+// remaining is returned in the QuotaRemainingTrailer.
+func QuotaUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	key := clientKey(ctx)
+	if QuotaBytes > 0 {
+		if remaining := chargeClient(key, 0); remaining <= 0 {
+			// This fails only if there's no grpc transport (unit tests).
+			grpc.SetTrailer(ctx, quotaTrailer(remaining))
+			return nil, quotaExceeded()
+		}
+	}
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	remaining := countBytesSent(key, resp)
+	if QuotaBytes > 0 {
+		grpc.SetTrailer(ctx, quotaTrailer(remaining))
+	}
+	return resp, nil
+}
+
+// quotaStream is a grpc.ServerStream that counts the bytes it sends, and
+// fails once the client's quota is used up.
+type quotaStream struct {
+	grpc.ServerStream
+	key       string
+	remaining int64
+}
+
+func (s *quotaStream) SendMsg(m interface{}) error {
+	if QuotaBytes > 0 && s.remaining <= 0 {
+		return quotaExceeded()
+	}
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.remaining = countBytesSent(s.key, m)
+	return nil
+}
+
+// QuotaStreamInterceptor is the streaming equivalent of
+// QuotaUnaryInterceptor; the quota is checked as each message is sent, so
+// a long stream (such as a download of the whole chain) can exceed it
+// only by one message.
+func QuotaStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	qs := &quotaStream{ServerStream: ss, key: clientKey(ss.Context())}
+	if QuotaBytes > 0 {
+		qs.remaining = chargeClient(qs.key, 0)
+		defer func() { ss.SetTrailer(quotaTrailer(qs.remaining)) }()
+		if qs.remaining <= 0 {
+			return quotaExceeded()
+		}
+	}
+	return handler(srv, qs)
+}
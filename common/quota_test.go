@@ -0,0 +1,112 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testTrailerStream records the trailer set on a stream.
+type testTrailerStream struct {
+	testServerStream
+	trailer metadata.MD
+}
+
+func (s *testTrailerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func TestClientQuota(t *testing.T) {
+	testT = t
+	restore := SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	defer restore()
+	blockSize := int64(proto.Size(testBlock(1000, 0)))
+	// Enough for 25 blocks.
+	QuotaBytes = 25 * blockSize
+	QuotaWindow = time.Hour
+	defer func() {
+		QuotaBytes = 0
+		clientUsages.usage = make(map[string]*clientUsage)
+	}()
+	info := &grpc.StreamServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange"}
+
+	// getBlockRange streams 10 blocks, as GetBlockRange would.
+	getBlockRange := func(address string) (*testTrailerStream, error) {
+		ss := &testTrailerStream{testServerStream: testServerStream{ctx: peerContext(address)}}
+		err := QuotaStreamInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+			for height := 1000; height < 1010; height++ {
+				if err := stream.SendMsg(testBlock(height, 0)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return ss, err
+	}
+	remaining := func(ss *testTrailerStream) int64 {
+		values := ss.trailer.Get(QuotaRemainingTrailer)
+		if len(values) != 1 {
+			t.Fatal("unexpected quota trailer", ss.trailer)
+		}
+		n, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for i := 1; i <= 2; i++ {
+		ss, err := getBlockRange("10.2.3.4:9067")
+		if err != nil {
+			t.Fatal("GetBlockRange within the quota failed", err)
+		}
+		if ss.sent != 10 || remaining(ss) != QuotaBytes-int64(i)*10*blockSize {
+			t.Fatal("unexpected blocks sent or quota remaining", ss.sent, remaining(ss))
+		}
+	}
+	// The third call exceeds the quota part way.
+	ss, err := getBlockRange("10.2.3.4:9067")
+	if status.Code(err) != codes.ResourceExhausted || ss.sent != 5 || remaining(ss) != 0 {
+		t.Fatal("GetBlockRange over the quota not stopped", ss.sent, err)
+	}
+	// Then the client is refused.
+	ss, err = getBlockRange("10.2.3.4:9068")
+	if status.Code(err) != codes.ResourceExhausted || ss.sent != 0 || remaining(ss) != 0 {
+		t.Fatal("GetBlockRange after the quota was used up not refused", ss.sent, err)
+	}
+	if _, err := QuotaUnaryInterceptor(peerContext("10.2.3.4:9067"), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return testBlock(1000, 0), nil
+		}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unary call after the quota was used up not refused", err)
+	}
+	// Other clients have their own quota.
+	if ss, err := getBlockRange("10.2.3.5:9067"); err != nil || remaining(ss) != QuotaBytes-10*blockSize {
+		t.Fatal("another client's GetBlockRange failed", err)
+	}
+
+	// As the window slides, the earliest usage expires.
+	Time.Sleep(30 * time.Minute)
+	if _, err := getBlockRange("10.2.3.4:9067"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("GetBlockRange allowed within the window", err)
+	}
+	Time.Sleep(31 * time.Minute)
+	if ss, err := getBlockRange("10.2.3.4:9067"); err != nil || remaining(ss) != QuotaBytes-10*blockSize {
+		t.Fatal("GetBlockRange refused after the window", err)
+	}
+	// Idle clients are forgotten.
+	if _, ok := clientUsages.usage["10.2.3.5"]; ok {
+		t.Fatal("idle client still tracked")
+	}
+}
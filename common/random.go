@@ -0,0 +1,100 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	cryptorand "crypto/rand"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Rand, like Time, is a level of indirection, for the randomness in request
+// IDs and retry backoff jitter, so that tests can be deterministic (see
+// SetDeterministic()). By default, Read is crypto/rand's, and Int63n uses
+// a math/rand source seeded at startup.
+var Rand struct {
+	Read   func(b []byte) (int, error)
+	Int63n func(n int64) int64
+}
+
+func init() {
+	Rand.Read = cryptorand.Read
+	Rand.Int63n = lockedRand(rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// lockedRand returns r's Int63n(), made safe for concurrent use.
+func lockedRand(r *rand.Rand) func(n int64) int64 {
+	var mutex sync.Mutex
+	return func(n int64) int64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return r.Int63n(n)
+	}
+}
+
+// SetDeterministic makes Time and Rand deterministic, for tests: the clock
+// starts at start and advances only when Time.Sleep() is called (which
+// returns immediately), and randomness comes from a math/rand source with
+// the given seed. It returns a function that restores the previous ones.
+func SetDeterministic(seed int64, start time.Time) (restore func()) {
+	savedTime, savedRand := Time, Rand
+	var mutex sync.Mutex
+	now := start
+	Time.Now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	Time.Sleep = func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	r := rand.New(rand.NewSource(seed))
+	Rand.Read = func(b []byte) (int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return r.Read(b)
+	}
+	Rand.Int63n = func(n int64) int64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return r.Int63n(n)
+	}
+	return func() {
+		Time, Rand = savedTime, savedRand
+	}
+}
+
+// Backoff computes the delays between retries: they double from Min up to
+// Max, and each is reduced by a random amount (jitter) of up to half, so
+// that retries by many clients (or servers) don't synchronize.
+type Backoff struct {
+	Min, Max time.Duration
+	attempt  int
+}
+
+// Next returns the delay before the next retry.
+func (b *Backoff) Next() time.Duration {
+	d := b.Min
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.attempt++
+	if half := int64(d / 2); half > 0 {
+		d -= time.Duration(Rand.Int63n(half + 1))
+	}
+	return d
+}
+
+// Reset starts over from Min (after a success).
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeterministicBackoff(t *testing.T) {
+	start := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	delays := func() ([]time.Duration, string) {
+		restore := SetDeterministic(42, start)
+		defer restore()
+		b := Backoff{Min: time.Second, Max: 8 * time.Second}
+		var d []time.Duration
+		for i := 0; i < 6; i++ {
+			d = append(d, b.Next())
+		}
+		b.Reset()
+		d = append(d, b.Next())
+		return d, NewRequestID()
+	}
+	first, firstID := delays()
+	second, secondID := delays()
+	if firstID != secondID {
+		t.Fatal("request IDs differ with the same seed", firstID, secondID)
+	}
+	for i, max := range []time.Duration{1, 2, 4, 8, 8, 8, 1} {
+		max *= time.Second
+		if first[i] != second[i] {
+			t.Fatal("delays differ with the same seed", i, first[i], second[i])
+		}
+		if first[i] < max/2 || first[i] > max {
+			t.Fatal("delay out of range", i, first[i])
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDTrailer is the grpc trailer in which each request's ID is returned
+// to the client, so it can be quoted in problem reports and matched to the
+// server's logs.
+const RequestIDTrailer = "x-request-id"
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random (version 4) UUID.
+func NewRequestID() string {
+	var b [16]byte
+	Rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// WithRequestID returns a copy of ctx that carries the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request that ctx belongs to, or "" if none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDUnaryInterceptor gives each request an ID, in its context and
+// the response's trailer.
+func RequestIDUnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	id := NewRequestID()
+	ctx = WithRequestID(ctx, id)
+	// This fails only if there's no grpc transport (unit tests).
+	grpc.SetTrailer(ctx, metadata.Pairs(RequestIDTrailer, id))
+	return handler(ctx, req)
+}
+
+// requestIDStream is a grpc.ServerStream whose context carries the request ID.
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
+
+// RequestIDStreamInterceptor is the streaming equivalent of
+// RequestIDUnaryInterceptor.
+func RequestIDStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	id := NewRequestID()
+	ss.SetTrailer(metadata.Pairs(RequestIDTrailer, id))
+	return handler(srv, &requestIDStream{ServerStream: ss, ctx: WithRequestID(ss.Context(), id)})
+}
+
+// RawRequestContext sends an rpc to pirated (using RawRequest) on behalf of
+// the request that ctx belongs to, and logs it (at debug level) with the
+// request's ID. If the request is canceled while waiting for a backend slot
+// (see LimitRawRequests), the rpc isn't sent, and ctx's error is returned.
+func RawRequestContext(ctx context.Context, method string, params []json.RawMessage) (json.RawMessage, error) {
+	start := time.Now()
+	rawRequest := RawRequest
+	if unlimitedRawRequest != nil {
+		release, err := AcquireBackend(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		rawRequest = unlimitedRawRequest
+	}
+	result, err := rawRequest(method, params)
+	if Log != nil && Log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		Log.WithFields(logrus.Fields{
+			"request_id": RequestID(ctx),
+			"method":     method,
+			"duration":   time.Since(start),
+			"error":      err,
+		}).Debug("pirated rpc")
+	}
+	return result, err
+}
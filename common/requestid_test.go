@@ -0,0 +1,80 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDServer replies with the request ID it finds in the context.
+type requestIDServer struct {
+	walletrpc.UnimplementedCompactTxStreamerServer
+}
+
+func (requestIDServer) GetLatestBlock(ctx context.Context, in *walletrpc.ChainSpec) (*walletrpc.BlockID, error) {
+	return &walletrpc.BlockID{Hash: []byte(RequestID(ctx))}, nil
+}
+
+func (requestIDServer) GetBlockRange(in *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
+	return resp.Send(&walletrpc.CompactBlock{Hash: []byte(RequestID(resp.Context()))})
+}
+
+func TestRequestID(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(RequestIDUnaryInterceptor),
+		grpc.StreamInterceptor(RequestIDStreamInterceptor))
+	walletrpc.RegisterCompactTxStreamerServer(server, requestIDServer{})
+	go server.Serve(l)
+	defer server.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := walletrpc.NewCompactTxStreamerClient(conn)
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	var trailer metadata.MD
+	blockID, err := client.GetLatestBlock(context.Background(), &walletrpc.ChainSpec{}, grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatal("GetLatestBlock failed", err)
+	}
+	ids := trailer.Get(RequestIDTrailer)
+	if len(ids) != 1 || !uuid.MatchString(ids[0]) || ids[0] != string(blockID.Hash) {
+		t.Fatal("unexpected request ID", ids, string(blockID.Hash))
+	}
+	first := ids[0]
+
+	stream, err := client.GetBlockRange(context.Background(), &walletrpc.BlockRange{})
+	if err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	block, err := stream.Recv()
+	if err != nil {
+		t.Fatal("Recv failed", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatal("unexpected error at the end of the stream", err)
+	}
+	ids = stream.Trailer().Get(RequestIDTrailer)
+	if len(ids) != 1 || !uuid.MatchString(ids[0]) || ids[0] != string(block.Hash) {
+		t.Fatal("unexpected request ID", ids, string(block.Hash))
+	}
+	if ids[0] == first {
+		t.Fatal("request IDs should differ")
+	}
+}
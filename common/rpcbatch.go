@@ -0,0 +1,96 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+)
+
+// RPCCall is one pirated rpc within a batch (see BatchRequest).
+type RPCCall struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// RPCResult is pirated's reply to one RPCCall; Err is set if the call failed,
+// as it would be by RawRequest.
+type RPCResult struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// RawBatchRequest points to the function to send several rpcs to pirated in
+// one (JSON-RPC batch) request; its results are in the same order as the
+// calls. It's nil if batching isn't available (as in unit tests, unless set).
+var RawBatchRequest func(calls []RPCCall) ([]RPCResult, error)
+
+// ErrBatchUnsupported is returned by RawBatchRequest if pirated doesn't
+// accept batch requests (it replies to one with a JSON-RPC invalid request
+// or parse error); other failures are assumed to be temporary.
+var ErrBatchUnsupported = errors.New("pirated does not support batch requests")
+
+// RPCBatchSize is the maximum number of rpcs sent to pirated in one batch;
+// zero disables batching.
+var RPCBatchSize = 100
+
+// batchUnsupported is set (atomically) once pirated has rejected a batch,
+// so that later batches are sent one rpc at a time without trying again.
+var batchUnsupported int32
+
+// BatchRequest makes the given pirated rpcs, on behalf of the request that
+// ctx belongs to, in as few round-trips as possible, and returns their
+// results in the same order. If batching is disabled or pirated doesn't
+// support it, the rpcs are made one at a time using RawRequestContext.
+func BatchRequest(ctx context.Context, calls []RPCCall) []RPCResult {
+	results := make([]RPCResult, len(calls))
+	for start := 0; start < len(calls); {
+		end := len(calls)
+		if RPCBatchSize > 0 && end-start > RPCBatchSize {
+			end = start + RPCBatchSize
+		}
+		if !sendBatch(ctx, calls[start:end], results[start:end]) {
+			for i := start; i < end; i++ {
+				results[i].Result, results[i].Err = RawRequestContext(ctx, calls[i].Method, calls[i].Params)
+			}
+		}
+		start = end
+	}
+	return results
+}
+
+// sendBatch sends the calls to pirated as one batch, filling in results;
+// it returns false if the calls must instead be made one at a time.
+func sendBatch(ctx context.Context, calls []RPCCall, results []RPCResult) bool {
+	if RawBatchRequest == nil || RPCBatchSize <= 0 || len(calls) < 2 ||
+		atomic.LoadInt32(&batchUnsupported) != 0 {
+		return false
+	}
+	release, err := AcquireBackend(ctx)
+	if err != nil {
+		// The calls fail the same way (quickly) one at a time.
+		return false
+	}
+	defer release()
+	replies, err := RawBatchRequest(calls)
+	if err == ErrBatchUnsupported {
+		Log.Warning("pirated does not support batch requests, sending rpcs one at a time")
+		atomic.StoreInt32(&batchUnsupported, 1)
+		return false
+	}
+	if err != nil || len(replies) != len(calls) {
+		// Let each rpc fail (or succeed) on its own.
+		Log.Warning("batch request failed, retrying rpcs one at a time: ", err)
+		return false
+	}
+	for i, reply := range replies {
+		countRPCResult(calls[i].Method, reply.Err)
+		results[i] = reply
+	}
+	return true
+}
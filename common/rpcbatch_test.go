@@ -0,0 +1,110 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// batchStubResult answers each call with its (single) parameter, or an error if
+// the method is "fail".
+func batchStubResult(call RPCCall) RPCResult {
+	if call.Method == "fail" {
+		return RPCResult{Err: errors.New("-5: No such mempool or blockchain transaction")}
+	}
+	return RPCResult{Result: call.Params[0]}
+}
+
+func TestBatchRequest(t *testing.T) {
+	Time.Now = nowStub
+	var batchSizes []int
+	var sequential int
+	RawBatchRequest = func(calls []RPCCall) ([]RPCResult, error) {
+		batchSizes = append(batchSizes, len(calls))
+		// Reply in the opposite order, as a batch-aware pirated may; the
+		// results must still be matched to their calls.
+		results := make([]RPCResult, len(calls))
+		for i := len(calls) - 1; i >= 0; i-- {
+			results[i] = batchStubResult(calls[i])
+		}
+		return results, nil
+	}
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		sequential++
+		result := batchStubResult(RPCCall{Method: method, Params: params})
+		return result.Result, result.Err
+	}
+	defer func() {
+		RawBatchRequest = nil
+		RPCBatchSize = 100
+		batchUnsupported = 0
+	}()
+
+	calls := make([]RPCCall, 25)
+	for i := range calls {
+		calls[i] = RPCCall{Method: "getrawtransaction", Params: []json.RawMessage{json.RawMessage(strconv.Itoa(i))}}
+	}
+	calls[7].Method = "fail"
+	check := func(results []RPCResult) {
+		if len(results) != len(calls) {
+			t.Fatal("unexpected number of results", len(results))
+		}
+		for i, result := range results {
+			if i == 7 {
+				if result.Err == nil {
+					t.Fatal("expected an error for call", i)
+				}
+				continue
+			}
+			if result.Err != nil || string(result.Result) != strconv.Itoa(i) {
+				t.Fatal("unexpected result for call", i, string(result.Result), result.Err)
+			}
+		}
+	}
+
+	// The calls are sent in batches of (at most) RPCBatchSize.
+	RPCBatchSize = 10
+	check(BatchRequest(context.Background(), calls))
+	if len(batchSizes) != 3 || batchSizes[0] != 10 || batchSizes[2] != 5 || sequential != 0 {
+		t.Fatal("unexpected batches", batchSizes, sequential)
+	}
+
+	// Batching disabled: one call at a time.
+	batchSizes = nil
+	RPCBatchSize = 0
+	check(BatchRequest(context.Background(), calls))
+	if len(batchSizes) != 0 || sequential != 25 {
+		t.Fatal("unexpected batches with batching disabled", batchSizes, sequential)
+	}
+
+	// A failed batch is retried one call at a time.
+	RPCBatchSize = 100
+	sequential = 0
+	RawBatchRequest = func(calls []RPCCall) ([]RPCResult, error) {
+		batchSizes = append(batchSizes, len(calls))
+		return nil, errors.New("connection refused")
+	}
+	check(BatchRequest(context.Background(), calls))
+	if len(batchSizes) != 1 || sequential != 25 {
+		t.Fatal("unexpected batches after a failure", batchSizes, sequential)
+	}
+
+	// If pirated doesn't support batches, they're no longer attempted.
+	batchSizes = nil
+	sequential = 0
+	RawBatchRequest = func(calls []RPCCall) ([]RPCResult, error) {
+		batchSizes = append(batchSizes, len(calls))
+		return nil, ErrBatchUnsupported
+	}
+	check(BatchRequest(context.Background(), calls))
+	check(BatchRequest(context.Background(), calls))
+	if len(batchSizes) != 1 || sequential != 50 {
+		t.Fatal("unexpected batches without batch support", batchSizes, sequential)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+// A warning is logged when more than rpcErrorRateThreshold of at least
+// rpcErrorRateMinCalls calls to a pirated rpc method fail within
+// rpcErrorRateWindow, and at most once per window per method.
+const (
+	rpcErrorRateWindow    = time.Minute
+	rpcErrorRateMinCalls  = 10
+	rpcErrorRateThreshold = 0.5
+)
+
+type rpcMethodStats struct {
+	windowStart time.Time
+	calls       int
+	errors      int
+	lastWarning time.Time
+}
+
+var (
+	rpcStatsMutex sync.Mutex
+	rpcStats      = make(map[string]*rpcMethodStats)
+)
+
+// InstrumentRawRequest wraps a RawRequest function so that pirated rpc
+// failures are counted, by method and category, in the rpc errors metric,
+// and a (rate-limited) warning is logged when a method is failing often.
+func InstrumentRawRequest(rawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)) func(method string, params []json.RawMessage) (json.RawMessage, error) {
+	return func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		result, err := rawRequest(method, params)
+		countRPCResult(method, err)
+		return result, err
+	}
+}
+
+// countRPCResult updates the rpc errors metric and statistics for one rpc,
+// and whether pirated is reachable.
+func countRPCResult(method string, err error) {
+	if err != nil && Metrics != nil {
+		Metrics.RPCErrorsCounter.WithLabelValues(method, rpcErrorCategory(err)).Inc()
+	}
+	recordRPCResult(method, err)
+	recordBackendResult(err)
+}
+
+// rpcErrorCategory returns "timeout", "connection" (couldn't talk to pirated),
+// or "rpc-error" (pirated returned an error).
+func rpcErrorCategory(err error) string {
+	if err == context.DeadlineExceeded {
+		return "timeout"
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "connection"
+	}
+	return "rpc-error"
+}
+
+func recordRPCResult(method string, err error) {
+	rpcStatsMutex.Lock()
+	defer rpcStatsMutex.Unlock()
+	now := Time.Now()
+	stats := rpcStats[method]
+	if stats == nil {
+		stats = &rpcMethodStats{windowStart: now}
+		rpcStats[method] = stats
+	}
+	if now.Sub(stats.windowStart) >= rpcErrorRateWindow {
+		stats.windowStart = now
+		stats.calls = 0
+		stats.errors = 0
+	}
+	stats.calls++
+	if err == nil {
+		return
+	}
+	stats.errors++
+	if stats.calls < rpcErrorRateMinCalls ||
+		float64(stats.errors)/float64(stats.calls) <= rpcErrorRateThreshold ||
+		(!stats.lastWarning.IsZero() && now.Sub(stats.lastWarning) < rpcErrorRateWindow) {
+		return
+	}
+	stats.lastWarning = now
+	Log.Warning("pirated rpc ", method, " failed ", stats.errors, " of ", stats.calls,
+		" times in the last ", now.Sub(stats.windowStart).Round(time.Second), ", latest error: ", err)
+}
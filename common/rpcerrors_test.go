@@ -0,0 +1,78 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Returns a different kind of failure depending on the method.
+func failingStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	switch method {
+	case "getblock":
+		return nil, errors.New("-8: Block height out of range")
+	case "getinfo":
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	case "getrawmempool":
+		return nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	}
+	return []byte("{}"), nil
+}
+
+func TestInstrumentRawRequest(t *testing.T) {
+	Metrics = GetPrometheusMetrics()
+	Time.Now = nowStub
+	sleepDuration = time.Hour
+	rawRequest := InstrumentRawRequest(failingStub)
+
+	for i := 0; i < rpcErrorRateMinCalls; i++ {
+		rawRequest("getblock", nil)
+	}
+	rawRequest("getinfo", nil)
+	rawRequest("getrawmempool", nil)
+	if _, err := rawRequest("getbestblockhash", nil); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, test := range []struct {
+		method   string
+		category string
+		expected float64
+	}{
+		{"getblock", "rpc-error", rpcErrorRateMinCalls},
+		{"getinfo", "connection", 1},
+		{"getrawmempool", "timeout", 1},
+		{"getbestblockhash", "rpc-error", 0},
+	} {
+		count := testutil.ToFloat64(Metrics.RPCErrorsCounter.WithLabelValues(test.method, test.category))
+		if count != test.expected {
+			t.Fatal("unexpected", test.method, test.category, "count", count)
+		}
+	}
+
+	// getblock has failed often enough to warn, but only once per window
+	warned := rpcStats["getblock"].lastWarning
+	if warned.IsZero() {
+		t.Fatal("expected a getblock error rate warning")
+	}
+	sleepDuration += time.Second
+	rawRequest("getblock", nil)
+	if rpcStats["getblock"].lastWarning != warned {
+		t.Fatal("error rate warning not rate-limited")
+	}
+	if !rpcStats["getinfo"].lastWarning.IsZero() {
+		t.Fatal("unexpected getinfo error rate warning")
+	}
+
+	sleepDuration = 0
+	rpcStats = make(map[string]*rpcMethodStats)
+	Metrics = nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RPCPassthrough is the set of pirated rpcs that the RawPiratedRPC admin
+// rpc passes through (see --rpc-passthrough); it should contain only ones
+// that don't change anything, such as getblockchaininfo or getpeerinfo.
+var RPCPassthrough map[string]bool
+
+// SetRPCPassthrough sets RPCPassthrough to the given methods.
+func SetRPCPassthrough(methods []string) {
+	RPCPassthrough = make(map[string]bool)
+	for _, method := range methods {
+		RPCPassthrough[method] = true
+	}
+}
+
+// PassthroughRPC makes the given pirated rpc, if it's in RPCPassthrough,
+// with the given (JSON) parameters, and returns its (JSON) result.
+func PassthroughRPC(method string, params []string) (json.RawMessage, error) {
+	if !RPCPassthrough[method] {
+		return nil, status.Errorf(codes.PermissionDenied, "pirated rpc %q is not allowed (see --rpc-passthrough)", method)
+	}
+	rawParams := make([]json.RawMessage, len(params))
+	for i, param := range params {
+		if !json.Valid([]byte(param)) {
+			return nil, status.Errorf(codes.InvalidArgument, "parameter %d is not JSON: %s", i, param)
+		}
+		rawParams[i] = json.RawMessage(param)
+	}
+	return RawRequest(method, rawParams)
+}
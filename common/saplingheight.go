@@ -0,0 +1,51 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// SaplingOnly makes GetBlock() and GetBlockRange() refuse heights below
+// sapling activation (see KnownSaplingActivationHeight()), where there's
+// nothing for shielded wallets, rather than fetching those blocks from
+// pirated.
+var SaplingOnly bool
+
+// saplingActivationHeights are the known sapling activation heights, by
+// chain name (as getblockchaininfo reports it).
+var saplingActivationHeights = map[string]int{
+	"main": 152855,
+}
+
+// KnownSaplingActivationHeight returns the known sapling activation height
+// of the given chain, and whether there is one.
+func KnownSaplingActivationHeight(chainName string) (int, bool) {
+	height, ok := saplingActivationHeights[chainName]
+	return height, ok
+}
+
+// SaplingActivationHeight returns the sapling activation height of the
+// given chain: the one pirated reported or, if it reported none, the known
+// one (if any). A disagreement is logged, since it means pirated isn't on
+// the chain its name suggests.
+func SaplingActivationHeight(chainName string, reported int) int {
+	known, ok := saplingActivationHeights[chainName]
+	if !ok {
+		return reported
+	}
+	if reported == 0 {
+		return known
+	}
+	if reported != known {
+		Log.WithFields(logrus.Fields{
+			"chain":    chainName,
+			"reported": reported,
+			"known":    known,
+		}).Warning("pirated's sapling activation height isn't the known one for its chain")
+	}
+	return reported
+}
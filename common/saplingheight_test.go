@@ -0,0 +1,27 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"testing"
+)
+
+func TestSaplingActivationHeight(t *testing.T) {
+	for _, tt := range []struct {
+		chainName string
+		reported  int
+		expected  int
+	}{
+		{"main", 152855, 152855},
+		{"main", 0, 152855},  // not reported
+		{"main", 1000, 1000}, // pirated knows best (but it's logged)
+		{"test", 280, 280},   // not in the table
+		{"regtest", 0, 0},    // not in the table, nor reported
+	} {
+		if height := SaplingActivationHeight(tt.chainName, tt.reported); height != tt.expected {
+			t.Fatal("unexpected sapling activation height", tt.chainName, tt.reported, height)
+		}
+	}
+}
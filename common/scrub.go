@@ -0,0 +1,159 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// blockRequestsInProgress is the number of gRPC requests currently serving
+// blocks; the cache scrubber stays out of the way while this is high.
+var blockRequestsInProgress int32
+
+// BlockRequestStarted should be called when a gRPC request starts serving
+// blocks, and BlockRequestFinished when it's done.
+func BlockRequestStarted() {
+	atomic.AddInt32(&blockRequestsInProgress, 1)
+}
+
+// BlockRequestFinished undoes BlockRequestStarted.
+func BlockRequestFinished() {
+	atomic.AddInt32(&blockRequestsInProgress, -1)
+}
+
+// CacheScrubber periodically re-reads the blocks in the cache and verifies
+// their checksums, so that disk corruption is found before a wallet hits it.
+type CacheScrubber struct {
+	Cache          *BlockCache
+	Interval       time.Duration // time between passes over the cache
+	BytesPerSecond int           // read budget, to avoid IO spikes (0 means unlimited)
+	BusyRequests   int32         // pause while this many block requests are in progress
+	Refetch        bool          // on corruption, re-download the bad block
+}
+
+// Run scrubs the cache forever, a full pass every s.Interval.
+func (s *CacheScrubber) Run() {
+	for {
+		Time.Sleep(s.Interval)
+		start := Time.Now()
+		bad := s.scrubPass()
+		Log.Info("Cache scrub found ", bad, " bad blocks, took ", Time.Now().Sub(start))
+	}
+}
+
+// scrubPass checks each block in the cache once, returning the number
+// of bad blocks found.
+func (s *CacheScrubber) scrubPass() int {
+	c := s.Cache
+	bad := 0
+	budget := s.BytesPerSecond
+	for height := c.GetFirstHeight(); height < c.GetNextHeight(); height++ {
+		for atomic.LoadInt32(&blockRequestsInProgress) >= s.BusyRequests {
+			Time.Sleep(time.Second)
+		}
+		c.mutex.RLock()
+		if height >= c.nextBlock {
+			// The cache was truncated (reorg) since the loop test.
+			c.mutex.RUnlock()
+			break
+		}
+		length := c.blockLength(height)
+		ok := c.readBlock(height) != nil
+		c.mutex.RUnlock()
+		if !ok {
+			bad++
+			Log.Warning("Cache scrub found a bad block at height ", height)
+			if Metrics != nil {
+				Metrics.CacheCorruptBlocksCounter.Inc()
+			}
+			if s.Refetch && !s.refetch(height) {
+				return bad
+			}
+		}
+		budget -= length
+		for s.BytesPerSecond > 0 && budget <= 0 {
+			Time.Sleep(time.Second)
+			budget += s.BytesPerSecond
+		}
+	}
+	return bad
+}
+
+// refetch replaces the bad block at the given height with pirated's copy of
+// it. If that can't be done in place, the cache is truncated at that height
+// instead, so the block ingestor downloads it (and the blocks after it)
+// again, and refetch returns false. If pirated doesn't have the same block
+// (it's down, or the chain has reorged), the block is left for the next pass.
+func (s *CacheScrubber) refetch(height int) bool {
+	c := s.Cache
+	block, err := getBlockFromRPC(context.Background(), height)
+	if block == nil {
+		Log.Warning("Cache scrub couldn't refetch the block at height ", height, ": ", err)
+		return true
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if height >= c.nextBlock {
+		return false
+	}
+	if c.hashes.lookup(block.Hash) != height {
+		Log.Warning("Cache scrub refetched a different block at height ", height, ", not repaired")
+		return true
+	}
+	if err := c.rewriteBlock(height, block); err != nil {
+		Log.Warning("Cache scrub couldn't repair the block at height ", height, " in place: ", err)
+		c.recoverFromCorruption(height)
+		return false
+	}
+	Log.Info("Cache scrub repaired the block at height ", height)
+	return true
+}
+
+// rewriteBlock overwrites the block at the given height in the blocks file
+// with the given (same) block, which must be stored the same way and take
+// the same space, as it does unless the block format or compression has
+// changed since it was added.
+// Caller should hold c.mutex.Lock().
+func (c *BlockCache) rewriteBlock(height int, block *walletrpc.CompactBlock) error {
+	data, err := proto.Marshal(block)
+	if err != nil {
+		return err
+	}
+	stored, compressed := data, false
+	if b := compressBlock(data); b != nil {
+		stored, compressed = b, true
+	}
+	index := height - c.firstBlock
+	if len(stored) != c.blockLength(height) || compressed != c.compressed[index] {
+		return errors.New("the block is no longer stored the same way")
+	}
+	// The block must be in the file (not pending), which is opened for
+	// appending, so it's rewritten through another descriptor.
+	c.flush()
+	f, err := os.OpenFile(c.blocksName, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(append(checksum(height, stored), stored...), c.starts[index])
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	c.mem.add(height, data)
+	return nil
+}
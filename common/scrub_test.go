@@ -0,0 +1,145 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCacheScrubber(t *testing.T) {
+	Metrics = GetPrometheusMetrics()
+	Time.Sleep = sleepStub
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	for height := 1000; height < 1010; height++ {
+		block := &walletrpc.CompactBlock{Height: uint64(height), Hash: make([]byte, 32)}
+		if err := c.Add(height, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Commit the blocks to disk, which is what the scrubber verifies.
+	c.Sync()
+	scrubber := &CacheScrubber{Cache: c, BytesPerSecond: 100, BusyRequests: 1}
+
+	// A clean cache; each block is 37 bytes, so the read budget
+	// (100 bytes per second) requires three sleeps.
+	if bad := scrubber.scrubPass(); bad != 0 {
+		t.Fatal("unexpected bad blocks", bad)
+	}
+	if sleepCount != 3 {
+		t.Fatal("unexpected sleep count", sleepCount)
+	}
+
+	// Flip a byte of block 1005 on disk.
+	f, err := os.OpenFile(c.blocksName, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	offset := c.starts[1005-1000] + 10
+	f.ReadAt(b, offset)
+	b[0] ^= 0xff
+	f.WriteAt(b, offset)
+	f.Close()
+
+	if bad := scrubber.scrubPass(); bad != 1 {
+		t.Fatal("unexpected bad blocks", bad)
+	}
+	if testutil.ToFloat64(Metrics.CacheCorruptBlocksCounter) != 1 {
+		t.Fatal("corrupt block not counted")
+	}
+	if c.GetLatestHeight() != 1009 {
+		t.Fatal("cache should be unchanged without Refetch")
+	}
+
+	// With Refetch, if pirated can't provide the block, it's left for
+	// the next pass (the cache isn't truncated).
+	scrubber.Refetch = true
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("connection refused")
+	}
+	if bad := scrubber.scrubPass(); bad != 1 {
+		t.Fatal("unexpected bad blocks", bad)
+	}
+	if c.GetLatestHeight() != 1009 {
+		t.Fatal("unexpected latest height after a failed refetch", c.GetLatestHeight())
+	}
+
+	c.Close()
+	os.RemoveAll(unitTestPath)
+	sleepCount = 0
+	sleepDuration = 0
+	Metrics = nil
+}
+
+func TestCacheScrubberRefetch(t *testing.T) {
+	testT = t
+	RawRequest = blockIngestorBatchStub
+	defer atomic.StoreInt32(&batchRequests, 0)
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 380640, 0)
+	defer c.Close()
+	for height := 380640; height < 380644; height++ {
+		block, err := getBlockFromRPC(context.Background(), height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add(height, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Sync()
+	corrupt := func(height int) {
+		f, err := os.OpenFile(c.blocksName, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b := make([]byte, 1)
+		offset := c.starts[height-380640] + 20
+		f.ReadAt(b, offset)
+		b[0] ^= 0xff
+		f.WriteAt(b, offset)
+	}
+	scrubber := &CacheScrubber{Cache: c, BusyRequests: 1, Refetch: true}
+
+	// Only the bad block is replaced (in place), with pirated's copy.
+	corrupt(380641)
+	if bad := scrubber.scrubPass(); bad != 1 {
+		t.Fatal("unexpected bad blocks", bad)
+	}
+	if c.GetLatestHeight() != 380643 {
+		t.Fatal("unexpected latest height after refetch", c.GetLatestHeight())
+	}
+	if bad := scrubber.scrubPass(); bad != 0 {
+		t.Fatal("block not repaired", bad)
+	}
+	expected, _ := getBlockFromRPC(context.Background(), 380641)
+	c.mutex.RLock()
+	repaired := c.readBlock(380641)
+	c.mutex.RUnlock()
+	if !proto.Equal(repaired, expected) {
+		t.Fatal("unexpected repaired block")
+	}
+
+	// A block that's now stored differently can't be rewritten in place.
+	expected.Vtx = append(expected.Vtx, &walletrpc.CompactTx{Index: 5})
+	c.mutex.Lock()
+	err := c.rewriteBlock(380641, expected)
+	c.mutex.Unlock()
+	if err == nil {
+		t.Fatal("rewriteBlock should have failed for a larger block")
+	}
+}
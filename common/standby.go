@@ -0,0 +1,248 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// CompactTxStreamerService is the name of the wallet service, for the
+// health service (see SetServing()).
+const CompactTxStreamerService = "pirate.wallet.sdk.rpc.CompactTxStreamer"
+
+// standbyBatchBlocks is the most blocks a standby requests from its primary
+// in one GetBlockRange.
+const standbyBatchBlocks = 1000
+
+// Standby keeps the cache in sync with a primary lightwalletd's, instead
+// of ingesting blocks from pirated, so that the standby can take over from
+// the primary (be promoted) with a warm cache. While it's a standby, it
+// serves requests from its cache, but reports itself as NOT_SERVING in the
+// health service, so that load balancers send clients to the primary.
+type Standby struct {
+	Primary  walletrpc.CompactTxStreamerClient
+	Cache    Cache
+	Health   *health.Server // may be nil
+	Interval time.Duration  // between polls of the primary for new blocks
+
+	mutex    sync.Mutex
+	promoted bool
+	promote  chan struct{}
+}
+
+// NewStandby returns a standby that follows the given primary, and reports
+// the server as NOT_SERVING until it's promoted.
+func NewStandby(primary walletrpc.CompactTxStreamerClient, cache Cache, healthServer *health.Server) *Standby {
+	if healthServer != nil {
+		SetServing(healthServer, false)
+	}
+	return &Standby{
+		Primary:  primary,
+		Cache:    cache,
+		Health:   healthServer,
+		Interval: 2 * time.Second,
+		promote:  make(chan struct{}, 1),
+	}
+}
+
+// SetServing sets the health service's status of the server, and of the
+// wallet service.
+func SetServing(healthServer *health.Server, serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(CompactTxStreamerService, status)
+}
+
+// Run follows the primary until the standby is promoted (see Promote()),
+// then starts the block ingestor, and reports the server as serving. The
+// repetition count, rep, is nonzero only for unit-testing, in which case
+// it returns after that many polls of the primary.
+func (s *Standby) Run(rep int) {
+	unreachable := Backoff{Min: time.Second, Max: 30 * time.Second}
+	for i := 0; rep == 0 || i < rep; i++ {
+		select {
+		case <-s.promote:
+			Log.WithFields(logrus.Fields{
+				"height": s.Cache.GetLatestHeight(),
+			}).Warning("Standby promoted, ingesting blocks from pirated")
+			StartIngestor(s.Cache)
+			if s.Health != nil {
+				SetServing(s.Health, true)
+			}
+			return
+		default:
+		}
+		added, err := s.catchUp(context.Background())
+		if err != nil {
+			Log.Warning("standby couldn't get blocks from the primary: ", err)
+			Time.Sleep(unreachable.Next())
+			continue
+		}
+		unreachable.Reset()
+		if added == 0 {
+			Time.Sleep(s.Interval)
+		}
+	}
+}
+
+// Promote makes the standby take over from the primary; it returns false
+// if it has already been promoted.
+func (s *Standby) Promote() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.promoted {
+		return false
+	}
+	s.promoted = true
+	s.promote <- struct{}{}
+	return true
+}
+
+// IsStandby returns whether the standby hasn't been promoted.
+func (s *Standby) IsStandby() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.promoted
+}
+
+// catchUp adds the primary's blocks after the cache's tip (up to
+// standbyBatchBlocks of them), returning how many were added. If the
+// primary has reorged, it removes the cache's tip instead, as the block
+// ingestor does, so the next call backs up until the chains agree.
+func (s *Standby) catchUp(ctx context.Context) (int, error) {
+	latest, err := s.Primary.GetLatestBlock(ctx, &walletrpc.ChainSpec{})
+	if err != nil {
+		return 0, err
+	}
+	c := s.Cache
+	next := c.GetNextHeight()
+	if int(latest.Height) < next {
+		if int(latest.Height) == next-1 && !bytes.Equal(latest.Hash, c.GetLatestHash()) {
+			s.reorg(next - 1)
+		}
+		return 0, nil
+	}
+	end := int(latest.Height)
+	if end >= next+standbyBatchBlocks {
+		end = next + standbyBatchBlocks - 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := s.Primary.GetBlockRange(ctx, &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: uint64(next)},
+		End:   &walletrpc.BlockID{Height: uint64(end)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	defer func() {
+		if added > 0 {
+			c.Sync()
+			invalidateLightdInfoCache()
+		}
+	}()
+	var block *walletrpc.CompactBlock
+	for {
+		part, err := stream.Recv()
+		if err == io.EOF {
+			return added, nil
+		}
+		if err != nil {
+			return added, err
+		}
+		// A large block may be sent in parts (see Continued).
+		if block == nil {
+			block = part
+		} else {
+			joinBlockParts(block, part)
+		}
+		if block.Continued {
+			continue
+		}
+		block.Sequence = 0
+		height := c.GetNextHeight()
+		if int(block.Height) != height {
+			return added, fmt.Errorf("the primary sent block %d, expected %d", block.Height, height)
+		}
+		if !c.HashMatch(block.PrevHash) {
+			s.reorg(height - 1)
+			return added, nil
+		}
+		if err := c.Add(height, block); err != nil {
+			Log.Fatal("Cache add failed:", err)
+		}
+		setIngestTip(block, true)
+		added++
+		block = nil
+	}
+}
+
+func (s *Standby) reorg(height int) {
+	Log.Info("REORG (standby): dropping block ", height, " ", displayHash(s.Cache.GetLatestHash()))
+	reorgKeepingOrphans(s.Cache, height)
+	invalidateLightdInfoCache()
+	setIngestTip(s.Cache.GetShared(s.Cache.GetLatestHeight()), false)
+}
+
+// joinBlockParts appends the next part of a block that was sent in parts
+// to the block; a transaction divided between them is rejoined.
+func joinBlockParts(block, part *walletrpc.CompactBlock) {
+	block.Continued = part.Continued
+	vtx := part.Vtx
+	if n := len(block.Vtx); n > 0 && len(vtx) > 0 && block.Vtx[n-1].Index == vtx[0].Index &&
+		bytes.Equal(block.Vtx[n-1].Hash, vtx[0].Hash) {
+		tx := block.Vtx[n-1]
+		tx.Spends = append(tx.Spends, vtx[0].Spends...)
+		tx.Outputs = append(tx.Outputs, vtx[0].Outputs...)
+		tx.Actions = append(tx.Actions, vtx[0].Actions...)
+		vtx = vtx[1:]
+	}
+	block.Vtx = append(block.Vtx, vtx...)
+}
+
+// StandbyHandler is the (admin) http interface to the standby, for
+// requests from the server's host: GET reports whether it's (still) a
+// standby, and POST promotes it.
+func StandbyHandler(s *Standby) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := checkLocalHTTPRequest(req); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if !s.Promote() {
+				http.Error(w, "already promoted", http.StatusConflict)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Standby bool `json:"standby"`
+			Height  int  `json:"height"`
+		}{s.IsStandby(), s.Cache.GetLatestHeight()})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// fakePrimary serves its chain (from height 1000) as a primary lightwalletd
+// would; a block with more than 5 transactions is sent in two parts.
+type fakePrimary struct {
+	walletrpc.UnimplementedCompactTxStreamerServer
+	mutex sync.Mutex
+	chain []*walletrpc.CompactBlock
+}
+
+func (p *fakePrimary) GetLatestBlock(ctx context.Context, in *walletrpc.ChainSpec) (*walletrpc.BlockID, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	tip := p.chain[len(p.chain)-1]
+	return &walletrpc.BlockID{Height: tip.Height, Hash: tip.Hash}, nil
+}
+
+func (p *fakePrimary) GetBlockRange(in *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
+	p.mutex.Lock()
+	chain := p.chain
+	p.mutex.Unlock()
+	for height := in.Start.Height; height <= in.End.Height; height++ {
+		block := chain[height-1000]
+		if len(block.Vtx) > 5 {
+			first := proto.Clone(block).(*walletrpc.CompactBlock)
+			second := proto.Clone(block).(*walletrpc.CompactBlock)
+			first.Vtx, first.Continued = first.Vtx[:5], true
+			// The transaction at the division is itself divided.
+			first.Vtx[4].Outputs = nil
+			second.Vtx = second.Vtx[4:]
+			second.Vtx[0].Spends = nil
+			if err := resp.Send(first); err != nil {
+				return err
+			}
+			block = second
+		}
+		if err := resp.Send(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extend adds blocks to the primary's chain (of the given version), from
+// the given height.
+func (p *fakePrimary) extend(height, end int, version byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.chain = p.chain[:height-1000]
+	for ; height <= end; height++ {
+		block := testBlock(height, version)
+		if height > 1000 {
+			block.PrevHash = p.chain[height-1001].Hash
+		}
+		p.chain = append(p.chain, block)
+	}
+}
+
+func TestStandby(t *testing.T) {
+	testT = t
+	restore := SetDeterministic(1, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	defer restore()
+	primary := &fakePrimary{}
+	primary.extend(1000, 1024, 0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	walletrpc.RegisterCompactTxStreamerServer(server, primary)
+	go server.Serve(l)
+	defer server.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := NewMemoryBlockCache(1000)
+	healthServer := health.NewServer()
+	serving := func() healthpb.HealthCheckResponse_ServingStatus {
+		reply, err := healthServer.Check(context.Background(),
+			&healthpb.HealthCheckRequest{Service: CompactTxStreamerService})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply.Status
+	}
+	standby := NewStandby(walletrpc.NewCompactTxStreamerClient(conn), c, healthServer)
+	if serving() != healthpb.HealthCheckResponse_NOT_SERVING || !standby.IsStandby() {
+		t.Fatal("standby reported as serving")
+	}
+	// expectChain checks that the standby's cache has the primary's chain.
+	expectChain := func() {
+		t.Helper()
+		primary.mutex.Lock()
+		defer primary.mutex.Unlock()
+		if c.GetNextHeight() != 1000+len(primary.chain) {
+			t.Fatal("unexpected cache tip", c.GetLatestHeight())
+		}
+		for i, block := range primary.chain {
+			if !proto.Equal(c.Get(1000+i), block) {
+				t.Fatal("unexpected block", 1000+i)
+			}
+		}
+	}
+
+	// It catches up with the primary.
+	standby.Run(2)
+	expectChain()
+
+	// Then follows it, including through a reorg.
+	primary.extend(1023, 1026, 1)
+	standby.Run(5)
+	expectChain()
+	if serving() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatal("standby reported as serving")
+	}
+
+	// When promoted, it ingests blocks from pirated, and is serving.
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	defer func() { RawRequest = nil }()
+	if !standby.Promote() || standby.Promote() {
+		t.Fatal("unexpected promotion result")
+	}
+	standby.Run(1)
+	defer StopIngestor()
+	if serving() != healthpb.HealthCheckResponse_SERVING || standby.IsStandby() || !ingestorRunning {
+		t.Fatal("promoted standby not serving")
+	}
+}
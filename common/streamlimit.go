@@ -0,0 +1,83 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxStreamDuration is the longest a streaming request may last (measured
+// from the start of the stream, including any catch-up), after which the
+// client is asked to reconnect, so that long-lived clients are spread over
+// the servers behind a load balancer. Zero means unlimited.
+var MaxStreamDuration time.Duration
+
+// cappedStream is a grpc.ServerStream whose context is canceled at
+// MaxStreamDuration, after which it can no longer be used (by a handler
+// that hasn't noticed yet).
+type cappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *cappedStream) Context() context.Context {
+	return s.ctx
+}
+
+// ended reports whether the stream has reached MaxStreamDuration.
+func (s *cappedStream) ended() bool {
+	return s.ctx.Err() == context.DeadlineExceeded
+}
+
+func (s *cappedStream) SendMsg(m interface{}) error {
+	if s.ended() {
+		return streamDurationError()
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *cappedStream) RecvMsg(m interface{}) error {
+	if s.ended() {
+		return streamDurationError()
+	}
+	return s.ServerStream.RecvMsg(m)
+}
+
+func streamDurationError() error {
+	return status.Errorf(codes.Unavailable,
+		"stream reached the maximum duration (%v), please reconnect", MaxStreamDuration)
+}
+
+// MaxStreamDurationInterceptor ends streams that last longer than
+// MaxStreamDuration with codes.Unavailable. The handler's context is
+// canceled at that time, and the stream fails when it's next used; the
+// interceptor returns only once the handler has, so that the limits on
+// requests in progress (MaxPeerRequests, and the in-flight gauge) count it
+// until then.
+func MaxStreamDurationInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if MaxStreamDuration <= 0 {
+		return handler(srv, ss)
+	}
+	ctx, cancel := context.WithTimeout(ss.Context(), MaxStreamDuration)
+	defer cancel()
+	capped := &cappedStream{ServerStream: ss, ctx: ctx}
+	err := handler(srv, capped)
+	if capped.ended() {
+		Log.Info("Ended stream ", info.FullMethod, " at the maximum duration")
+		return streamDurationError()
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream counts the messages sent by a stream handler.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context // nil means context.Background()
+	sent int
+}
+
+func (s *testServerStream) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *testServerStream) SendMsg(m interface{}) error {
+	s.sent++
+	return nil
+}
+
+func TestMaxStreamDuration(t *testing.T) {
+	MaxStreamDuration = 100 * time.Millisecond
+	defer func() { MaxStreamDuration = 0 }()
+	info := &grpc.StreamServerInfo{FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetMempoolStream"}
+
+	// A handler that sends forever (live stream) is ended at the cap.
+	ss := &testServerStream{}
+	handlerErr := make(chan error, 1)
+	start := time.Now()
+	err := MaxStreamDurationInterceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			if err := stream.SendMsg(nil); err != nil {
+				handlerErr <- err
+				return err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	elapsed := time.Since(start)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("unexpected error", err)
+	}
+	if elapsed < MaxStreamDuration || elapsed > 5*MaxStreamDuration {
+		t.Fatal("stream ended at the wrong time", elapsed)
+	}
+	// The handler can no longer send.
+	select {
+	case err := <-handlerErr:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatal("unexpected handler error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not stop")
+	}
+	if ss.sent == 0 {
+		t.Fatal("nothing was sent before the cap")
+	}
+
+	// A handler that's waiting (without sending) is ended too, and its
+	// context is canceled.
+	err = MaxStreamDurationInterceptor(nil, &testServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("unexpected error", err)
+	}
+
+	// A handler that's slow to notice still counts until it returns.
+	returned := false
+	err = MaxStreamDurationInterceptor(nil, &testServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		<-stream.Context().Done()
+		time.Sleep(MaxStreamDuration)
+		returned = true
+		return nil
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("unexpected error", err)
+	}
+	if !returned {
+		t.Fatal("interceptor returned before the handler")
+	}
+
+	// Streams that finish before the cap are unaffected.
+	err = MaxStreamDurationInterceptor(nil, &testServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return stream.SendMsg(nil)
+	})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+}
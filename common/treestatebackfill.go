@@ -0,0 +1,187 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// BackfillProgress reports on the most recent (or current) tree state
+// index backfill.
+type BackfillProgress struct {
+	Running  bool   `json:"running"`
+	Interval int    `json:"interval"`
+	Start    int    `json:"start"`   // first height to index
+	End      int    `json:"end"`     // last height to index (the cache's tip when started)
+	Next     int    `json:"next"`    // next height to index
+	Indexed  int    `json:"indexed"` // tree states fetched from pirated
+	Skipped  int    `json:"skipped"` // already in the index (from an earlier run)
+	Error    string `json:"error,omitempty"`
+}
+
+// treeStateBackfill is the state of the (only) backfill.
+var treeStateBackfill struct {
+	mutex    sync.Mutex
+	progress BackfillProgress
+	cancel   chan struct{}
+	done     chan struct{}
+}
+
+// StartTreeStateBackfill starts adding the tree state of every cached block
+// whose height is a multiple of interval to TreeStates, in the background.
+// Heights already in the index are skipped, so an interrupted (or canceled)
+// backfill resumes where it left off when started again.
+func StartTreeStateBackfill(cache Cache, interval int) error {
+	if TreeStates == nil {
+		return errors.New("the tree state index is not enabled")
+	}
+	if interval < 1 {
+		return errors.New("interval must be at least 1")
+	}
+	b := &treeStateBackfill
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.progress.Running {
+		return errors.New("a backfill is already running")
+	}
+	start := (cache.GetFirstHeight() + interval - 1) / interval * interval
+	b.progress = BackfillProgress{
+		Running:  true,
+		Interval: interval,
+		Start:    start,
+		End:      cache.GetLatestHeight(),
+		Next:     start,
+	}
+	b.cancel = make(chan struct{})
+	b.done = make(chan struct{})
+	go runTreeStateBackfill(cache, b.cancel, b.done)
+	return nil
+}
+
+// CancelTreeStateBackfill stops the running backfill (if any), and waits
+// for it to stop.
+func CancelTreeStateBackfill() {
+	b := &treeStateBackfill
+	b.mutex.Lock()
+	if !b.progress.Running {
+		b.mutex.Unlock()
+		return
+	}
+	close(b.cancel)
+	done := b.done
+	b.mutex.Unlock()
+	<-done
+}
+
+// TreeStateBackfillProgress returns the progress of the current (or most
+// recent) backfill.
+func TreeStateBackfillProgress() BackfillProgress {
+	b := &treeStateBackfill
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.progress
+}
+
+func runTreeStateBackfill(cache Cache, cancel, done chan struct{}) {
+	b := &treeStateBackfill
+	defer close(done)
+	lastLog := Time.Now()
+	finish := func(err error) {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		b.progress.Running = false
+		if err != nil {
+			b.progress.Error = err.Error()
+		}
+		Log.Info("Tree state backfill stopped at height ", b.progress.Next, ", indexed ",
+			b.progress.Indexed, ", skipped ", b.progress.Skipped, " ", b.progress.Error)
+	}
+	for {
+		b.mutex.Lock()
+		progress := b.progress
+		b.mutex.Unlock()
+		if progress.Next > progress.End {
+			finish(nil)
+			return
+		}
+		select {
+		case <-cancel:
+			finish(errors.New("canceled"))
+			return
+		default:
+		}
+		height := progress.Next
+		indexed := 0
+		if TreeStates.Lookup(cache, height) == nil {
+			reply, err := GetTreeStateFromRPC(context.Background(), height, nil)
+			var treeState *walletrpc.TreeState
+			if err == nil {
+				treeState, err = TreeStateFromReply(reply, TreeStates.sprout)
+			}
+			if err == nil {
+				err = TreeStates.Put(cache, treeState)
+			}
+			if err != nil {
+				finish(err)
+				return
+			}
+			indexed = 1
+		}
+		b.mutex.Lock()
+		b.progress.Indexed += indexed
+		b.progress.Skipped += 1 - indexed
+		b.progress.Next += b.progress.Interval
+		b.mutex.Unlock()
+		if Time.Now().Sub(lastLog) >= 30*time.Second {
+			lastLog = Time.Now()
+			Log.Info("Tree state backfill at height ", height, " of ", progress.End)
+		}
+	}
+}
+
+// TreeStateBackfillHandler is the (admin) http interface to the tree state
+// index backfill: GET reports its progress, POST starts it (the optional
+// "interval" parameter defaults to TreeStateIndexInterval), and DELETE
+// cancels it, for requests from the server's host.
+func TreeStateBackfillHandler(cache Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := checkLocalHTTPRequest(req); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			interval := TreeStateIndexInterval
+			if s := req.FormValue("interval"); s != "" {
+				var err error
+				if interval, err = strconv.Atoi(s); err != nil {
+					http.Error(w, "invalid interval", http.StatusBadRequest)
+					return
+				}
+			}
+			if err := StartTreeStateBackfill(cache, interval); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		case http.MethodDelete:
+			CancelTreeStateBackfill()
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TreeStateBackfillProgress())
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+)
+
+func TestTreeStateBackfill(t *testing.T) {
+	Time.Now = time.Now
+	dir, err := ioutil.TempDir("", "lwd-treestates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	defer func() {
+		c.Close()
+		os.RemoveAll(unitTestPath)
+	}()
+	for height := 1000; height < 1010; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := TreeStateBackfillHandler(c)
+	request := func(method, url string) (int, BackfillProgress) {
+		req := httptest.NewRequest(method, url, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var progress BackfillProgress
+		json.Unmarshal(w.Body.Bytes(), &progress)
+		return w.Code, progress
+	}
+	wait := func() BackfillProgress {
+		for i := 0; i < 1000; i++ {
+			if _, progress := request("GET", "/treestates/backfill"); !progress.Running {
+				return progress
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("backfill did not finish")
+		return BackfillProgress{}
+	}
+
+	// Only from this host.
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/treestates/backfill", nil))
+	if w.Code != http.StatusForbidden || TreeStateBackfillProgress().Running {
+		t.Fatal("unexpected status for a remote request", w.Code)
+	}
+
+	// The index must be enabled.
+	if code, _ := request("POST", "/treestates/backfill"); code != http.StatusConflict {
+		t.Fatal("unexpected status without an index", code)
+	}
+	TreeStates, err = OpenTreeStateIndex(filepath.Join(dir, "treestates"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		TreeStates.Close()
+		TreeStates = nil
+	}()
+
+	var calls int32
+	block := make(chan struct{})
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var heightStr string
+		json.Unmarshal(params[0], &heightStr)
+		height, _ := strconv.Atoi(heightStr)
+		if method != "z_gettreestate" {
+			t.Fatal("unexpected rpc", method)
+		}
+		atomic.AddInt32(&calls, 1)
+		if height == 1006 {
+			<-block
+		}
+		return json.RawMessage(`{"height":` + heightStr + `,"hash":"` +
+			hex.EncodeToString(parser.Reverse(testBlock(height, 0).Hash)) + `",` +
+			`"sapling":{"commitments":{"finalState":"01"}}}`), nil
+	}
+
+	// Cancel partway (while the rpc for height 1006 is in progress).
+	if code, progress := request("POST", "/treestates/backfill?interval=2"); code != http.StatusOK ||
+		!progress.Running || progress.Start != 1000 || progress.End != 1009 {
+		t.Fatal("unexpected progress", code, progress)
+	}
+	for atomic.LoadInt32(&calls) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if code, _ := request("POST", "/treestates/backfill?interval=2"); code != http.StatusConflict {
+		t.Fatal("a second backfill should not start", code)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+	if _, progress := request("DELETE", "/treestates/backfill"); progress.Running ||
+		progress.Error != "canceled" || progress.Indexed != 4 || progress.Next != 1008 {
+		t.Fatal("unexpected progress after cancel", progress)
+	}
+
+	// Resume; only the remaining height needs an rpc.
+	atomic.StoreInt32(&calls, 0)
+	request("POST", "/treestates/backfill?interval=2")
+	if progress := wait(); progress.Error != "" || progress.Indexed != 1 || progress.Skipped != 4 {
+		t.Fatal("unexpected progress after resuming", progress)
+	}
+	if calls != 1 {
+		t.Fatal("unexpected rpcs", calls)
+	}
+
+	// The tree states are now served locally.
+	RawRequest = nil
+	for height := 1000; height < 1010; height++ {
+		if (TreeStates.Lookup(c, height) != nil) != (height%2 == 0) {
+			t.Fatal("unexpected index entry at height", height)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// TreeStates, if not nil, is the local index of tree states that's checked
+// before asking pirated (z_gettreestate, which is slow for old blocks).
+var TreeStates *TreeStateIndex
+
+// StrictTreeState makes the absence of the sprout finalState (in pirated's
+// z_gettreestate reply) an error, rather than falling back to the finalRoot,
+// to detect a backend that doesn't provide it. It only applies when the
+// sprout tree is served (see TreeStateFromReply()).
+var StrictTreeState bool
+
+// TreeStateRootFallback makes GetTreeState, when pirated can't provide a
+// tree state (z_gettreestate fails), reply with the block's note commitment
+// tree roots (from getblock) instead, as a last resort. A wallet can check
+// its own tree against them, but can't start syncing from them, since the
+// tree states themselves (the frontiers) are missing.
+var TreeStateRootFallback bool
+
+// TreeStateIndexInterval is how often (in blocks) the block ingestor adds
+// the tree state of a newly-ingested block to TreeStates.
+var TreeStateIndexInterval = 1000
+
+// treeStateIndexCompactMin is the fewest replaced (stale) entries that the
+// tree state index file is compacted for, so it's not rewritten too often.
+const treeStateIndexCompactMin = 100
+
+// TreeStateIndex holds tree states (as fetched once from pirated), by
+// height, in memory and in an append-only file of JSON lines, so they
+// survive restarts. Each includes the sprout tree (or root), and no network.
+// Only tree states of cached blocks are added, and the file is compacted
+// when most of its entries have been replaced, so it stays about as large
+// as the cache allows. A nil *TreeStateIndex is a valid, always-empty index.
+type TreeStateIndex struct {
+	mutex  sync.RWMutex
+	path   string
+	file   *os.File
+	lines  int // entries in the file, including replaced ones
+	states map[int]*walletrpc.TreeState
+	sprout bool // the sprout tree is served, see TreeStateFromReply()
+}
+
+// OpenTreeStateIndex loads (or creates) the tree state index file; sprout
+// is whether GetTreeState replies include the sprout tree.
+func OpenTreeStateIndex(path string, sprout bool) (*TreeStateIndex, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	x := &TreeStateIndex{path: path, file: file, states: make(map[int]*walletrpc.TreeState), sprout: sprout}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		x.lines++
+		treeState := &walletrpc.TreeState{}
+		if err := json.Unmarshal(scanner.Bytes(), treeState); err != nil {
+			// Most likely, the last line was only partly written
+			// (crash); the tree state will be fetched again.
+			Log.Warning("ignoring bad tree state index entry: ", err)
+			continue
+		}
+		x.states[int(treeState.Height)] = treeState
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Don't append to a partly-written last line.
+	if fi, err := file.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			file.Write([]byte{'\n'})
+		}
+	}
+	Log.Info("Loaded ", len(x.states), " tree states from ", path)
+	x.maybeCompact()
+	return x, nil
+}
+
+// Lookup returns (a copy of) the tree state at the given height, if it's
+// in the index and its block is the one in the cache at that height (so a
+// tree state from before a reorg isn't used); otherwise nil.
+func (x *TreeStateIndex) Lookup(cache Cache, height int) *walletrpc.TreeState {
+	if x == nil {
+		return nil
+	}
+	x.mutex.RLock()
+	state := x.states[height]
+	x.mutex.RUnlock()
+	if state == nil {
+		return nil
+	}
+	block := cache.GetShared(height)
+	if block == nil || hex.EncodeToString(parser.Reverse(block.Hash)) != state.Hash {
+		return nil
+	}
+	treeState := *state
+	return &treeState
+}
+
+// Put adds (a copy of) the tree state to the index, replacing any at the
+// same height, if its block is the one in the cache at that height (only
+// such a tree state can be looked up). It does nothing if the same tree
+// state is already indexed, as when z_gettreestate follows a skip hash to
+// the same earlier block for many requested heights.
+func (x *TreeStateIndex) Put(cache Cache, treeState *walletrpc.TreeState) error {
+	if x == nil {
+		return nil
+	}
+	height := int(treeState.Height)
+	block := cache.GetShared(height)
+	if block == nil || hex.EncodeToString(parser.Reverse(block.Hash)) != treeState.Hash {
+		return nil
+	}
+	state := *treeState
+	state.Network = ""
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if old := x.states[height]; old != nil && proto.Equal(old, &state) {
+		return nil
+	}
+	line, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	if _, err := x.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	x.lines++
+	x.states[height] = &state
+	x.maybeCompact()
+	return nil
+}
+
+// maybeCompact rewrites the index file without its replaced entries, if
+// they outnumber the current ones; the caller must hold x.mutex (or own x).
+// Failure isn't fatal; the file is appended to as before.
+func (x *TreeStateIndex) maybeCompact() {
+	stale := x.lines - len(x.states)
+	if stale < treeStateIndexCompactMin || stale <= len(x.states) {
+		return
+	}
+	if err := x.compact(); err != nil {
+		Log.Warning("couldn't compact the tree state index: ", err)
+		return
+	}
+	Log.Info("Compacted the tree state index, removed ", stale, " replaced entries")
+}
+
+func (x *TreeStateIndex) compact() error {
+	heights := make([]int, 0, len(x.states))
+	for height := range x.states {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+	tmpPath := x.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, height := range heights {
+		line, err := json.Marshal(x.states[height])
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, x.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	file, err := os.OpenFile(x.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	x.file.Close()
+	x.file, x.lines = file, len(heights)
+	return nil
+}
+
+// Close closes the index file.
+func (x *TreeStateIndex) Close() {
+	if x != nil {
+		x.file.Close()
+	}
+}
+
+// GetTreeStateFromRPC asks pirated for the tree state of the given block
+// (by height, or if zero, by hash, in internal byte order as in BlockID),
+// following skip hashes back to the block where the sapling tree last
+// changed, on behalf of the request ctx belongs to (see RawRequestContext).
+func GetTreeStateFromRPC(ctx context.Context, height int, hash []byte) (*PiratedRpcReplyGettreestate, error) {
+	// The Zcash z_gettreestate rpc accepts either a block height or block hash
+	params := make([]json.RawMessage, 1)
+	var hashJSON []byte
+	// The reply must be for the block we asked for; a reorg between the
+	// request and the rpc could otherwise cause us to serve the wrong tree.
+	wantHeight := height
+	var wantHash string
+	if height > 0 {
+		heightJSON, err := json.Marshal(strconv.Itoa(height))
+		if err != nil {
+			return nil, err
+		}
+		params[0] = heightJSON
+	} else {
+		// hash is little-endian (internal order), the rpc wants big-endian
+		wantHash = hex.EncodeToString(parser.Reverse(hash))
+		hashJSON, err := json.Marshal(wantHash)
+		if err != nil {
+			return nil, err
+		}
+		params[0] = hashJSON
+	}
+	var gettreestateReply PiratedRpcReplyGettreestate
+	for {
+		result, rpcErr := RawRequestContext(ctx, "z_gettreestate", params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		err := json.Unmarshal(result, &gettreestateReply)
+		if err != nil {
+			return nil, err
+		}
+		if wantHeight > 0 && gettreestateReply.Height != wantHeight {
+			return nil, fmt.Errorf("pirated returned treestate for height %d, requested height %d",
+				gettreestateReply.Height, wantHeight)
+		}
+		if wantHash != "" && gettreestateReply.Hash != wantHash {
+			return nil, fmt.Errorf("pirated returned treestate for block %s, requested block %s",
+				gettreestateReply.Hash, wantHash)
+		}
+		if gettreestateReply.Sapling.Commitments.FinalState != "" {
+			break
+		}
+		if gettreestateReply.Sapling.SkipHash == "" {
+			break
+		}
+		wantHeight = 0
+		wantHash = gettreestateReply.Sapling.SkipHash
+		hashJSON, err = json.Marshal(wantHash)
+		if err != nil {
+			return nil, err
+		}
+		params[0] = hashJSON
+	}
+	if gettreestateReply.Sapling.Commitments.FinalState == "" {
+		return nil, errors.New("pirated did not return treestate")
+	}
+	return &gettreestateReply, nil
+}
+
+// TreeStateFromReply converts pirated's z_gettreestate reply to a tree state
+// (without the network). pirated omits the sprout finalState once the tree
+// is no longer stored at this height; the finalRoot is the best we can offer
+// then, unless StrictTreeState is set and the sprout tree is served (sprout,
+// otherwise it's dropped, and its absence is harmless). A pool's tree is
+// left empty if pirated reports that the pool isn't active (yet) at this
+// height, whatever (stale) tree state it may include.
+func TreeStateFromReply(reply *PiratedRpcReplyGettreestate, sprout bool) (*walletrpc.TreeState, error) {
+	sproutTree := reply.Sprout.Commitments.FinalState
+	if sproutTree == "" {
+		if StrictTreeState && sprout {
+			return nil, fmt.Errorf("pirated returned no sprout finalState for height %d", reply.Height)
+		}
+		sproutTree = reply.Sprout.Commitments.FinalRoot
+	}
+	treeState := &walletrpc.TreeState{
+		Height:     uint64(reply.Height),
+		Hash:       reply.Hash,
+		Time:       reply.Time,
+		SproutTree: sproutTree,
+	}
+	if poolActive(reply.Sapling.Active) {
+		treeState.SaplingTree = reply.Sapling.Commitments.FinalState
+	}
+	if poolActive(reply.Orchard.Active) {
+		treeState.OrchardTree = reply.Orchard.Commitments.FinalState
+	}
+	return treeState, nil
+}
+
+// poolActive interprets a pool's "active" field in a z_gettreestate reply;
+// the legacy format doesn't have it.
+func poolActive(active *bool) bool {
+	return active == nil || *active
+}
+
+// TreeStateRootsFromRPC returns the sapling and orchard tree roots of the
+// given block (by height, or if zero, by hash, as for GetTreeStateFromRPC)
+// from pirated's getblock, as a tree state without the tree states
+// themselves (see TreeStateRootFallback), on behalf of the request ctx
+// belongs to.
+func TreeStateRootsFromRPC(ctx context.Context, height int, hash []byte) (*walletrpc.TreeState, error) {
+	var id string
+	if height > 0 {
+		id = strconv.Itoa(height)
+	} else {
+		id = hex.EncodeToString(parser.Reverse(hash))
+	}
+	idJSON, err := json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	params := []json.RawMessage{idJSON, json.RawMessage("1")}
+	result, rpcErr := RawRequestContext(ctx, "getblock", params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var block PirateRpcReplyGetblock1
+	if err := json.Unmarshal(result, &block); err != nil {
+		return nil, err
+	}
+	if height > 0 && block.Height != height || height == 0 && block.Hash != id {
+		return nil, fmt.Errorf("pirated returned block %s at height %d, requested %s", block.Hash, block.Height, id)
+	}
+	if block.FinalSaplingRoot == "" {
+		return nil, errors.New("pirated did not return the block's sapling root")
+	}
+	return &walletrpc.TreeState{
+		Height:      uint64(block.Height),
+		Hash:        block.Hash,
+		Time:        block.Time,
+		SaplingRoot: block.FinalSaplingRoot,
+		OrchardRoot: block.FinalOrchardRoot,
+	}, nil
+}
+
+// indexTreeState adds the tree state of the given (just ingested) block to
+// TreeStates; failure isn't fatal, since it can be fetched again later.
+func indexTreeState(cache Cache, height int) {
+	reply, err := GetTreeStateFromRPC(context.Background(), height, nil)
+	var treeState *walletrpc.TreeState
+	if err == nil {
+		treeState, err = TreeStateFromReply(reply, TreeStates.sprout)
+	}
+	if err == nil {
+		err = TreeStates.Put(cache, treeState)
+	}
+	if err != nil {
+		Log.Warning("couldn't index the tree state at height ", height, ": ", err)
+	}
+}
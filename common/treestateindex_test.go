@@ -0,0 +1,145 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/parser"
+)
+
+func TestTreeStateIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lwd-treestates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "treestates")
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 1000, 0)
+	defer func() {
+		c.Close()
+		os.RemoveAll(unitTestPath)
+	}()
+	for height := 1000; height < 1002; height++ {
+		if err := c.Add(height, testBlock(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	displayHash := func(height int) string {
+		return hex.EncodeToString(parser.Reverse(testBlock(height, 0).Hash))
+	}
+
+	// As the block ingestor does, for each indexed height.
+	TreeStates, err = OpenTreeStateIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { TreeStates = nil }()
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var height string
+		json.Unmarshal(params[0], &height)
+		if method != "z_gettreestate" || height != "1000" {
+			t.Fatal("unexpected rpc", method, height)
+		}
+		return json.RawMessage(`{"height":1000,"hash":"` + displayHash(1000) + `",` +
+			`"sprout":{"commitments":{"finalRoot":"abcd"}},"sapling":{"commitments":{"finalState":"01"}}}`), nil
+	}
+	indexTreeState(c, 1000)
+	if TreeStates.Lookup(c, 1001) != nil {
+		t.Fatal("unexpected tree state at height 1001")
+	}
+
+	// A partly-written (last) entry, as after a crash, is ignored.
+	TreeStates.Close()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"height":1001,"hash":"`))
+	f.Close()
+	TreeStates, err = OpenTreeStateIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer TreeStates.Close()
+	treeState := TreeStates.Lookup(c, 1000)
+	if treeState == nil || treeState.Hash != displayHash(1000) ||
+		treeState.SaplingTree != "01" || treeState.SproutTree != "abcd" {
+		t.Fatal("unexpected tree state", treeState)
+	}
+	// The caller's copy is its own.
+	treeState.Network = "main"
+	if TreeStates.Lookup(c, 1000).Network != "" {
+		t.Fatal("index entry was modified")
+	}
+	if TreeStates.Lookup(c, 1001) != nil {
+		t.Fatal("unexpected tree state at height 1001")
+	}
+
+	// Later entries aren't lost.
+	treeState.Height, treeState.Hash = 1001, displayHash(1001)
+	if err := TreeStates.Put(c, treeState); err != nil {
+		t.Fatal(err)
+	}
+	TreeStates.Close()
+	TreeStates, err = OpenTreeStateIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if TreeStates.Lookup(c, 1000) == nil || TreeStates.Lookup(c, 1001) == nil {
+		t.Fatal("tree states missing after reopening")
+	}
+	defer func() { TreeStates.Close() }()
+	lines := func() int {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+	before := lines()
+
+	// Neither the same tree state again, nor one of a block that isn't
+	// cached, is added.
+	if err := TreeStates.Put(c, treeState); err != nil {
+		t.Fatal(err)
+	}
+	uncached := *treeState
+	uncached.Height, uncached.Hash = 1002, displayHash(1002)
+	if err := TreeStates.Put(c, &uncached); err != nil {
+		t.Fatal(err)
+	}
+	if lines() != before || TreeStates.Lookup(c, 1002) != nil {
+		t.Fatal("unexpected tree state index entries", lines(), before)
+	}
+
+	// Replaced entries are compacted away.
+	for i := 0; i < treeStateIndexCompactMin+1; i++ {
+		treeState.SaplingTree = fmt.Sprintf("%04x", i)
+		if err := TreeStates.Put(c, treeState); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := lines(); n >= treeStateIndexCompactMin {
+		t.Fatal("tree state index not compacted", n)
+	}
+	TreeStates.Close()
+	TreeStates, err = OpenTreeStateIndex(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if TreeStates.Lookup(c, 1000) == nil ||
+		TreeStates.Lookup(c, 1001).SaplingTree != fmt.Sprintf("%04x", treeStateIndexCompactMin) {
+		t.Fatal("tree states lost by compaction")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// TxExpiryDelta is the number of blocks after which we recommend that a new
+// transaction expires (this is pirated's default, DEFAULT_TX_EXPIRY_DELTA).
+var TxExpiryDelta uint32 = 20
+
+// TxParamsCacheTTL is how long a getblockchaininfo result is reused by
+// GetTxConstructionParams(); wallets may call it before every transaction.
+var TxParamsCacheTTL = 10 * time.Second
+
+var txParamsCache struct {
+	mutex     sync.Mutex
+	params    *walletrpc.TxConstructionParams
+	fetchedAt time.Time
+}
+
+// GetTxConstructionParams returns the consensus branch ID of the next block,
+// the recommended expiry delta, and the current tip height.
+func GetTxConstructionParams() (*walletrpc.TxConstructionParams, error) {
+	txParamsCache.mutex.Lock()
+	defer txParamsCache.mutex.Unlock()
+	if txParamsCache.params != nil && Time.Now().Sub(txParamsCache.fetchedAt) < TxParamsCacheTTL {
+		return txParamsCache.params, nil
+	}
+	result, rpcErr := RawRequest("getblockchaininfo", []json.RawMessage{})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var getblockchaininfoReply PiratedRpcReplyGetblockchaininfo
+	err := json.Unmarshal(result, &getblockchaininfoReply)
+	if err != nil {
+		return nil, err
+	}
+	txParamsCache.params = &walletrpc.TxConstructionParams{
+		ConsensusBranchId: getblockchaininfoReply.Consensus.Nextblock,
+		ExpiryDelta:       TxExpiryDelta,
+		Height:            uint64(getblockchaininfoReply.Blocks),
+	}
+	txParamsCache.fetchedAt = Time.Now()
+	return txParamsCache.params, nil
+}
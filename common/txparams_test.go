@@ -0,0 +1,57 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var txParamsCalls int
+
+func txParamsStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "getblockchaininfo" {
+		testT.Fatal("unexpected method", method)
+	}
+	txParamsCalls++
+	return []byte(`{"chain":"main","blocks":1234567,
+		"consensus":{"chaintip":"76b809bb","nextblock":"e9ff75a6"}}`), nil
+}
+
+func TestGetTxConstructionParams(t *testing.T) {
+	testT = t
+	RawRequest = txParamsStub
+	Time.Now = nowStub
+
+	for i := 0; i < 2; i++ {
+		params, err := GetTxConstructionParams()
+		if err != nil {
+			t.Fatal("GetTxConstructionParams failed:", err)
+		}
+		// New transactions must use the branch ID of the next block.
+		if params.ConsensusBranchId != "e9ff75a6" {
+			t.Fatal("unexpected branch ID", params.ConsensusBranchId)
+		}
+		if params.ExpiryDelta != TxExpiryDelta || params.Height != 1234567 {
+			t.Fatal("unexpected params", params)
+		}
+	}
+	// the second call should have used the cached reply
+	if txParamsCalls != 1 {
+		t.Fatal("unexpected getblockchaininfo calls", txParamsCalls)
+	}
+	sleepDuration += TxParamsCacheTTL + time.Second
+	if _, err := GetTxConstructionParams(); err != nil {
+		t.Fatal("GetTxConstructionParams failed:", err)
+	}
+	if txParamsCalls != 2 {
+		t.Fatal("unexpected getblockchaininfo calls", txParamsCalls)
+	}
+
+	txParamsCache.params = nil
+	txParamsCalls = 0
+	sleepDuration = 0
+}
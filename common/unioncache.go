@@ -0,0 +1,240 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+)
+
+// OpenFrozenBlockCache opens the db files in the given directory (laid out
+// as NewBlockCache's) read-only, so they can be on a read-only filesystem;
+// the blocks must begin at startHeight. Every block is checked, and an
+// error is returned if any can't be read or isn't at the expected height,
+// rather than discarding it, since a frozen cache can't be repaired.
+// Nothing may be added to the returned cache.
+func OpenFrozenBlockCache(dbPath string, chainName string, startHeight int) (*BlockCache, error) {
+	dir := filepath.Join(dbPath, chainName)
+	version, err := readCacheVersion(dir)
+	if err != nil {
+		return nil, err
+	}
+	if version > CacheFormatVersion {
+		return nil, fmt.Errorf("cache %s is format version %d, newer than this lightwalletd's (%d)",
+			dir, version, CacheFormatVersion)
+	}
+	c := &BlockCache{frozen: true, hashes: newHashIndex()}
+	c.mem = newBlockLRU(MemoryCacheBlocks, MemoryCachePolicy)
+	c.firstBlock = startHeight
+	c.nextBlock = startHeight
+	c.lengthsName, c.blocksName = dbFileNames(dbPath, chainName)
+	if c.blocksFile, err = os.Open(c.blocksName); err != nil {
+		return nil, err
+	}
+	if c.lengthsFile, err = os.Open(c.lengthsName); err != nil {
+		c.blocksFile.Close()
+		return nil, err
+	}
+	lengths, err := ioutil.ReadAll(c.lengthsFile)
+	if err == nil && len(lengths)%4 != 0 {
+		err = fmt.Errorf("%s has a partial entry", c.lengthsName)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	var offset int64
+	c.starts = append(c.starts, 0)
+	for i := 0; i < len(lengths)/4; i++ {
+		length := binary.LittleEndian.Uint32(lengths[i*4 : (i+1)*4])
+		offset += int64(length&^compressedLengthFlag) + 8
+		c.starts = append(c.starts, offset)
+		c.compressed = append(c.compressed, length&compressedLengthFlag != 0)
+		block := c.readBlock(c.nextBlock)
+		if block == nil {
+			c.Close()
+			return nil, fmt.Errorf("cache %s has a bad block at height %d (is its first height %d?)",
+				dir, c.nextBlock, startHeight)
+		}
+		c.latestHash = block.Hash
+		c.hashes.add(block.Hash, c.nextBlock)
+		c.nextBlock++
+	}
+	Log.Info("Found ", c.nextBlock-c.firstBlock, " blocks in frozen cache ", dir)
+	return c, nil
+}
+
+// UnionCache serves the blocks of an ordered list of caches as one: frozen
+// (historical) caches, which are only read, followed by a live cache, which
+// the block ingestor extends. Each cache must begin where the one before
+// it ends, so that (for example) a cache in an old layout, or on slow
+// storage, can be used as it is while newer blocks are cached elsewhere,
+// instead of copying it.
+type UnionCache struct {
+	frozen []Cache // in height order; never modified
+	live   Cache
+}
+
+// NewUnionCache returns the union of the given caches, after checking that
+// each begins at the height following the previous one's last block, and
+// that its first block extends that block.
+func NewUnionCache(frozen []Cache, live Cache) (*UnionCache, error) {
+	all := append(append([]Cache(nil), frozen...), live)
+	for i := 1; i < len(all); i++ {
+		prev, c := all[i-1], all[i]
+		if c.GetFirstHeight() != prev.GetNextHeight() {
+			return nil, fmt.Errorf("cache %d begins at height %d, but cache %d ends at height %d",
+				i, c.GetFirstHeight(), i-1, prev.GetNextHeight()-1)
+		}
+		first := c.GetShared(c.GetFirstHeight())
+		if prevHash := prev.GetLatestHash(); first != nil && prevHash != nil &&
+			!bytes.Equal(first.PrevHash, prevHash) {
+			return nil, fmt.Errorf("the first block of cache %d (height %d) doesn't extend cache %d",
+				i, c.GetFirstHeight(), i-1)
+		}
+	}
+	return &UnionCache{frozen: frozen, live: live}, nil
+}
+
+// cacheFor returns the cache holding (or that would hold) the given height.
+func (u *UnionCache) cacheFor(height int) Cache {
+	for _, c := range u.frozen {
+		if height >= c.GetFirstHeight() && height < c.GetNextHeight() {
+			return c
+		}
+	}
+	return u.live
+}
+
+// Add adds the given block to the live cache.
+func (u *UnionCache) Add(height int, block *walletrpc.CompactBlock) error {
+	return u.live.Add(height, block)
+}
+
+// Get returns (a copy of) the block at the given height, or nil.
+func (u *UnionCache) Get(height int) *walletrpc.CompactBlock {
+	return u.cacheFor(height).Get(height)
+}
+
+// GetShared is like Get, but the caller must not modify the block.
+func (u *UnionCache) GetShared(height int) *walletrpc.CompactBlock {
+	return u.cacheFor(height).GetShared(height)
+}
+
+// Peek is like GetShared, but doesn't affect the caches' memory.
+func (u *UnionCache) Peek(height int) *walletrpc.CompactBlock {
+	return u.cacheFor(height).Peek(height)
+}
+
+// GetFirstHeight returns the height of the first frozen cache's first block.
+func (u *UnionCache) GetFirstHeight() int {
+	if len(u.frozen) > 0 {
+		return u.frozen[0].GetFirstHeight()
+	}
+	return u.live.GetFirstHeight()
+}
+
+// GetNextHeight returns the height of the lowest unobtained block.
+func (u *UnionCache) GetNextHeight() int {
+	return u.live.GetNextHeight()
+}
+
+// Len returns the number of blocks in all the caches.
+func (u *UnionCache) Len() int {
+	n := u.live.Len()
+	for _, c := range u.frozen {
+		n += c.Len()
+	}
+	return n
+}
+
+// GetLatestHeight returns the height of the most recent block, or -1
+// if all the caches are empty.
+func (u *UnionCache) GetLatestHeight() int {
+	height, _ := u.GetLatestHeightHash()
+	return height
+}
+
+// GetLatestHash returns the hash of the most recent block, or nil.
+func (u *UnionCache) GetLatestHash() []byte {
+	_, hash := u.GetLatestHeightHash()
+	return hash
+}
+
+// GetLatestHeightHash returns the height and hash of the most recent
+// block, which is the last frozen one until the live cache has a block.
+func (u *UnionCache) GetLatestHeightHash() (int, []byte) {
+	if height, hash := u.live.GetLatestHeightHash(); height >= 0 {
+		return height, hash
+	}
+	for i := len(u.frozen) - 1; i >= 0; i-- {
+		if height, hash := u.frozen[i].GetLatestHeightHash(); height >= 0 {
+			return height, hash
+		}
+	}
+	return -1, nil
+}
+
+// HashMatch indicates if the given prev-hash matches the most recent
+// block's hash (or all the caches are empty).
+func (u *UnionCache) HashMatch(prevhash []byte) bool {
+	if u.live.GetLatestHeight() >= 0 {
+		return u.live.HashMatch(prevhash)
+	}
+	hash := u.GetLatestHash()
+	return hash == nil || bytes.Equal(hash, prevhash)
+}
+
+// GetHeightByHash returns the height of the block with the given hash, in
+// any of the caches, or -1.
+func (u *UnionCache) GetHeightByHash(hash []byte) int {
+	if height := u.live.GetHeightByHash(hash); height >= 0 {
+		return height
+	}
+	for i := len(u.frozen) - 1; i >= 0; i-- {
+		if height := u.frozen[i].GetHeightByHash(hash); height >= 0 {
+			return height
+		}
+	}
+	return -1
+}
+
+// GetLiteWalletBlockGroup returns the block at which a group of blocks
+// starting at the given height ends; a group doesn't extend beyond the
+// cache (frozen or live) it starts in.
+func (u *UnionCache) GetLiteWalletBlockGroup(height int) *walletrpc.BlockID {
+	return u.cacheFor(height).GetLiteWalletBlockGroup(height)
+}
+
+// Reorg removes the blocks from the given height on, which must all be in
+// the live cache; the frozen caches' blocks can't be replaced, so a reorg
+// that deep is fatal.
+func (u *UnionCache) Reorg(height int) {
+	if height < u.live.GetFirstHeight() {
+		Log.Fatal("reorg at height ", height, " is below the live cache (height ",
+			u.live.GetFirstHeight(), "), the frozen caches are not on pirated's chain")
+	}
+	u.live.Reorg(height)
+}
+
+// Sync commits the blocks added to the live cache.
+func (u *UnionCache) Sync() {
+	u.live.Sync()
+}
+
+// Close closes all the caches.
+func (u *UnionCache) Close() {
+	for _, c := range u.frozen {
+		c.Close()
+	}
+	u.live.Close()
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// chainedTestBlock is testBlock(height, 0) with its previous block's hash.
+func chainedTestBlock(height int) *walletrpc.CompactBlock {
+	block := testBlock(height, 0)
+	block.PrevHash = testBlock(height-1, 0).Hash
+	return block
+}
+
+func TestUnionCache(t *testing.T) {
+	os.RemoveAll(unitTestPath)
+	defer os.RemoveAll(unitTestPath)
+	historyPath := filepath.Join(unitTestPath, "history")
+	livePath := filepath.Join(unitTestPath, "live")
+
+	// Blocks 380640-380644 in the historical cache, which is then frozen.
+	history := NewBlockCache(historyPath, unitTestChain, 380640, 0)
+	for height := 380640; height < 380645; height++ {
+		if err := history.Add(height, chainedTestBlock(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history.Close()
+
+	// The frozen cache's blocks must be at the heights expected.
+	if _, err := OpenFrozenBlockCache(historyPath, unitTestChain, 380641); err == nil {
+		t.Fatal("expected an error for the wrong first height")
+	}
+	frozen, err := OpenFrozenBlockCache(historyPath, unitTestChain, 380640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frozen.GetNextHeight() != 380645 {
+		t.Fatal("unexpected frozen cache next height", frozen.GetNextHeight())
+	}
+
+	// A live cache that doesn't continue the frozen one is rejected.
+	gap := NewMemoryBlockCache(380646)
+	if _, err := NewUnionCache([]Cache{frozen}, gap); err == nil {
+		t.Fatal("expected an error for a gap between the caches")
+	}
+	fork := NewMemoryBlockCache(380645)
+	fork.Add(380645, testBlock(380645, 0))
+	if _, err := NewUnionCache([]Cache{frozen}, fork); err == nil {
+		t.Fatal("expected an error for a live cache that doesn't extend the frozen one")
+	}
+
+	live := NewBlockCache(livePath, unitTestChain, 380645, 0)
+	union, err := NewUnionCache([]Cache{frozen}, live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer union.Close()
+	if union.GetFirstHeight() != 380640 || union.GetNextHeight() != 380645 || union.GetLatestHeight() != 380644 ||
+		!bytes.Equal(union.GetLatestHash(), testBlock(380644, 0).Hash) {
+		t.Fatal("unexpected union of the frozen cache and an empty live cache",
+			union.GetFirstHeight(), union.GetNextHeight(), union.GetLatestHeight())
+	}
+	if !union.HashMatch(testBlock(380644, 0).Hash) || union.HashMatch(testBlock(380643, 0).Hash) {
+		t.Fatal("the next block must extend the frozen cache")
+	}
+
+	// New blocks go to the live cache.
+	for height := 380645; height < 380650; height++ {
+		if err := union.Add(height, chainedTestBlock(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if live.GetFirstHeight() != 380645 || live.GetNextHeight() != 380650 || union.GetLatestHeight() != 380649 {
+		t.Fatal("unexpected live cache", live.GetFirstHeight(), live.GetNextHeight(), union.GetLatestHeight())
+	}
+	for height := 380640; height < 380650; height++ {
+		if !proto.Equal(union.Get(height), chainedTestBlock(height)) ||
+			!proto.Equal(union.GetShared(height), chainedTestBlock(height)) {
+			t.Fatal("unexpected block", height)
+		}
+	}
+	if union.Get(380639) != nil || union.Get(380650) != nil {
+		t.Fatal("unexpected block outside the union")
+	}
+	// Hashes are found in either cache.
+	if union.GetHeightByHash(testBlock(380642, 0).Hash) != 380642 ||
+		union.GetHeightByHash(testBlock(380647, 0).Hash) != 380647 {
+		t.Fatal("unexpected height by hash")
+	}
+	// A block group doesn't span caches.
+	if group := union.GetLiteWalletBlockGroup(380642); group == nil || group.Height != 380644 {
+		t.Fatal("unexpected block group", group)
+	}
+
+	// Reorgs within the live cache are as usual.
+	union.Reorg(380648)
+	if union.GetNextHeight() != 380648 || !union.HashMatch(testBlock(380647, 0).Hash) {
+		t.Fatal("unexpected union after reorg", union.GetNextHeight())
+	}
+	union.Reorg(380645)
+	if union.GetLatestHeight() != 380644 || frozen.GetNextHeight() != 380645 {
+		t.Fatal("unexpected union after reorg of the live cache", union.GetLatestHeight())
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package frontend
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits on a client's bloom filter (the same as BIP 37's).
+const (
+	maxBloomFilterSize    = 36000 // bytes
+	maxBloomHashFunctions = 50
+)
+
+// bloomFilter is a client's (validated) walletrpc.BloomFilter.
+type bloomFilter struct {
+	data          []byte
+	hashFunctions uint32
+	tweak         uint32
+}
+
+// newBloomFilter validates the client's filter; it returns nil if there's
+// no filter (all transactions are sent).
+func newBloomFilter(f *walletrpc.BloomFilter) (*bloomFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	if len(f.Data) == 0 || len(f.Data) > maxBloomFilterSize {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"bloom filter must be 1 to %d bytes", maxBloomFilterSize)
+	}
+	if f.HashFunctions == 0 || f.HashFunctions > maxBloomHashFunctions {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"bloom filter must use 1 to %d hash functions", maxBloomHashFunctions)
+	}
+	return &bloomFilter{data: f.Data, hashFunctions: f.HashFunctions, tweak: f.Tweak}, nil
+}
+
+// bloomBit returns the index of the filter bit selected by the given hash
+// function for the element.
+func (f *bloomFilter) bloomBit(i uint32, element []byte) uint32 {
+	return murmur3(i*0xFBA4C795+f.tweak, element) % uint32(len(f.data)*8)
+}
+
+// contains returns true if the element may be in the filter; false means it
+// certainly isn't.
+func (f *bloomFilter) contains(element []byte) bool {
+	for i := uint32(0); i < f.hashFunctions; i++ {
+		bit := f.bloomBit(i, element)
+		if f.data[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTx returns true if any of the transaction's nullifiers or note
+// commitments may be in the filter.
+func (f *bloomFilter) matchesTx(tx *walletrpc.CompactTx) bool {
+	for _, spend := range tx.Spends {
+		if f.contains(spend.Nf) {
+			return true
+		}
+	}
+	for _, output := range tx.Outputs {
+		if f.contains(output.Cmu) {
+			return true
+		}
+	}
+	for _, action := range tx.Actions {
+		if f.contains(action.Nullifier) || f.contains(action.Cmx) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBlock removes the transactions that don't match the filter from the
+// given compact block. The block is modified in place, as by omitCiphertext().
+func filterBlock(block *walletrpc.CompactBlock, f *bloomFilter) {
+	vtx := block.Vtx[:0]
+	for _, tx := range block.Vtx {
+		if f.matchesTx(tx) {
+			vtx = append(vtx, tx)
+		}
+	}
+	block.Vtx = vtx
+}
+
+// murmur3 is MurmurHash3 (x86, 32-bit), as used by BIP 37 bloom filters.
+func murmur3(seed uint32, data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	nblocks := len(data) / 4
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	tail := data[nblocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// treeStateReply is what the z_gettreestate stub returns.
+var treeStateReply string
+
+func gettreestateStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "z_gettreestate" {
+		testT.Fatal("unexpected method", method)
+	}
+	return []byte(treeStateReply), nil
+}
+
+func TestGetTreeState(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+
+	treeStateReply = `{"height":1000,"hash":"aabb","time":1234,` +
+		`"sapling":{"commitments":{"finalState":"01a2"}},` +
+		`"orchard":{"commitments":{"finalState":"00"}}}`
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.Height != 1000 || treeState.Hash != "aabb" || treeState.Time != 1234 {
+		t.Fatal("GetTreeState unexpected block fields", treeState)
+	}
+	if treeState.SaplingTree != "01a2" || treeState.OrchardTree != "00" {
+		t.Fatal("GetTreeState unexpected tree states", treeState)
+	}
+}
+
+func TestGetTreeStateInactivePool(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+
+	// Before orchard activation, pirated may include a (stale) orchard
+	// tree state and root.
+	treeStateReply = `{"height":1000,"hash":"aabb","time":1234,` +
+		`"sapling":{"active":true,"commitments":{"finalRoot":"5a5a","finalState":"01a2"}},` +
+		`"orchard":{"active":false,"commitments":{"finalRoot":"0a0a","finalState":"01b3"}}}`
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.SaplingTree != "01a2" || treeState.OrchardTree != "" {
+		t.Fatal("GetTreeState unexpected tree states", treeState)
+	}
+
+	treeStateReply = `{"height":1001,"hash":"aabc","time":1235,` +
+		`"sapling":{"active":true,"commitments":{"finalState":"01a2"}},` +
+		`"orchard":{"active":true,"commitments":{"finalState":"01b3"}}}`
+	treeState, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1001})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.SaplingTree != "01a2" || treeState.OrchardTree != "01b3" {
+		t.Fatal("GetTreeState unexpected tree states", treeState)
+	}
+}
+
+func TestGetTreeStateMalformed(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+
+	for _, test := range []struct {
+		reply    string
+		expected string
+	}{
+		{
+			// odd length
+			`{"height":1000,"sapling":{"commitments":{"finalState":"01a"}}}`,
+			"invalid sapling tree state",
+		},
+		{
+			// not hex
+			`{"height":1000,"sapling":{"commitments":{"finalState":"01zz"}}}`,
+			"invalid sapling tree state",
+		},
+		{
+			`{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+				`"orchard":{"commitments":{"finalState":"xyz"}}}`,
+			"invalid orchard tree state",
+		},
+	} {
+		treeStateReply = test.reply
+		_, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+		if err == nil {
+			t.Fatal("GetTreeState should have failed on", test.reply)
+		}
+		if !strings.Contains(err.Error(), test.expected) {
+			t.Fatal("GetTreeState unexpected error:", err)
+		}
+	}
+}
+
+func TestGetTreeStateSprout(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+
+	const finalState = `{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+		`"sprout":{"commitments":{"finalRoot":"abcd","finalState":"0102"}}}`
+	const finalRoot = `{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+		`"sprout":{"commitments":{"finalRoot":"abcd"}}}`
+
+	// disabled by default, so existing clients see no change
+	treeStateReply = finalState
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.SproutTree != "" {
+		t.Fatal("GetTreeState unexpected sprout tree", treeState.SproutTree)
+	}
+
+	lwd.(*lwdStreamer).sproutEnable = true
+	for _, test := range []struct {
+		reply    string
+		expected string
+	}{
+		{finalState, "0102"},
+		{finalRoot, "abcd"},
+	} {
+		treeStateReply = test.reply
+		treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if treeState.SproutTree != test.expected {
+			t.Fatal("GetTreeState unexpected sprout tree", treeState.SproutTree)
+		}
+	}
+}
+
+func TestGetTreeStateStrict(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+	lwd.(*lwdStreamer).sproutEnable = true
+	defer func() { common.StrictTreeState = false }()
+
+	// no sprout finalState, so (by default) the finalRoot
+	treeStateReply = `{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+		`"sprout":{"commitments":{"finalRoot":"abcd"}}}`
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.SproutTree != "abcd" {
+		t.Fatal("GetTreeState unexpected sprout tree", treeState.SproutTree)
+	}
+
+	common.StrictTreeState = true
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err == nil || !strings.Contains(err.Error(), "no sprout finalState for height 1000") {
+		t.Fatal("GetTreeState should have failed without the sprout finalState:", err)
+	}
+	treeStateReply = `{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+		`"sprout":{"commitments":{"finalRoot":"abcd","finalState":"0102"}}}`
+	treeState, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.SproutTree != "0102" {
+		t.Fatal("GetTreeState unexpected sprout tree", treeState.SproutTree)
+	}
+
+	// The sprout tree isn't needed if it's not served.
+	lwd.(*lwdStreamer).sproutEnable = false
+	treeStateReply = `{"height":1000,"sapling":{"commitments":{"finalState":"01"}},` +
+		`"sprout":{"commitments":{"finalRoot":"abcd"}}}`
+	treeState, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err != nil {
+		t.Fatal("GetTreeState failed without the sprout tree served:", err)
+	}
+	if treeState.SproutTree != "" || treeState.SaplingTree != "01" {
+		t.Fatal("GetTreeState unexpected tree state", treeState)
+	}
+}
+
+func TestGetTreeStateRootFallback(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+	defer func() { common.TreeStateRootFallback = false }()
+	getblockFails := false
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "z_gettreestate":
+			return nil, errors.New("-8: tree state unavailable")
+		case "getblock":
+			if getblockFails {
+				return nil, errors.New("-8: block unavailable")
+			}
+			if string(params[1]) != "1" {
+				t.Fatal("unexpected getblock verbosity", string(params[1]))
+			}
+			if id := string(params[0]); id != `"1000"` && id != `"aabb"` {
+				t.Fatal("unexpected getblock id", id)
+			}
+			return []byte(`{"height":1000,"hash":"aabb","time":1234,` +
+				`"finalsaplingroot":"5a5a","finalorchardroot":"0a0a","tx":[]}`), nil
+		}
+		t.Fatal("unexpected method", method)
+		return nil, nil
+	}
+
+	// By default, the tree state request fails as z_gettreestate did.
+	_, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err == nil || !strings.Contains(err.Error(), "tree state unavailable") {
+		t.Fatal("GetTreeState should have failed:", err)
+	}
+
+	common.TreeStateRootFallback = true
+	for _, id := range []*walletrpc.BlockID{{Height: 1000}, {Hash: []byte{0xbb, 0xaa}}} {
+		treeState, err := lwd.GetTreeState(context.Background(), id)
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if treeState.Height != 1000 || treeState.Hash != "aabb" || treeState.Time != 1234 || treeState.Network != "main" {
+			t.Fatal("GetTreeState unexpected block fields", treeState)
+		}
+		if treeState.SaplingRoot != "5a5a" || treeState.OrchardRoot != "0a0a" ||
+			treeState.SaplingTree != "" || treeState.OrchardTree != "" || treeState.SproutTree != "" {
+			t.Fatal("GetTreeState unexpected roots or tree states", treeState)
+		}
+	}
+
+	// If getblock fails too, z_gettreestate's error is reported.
+	getblockFails = true
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err == nil || !strings.Contains(err.Error(), "tree state unavailable") {
+		t.Fatal("GetTreeState should have failed:", err)
+	}
+}
+
+func TestGetTreeStateMismatch(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	lwd, _ := testsetup()
+
+	// requested by height, but a reorg moved the backend elsewhere
+	treeStateReply = `{"height":999,"hash":"aabb","sapling":{"commitments":{"finalState":"01"}}}`
+	_, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1000})
+	if err == nil {
+		t.Fatal("GetTreeState should have failed on height mismatch")
+	}
+	if !strings.Contains(err.Error(), "for height 999, requested height 1000") {
+		t.Fatal("GetTreeState unexpected error:", err)
+	}
+
+	// requested by hash (in internal order, the reverse of pirated's)
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Hash: []byte{0xdd, 0xcc}})
+	if err == nil {
+		t.Fatal("GetTreeState should have failed on hash mismatch")
+	}
+	if !strings.Contains(err.Error(), "for block aabb, requested block ccdd") {
+		t.Fatal("GetTreeState unexpected error:", err)
+	}
+
+	// a matching hash is accepted
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Hash: []byte{0xbb, 0xaa}})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if treeState.Height != 999 {
+		t.Fatal("GetTreeState unexpected height", treeState.Height)
+	}
+}
+
+// gettreestateHeightStub returns a tree state for whatever height is requested.
+func gettreestateHeightStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	var heightStr string
+	if err := json.Unmarshal(params[0], &heightStr); err != nil {
+		testT.Fatal("could not unmarshal height")
+	}
+	return []byte(`{"height":` + heightStr + `,"sapling":{"commitments":{"finalState":"01"}}}`), nil
+}
+
+type testgettreestaterange struct {
+	walletrpc.CompactTxStreamer_GetTreeStateRangeServer
+	heights []uint64
+}
+
+func (tg *testgettreestaterange) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgettreestaterange) Send(treeState *walletrpc.TreeState) error {
+	tg.heights = append(tg.heights, treeState.Height)
+	return nil
+}
+
+func TestGetTreeStateRange(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateHeightStub
+	lwd, _ := testsetup()
+
+	resp := &testgettreestaterange{}
+	err := lwd.GetTreeStateRange(&walletrpc.TreeStateRange{StartHeight: 1000, EndHeight: 1025, Step: 10}, resp)
+	if err != nil {
+		t.Fatal("GetTreeStateRange failed:", err)
+	}
+	expected := []uint64{1000, 1010, 1020}
+	if len(resp.heights) != len(expected) {
+		t.Fatal("GetTreeStateRange unexpected heights", resp.heights)
+	}
+	for i, height := range expected {
+		if resp.heights[i] != height {
+			t.Fatal("GetTreeStateRange unexpected heights", resp.heights)
+		}
+	}
+
+	for _, span := range []*walletrpc.TreeStateRange{
+		{StartHeight: 1000, EndHeight: 1025, Step: 0},
+		{StartHeight: 0, EndHeight: 1025, Step: 1},
+		{StartHeight: 1025, EndHeight: 1000, Step: 1},
+		{StartHeight: 1000, EndHeight: 1000 + maxTreeStateRangeCount, Step: 1},
+	} {
+		err := lwd.GetTreeStateRange(span, &testgettreestaterange{})
+		if err == nil {
+			t.Fatal("GetTreeStateRange should have failed on", span)
+		}
+	}
+}
+
+func TestGetTreeStateIndex(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	dir, err := ioutil.TempDir("", "lwd-treestates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	common.TreeStates, err = common.OpenTreeStateIndex(filepath.Join(dir, "treestates"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		common.TreeStates.Close()
+		common.TreeStates = nil
+	}()
+	if err := cache.Add(380640, &walletrpc.CompactBlock{Height: 380640, Hash: []byte{0xbb, 0xaa}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first request is answered by pirated, and indexed.
+	calls := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		calls++
+		return gettreestateStub(method, params)
+	}
+	treeStateReply = `{"height":380640,"hash":"aabb","time":1234,` +
+		`"sapling":{"commitments":{"finalState":"01a2"}},` +
+		`"orchard":{"commitments":{"finalState":"00"}}}`
+	first, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err != nil || calls != 1 {
+		t.Fatal("GetTreeState failed:", err, calls)
+	}
+
+	// Later requests (even after a restart) are served from the index,
+	// without calling pirated.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		t.Fatal("unexpected rpc", method)
+		return nil, nil
+	}
+	for i := 0; i < 2; i++ {
+		treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380640})
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if !proto.Equal(treeState, first) || treeState.Network != "main" {
+			t.Fatal("unexpected tree state from the index", treeState)
+		}
+		common.TreeStates.Close()
+		common.TreeStates, err = common.OpenTreeStateIndex(filepath.Join(dir, "treestates"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// After a reorg replaces the block, its tree state must come from
+	// pirated again.
+	cache.Reorg(380640)
+	if err := cache.Add(380640, &walletrpc.CompactBlock{Height: 380640, Hash: []byte{0xdd, 0xcc}}); err != nil {
+		t.Fatal(err)
+	}
+	common.RawRequest = gettreestateStub
+	treeStateReply = `{"height":380640,"hash":"ccdd","sapling":{"commitments":{"finalState":"03"}}}`
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err != nil || treeState.Hash != "ccdd" || treeState.SaplingTree != "03" {
+		t.Fatal("unexpected tree state after a reorg", treeState, err)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/common/logging"
+	"github.com/PirateNetwork/lightwalletd/parser"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+)
+
+// testHarness is an in-process lightwalletd for tests that exercise the
+// real request paths (including streaming) end-to-end: a gRPC server with
+// the interceptors lightwalletd installs (see logging.ServerInterceptors()),
+// backed by a fake pirated and a block cache in a temporary directory, and
+// a client connected to it. Close it when done; it replaces
+// common.RawRequest until then.
+type testHarness struct {
+	Client  walletrpc.CompactTxStreamerClient
+	Cache   *common.BlockCache
+	Backend *fakeBackend
+
+	dir        string
+	server     *grpc.Server
+	conn       *grpc.ClientConn
+	rawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)
+}
+
+// newTestHarness starts a harness whose cache begins at startHeight.
+func newTestHarness(t *testing.T, startHeight int) *testHarness {
+	t.Helper()
+	setupMetrics()
+	dir, err := ioutil.TempDir("", "lwd-harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &testHarness{
+		Backend:    newFakeBackend(),
+		dir:        dir,
+		rawRequest: common.RawRequest,
+	}
+	common.RawRequest = h.Backend.rawRequest
+	h.Cache = common.NewBlockCache(dir, unitTestChain, startHeight, 0)
+	lwd, err := NewLwdStreamer(h.Cache, dir, "main", false /* enablePing */, false /* enableSprout */)
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	h.server = grpc.NewServer(logging.ServerInterceptors()...)
+	walletrpc.RegisterCompactTxStreamerServer(h.server, lwd)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	go h.server.Serve(listener)
+	h.conn, err = grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	h.Client = walletrpc.NewCompactTxStreamerClient(h.conn)
+	return h
+}
+
+// Close stops the server, removes the cache, and restores common.RawRequest.
+func (h *testHarness) Close() {
+	if h.conn != nil {
+		h.conn.Close()
+	}
+	if h.server != nil {
+		h.server.Stop()
+	}
+	if h.Cache != nil {
+		h.Cache.Close()
+	}
+	os.RemoveAll(h.dir)
+	common.RawRequest = h.rawRequest
+}
+
+// fakeBlock is a block as the fake pirated serves it.
+type fakeBlock struct {
+	hex   string   // getblock verbosity 0
+	hash  string   // big-endian hex
+	txids []string // big-endian hex
+}
+
+// fakeBackend is a configurable fake pirated. It serves the blocks added to
+// it (getblock, getblockcount and getbestblockhash); other rpcs are
+// answered by the handlers set with Handle, and fail otherwise.
+type fakeBackend struct {
+	mutex    sync.Mutex
+	blocks   map[int]*fakeBlock
+	tip      int
+	handlers map[string]func(params []json.RawMessage) (json.RawMessage, error)
+	calls    map[string]int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		blocks:   make(map[int]*fakeBlock),
+		handlers: make(map[string]func(params []json.RawMessage) (json.RawMessage, error)),
+		calls:    make(map[string]int),
+	}
+}
+
+// AddBlock adds the given (raw) block; the highest one added is the tip.
+// Txids are computed as for pre-v5 transactions.
+func (b *fakeBackend) AddBlock(t *testing.T, data []byte) {
+	t.Helper()
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(data); err != nil {
+		t.Fatal(err)
+	}
+	fb := &fakeBlock{
+		hex:  hex.EncodeToString(data),
+		hash: hex.EncodeToString(block.GetDisplayHash()),
+	}
+	for _, tx := range block.Transactions() {
+		first := sha256.Sum256(tx.Bytes())
+		txid := sha256.Sum256(first[:])
+		fb.txids = append(fb.txids, hex.EncodeToString(parser.Reverse(txid[:])))
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.blocks[block.GetHeight()] = fb
+	if block.GetHeight() > b.tip {
+		b.tip = block.GetHeight()
+	}
+}
+
+// Handle sets the handler of the given rpc, which may replace a built-in one.
+func (b *fakeBackend) Handle(method string, handler func(params []json.RawMessage) (json.RawMessage, error)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[method] = handler
+}
+
+// Calls returns the number of times the given rpc has been made.
+func (b *fakeBackend) Calls(method string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.calls[method]
+}
+
+func (b *fakeBackend) rawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	b.mutex.Lock()
+	b.calls[method]++
+	handler := b.handlers[method]
+	b.mutex.Unlock()
+	if handler != nil {
+		return handler(params)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch method {
+	case "getblockcount":
+		return json.Marshal(b.tip)
+	case "getbestblockhash":
+		if fb := b.blocks[b.tip]; fb != nil {
+			return json.Marshal(fb.hash)
+		}
+		return nil, errors.New("-8: Block height out of range")
+	case "getblock":
+		var arg string
+		if err := json.Unmarshal(params[0], &arg); err != nil {
+			return nil, err
+		}
+		var fb *fakeBlock
+		if height, err := strconv.Atoi(arg); err == nil {
+			fb = b.blocks[height]
+		} else {
+			for _, block := range b.blocks {
+				if block.hash == arg {
+					fb = block
+				}
+			}
+		}
+		if fb == nil {
+			return nil, errors.New("-8: Block height out of range")
+		}
+		if len(params) > 1 && string(params[1]) == "1" {
+			return json.Marshal(&common.PirateRpcReplyGetblock1{Hash: fb.hash, Tx: fb.txids})
+		}
+		return json.Marshal(fb.hex)
+	}
+	return nil, errors.New("-32601: Method not found")
+}
+
+func TestHarnessGetBlockRange(t *testing.T) {
+	h := newTestHarness(t, 380640)
+	defer h.Close()
+	// The first two test blocks are cached; pirated has all four.
+	for i, blockJSON := range blocks {
+		var blockHex string
+		json.Unmarshal(blockJSON, &blockHex)
+		data, _ := hex.DecodeString(blockHex)
+		h.Backend.AddBlock(t, data)
+		if i < 2 {
+			block := parser.NewBlock()
+			block.ParseFromSlice(data)
+			if err := h.Cache.Add(block.GetHeight(), block.ToCompact()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stream, err := h.Client.GetBlockRange(context.Background(), &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380643},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var heights []uint64
+	for {
+		block, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("GetBlockRange failed", err)
+		}
+		heights = append(heights, block.Height)
+	}
+	if fmt.Sprint(heights) != "[380640 380641 380642 380643]" {
+		t.Fatal("unexpected blocks", heights)
+	}
+	// Only the uncached blocks were fetched (each is two getblock rpcs).
+	if calls := h.Backend.Calls("getblock"); calls != 4 {
+		t.Fatal("unexpected getblock rpcs", calls)
+	}
+
+	// Errors reach the client too.
+	stream, err = h.Client.GetBlockRange(context.Background(), &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380643},
+		End:   &walletrpc.BlockID{Height: 380644},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if err == io.EOF {
+		t.Fatal("GetBlockRange should fail beyond pirated's tip")
+	}
+}
+
+// lazyStream checks, as each block is sent, how many blocks have been
+// fetched from pirated so far.
+type lazyStream struct {
+	walletrpc.CompactTxStreamer_GetBlockRangeServer
+	t       *testing.T
+	backend *fakeBackend
+	sent    int
+}
+
+func (s *lazyStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *lazyStream) Send(block *walletrpc.CompactBlock) error {
+	s.sent++
+	// Each block is two getblock rpcs; none is fetched ahead of the client.
+	if calls := s.backend.Calls("getblock"); calls != 2*s.sent {
+		s.t.Fatal("block", block.Height, "sent after", calls, "getblock rpcs")
+	}
+	return nil
+}
+
+// Without a memory budget, GetBlockRange converts each block only when the
+// client is ready for it.
+func TestGetBlockRangeLazy(t *testing.T) {
+	h := newTestHarness(t, 380640)
+	defer h.Close()
+	for _, blockJSON := range blocks {
+		var blockHex string
+		json.Unmarshal(blockJSON, &blockHex)
+		data, _ := hex.DecodeString(blockHex)
+		h.Backend.AddBlock(t, data)
+	}
+	lwd, err := NewLwdStreamer(h.Cache, h.dir, "main", false /* enablePing */, false /* enableSprout */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &lazyStream{t: t, backend: h.Backend}
+	err = lwd.GetBlockRange(&walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380643},
+		End:   &walletrpc.BlockID{Height: 380640},
+	}, stream)
+	if err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	if stream.sent != 4 {
+		t.Fatal("unexpected number of blocks", stream.sent)
+	}
+}
@@ -6,9 +6,19 @@
 package frontend
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/pkg/errors"
 	ini "gopkg.in/ini.v1"
@@ -25,15 +35,265 @@ func NewZRPCFromConf(confPath interface{}) (*rpcclient.Client, error) {
 
 // NewZRPCFromFlags gets pirated rpc connection information from provided flags.
 func NewZRPCFromFlags(opts *common.Options) (*rpcclient.Client, error) {
+	return rpcclient.New(connFromFlags(opts), nil)
+}
+
+func connFromFlags(opts *common.Options) *rpcclient.ConnConfig {
 	// Connect to local Pirate RPC server using HTTP POST mode.
-	connCfg := &rpcclient.ConnConfig{
+	return &rpcclient.ConnConfig{
 		Host:         net.JoinHostPort(opts.RPCHost, opts.RPCPort),
 		User:         opts.RPCUser,
 		Pass:         opts.RPCPassword,
 		HTTPPostMode: true, // Pirate only supports HTTP POST mode
 		DisableTLS:   true, // Pirate does not provide TLS by default
+		Proxy:        common.PiratedProxy,
 	}
-	return rpcclient.New(connCfg, nil)
+}
+
+// BatchClient sends JSON-RPC batch requests to pirated, which the rpcclient
+// package doesn't support.
+type BatchClient struct {
+	connCfg *rpcclient.ConnConfig
+}
+
+// NewBatchClientFromFlags gets pirated rpc connection information from
+// provided flags.
+func NewBatchClientFromFlags(opts *common.Options) *BatchClient {
+	return &BatchClient{connCfg: connFromFlags(opts)}
+}
+
+// NewBatchClientFromConf reads the pirated configuration file.
+func NewBatchClientFromConf(confPath interface{}) (*BatchClient, error) {
+	connCfg, err := connFromConf(confPath)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchClient{connCfg: connCfg}, nil
+}
+
+// RawBatchRequest sends the calls to pirated in one request; it has the
+// same signature as common.RawBatchRequest.
+func (c *BatchClient) RawBatchRequest(calls []common.RPCCall) ([]common.RPCResult, error) {
+	return batchRequest(c.connCfg, calls)
+}
+
+type batchCall struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      int               `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type batchReply struct {
+	ID     *int              `json:"id"`
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+}
+
+// batchRequest sends the calls to pirated as one JSON-RPC batch (an array of
+// requests), and matches the replies, which may be in any order, to the
+// calls by id.
+func batchRequest(connCfg *rpcclient.ConnConfig, calls []common.RPCCall) ([]common.RPCResult, error) {
+	batch := make([]batchCall, len(calls))
+	for i, call := range calls {
+		params := call.Params
+		if params == nil {
+			params = []json.RawMessage{}
+		}
+		batch[i] = batchCall{JSONRPC: "1.0", ID: i, Method: call.Method, Params: params}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", "http://"+connCfg.Host, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(connCfg.User, connCfg.Pass)
+	resp, err := httpClient(connCfg.Proxy).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, errors.Errorf("batch request failed: %s", resp.Status)
+	}
+	var replies []batchReply
+	if err := json.Unmarshal(respBody, &replies); err != nil {
+		// A server that doesn't understand batches replies with a
+		// single invalid request (or parse) error; anything else, such
+		// as a proxy's error page, may be temporary.
+		var reply batchReply
+		if json.Unmarshal(respBody, &reply) == nil && reply.Error != nil &&
+			(reply.Error.Code == btcjson.ErrRPCInvalidRequest.Code || reply.Error.Code == btcjson.ErrRPCParse.Code) {
+			return nil, common.ErrBatchUnsupported
+		}
+		return nil, errors.Errorf("batch request failed: %s", resp.Status)
+	}
+	results := make([]common.RPCResult, len(calls))
+	seen := make([]bool, len(calls))
+	for _, reply := range replies {
+		if reply.ID == nil || *reply.ID < 0 || *reply.ID >= len(calls) || seen[*reply.ID] {
+			return nil, errors.New("batch reply has an unexpected id")
+		}
+		seen[*reply.ID] = true
+		if reply.Error != nil {
+			results[*reply.ID].Err = reply.Error
+		} else {
+			results[*reply.ID].Result = reply.Result
+		}
+	}
+	for _, ok := range seen {
+		if !ok {
+			return nil, errors.New("batch reply is missing a result")
+		}
+	}
+	return results, nil
+}
+
+// CheckProxyURL checks that proxy is a SOCKS5 proxy URL (with a host and
+// port, and optionally a user and password), such as socks5://127.0.0.1:9050
+// for Tor.
+func CheckProxyURL(proxy string) error {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return errors.Wrap(err, "invalid proxy URL")
+	}
+	if u.Scheme != "socks5" {
+		return errors.Errorf("proxy URL %q must begin with socks5://", proxy)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return errors.Errorf("proxy URL %q must include a host and port", proxy)
+	}
+	return nil
+}
+
+// rpcHTTPTimeout limits how long a batch request to pirated (including
+// reading the reply) can take, so that a hung pirated doesn't hold up the
+// block ingestor (or a backend slot) forever.
+const rpcHTTPTimeout = 5 * time.Minute
+
+var (
+	directClient      = &http.Client{Timeout: rpcHTTPTimeout}
+	proxyClientsMutex sync.Mutex
+	proxyClients      = make(map[string]*http.Client)
+)
+
+// httpClient returns the (shared, so connections are reused) http client
+// that connects through the given SOCKS5 proxy, if any. The proxy resolves
+// pirated's host name, so it isn't looked up locally.
+func httpClient(proxy string) *http.Client {
+	if proxy == "" {
+		return directClient
+	}
+	proxyClientsMutex.Lock()
+	defer proxyClientsMutex.Unlock()
+	client := proxyClients[proxy]
+	if client == nil {
+		// Checked by CheckProxyURL() at startup.
+		proxyURL, _ := url.Parse(proxy)
+		client = &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+			Timeout:   rpcHTTPTimeout,
+		}
+		proxyClients[proxy] = client
+	}
+	return client
+}
+
+// CookieClient is a pirated rpc client that authenticates using the
+// credentials pirated writes to its .cookie file. These change each time
+// pirated restarts, so the file is re-read whenever it changes.
+type CookieClient struct {
+	host       string
+	cookiePath string
+	mutex      sync.Mutex
+	modTime    time.Time
+	size       int64
+	client     *rpcclient.Client
+	connCfg    *rpcclient.ConnConfig
+}
+
+// NewZRPCFromCookie gets the pirated rpc host and port from the provided
+// flags (or, if not given, the pirated configuration file) and the
+// credentials from the cookie file.
+func NewZRPCFromCookie(opts *common.Options) (*CookieClient, error) {
+	host := net.JoinHostPort(opts.RPCHost, opts.RPCPort)
+	if opts.RPCHost == "" || opts.RPCPort == "" {
+		connCfg, err := connFromConf(opts.PirateConfPath)
+		if err != nil {
+			return nil, err
+		}
+		host = connCfg.Host
+	}
+	return &CookieClient{host: host, cookiePath: opts.RPCCookiePath}, nil
+}
+
+// RawRequest sends the request to pirated; it has the same signature as
+// common.RawRequest.
+func (c *CookieClient) RawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.RawRequest(method, params)
+}
+
+// RawBatchRequest sends the calls to pirated in one request; it has the
+// same signature as common.RawBatchRequest.
+func (c *CookieClient) RawBatchRequest(calls []common.RPCCall) ([]common.RPCResult, error) {
+	if _, err := c.getClient(); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	connCfg := c.connCfg
+	c.mutex.Unlock()
+	return batchRequest(connCfg, calls)
+}
+
+// Return the rpc client, (re)creating it if the cookie file has changed.
+func (c *CookieClient) getClient() (*rpcclient.Client, error) {
+	info, err := os.Stat(c.cookiePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cookie file")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.client, nil
+	}
+	cookie, err := ioutil.ReadFile(c.cookiePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cookie file")
+	}
+	// The cookie is "user:password" (the user is always "__cookie__").
+	userPass := strings.SplitN(strings.TrimSpace(string(cookie)), ":", 2)
+	if len(userPass) != 2 {
+		return nil, errors.New("malformed cookie file")
+	}
+	connCfg := &rpcclient.ConnConfig{
+		Host:         c.host,
+		User:         userPass[0],
+		Pass:         userPass[1],
+		HTTPPostMode: true, // Pirate only supports HTTP POST mode
+		DisableTLS:   true, // Pirate does not provide TLS by default
+		Proxy:        common.PiratedProxy,
+	}
+	client, err := rpcclient.New(connCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.client != nil {
+		c.client.Shutdown()
+	}
+	c.client, c.connCfg, c.modTime, c.size = client, connCfg, info.ModTime(), info.Size()
+	return client, nil
 }
 
 // If passed a string, interpret as a path, open and read; if passed
@@ -67,6 +327,7 @@ func connFromConf(confPath interface{}) (*rpcclient.ConnConfig, error) {
 		Pass:         password,
 		HTTPPostMode: true, // Pirate only supports HTTP POST mode
 		DisableTLS:   true, // Pirate does not provide TLS by default
+		Proxy:        common.PiratedProxy,
 	}
 	// Notice the notification parameter is nil since notifications are
 	// not supported in HTTP POST mode.
@@ -7,10 +7,12 @@
 package frontend
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"net"
@@ -25,9 +27,13 @@ import (
 	"github.com/PirateNetwork/lightwalletd/common"
 	"github.com/PirateNetwork/lightwalletd/parser"
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 type latencyCacheEntry struct {
@@ -37,18 +43,20 @@ type latencyCacheEntry struct {
 }
 
 type lwdStreamer struct {
-	cache      *common.BlockCache
+	cache      common.Cache
 	dbPath     string
 	chainName  string
 	pingEnable bool
+	// include the sprout tree state in GetTreeState replies
+	sproutEnable bool
 	walletrpc.UnimplementedCompactTxStreamerServer
 	latencyCache map[string]*latencyCacheEntry
 	latencyMutex sync.RWMutex
 }
 
 // NewLwdStreamer constructs a gRPC context.
-func NewLwdStreamer(cache *common.BlockCache, dbPath string, chainName string, enablePing bool) (walletrpc.CompactTxStreamerServer, error) {
-	return &lwdStreamer{cache: cache, dbPath: dbPath, chainName: chainName, pingEnable: enablePing, latencyCache: make(map[string]*latencyCacheEntry), latencyMutex: sync.RWMutex{}}, nil
+func NewLwdStreamer(cache common.Cache, dbPath string, chainName string, enablePing bool, enableSprout bool) (walletrpc.CompactTxStreamerServer, error) {
+	return &lwdStreamer{cache: cache, dbPath: dbPath, chainName: chainName, pingEnable: enablePing, sproutEnable: enableSprout, latencyCache: make(map[string]*latencyCacheEntry), latencyMutex: sync.RWMutex{}}, nil
 }
 
 // DarksideStreamer holds the gRPC state for darksidewalletd.
@@ -153,8 +161,7 @@ func (s *lwdStreamer) GetLiteWalletBlockGroup(ctx context.Context, id *walletrpc
 
 // GetLatestBlock returns the height of the best chain, according to zcashd.
 func (s *lwdStreamer) GetLatestBlock(ctx context.Context, placeholder *walletrpc.ChainSpec) (*walletrpc.BlockID, error) {
-	latestBlock := s.cache.GetLatestHeight()
-	latestHash := s.cache.GetLatestHash()
+	latestBlock, latestHash := s.cache.GetLatestHeightHash()
 
 	if latestBlock == -1 {
 		return nil, errors.New("Cache is empty. Server is probably not yet ready")
@@ -163,6 +170,18 @@ func (s *lwdStreamer) GetLatestBlock(ctx context.Context, placeholder *walletrpc
 	return &walletrpc.BlockID{Height: uint64(latestBlock), Hash: latestHash}, nil
 }
 
+// GetBestBlockHash returns the hash of the latest block in the cache, for
+// clients that need nothing else.
+func (s *lwdStreamer) GetBestBlockHash(ctx context.Context, placeholder *walletrpc.ChainSpec) (*walletrpc.BlockHash, error) {
+	latestBlock, latestHash := s.cache.GetLatestHeightHash()
+
+	if latestBlock == -1 {
+		return nil, errors.New("Cache is empty. Server is probably not yet ready")
+	}
+
+	return &walletrpc.BlockHash{Hash: latestHash}, nil
+}
+
 // GetTaddressTxids is a streaming RPC that returns transaction IDs that have
 // the given transparent address (taddr) as either an input or output.
 func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.TransparentAddressBlockFilter, resp walletrpc.CompactTxStreamer_GetTaddressTxidsServer) error {
@@ -176,6 +195,9 @@ func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.Transparent
 	if addressBlockFilter.Range.End == nil {
 		return errors.New("Must specify an end block height")
 	}
+	if err := s.checkTaddresses([]string{addressBlockFilter.Address}); err != nil {
+		return err
+	}
 	params := make([]json.RawMessage, 1)
 	request := &common.PiratedRpcRequestGetaddresstxids{
 		Addresses: []string{addressBlockFilter.Address},
@@ -187,7 +209,7 @@ func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.Transparent
 		return err
 	}
 	params[0] = param
-	result, rpcErr := common.RawRequest("getaddresstxids", params)
+	result, rpcErr := common.RawRequestContext(resp.Context(), "getaddresstxids", params)
 
 	// For some reason, the error responses are not JSON
 	if rpcErr != nil {
@@ -238,42 +260,182 @@ func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.Transparent
 	return nil
 }
 
-// GetBlock returns the compact block at the requested height. Requesting a
-// block by hash is not yet supported.
+// GetBlock returns the compact block at the requested height, or with the
+// requested hash (see BlockID). A block that was recently reorged away (see
+// common.ReorgGracePeriod) can still be requested by hash, and is marked
+// as orphaned.
 func (s *lwdStreamer) GetBlock(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.CompactBlock, error) {
 	if id.Height == 0 && id.Hash == nil {
 		return nil, errors.New("request for unspecified identifier")
 	}
 
+	var cBlock *walletrpc.CompactBlock
+	var err error
 	// Precedence: a hash is more specific than a height. If we have it, use it first.
 	if id.Hash != nil {
-		// TODO: Get block by hash
-		return nil, errors.New("GetBlock by Hash is not yet implemented")
+		if cBlock, err = s.getBlockByHash(id.Hash); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.checkSaplingHeight(id.Height); err != nil {
+			return nil, err
+		}
+		common.BlockRequestStarted()
+		// The block is only read (and marshalled) here, so it can be shared.
+		cBlock, err = common.GetSharedBlock(ctx, s.cache, int(id.Height))
+		common.BlockRequestFinished()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	if common.MaxBlockElements > 0 && blockElements(cBlock) > common.MaxBlockElements {
+		// GetBlockRange can split the block, but we can return only one message.
+		return nil, fmt.Errorf("Block %d has too many shielded elements (%d) for one message, use GetBlockRange",
+			cBlock.Height, blockElements(cBlock))
+	}
+
+	common.Metrics.TotalBlocksServedConter.Inc()
+	return cBlock, err
+}
+
+// getBlockByHash returns the cached block with the given hash, or, if it
+// was reorged away within the grace period, the orphaned block.
+func (s *lwdStreamer) getBlockByHash(hash []byte) (*walletrpc.CompactBlock, error) {
+	if len(hash) != 32 {
+		return nil, status.Errorf(codes.InvalidArgument, "block hash must be 32 bytes, not %d", len(hash))
+	}
+	if height := s.cache.GetHeightByHash(hash); height >= 0 {
+		if block := s.cache.GetShared(height); block != nil && bytes.Equal(block.Hash, hash) {
+			return block, nil
+		}
+	}
+	if block := common.GetOrphanedBlock(hash); block != nil {
+		return block, nil
 	}
-	cBlock, err := common.GetBlock(s.cache, int(id.Height))
+	return nil, s.blockNotFound(hash)
+}
 
+// blockNotFound returns the error for a block hash that's not in the
+// cache's hash index, saying why, according to pirated: the hash is
+// unknown (mistyped, or for another network), or the block isn't on the
+// best chain, or is above the cache (not cached yet), or is too old to be
+// indexed (pruned from the index, see common.HashIndexBlocks).
+func (s *lwdStreamer) blockNotFound(hash []byte) error {
+	display := hex.EncodeToString(parser.Reverse(hash))
+	height, best, err := common.BlockHeightFromRPC(hash)
 	if err != nil {
+		return err
+	}
+	switch {
+	case height < 0:
+		return status.Errorf(codes.NotFound,
+			"block %s is unknown (check the hash, and that it's for this network)", display)
+	case !best:
+		return status.Errorf(codes.NotFound,
+			"block %s at height %d is not on the best chain (it was reorged away)", display, height)
+	case height >= s.cache.GetNextHeight():
+		return status.Errorf(codes.NotFound,
+			"block %s is at a future height %d, not cached yet (the latest is %d), try again later",
+			display, height, s.cache.GetLatestHeight())
+	default:
+		return status.Errorf(codes.NotFound,
+			"block %s at height %d is no longer indexed by hash (pruned), request it by height",
+			display, height)
+	}
+}
+
+// GetBlockExtended returns the compact block corresponding to the given
+// block identifier, with the transparent inputs and outputs of its
+// transactions, for explorers. It's expensive, so must be enabled.
+func (s *lwdStreamer) GetBlockExtended(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.ExtendedBlock, error) {
+	if !common.BlockExtended {
+		return nil, errors.New("GetBlockExtended not enabled, start lightwalletd with --block-extended")
+	}
+	if id.Height == 0 && id.Hash != nil {
+		return nil, errors.New("GetBlockExtended by Hash is not yet implemented")
+	}
+	if id.Height == 0 {
+		return nil, errors.New("request for unspecified identifier")
+	}
+	if err := s.checkSaplingHeight(id.Height); err != nil {
 		return nil, err
 	}
+	return common.GetBlockExtended(ctx, s.chainName, int(id.Height))
+}
 
-	common.Metrics.TotalBlocksServedConter.Inc()
-	return cBlock, err
+// checkSaplingHeight returns a NotFound error if only blocks from sapling
+// activation on are served, and the given height is below it. For a chain
+// without a known activation height, the cache's first height is used.
+func (s *lwdStreamer) checkSaplingHeight(height uint64) error {
+	if !common.SaplingOnly {
+		return nil
+	}
+	activation, ok := common.KnownSaplingActivationHeight(s.chainName)
+	if !ok {
+		activation = s.cache.GetFirstHeight()
+	}
+	if int(height) < activation {
+		return status.Errorf(codes.NotFound, "height %d is below sapling activation height %d",
+			height, activation)
+	}
+	return nil
 }
 
 // GetBlockRange is a streaming RPC that returns blocks, in compact form,
 // (as also returned by GetBlock) from the block height 'start' to height
-// 'end' inclusively.
+// 'end' inclusively. The blocks are always sent in order (descending if
+// 'start' is greater than 'end') with no gaps; wallets depend on this.
 func (s *lwdStreamer) GetBlockRange(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
-	blockChan := make(chan *walletrpc.CompactBlock)
-	errChan := make(chan error)
+	common.BlockRequestStarted()
+	defer common.BlockRequestFinished()
+
 	if span.Start == nil || span.End == nil {
 		return errors.New("Must specify start and end heights")
 	}
+	if len(span.Start.Hash) > 0 {
+		// Resume after the block with this hash (the last one the client
+		// processed), wherever it is.
+		height := s.cache.GetHeightByHash(span.Start.Hash)
+		if height < 0 {
+			return status.Errorf(codes.NotFound,
+				"start block %s is not in the best chain (it may have been reorged away), resume from an earlier block",
+				hex.EncodeToString(parser.Reverse(span.Start.Hash)))
+		}
+		if uint64(height) >= span.End.Height {
+			// The client already has the whole range.
+			return nil
+		}
+		span = proto.Clone(span).(*walletrpc.BlockRange)
+		span.Start = &walletrpc.BlockID{Height: uint64(height + 1)}
+	}
+	if span.Start.Height == span.End.Height+1 {
+		// The empty range (see BlockRange); the client already has every
+		// block up to the end, which may be the tip.
+		return nil
+	}
+	for _, height := range []uint64{span.Start.Height, span.End.Height} {
+		if err := s.checkSaplingHeight(height); err != nil {
+			return err
+		}
+		if common.DeepHistoryHeight > 0 && height < uint64(common.DeepHistoryHeight) {
+			return status.Errorf(codes.FailedPrecondition,
+				"blocks below height %d are not served; start syncing at or above it, from its tree state (GetTreeState)",
+				common.DeepHistoryHeight)
+		}
+	}
+	filter, err := newBloomFilter(span.Filter)
+	if err != nil {
+		return err
+	}
+	exclude := excludePrefixes(span.Exclude)
 
 	peerip := s.peerIPFromContext(resp.Context())
+	requestID := common.RequestID(resp.Context())
 
 	// Latency logging
 	go func() {
+		defer common.StreamGoroutineStarted()()
 		// If there is no ip, ignore
 		if peerip == "unknown" {
 			return
@@ -319,97 +481,284 @@ func (s *lwdStreamer) GetBlockRange(span *walletrpc.BlockRange, resp walletrpc.C
 
 	// Logging and metrics
 	go func() {
+		defer common.StreamGoroutineStarted()()
 		// Log a daily active user if the user requests the day's "key block"
 		for height := span.Start.Height; height <= span.End.Height; height++ {
 			s.dailyActiveBlock(height, peerip)
 		}
 
 		common.Log.WithFields(logrus.Fields{
-			"method":    "GetBlockRange",
-			"start":     span.Start.Height,
-			"end":       span.End.Height,
-			"peer_addr": peerip,
+			"method":     "GetBlockRange",
+			"start":      span.Start.Height,
+			"end":        span.End.Height,
+			"peer_addr":  peerip,
+			"request_id": requestID,
 		}).Info("Service")
 		common.Metrics.TotalBlocksServedConter.Add(math.Abs(float64(span.Start.Height) - float64(span.End.Height)))
 	}()
 
-	go common.GetBlockRange(s.cache, blockChan, errChan, int(span.Start.Height), int(span.End.Height))
-
+	// Each block is fetched and converted only when it's about to be sent,
+	// so a slow client holds no more than one block in memory ...
+	blocks := common.NewBlockRangeReader(resp.Context(), s.cache, int(span.Start.Height), int(span.End.Height))
+
+	// ... unless it's allowed to read ahead of the client, within the
+	// stream's memory budget; the blocks (and the end of the stream) then
+	// come from the prefetcher.
+	var budget *memoryBudget
+	var prefetch <-chan prefetched
+	if common.StreamMemoryBudget > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		budget = newMemoryBudget(common.StreamMemoryBudget)
+		prefetch = prefetchBlocks(blocks, budget, done)
+	}
+
+	// If requested, number the messages so the client can detect any that
+	// are lost (by an unreliable proxy, for example).
+	var sequence uint64
 	for {
-		select {
-		case err := <-errChan:
+		var cBlock *walletrpc.CompactBlock
+		var err error
+		size := 0
+		if prefetch == nil {
+			cBlock, err = blocks.Next()
+		} else {
+			p := <-prefetch
+			cBlock, err, size = p.block, p.err, p.size
+		}
+		if cBlock == nil {
 			return err
-		case cBlock := <-blockChan:
-			err := resp.Send(cBlock)
-			if err != nil {
+		}
+		if filter != nil {
+			filterBlock(cBlock, filter)
+		}
+		if len(exclude) > 0 {
+			excludeFromBlock(cBlock, exclude)
+		}
+		if span.OmitCiphertext {
+			omitCiphertext(cBlock)
+		}
+		for _, part := range splitBlock(cBlock, common.MaxBlockElements) {
+			if span.SequenceNumbers {
+				sequence++
+				part.Sequence = sequence
+			}
+			if err := resp.Send(part); err != nil {
 				return err
 			}
+			countShieldedServed(part)
+		}
+		if budget != nil {
+			budget.release(size)
 		}
 	}
 }
 
+// omitCiphertext removes the output and action ciphertexts from the given
+// compact block, keeping the nullifiers and note commitments. The block is
+// modified in place; common.GetBlock() (which BlockRangeReader uses) returns
+// a new copy for each request (unlike common.GetSharedBlock()), so this is
+// safe.
+func omitCiphertext(block *walletrpc.CompactBlock) {
+	for _, tx := range block.Vtx {
+		for _, output := range tx.Outputs {
+			output.Ciphertext = nil
+		}
+		for _, action := range tx.Actions {
+			action.Ciphertext = nil
+		}
+	}
+}
+
+// countShieldedServed adds the block's shielded elements to the metrics of
+// those served.
+func countShieldedServed(block *walletrpc.CompactBlock) {
+	var spends, outputs, actions int
+	for _, tx := range block.Vtx {
+		spends += len(tx.Spends)
+		outputs += len(tx.Outputs)
+		actions += len(tx.Actions)
+	}
+	served := common.Metrics.ShieldedServedCounter
+	served.WithLabelValues("sapling", "spend").Add(float64(spends))
+	served.WithLabelValues("sapling", "output").Add(float64(outputs))
+	served.WithLabelValues("orchard", "spend").Add(float64(actions))
+	served.WithLabelValues("orchard", "output").Add(float64(actions))
+}
+
+// blockElements returns the number of spends, outputs, and actions in the block.
+func blockElements(block *walletrpc.CompactBlock) int {
+	n := 0
+	for _, tx := range block.Vtx {
+		n += len(tx.Spends) + len(tx.Outputs) + len(tx.Actions)
+	}
+	return n
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// splitBlock divides a block that has more than max spends, outputs, and
+// actions into several messages of at most max elements, each with the
+// block's header fields (and chain metadata); all but the last have
+// Continued set. A transaction may itself be divided, in which case its
+// parts (each with its index, hash, and coinbase marker) are at the end of
+// one message and the start of the next. A block that isn't too large (or
+// if max is zero) is returned as is.
+func splitBlock(block *walletrpc.CompactBlock, max int) []*walletrpc.CompactBlock {
+	if max <= 0 || blockElements(block) <= max {
+		return []*walletrpc.CompactBlock{block}
+	}
+	newPart := func() *walletrpc.CompactBlock {
+		return &walletrpc.CompactBlock{
+			ProtoVersion:  block.ProtoVersion,
+			Height:        block.Height,
+			Hash:          block.Hash,
+			PrevHash:      block.PrevHash,
+			Time:          block.Time,
+			Header:        block.Header,
+			ChainMetadata: block.ChainMetadata,
+		}
+	}
+	var parts []*walletrpc.CompactBlock
+	part := newPart()
+	count := 0
+	for _, tx := range block.Vtx {
+		spends, outputs, actions := tx.Spends, tx.Outputs, tx.Actions
+		for {
+			if count == max && len(spends)+len(outputs)+len(actions) > 0 {
+				part.Continued = true
+				parts = append(parts, part)
+				part = newPart()
+				count = 0
+			}
+			ptx := &walletrpc.CompactTx{Index: tx.Index, Hash: tx.Hash, Fee: tx.Fee, Coinbase: tx.Coinbase}
+			n := minInt(max-count, len(spends))
+			ptx.Spends, spends = spends[:n], spends[n:]
+			count += n
+			n = minInt(max-count, len(outputs))
+			ptx.Outputs, outputs = outputs[:n], outputs[n:]
+			count += n
+			n = minInt(max-count, len(actions))
+			ptx.Actions, actions = actions[:n], actions[n:]
+			count += n
+			part.Vtx = append(part.Vtx, ptx)
+			if len(spends)+len(outputs)+len(actions) == 0 {
+				break
+			}
+		}
+	}
+	return append(parts, part)
+}
+
 // GetTreeState returns the note commitment tree state corresponding to the given block.
 // See section 3.7 of the Zcash protocol specification. It returns several other useful
 // values also (even though they can be obtained using GetBlock).
-// The block can be specified by either height or hash.
+// The block can be specified by either height or hash (see BlockID).
 func (s *lwdStreamer) GetTreeState(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.TreeState, error) {
 	if id.Height == 0 && id.Hash == nil {
 		return nil, errors.New("request for unspecified identifier")
 	}
-	// The Zcash z_gettreestate rpc accepts either a block height or block hash
-	params := make([]json.RawMessage, 1)
-	var hashJSON []byte
 	if id.Height > 0 {
-		heightJSON, err := json.Marshal(strconv.Itoa(int(id.Height)))
-		if err != nil {
+		if treeState := common.TreeStates.Lookup(s.cache, int(id.Height)); treeState != nil {
+			return s.treeStateReply(treeState)
+		}
+	}
+	gettreestateReply, err := common.GetTreeStateFromRPC(ctx, int(id.Height), id.Hash)
+	if err != nil {
+		if !common.TreeStateRootFallback {
 			return nil, err
 		}
-		params[0] = heightJSON
-	} else {
-		// id.Hash is big-endian, keep in big-endian for the rpc
-		hashJSON, err := json.Marshal(hex.EncodeToString(id.Hash))
-		if err != nil {
+		// Only the roots, so it's not indexed (or sent with a sprout tree).
+		treeState, rootErr := common.TreeStateRootsFromRPC(ctx, int(id.Height), id.Hash)
+		if rootErr != nil {
 			return nil, err
 		}
-		params[0] = hashJSON
+		common.Log.Warning("z_gettreestate failed (", err, "), replying with the tree roots at height ", treeState.Height)
+		treeState.Network = s.chainName
+		return treeState, nil
 	}
-	var gettreestateReply common.PiratedRpcReplyGettreestate
-	for {
-		result, rpcErr := common.RawRequest("z_gettreestate", params)
-		if rpcErr != nil {
-			return nil, rpcErr
-		}
-		err := json.Unmarshal(result, &gettreestateReply)
+	treeState, err := common.TreeStateFromReply(gettreestateReply, s.sproutEnable)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTreeStateHex("sapling", treeState.SaplingTree); err != nil {
+		return nil, err
+	}
+	if err := checkTreeStateHex("orchard", treeState.OrchardTree); err != nil {
+		return nil, err
+	}
+	// Fetch each tree state from pirated only once.
+	if err := common.TreeStates.Put(s.cache, treeState); err != nil {
+		common.Log.Warning("couldn't index the tree state at height ", treeState.Height, ": ", err)
+	}
+	return s.treeStateReply(treeState)
+}
+
+// treeStateReply completes a tree state (from pirated or the index) for
+// this server's network and options.
+func (s *lwdStreamer) treeStateReply(treeState *walletrpc.TreeState) (*walletrpc.TreeState, error) {
+	treeState.Network = s.chainName
+	if !s.sproutEnable {
+		treeState.SproutTree = ""
+	} else if err := checkTreeStateHex("sprout", treeState.SproutTree); err != nil {
+		return nil, err
+	}
+	return treeState, nil
+}
+
+// maxTreeStateRangeCount limits the number of tree states a single
+// GetTreeStateRange call can return, since each costs a pirated rpc.
+const maxTreeStateRangeCount = 1000
+
+// GetTreeStateRange streams the tree states at every step-th height from
+// the start height to the end height (inclusive), as returned by GetTreeState.
+func (s *lwdStreamer) GetTreeStateRange(span *walletrpc.TreeStateRange, resp walletrpc.CompactTxStreamer_GetTreeStateRangeServer) error {
+	if span.StartHeight == 0 {
+		return errors.New("Must specify a start block height")
+	}
+	if span.EndHeight < span.StartHeight {
+		return errors.New("End height must not be less than start height")
+	}
+	if span.Step == 0 {
+		return errors.New("Step must be greater than zero")
+	}
+	count := (span.EndHeight-span.StartHeight)/uint64(span.Step) + 1
+	if count > maxTreeStateRangeCount {
+		return fmt.Errorf("Range contains %d tree states, maximum is %d", count, maxTreeStateRangeCount)
+	}
+	for i := uint64(0); i < count; i++ {
+		height := span.StartHeight + i*uint64(span.Step)
+		treeState, err := s.GetTreeState(resp.Context(), &walletrpc.BlockID{Height: height})
 		if err != nil {
-			return nil, err
-		}
-		if gettreestateReply.Sapling.Commitments.FinalState != "" {
-			break
-		}
-		if gettreestateReply.Sapling.SkipHash == "" {
-			break
+			return err
 		}
-		hashJSON, err = json.Marshal(gettreestateReply.Sapling.SkipHash)
-		if err != nil {
-			return nil, err
+		if err := resp.Send(treeState); err != nil {
+			return err
 		}
-		params[0] = hashJSON
 	}
-	if gettreestateReply.Sapling.Commitments.FinalState == "" {
-		return nil, errors.New("pirated did not return treestate")
+	return nil
+}
+
+// checkTreeStateHex verifies that a commitment tree state from pirated is
+// valid, even-length hex (an empty tree state is allowed), so that a backend
+// bug is reported here rather than when the wallet tries to decode it.
+func checkTreeStateHex(pool string, tree string) error {
+	if _, err := hex.DecodeString(tree); err != nil {
+		return fmt.Errorf("pirated returned an invalid %s tree state: %v", pool, err)
 	}
-	return &walletrpc.TreeState{
-		Network:     s.chainName,
-		Height:      uint64(gettreestateReply.Height),
-		Hash:        gettreestateReply.Hash,
-		Time:        gettreestateReply.Time,
-		SaplingTree: gettreestateReply.Sapling.Commitments.FinalState,
-		OrchardTree: gettreestateReply.Orchard.Commitments.FinalState,
-	}, nil
+	return nil
 }
 
 // GetTransaction returns the raw transaction bytes that are returned
-// by the pirated 'getrawtransaction' RPC.
+// by the pirated 'getrawtransaction' RPC. The height is the height of the
+// block containing the transaction, or zero if it's (only) in the mempool;
+// a transaction that's in neither (or, with --no-mempool-lookup, isn't
+// confirmed) is NotFound.
 func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilter) (*walletrpc.RawTransaction, error) {
 	if txf.Hash != nil {
 		if len(txf.Hash) != 32 {
@@ -423,13 +772,18 @@ func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilte
 			leHashStringJSON,
 			json.RawMessage("1"),
 		}
-		result, rpcErr := common.RawRequest("getrawtransaction", params)
+		result, rpcErr := common.RawRequestContext(ctx, "getrawtransaction", params)
 
 		// For some reason, the error responses are not JSON
 		if rpcErr != nil {
+			if strings.HasPrefix(rpcErr.Error(), "-5:") {
+				// RPC_INVALID_ADDRESS_OR_KEY, "No such mempool or blockchain transaction"
+				return nil, status.Errorf(codes.NotFound, "transaction %s not found",
+					hex.EncodeToString(parser.Reverse(txf.Hash)))
+			}
 			return nil, rpcErr
 		}
-		// Many other fields are returned, but we need only these two.
+		// Many other fields are returned, but we need only these.
 		var txinfo common.PiratedRpcReplyGetrawtransaction
 		err = json.Unmarshal(result, &txinfo)
 		if err != nil {
@@ -439,9 +793,15 @@ func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilte
 		if err != nil {
 			return nil, err
 		}
+		// Zero tells the client that the transaction is unconfirmed.
+		height := txinfo.ConfirmedHeight()
+		if height == 0 && common.NoMempoolLookup {
+			return nil, status.Errorf(codes.NotFound, "transaction %s not found (unconfirmed)",
+				hex.EncodeToString(parser.Reverse(txf.Hash)))
+		}
 		return &walletrpc.RawTransaction{
 			Data:   txBytes,
-			Height: uint64(txinfo.Height),
+			Height: uint64(height),
 		}, nil
 	}
 
@@ -454,9 +814,101 @@ func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilte
 // GetLightdInfo gets the LightWalletD (this server) info, and includes information
 // it gets from its backend pirated.
 func (s *lwdStreamer) GetLightdInfo(ctx context.Context, in *walletrpc.Empty) (*walletrpc.LightdInfo, error) {
+	if common.LightdInfoCacheTTL > 0 {
+		// Let HTTP proxies (for example, in front of a status page) cache
+		// the reply as long as we do. This fails only if there's no
+		// grpc transport (as in tests), in which case there's no header.
+		grpc.SetHeader(ctx, metadata.Pairs("cache-control",
+			fmt.Sprintf("max-age=%d", int(common.LightdInfoCacheTTL.Seconds()))))
+	}
 	return common.GetLightdInfo()
 }
 
+// GetChainStats returns chain-level statistics (height, difficulty,
+// transactions, coin supply), mainly for block explorers.
+func (s *lwdStreamer) GetChainStats(ctx context.Context, in *walletrpc.Empty) (*walletrpc.ChainStats, error) {
+	return common.GetChainStats()
+}
+
+// maxShieldedStatsRange limits the number of blocks a single
+// GetShieldedStats call can count.
+const maxShieldedStatsRange = 10000
+
+// GetShieldedStats counts the shielded transactions, spends, outputs and
+// actions in the given range of (cached) blocks, inclusive, for explorers;
+// it makes no pirated rpcs, and reads the blocks without displacing those
+// in the cache's memory (see Cache.Peek). It stops if the client cancels
+// the request.
+func (s *lwdStreamer) GetShieldedStats(ctx context.Context, span *walletrpc.BlockRange) (*walletrpc.ShieldedStats, error) {
+	if span == nil || span.Start == nil || span.End == nil {
+		return nil, status.Error(codes.InvalidArgument, "must specify start and end heights")
+	}
+	start, end := span.Start.Height, span.End.Height
+	if start > end {
+		return nil, status.Errorf(codes.InvalidArgument, "start height %d is above end height %d", start, end)
+	}
+	if end-start >= maxShieldedStatsRange {
+		return nil, status.Errorf(codes.InvalidArgument, "range contains %d blocks, maximum is %d",
+			end-start+1, maxShieldedStatsRange)
+	}
+	first, latest := s.cache.GetFirstHeight(), s.cache.GetLatestHeight()
+	if start < uint64(first) || latest < 0 || end > uint64(latest) {
+		return nil, status.Errorf(codes.OutOfRange, "range %d to %d is not within the cached blocks (%d to %d)",
+			start, end, first, latest)
+	}
+	stats := &walletrpc.ShieldedStats{StartHeight: start, EndHeight: end}
+	for height := start; height <= end; height++ {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		block := s.cache.Peek(int(height))
+		if block == nil {
+			// A reorg has removed it since the range was checked (or
+			// it can't be read).
+			return nil, status.Errorf(codes.Unavailable, "block %d is no longer cached, try again", height)
+		}
+		for _, tx := range block.Vtx {
+			if len(tx.Spends)+len(tx.Outputs)+len(tx.Actions) > 0 {
+				stats.Transactions++
+			}
+			stats.SaplingSpends += uint64(len(tx.Spends))
+			stats.SaplingOutputs += uint64(len(tx.Outputs))
+			stats.OrchardActions += uint64(len(tx.Actions))
+		}
+	}
+	return stats, nil
+}
+
+// GetTxConstructionParams returns the consensus branch ID and expiry delta a
+// wallet needs to build a transaction, so it doesn't have to hardcode them.
+func (s *lwdStreamer) GetTxConstructionParams(ctx context.Context, in *walletrpc.Empty) (*walletrpc.TxConstructionParams, error) {
+	return common.GetTxConstructionParams()
+}
+
+// GetServerCapabilities returns the optional features this lightwalletd
+// supports (as it's configured), and its limits, so that wallets needn't
+// discover them by trying each rpc.
+func (s *lwdStreamer) GetServerCapabilities(ctx context.Context, in *walletrpc.Empty) (*walletrpc.ServerCapabilities, error) {
+	return &walletrpc.ServerCapabilities{
+		MinProtocolVersion:    uint32(common.MinProtocolVersion),
+		MaxProtocolVersion:    common.ProtocolVersion,
+		BlockExtended:         common.BlockExtended,
+		TreeStateBridge:       common.TreeStateBridgeSupport,
+		TreeStateIndex:        common.TreeStates != nil,
+		MempoolLookup:         !common.NoMempoolLookup,
+		SaplingOnly:           common.SaplingOnly,
+		Ping:                  s.pingEnable,
+		DeepHistoryHeight:     uint64(common.DeepHistoryHeight),
+		MaxBlockElements:      uint32(common.MaxBlockElements),
+		MaxTaddresses:         uint32(common.MaxTaddresses),
+		MaxTreeStateRange:     maxTreeStateRangeCount,
+		MaxBloomFilterSize:    maxBloomFilterSize,
+		MaxBloomHashFunctions: maxBloomHashFunctions,
+		MaxTxSize:             uint32(common.MaxTxSize),
+		MaxShieldedStatsRange: maxShieldedStatsRange,
+	}, nil
+}
+
 // SendTransaction forwards raw transaction bytes to a pirated instance over JSON-RPC
 func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawTransaction) (*walletrpc.SendResponse, error) {
 	// sendrawtransaction "hexstring" ( allowhighfees )
@@ -470,6 +922,9 @@ func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawT
 	if rawtx == nil || rawtx.Data == nil {
 		return nil, errors.New("Bad transaction data")
 	}
+	if err := checkTxSize(len(rawtx.Data)); err != nil {
+		return nil, err
+	}
 
 	// Construct raw JSON-RPC params
 	params := make([]json.RawMessage, 1)
@@ -478,7 +933,7 @@ func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawT
 		return &walletrpc.SendResponse{}, err
 	}
 	params[0] = txJSON
-	result, rpcErr := common.RawRequest("sendrawtransaction", params)
+	result, rpcErr := common.RawRequestContext(ctx, "sendrawtransaction", params)
 
 	var errCode int64
 	var errMsg string
@@ -506,13 +961,127 @@ func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawT
 		ErrorCode:    int32(errCode),
 		ErrorMessage: errMsg,
 	}
+	if rpcErr == nil && common.SendConfirmWait > 0 {
+		var txid string
+		if err := json.Unmarshal(result, &txid); err != nil {
+			txid = errMsg
+		}
+		resp.MempoolStatus = waitForMempool(ctx, txid)
+	}
 
 	common.Metrics.SendTransactionsCounter.Inc()
 
 	return resp, nil
 }
 
-func getTaddressBalancePiratedRpc(addressList []string) (*walletrpc.Balance, error) {
+// checkTxSize returns an error if a raw transaction is larger than
+// MaxTxSize, so it isn't passed to pirated.
+func checkTxSize(n int) error {
+	if common.MaxTxSize > 0 && n > common.MaxTxSize {
+		return status.Errorf(codes.InvalidArgument, "transaction too large (%d bytes; the limit is %d)", n, common.MaxTxSize)
+	}
+	return nil
+}
+
+// SendResponse.MempoolStatus values
+const (
+	mempoolStatusPresent = "in_mempool"
+	mempoolStatusNotSeen = "not_seen"
+)
+
+// sendConfirmPollInterval is how often waitForMempool() checks the mempool.
+const sendConfirmPollInterval = 250 * time.Millisecond
+
+// waitForMempool polls pirated's mempool until the given transaction is in
+// it, or common.SendConfirmWait has passed (or the request is canceled).
+// Failing to see it is only a warning, since it may still arrive.
+func waitForMempool(ctx context.Context, txid string) string {
+	deadline := common.Time.Now().Add(common.SendConfirmWait)
+	for {
+		// getrawmempool
+		result, rpcErr := common.RawRequestContext(ctx, "getrawmempool", []json.RawMessage{})
+		var txids []string
+		if rpcErr == nil && json.Unmarshal(result, &txids) == nil {
+			for _, id := range txids {
+				if id == txid {
+					return mempoolStatusPresent
+				}
+			}
+		}
+		if ctx.Err() != nil || !common.Time.Now().Before(deadline) {
+			common.Log.WithFields(logrus.Fields{
+				"txid":       txid,
+				"request_id": common.RequestID(ctx),
+			}).Warning("sent transaction not seen in the mempool")
+			return mempoolStatusNotSeen
+		}
+		common.Time.Sleep(sendConfirmPollInterval)
+	}
+}
+
+// CheckTransaction reports whether pirated would accept the given raw
+// transaction into its mempool, without broadcasting it.
+func (s *lwdStreamer) CheckTransaction(ctx context.Context, rawtx *walletrpc.RawTransaction) (*walletrpc.CheckTransactionResponse, error) {
+	// testmempoolaccept ["hexstring"]
+	//
+	// Result:
+	// [{"txid": "hex", "allowed": true|false, "reject-reason": "text"}]
+
+	// Verify rawtx
+	if rawtx == nil || rawtx.Data == nil {
+		return nil, errors.New("Bad transaction data")
+	}
+	if err := checkTxSize(len(rawtx.Data)); err != nil {
+		return nil, err
+	}
+	params := make([]json.RawMessage, 1)
+	txJSON, err := json.Marshal([]string{hex.EncodeToString(rawtx.Data)})
+	if err != nil {
+		return nil, err
+	}
+	params[0] = txJSON
+	result, rpcErr := common.RawRequestContext(ctx, "testmempoolaccept", params)
+	if rpcErr != nil {
+		if _, ok := status.FromError(rpcErr); ok {
+			return nil, rpcErr
+		}
+		// As with sendrawtransaction, the error responses are not JSON;
+		// an error without pirated's error code is from reaching it (such
+		// as a refused connection, or a timeout), not the transaction.
+		errParts := strings.SplitN(rpcErr.Error(), ":", 2)
+		var errCode int64
+		var err error = errors.New("no error code")
+		if len(errParts) == 2 {
+			errCode, err = strconv.ParseInt(errParts[0], 10, 32)
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, "CheckTransaction couldn't reach pirated: "+rpcErr.Error())
+		}
+		switch errCode {
+		case -32601:
+			// RPC_METHOD_NOT_FOUND, not a problem with the transaction
+			return nil, errors.New("CheckTransaction is not supported by this pirated")
+		case -28:
+			// RPC_IN_WARMUP, pirated is starting up
+			return nil, status.Error(codes.Unavailable, "CheckTransaction: "+rpcErr.Error())
+		}
+		// The transaction couldn't be checked (for example, it can't be
+		// decoded), so it would be rejected.
+		return &walletrpc.CheckTransactionResponse{
+			Reason: strings.TrimSpace(errParts[1]),
+		}, nil
+	}
+	var replies []common.PiratedRpcReplyTestmempoolaccept
+	if err := json.Unmarshal(result, &replies); err != nil || len(replies) != 1 {
+		return nil, errors.New("CheckTransaction couldn't parse testmempoolaccept result")
+	}
+	return &walletrpc.CheckTransactionResponse{
+		Accepted: replies[0].Allowed,
+		Reason:   replies[0].RejectReason,
+	}, nil
+}
+
+func getTaddressBalancePiratedRpc(ctx context.Context, addressList []string) (*walletrpc.Balance, error) {
 	params := make([]json.RawMessage, 1)
 	addrList := &common.PiratedRpcRequestGetaddressbalance{
 		Addresses: addressList,
@@ -523,7 +1092,7 @@ func getTaddressBalancePiratedRpc(addressList []string) (*walletrpc.Balance, err
 	}
 	params[0] = param
 
-	result, rpcErr := common.RawRequest("getaddressbalance", params)
+	result, rpcErr := common.RawRequestContext(ctx, "getaddressbalance", params)
 	if rpcErr != nil {
 		return &walletrpc.Balance{}, rpcErr
 	}
@@ -535,9 +1104,40 @@ func getTaddressBalancePiratedRpc(addressList []string) (*walletrpc.Balance, err
 	return &walletrpc.Balance{ValueZat: balanceReply.Balance}, nil
 }
 
+// checkTaddressCount returns an error if a request has more than
+// MaxTaddresses addresses.
+func checkTaddressCount(n int) error {
+	if common.MaxTaddresses > 0 && n > common.MaxTaddresses {
+		return status.Errorf(codes.InvalidArgument, "too many addresses (the limit is %d)", common.MaxTaddresses)
+	}
+	return nil
+}
+
+// checkTaddresses returns an error unless there aren't too many addresses,
+// and each is a t-address of this lightwalletd's chain (if its encodings
+// are known).
+func (s *lwdStreamer) checkTaddresses(addresses []string) error {
+	if err := checkTaddressCount(len(addresses)); err != nil {
+		return err
+	}
+	params := common.GetAddressParams(s.chainName)
+	if params == nil {
+		return nil
+	}
+	for _, address := range addresses {
+		if params.TransparentType(address) == "" {
+			return errors.New("Invalid address")
+		}
+	}
+	return nil
+}
+
 // GetTaddressBalance returns the total balance for a list of taddrs
 func (s *lwdStreamer) GetTaddressBalance(ctx context.Context, addresses *walletrpc.AddressList) (*walletrpc.Balance, error) {
-	return getTaddressBalancePiratedRpc(addresses.Addresses)
+	if err := s.checkTaddresses(addresses.Addresses); err != nil {
+		return &walletrpc.Balance{}, err
+	}
+	return getTaddressBalancePiratedRpc(ctx, addresses.Addresses)
 }
 
 // GetTaddressBalanceStream returns the total balance for a list of taddrs
@@ -552,8 +1152,15 @@ func (s *lwdStreamer) GetTaddressBalanceStream(addresses walletrpc.CompactTxStre
 			return err
 		}
 		addressList = append(addressList, addr.Address)
+		// Don't wait for the client to finish sending too many.
+		if err := checkTaddressCount(len(addressList)); err != nil {
+			return err
+		}
+	}
+	if err := s.checkTaddresses(addressList); err != nil {
+		return err
 	}
-	balance, err := getTaddressBalancePiratedRpc(addressList)
+	balance, err := getTaddressBalancePiratedRpc(addresses.Context(), addressList)
 	if err != nil {
 		return err
 	}
@@ -561,8 +1168,67 @@ func (s *lwdStreamer) GetTaddressBalanceStream(addresses walletrpc.CompactTxStre
 	return nil
 }
 
-func (s *lwdStreamer) GetMempoolStream(_empty *walletrpc.Empty, resp walletrpc.CompactTxStreamer_GetMempoolStreamServer) error {
-	err := common.GetMempool(func(tx *walletrpc.RawTransaction) error {
+// ClassifyAddress returns the type of the given address, so that wallets
+// needn't embed the address encoding rules. If this lightwalletd's chain is
+// in the address table, t-addresses are classified locally, and anything
+// that isn't a sapling z-address of this chain is invalid; otherwise (and
+// to check the sapling key itself) pirated determines it. A node only
+// accepts addresses for its own network, so a valid address belongs to
+// this lightwalletd's chain.
+func (s *lwdStreamer) ClassifyAddress(ctx context.Context, in *walletrpc.Address) (*walletrpc.AddressClassification, error) {
+	if in == nil || in.Address == "" {
+		return nil, errors.New("Must specify an address")
+	}
+	params := make([]json.RawMessage, 1)
+	param, err := json.Marshal(in.Address)
+	if err != nil {
+		return nil, err
+	}
+	params[0] = param
+
+	if addressParams := common.GetAddressParams(s.chainName); addressParams != nil {
+		if addrType := addressParams.TransparentType(in.Address); addrType != "" {
+			return &walletrpc.AddressClassification{Valid: true, Type: addrType, Network: s.chainName}, nil
+		}
+		if !addressParams.IsSapling(in.Address) {
+			return &walletrpc.AddressClassification{}, nil
+		}
+	} else {
+		// validateaddress "taddr"
+		result, rpcErr := common.RawRequestContext(ctx, "validateaddress", params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		var taddrReply common.PiratedRpcReplyValidateaddress
+		if err := json.Unmarshal(result, &taddrReply); err != nil {
+			return nil, err
+		}
+		if taddrReply.IsValid {
+			addrType := "p2pkh"
+			if taddrReply.IsScript {
+				addrType = "p2sh"
+			}
+			return &walletrpc.AddressClassification{Valid: true, Type: addrType, Network: s.chainName}, nil
+		}
+	}
+
+	// z_validateaddress "zaddr"
+	result, rpcErr := common.RawRequestContext(ctx, "z_validateaddress", params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var zaddrReply common.PiratedRpcReplyZValidateaddress
+	if err := json.Unmarshal(result, &zaddrReply); err != nil {
+		return nil, err
+	}
+	if zaddrReply.IsValid {
+		return &walletrpc.AddressClassification{Valid: true, Type: zaddrReply.Type, Network: s.chainName}, nil
+	}
+	return &walletrpc.AddressClassification{}, nil
+}
+
+func (s *lwdStreamer) GetMempoolStream(arg *walletrpc.GetMempoolStreamArg, resp walletrpc.CompactTxStreamer_GetMempoolStreamServer) error {
+	err := common.GetMempool(resp.Context(), arg.GetCursor(), func(tx *walletrpc.RawTransaction) error {
 		return resp.Send(tx)
 	})
 	return err
@@ -580,7 +1246,7 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 		lastMempool = time.Now()
 		// Refresh our copy of the mempool.
 		params := make([]json.RawMessage, 0)
-		result, rpcErr := common.RawRequest("getrawmempool", params)
+		result, rpcErr := common.RawRequestContext(resp.Context(), "getrawmempool", params)
 		if rpcErr != nil {
 			return rpcErr
 		}
@@ -592,6 +1258,8 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 		if mempoolMap == nil {
 			mempoolMap = &newmempoolMap
 		}
+		var newTxids []string
+		var calls []common.RPCCall
 		for _, txidstr := range mempoolList {
 			if ctx, ok := (*mempoolMap)[txidstr]; ok {
 				// This ctx has already been fetched, copy pointer to it.
@@ -605,14 +1273,18 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 			// The "0" is because we only need the raw hex, which is returned as
 			// just a hex string, and not even a json string (with quotes).
 			params := []json.RawMessage{txidJSON, json.RawMessage("0")}
-			result, rpcErr := common.RawRequest("getrawtransaction", params)
-			if rpcErr != nil {
+			newTxids = append(newTxids, txidstr)
+			calls = append(calls, common.RPCCall{Method: "getrawtransaction", Params: params})
+		}
+		for i, reply := range common.BatchRequest(resp.Context(), calls) {
+			txidstr := newTxids[i]
+			if reply.Err != nil {
 				// Not an error; mempool transactions can disappear
 				continue
 			}
 			// strip the quotes
 			var txStr string
-			err = json.Unmarshal(result, &txStr)
+			err = json.Unmarshal(reply.Result, &txStr)
 			if err != nil {
 				return err
 			}
@@ -634,11 +1306,7 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 		}
 		mempoolMap = &newmempoolMap
 	}
-	excludeHex := make([]string, len(exclude.Txid))
-	for i := 0; i < len(exclude.Txid); i++ {
-		excludeHex[i] = hex.EncodeToString(parser.Reverse(exclude.Txid[i]))
-	}
-	for _, txid := range MempoolFilter(mempoolList, excludeHex) {
+	for _, txid := range MempoolFilter(mempoolList, excludePrefixes(exclude.Txid)) {
 		tx := (*mempoolMap)[txid]
 		if len(tx.Hash) > 0 {
 			err := resp.Send(tx)
@@ -652,51 +1320,82 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 
 // Return the subset of items that aren't excluded, but
 // if more than one item matches an exclude entry, return
-// all those items.
+// all those items (see excludedTxids).
 func MempoolFilter(items, exclude []string) []string {
-	sort.Slice(items, func(i, j int) bool {
-		return items[i] < items[j]
-	})
-	sort.Slice(exclude, func(i, j int) bool {
-		return exclude[i] < exclude[j]
-	})
-	// Determine how many items match each exclude item.
-	nmatches := make([]int, len(exclude))
-	// is the exclude string less than the item string?
-	lessthan := func(e, i string) bool {
-		l := len(e)
-		if l > len(i) {
-			l = len(i)
+	sort.Strings(items)
+	excluded := excludedTxids(items, exclude)
+	tosend := make([]string, 0)
+	for _, item := range items {
+		if !excluded[item] {
+			tosend = append(tosend, item)
 		}
-		return e < i[0:l]
 	}
-	ei := 0
-	for _, item := range items {
-		for ei < len(exclude) && lessthan(exclude[ei], item) {
-			ei++
+	return tosend
+}
+
+// excludePrefixes converts the shortened txids that a client sends (see
+// Exclude), which are in the reverse of the display order, to hex prefixes
+// of the (displayed) txids.
+func excludePrefixes(exclude [][]byte) []string {
+	prefixes := make([]string, len(exclude))
+	for i, txid := range exclude {
+		prefixes[i] = hex.EncodeToString(parser.Reverse(txid))
+	}
+	return prefixes
+}
+
+// excludedTxids returns the set of txids (hex, as displayed) that the
+// exclude prefixes select: a prefix that matches exactly one of the txids
+// excludes it. A prefix that matches several is ambiguous, so it excludes
+// none of them (the client receives them again rather than miss one);
+// an empty prefix matches nothing.
+func excludedTxids(txids, exclude []string) map[string]bool {
+	sorted := append([]string(nil), txids...)
+	sort.Strings(sorted)
+	excluded := make(map[string]bool)
+	for _, prefix := range exclude {
+		if prefix == "" {
+			continue
 		}
-		match := ei < len(exclude) && strings.HasPrefix(item, exclude[ei])
-		if match {
-			nmatches[ei]++
+		i := sort.SearchStrings(sorted, prefix)
+		if i < len(sorted) && strings.HasPrefix(sorted[i], prefix) &&
+			(i+1 == len(sorted) || !strings.HasPrefix(sorted[i+1], prefix)) {
+			excluded[sorted[i]] = true
 		}
 	}
+	return excluded
+}
 
-	// Add each item that isn't uniquely excluded to the results.
-	tosend := make([]string, 0)
-	ei = 0
-	for _, item := range items {
-		for ei < len(exclude) && lessthan(exclude[ei], item) {
-			ei++
-		}
-		match := ei < len(exclude) && strings.HasPrefix(item, exclude[ei])
-		if !match || nmatches[ei] > 1 {
-			tosend = append(tosend, item)
+// excludeFromBlock removes the transactions that the exclude prefixes
+// select (see excludedTxids) from the block, which is modified in place,
+// as by filterBlock(). Ambiguity is decided within the block, so a prefix
+// that matches one transaction in each of several blocks excludes each of
+// them; clients should shorten txids only as far as they stay unique over
+// the whole range.
+func excludeFromBlock(block *walletrpc.CompactBlock, exclude []string) {
+	txids := make([]string, len(block.Vtx))
+	for i, tx := range block.Vtx {
+		txids[i] = hex.EncodeToString(parser.Reverse(tx.Hash))
+	}
+	excluded := excludedTxids(txids, exclude)
+	if len(excluded) == 0 {
+		return
+	}
+	vtx := block.Vtx[:0]
+	for i, tx := range block.Vtx {
+		if !excluded[txids[i]] {
+			vtx = append(vtx, tx)
 		}
 	}
-	return tosend
+	block.Vtx = vtx
 }
 
-func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAddressUtxosReply) error) error {
+// getAddressUtxos calls f for each of the UTXOs that the given request
+// selects; tip, the height of the best block, determines confirmations.
+func getAddressUtxos(ctx context.Context, arg *walletrpc.GetAddressUtxosArg, tip int, f func(*walletrpc.GetAddressUtxosReply) error) error {
+	if arg.MinConfirmations < 0 {
+		return status.Errorf(codes.InvalidArgument, "minConfirmations %d is negative", arg.MinConfirmations)
+	}
 	params := make([]json.RawMessage, 1)
 	addrList := &common.PiratedRpcRequestGetaddressutxos{
 		Addresses: arg.Addresses,
@@ -706,7 +1405,7 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 		return err
 	}
 	params[0] = param
-	result, rpcErr := common.RawRequest("getaddressutxos", params)
+	result, rpcErr := common.RawRequestContext(ctx, "getaddressutxos", params)
 	if rpcErr != nil {
 		return rpcErr
 	}
@@ -720,6 +1419,9 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 		if uint64(utxo.Height) < arg.StartHeight {
 			continue
 		}
+		if tip-utxo.Height+1 < int(arg.MinConfirmations) {
+			continue
+		}
 		n++
 		if arg.MaxEntries > 0 && uint32(n) > arg.MaxEntries {
 			break
@@ -748,8 +1450,11 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 }
 
 func (s *lwdStreamer) GetAddressUtxos(ctx context.Context, arg *walletrpc.GetAddressUtxosArg) (*walletrpc.GetAddressUtxosReplyList, error) {
+	if err := s.checkTaddresses(arg.Addresses); err != nil {
+		return &walletrpc.GetAddressUtxosReplyList{}, err
+	}
 	addressUtxos := make([]*walletrpc.GetAddressUtxosReply, 0)
-	err := getAddressUtxos(arg, func(utxo *walletrpc.GetAddressUtxosReply) error {
+	err := getAddressUtxos(ctx, arg, s.cache.GetLatestHeight(), func(utxo *walletrpc.GetAddressUtxosReply) error {
 		addressUtxos = append(addressUtxos, utxo)
 		return nil
 	})
@@ -760,7 +1465,10 @@ func (s *lwdStreamer) GetAddressUtxos(ctx context.Context, arg *walletrpc.GetAdd
 }
 
 func (s *lwdStreamer) GetAddressUtxosStream(arg *walletrpc.GetAddressUtxosArg, resp walletrpc.CompactTxStreamer_GetAddressUtxosStreamServer) error {
-	err := getAddressUtxos(arg, func(utxo *walletrpc.GetAddressUtxosReply) error {
+	if err := s.checkTaddresses(arg.Addresses); err != nil {
+		return err
+	}
+	err := getAddressUtxos(resp.Context(), arg, s.cache.GetLatestHeight(), func(utxo *walletrpc.GetAddressUtxosReply) error {
 		return resp.Send(utxo)
 	})
 	if err != nil {
@@ -769,6 +1477,32 @@ func (s *lwdStreamer) GetAddressUtxosStream(arg *walletrpc.GetAddressUtxosArg, r
 	return nil
 }
 
+// GetConfig returns the server's configuration, with secrets redacted, to
+// a client on the same host.
+func (s *lwdStreamer) GetConfig(ctx context.Context, in *walletrpc.Empty) (*walletrpc.ServerConfig, error) {
+	if err := common.CheckLocalPeer(ctx); err != nil {
+		return nil, err
+	}
+	return &walletrpc.ServerConfig{
+		ChainName: s.chainName,
+		Version:   common.Version,
+		Settings:  common.ConfigSettings(common.RunningOptions),
+	}, nil
+}
+
+// RawPiratedRPC passes the given pirated rpc through, for a client on the
+// same host, if it's allowed (see common.RPCPassthrough).
+func (s *lwdStreamer) RawPiratedRPC(ctx context.Context, in *walletrpc.RawRPCRequest) (*walletrpc.RawRPCReply, error) {
+	if err := common.CheckLocalPeer(ctx); err != nil {
+		return nil, err
+	}
+	result, err := common.PassthroughRPC(in.Method, in.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.RawRPCReply{Result: string(result)}, nil
+}
+
 // This rpc is used only for testing.
 var concurrent int64
 
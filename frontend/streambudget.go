@@ -0,0 +1,105 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Copyright (c) 2019-2021 Pirate Chain developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package frontend
+
+import (
+	"sync"
+
+	"github.com/PirateNetwork/lightwalletd/common"
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// maxPrefetchBlocks limits how many (small) blocks a stream reads ahead,
+// whatever its memory budget.
+const maxPrefetchBlocks = 1000
+
+// memoryBudget accounts for the bytes of blocks that a stream has read
+// ahead but not yet sent to its client.
+type memoryBudget struct {
+	mutex    sync.Mutex
+	limit    int
+	used     int
+	peak     int           // most bytes ever in use (for tests)
+	released chan struct{} // signaled whenever bytes are released
+}
+
+func newMemoryBudget(limit int) *memoryBudget {
+	return &memoryBudget{limit: limit, released: make(chan struct{}, 1)}
+}
+
+// acquire waits until size more bytes fit within the budget (a block larger
+// than the whole budget is allowed when nothing else is buffered, so it
+// can't stall the stream), or until done is closed (returning false).
+func (b *memoryBudget) acquire(size int, done <-chan struct{}) bool {
+	for {
+		b.mutex.Lock()
+		if b.used == 0 || b.used+size <= b.limit {
+			b.used += size
+			if b.used > b.peak {
+				b.peak = b.used
+			}
+			b.mutex.Unlock()
+			return true
+		}
+		b.mutex.Unlock()
+		select {
+		case <-b.released:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// release returns size bytes to the budget, waking a waiting acquire().
+func (b *memoryBudget) release(size int) {
+	b.mutex.Lock()
+	b.used -= size
+	b.mutex.Unlock()
+	select {
+	case b.released <- struct{}{}:
+	default:
+	}
+}
+
+// A prefetched block, or (if block is nil) the end of the stream, with its
+// error (if any).
+type prefetched struct {
+	block *walletrpc.CompactBlock
+	size  int
+	err   error
+}
+
+// prefetchBlocks reads blocks ahead of the client, as long as they fit
+// within the budget (so at most one block beyond it is read but not sent);
+// the caller must release each block's size once it's been sent. The
+// stream's end (error) follows its last block. Reading stops when done is
+// closed.
+func prefetchBlocks(blocks *common.BlockRangeReader, budget *memoryBudget, done <-chan struct{}) <-chan prefetched {
+	out := make(chan prefetched, maxPrefetchBlocks)
+	go func() {
+		defer common.StreamGoroutineStarted()()
+		for {
+			var p prefetched
+			p.block, p.err = blocks.Next()
+			if p.block != nil {
+				p.size = proto.Size(p.block)
+				if !budget.acquire(p.size, done) {
+					return
+				}
+			}
+			select {
+			case out <- p:
+			case <-done:
+				return
+			}
+			if p.block == nil {
+				return
+			}
+		}
+	}()
+	return out
+}
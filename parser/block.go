@@ -7,7 +7,9 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
 
 	"github.com/PirateNetwork/lightwalletd/parser/internal/bytestring"
 	"github.com/PirateNetwork/lightwalletd/walletrpc"
@@ -48,6 +50,14 @@ func (b *Block) GetDisplayHash() []byte {
 	return b.hdr.GetDisplayHash()
 }
 
+// MeetsTarget returns true if the block hash is within the header's
+// proof-of-work target. (The Equihash solution itself isn't verified.)
+func (b *Block) MeetsTarget() bool {
+	target := b.hdr.GetTarget()
+	hash := new(big.Int).SetBytes(b.GetDisplayHash())
+	return target.Sign() > 0 && hash.Cmp(target) <= 0
+}
+
 // TODO: encode hash endianness in a type?
 
 // GetEncodableHash returns the block hash in little-endian wire order.
@@ -127,6 +137,39 @@ func (b *Block) ToCompact() *walletrpc.CompactBlock {
 	return compactBlock
 }
 
+// CheckCompact cross-checks the given compact block against this (full)
+// block, which it should have been converted from: the same header fields,
+// and a compact transaction, in order, for each transaction with shielded
+// elements, having the same number of each kind of element (so the same
+// number of note commitments), of the expected sizes. It guards against
+// conversion bugs sending malformed compact blocks to wallets.
+func (b *Block) CheckCompact(compactBlock *walletrpc.CompactBlock) error {
+	if compactBlock.Height != uint64(b.GetHeight()) {
+		return fmt.Errorf("compact block height %d, expected %d", compactBlock.Height, b.GetHeight())
+	}
+	if !bytes.Equal(compactBlock.Hash, b.GetEncodableHash()) ||
+		!bytes.Equal(compactBlock.PrevHash, b.hdr.HashPrevBlock) {
+		return errors.New("compact block hash or prevHash doesn't match the block")
+	}
+	i := 0
+	for idx, tx := range b.vtx {
+		if !tx.HasShieldedElements() {
+			continue
+		}
+		if i >= len(compactBlock.Vtx) {
+			return fmt.Errorf("compact block is missing transaction %d", idx)
+		}
+		if err := tx.checkCompact(idx, compactBlock.Vtx[i]); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("transaction %d", idx))
+		}
+		i++
+	}
+	if i != len(compactBlock.Vtx) {
+		return fmt.Errorf("compact block has %d transactions, expected %d", len(compactBlock.Vtx), i)
+	}
+	return nil
+}
+
 // ParseFromSlice deserializes a block from the given data stream
 // and returns a slice to the remaining data. The caller should verify
 // there is no remaining data if none is expected.
@@ -195,6 +195,13 @@ func parseNBits(b []byte) *big.Int {
 	return new(big.Int).SetBytes(targetBytes)
 }
 
+// GetTarget returns the proof-of-work target threshold (from nBits) that
+// the block hash must be less than or equal to.
+func (hdr *BlockHeader) GetTarget() *big.Int {
+	// nBits is little-endian on the wire
+	return parseNBits(Reverse(hdr.NBitsBytes))
+}
+
 // GetDisplayHash returns the bytes of a block hash in big-endian order.
 func (hdr *BlockHeader) GetDisplayHash() []byte {
 	if hdr.cachedHash != nil {
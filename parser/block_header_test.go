@@ -258,3 +258,36 @@ func TestWriteCompactLengthPrefixed(t *testing.T) {
 		t.Fatal("TestWriteCompactLengthPrefixed incorrect result")
 	}
 }
+
+func TestBlockMeetsTarget(t *testing.T) {
+	testBlocks, err := os.Open("../testdata/blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testBlocks.Close()
+
+	scan := bufio.NewScanner(testBlocks)
+	for scan.Scan() {
+		blockData, err := hex.DecodeString(scan.Text())
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := NewBlock()
+		if _, err := block.ParseFromSlice(blockData); err != nil {
+			t.Fatal(err)
+		}
+		if block.hdr.GetTarget().Sign() <= 0 {
+			t.Fatal("unexpected target", block.hdr.GetTarget())
+		}
+		if !block.MeetsTarget() {
+			t.Fatalf("block %d does not meet its target", block.GetHeight())
+		}
+
+		// A different nonce (almost certainly) gives a hash that doesn't.
+		block.hdr.Nonce[0] ^= 0xff
+		block.hdr.cachedHash = nil
+		if block.MeetsTarget() {
+			t.Fatalf("block %d with a modified nonce meets its target", block.GetHeight())
+		}
+	}
+}
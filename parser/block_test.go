@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"github.com/PirateNetwork/lightwalletd/walletrpc"
 	"github.com/pkg/errors"
 
 	protobuf "github.com/golang/protobuf/proto"
@@ -78,3 +79,72 @@ func TestCompactBlocks(t *testing.T) {
 	}
 
 }
+
+func TestCheckCompact(t *testing.T) {
+	var compactTests []struct {
+		Full string `json:"full"`
+	}
+	blockJSON, err := ioutil.ReadFile("../testdata/compact_blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(blockJSON, &compactTests); err != nil {
+		t.Fatal(err)
+	}
+	// A block with at least one shielded output.
+	var block *Block
+	for _, test := range compactTests {
+		blockData, _ := hex.DecodeString(test.Full)
+		b := NewBlock()
+		if _, err := b.ParseFromSlice(blockData); err != nil {
+			t.Fatal(err)
+		}
+		for _, ctx := range b.ToCompact().Vtx {
+			if len(ctx.Outputs) > 0 {
+				block = b
+			}
+		}
+		if block != nil {
+			break
+		}
+	}
+	if block == nil {
+		t.Fatal("no test block with shielded outputs")
+	}
+	if err := block.CheckCompact(block.ToCompact()); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		corrupt func(*walletrpc.CompactBlock)
+	}{
+		{"height", func(cb *walletrpc.CompactBlock) { cb.Height++ }},
+		{"prevHash", func(cb *walletrpc.CompactBlock) { cb.PrevHash = nil }},
+		{"missing tx", func(cb *walletrpc.CompactBlock) { cb.Vtx = cb.Vtx[:len(cb.Vtx)-1] }},
+		{"extra tx", func(cb *walletrpc.CompactBlock) { cb.Vtx = append(cb.Vtx, cb.Vtx[0]) }},
+		{"tx index", func(cb *walletrpc.CompactBlock) { cb.Vtx[0].Index++ }},
+		{"missing output", func(cb *walletrpc.CompactBlock) {
+			for _, ctx := range cb.Vtx {
+				if len(ctx.Outputs) > 0 {
+					ctx.Outputs = ctx.Outputs[1:]
+					return
+				}
+			}
+		}},
+		{"short cmu", func(cb *walletrpc.CompactBlock) {
+			for _, ctx := range cb.Vtx {
+				if len(ctx.Outputs) > 0 {
+					ctx.Outputs[0].Cmu = ctx.Outputs[0].Cmu[:31]
+					return
+				}
+			}
+		}},
+	} {
+		compact := block.ToCompact()
+		test.corrupt(compact)
+		if err := block.CheckCompact(compact); err == nil {
+			t.Error("inconsistent compact block passed the check:", test.name)
+		}
+	}
+}
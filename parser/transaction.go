@@ -7,6 +7,7 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -36,10 +37,10 @@ type rawTransaction struct {
 // Txin format as described in https://en.bitcoin.it/wiki/Transaction
 type txIn struct {
 	// SHA256d of a previous (to-be-used) transaction
-	//PrevTxHash []byte
+	PrevTxHash []byte
 
 	// Index of the to-be-used output in the previous tx
-	//PrevTxOutIndex uint32
+	PrevTxOutIndex uint32
 
 	// CompactSize-prefixed, could be a pubkey or a script
 	ScriptSig []byte
@@ -51,12 +52,12 @@ type txIn struct {
 func (tx *txIn) ParseFromSlice(data []byte) ([]byte, error) {
 	s := bytestring.String(data)
 
-	if !s.Skip(32) {
-		return nil, errors.New("could not skip PrevTxHash")
+	if !s.ReadBytes(&tx.PrevTxHash, 32) {
+		return nil, errors.New("could not read PrevTxHash")
 	}
 
-	if !s.Skip(4) {
-		return nil, errors.New("could not skip PrevTxOutIndex")
+	if !s.ReadUint32(&tx.PrevTxOutIndex) {
+		return nil, errors.New("could not read PrevTxOutIndex")
 	}
 
 	if !s.ReadCompactLengthPrefixed((*bytestring.String)(&tx.ScriptSig)) {
@@ -76,18 +77,18 @@ type txOut struct {
 	Value uint64
 
 	// Script. CompactSize-prefixed.
-	//Script []byte
+	Script []byte
 }
 
 func (tx *txOut) ParseFromSlice(data []byte) ([]byte, error) {
 	s := bytestring.String(data)
 
-	if !s.Skip(8) {
-		return nil, errors.New("could not skip txOut value")
+	if !s.ReadUint64(&tx.Value) {
+		return nil, errors.New("could not read txOut value")
 	}
 
-	if !s.SkipCompactLengthPrefixed() {
-		return nil, errors.New("could not skip txOut script")
+	if !s.ReadCompactLengthPrefixed((*bytestring.String)(&tx.Script)) {
+		return nil, errors.New("could not read txOut script")
 	}
 
 	return []byte(s), nil
@@ -370,6 +371,16 @@ func (tx *Transaction) HasShieldedElements() bool {
 	return tx.version >= 4 && nshielded > 0
 }
 
+// IsCoinbase indicates whether a transaction is a coinbase transaction:
+// its only input spends the null outpoint (all-zero hash, index 0xffffffff).
+func (tx *Transaction) IsCoinbase() bool {
+	if len(tx.transparentInputs) != 1 {
+		return false
+	}
+	in := tx.transparentInputs[0]
+	return in.PrevTxOutIndex == 0xffffffff && bytes.Equal(in.PrevTxHash, make([]byte, 32))
+}
+
 // ToCompact converts the given (full) transaction to compact format.
 func (tx *Transaction) ToCompact(index int) *walletrpc.CompactTx {
 	ctx := &walletrpc.CompactTx{
@@ -392,6 +403,73 @@ func (tx *Transaction) ToCompact(index int) *walletrpc.CompactTx {
 	return ctx
 }
 
+// HasTransparentElements indicates whether a transaction has at least one
+// transparent input or output.
+func (tx *Transaction) HasTransparentElements() bool {
+	return len(tx.transparentInputs)+len(tx.transparentOutputs) > 0
+}
+
+// ToExtended returns the transparent inputs and outputs of the given (full)
+// transaction; only the inputs' previous outputs (not their addresses or
+// values) and the outputs' values and scripts are known from the
+// transaction itself.
+func (tx *Transaction) ToExtended(index int) *walletrpc.ExtendedTx {
+	etx := &walletrpc.ExtendedTx{
+		Index: uint64(index), // index is contextual
+		Hash:  tx.GetEncodableHash(),
+		Vin:   make([]*walletrpc.TransparentInput, len(tx.transparentInputs)),
+		Vout:  make([]*walletrpc.TransparentOutput, len(tx.transparentOutputs)),
+	}
+	for i, in := range tx.transparentInputs {
+		etx.Vin[i] = &walletrpc.TransparentInput{
+			PrevTxid:  in.PrevTxHash,
+			PrevIndex: in.PrevTxOutIndex,
+		}
+	}
+	for i, out := range tx.transparentOutputs {
+		etx.Vout[i] = &walletrpc.TransparentOutput{
+			ValueZat: out.Value,
+			Script:   out.Script,
+		}
+	}
+	return etx
+}
+
+// checkCompact returns an error if the given compact transaction isn't
+// (structurally) the compact form of this transaction, at the given index.
+func (tx *Transaction) checkCompact(index int, ctx *walletrpc.CompactTx) error {
+	if ctx.Index != uint64(index) {
+		return fmt.Errorf("compact transaction index %d, expected %d", ctx.Index, index)
+	}
+	if !bytes.Equal(ctx.Hash, tx.GetEncodableHash()) {
+		return errors.New("compact transaction hash doesn't match")
+	}
+	if len(ctx.Spends) != len(tx.shieldedSpends) ||
+		len(ctx.Outputs) != len(tx.shieldedOutputs) ||
+		len(ctx.Actions) != len(tx.orchardActions) {
+		return fmt.Errorf("compact transaction has %d spends, %d outputs, %d actions, expected %d, %d, %d",
+			len(ctx.Spends), len(ctx.Outputs), len(ctx.Actions),
+			len(tx.shieldedSpends), len(tx.shieldedOutputs), len(tx.orchardActions))
+	}
+	for i, spend := range ctx.Spends {
+		if len(spend.Nf) != 32 {
+			return fmt.Errorf("spend %d has a malformed nullifier", i)
+		}
+	}
+	for i, output := range ctx.Outputs {
+		if len(output.Cmu) != 32 || len(output.Epk) != 32 || len(output.Ciphertext) != 52 {
+			return fmt.Errorf("output %d is malformed", i)
+		}
+	}
+	for i, action := range ctx.Actions {
+		if len(action.Nullifier) != 32 || len(action.Cmx) != 32 ||
+			len(action.EphemeralKey) != 32 || len(action.Ciphertext) != 52 {
+			return fmt.Errorf("action %d is malformed", i)
+		}
+	}
+	return nil
+}
+
 // parse version 4 transaction data after the nVersionGroupId field.
 func (tx *Transaction) parseV4(data []byte) ([]byte, error) {
 	s := bytestring.String(data)
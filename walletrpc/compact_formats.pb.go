@@ -20,6 +20,7 @@ It has these top-level messages:
 	CompactSaplingSpend
 	CompactSaplingOutput
 	CompactOrchardAction
+	ChainMetadata
 */
 package walletrpc
 
@@ -50,6 +51,11 @@ type CompactBlock struct {
 	Time         uint32       `protobuf:"varint,5,opt,name=time" json:"time,omitempty"`
 	Header       []byte       `protobuf:"bytes,6,opt,name=header,proto3" json:"header,omitempty"`
 	Vtx          []*CompactTx `protobuf:"bytes,7,rep,name=vtx" json:"vtx,omitempty"`
+	Continued    bool         `protobuf:"varint,8,opt,name=continued" json:"continued,omitempty"`
+	Sequence     uint64       `protobuf:"varint,9,opt,name=sequence" json:"sequence,omitempty"`
+	// information about the state of the chain as of this block
+	ChainMetadata *ChainMetadata `protobuf:"bytes,10,opt,name=chainMetadata" json:"chainMetadata,omitempty"`
+	Orphaned      bool           `protobuf:"varint,11,opt,name=orphaned" json:"orphaned,omitempty"`
 }
 
 func (m *CompactBlock) Reset()                    { *m = CompactBlock{} }
@@ -106,6 +112,34 @@ func (m *CompactBlock) GetVtx() []*CompactTx {
 	return nil
 }
 
+func (m *CompactBlock) GetContinued() bool {
+	if m != nil {
+		return m.Continued
+	}
+	return false
+}
+
+func (m *CompactBlock) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *CompactBlock) GetChainMetadata() *ChainMetadata {
+	if m != nil {
+		return m.ChainMetadata
+	}
+	return nil
+}
+
+func (m *CompactBlock) GetOrphaned() bool {
+	if m != nil {
+		return m.Orphaned
+	}
+	return false
+}
+
 // CompactTx contains the minimum information for a wallet to know if this transaction
 // is relevant to it (either pays to it or spends from it) via shielded elements
 // only. This message will not encode a transparent-to-transparent transaction.
@@ -121,6 +155,8 @@ type CompactTx struct {
 	Spends  []*CompactSaplingSpend  `protobuf:"bytes,4,rep,name=spends" json:"spends,omitempty"`
 	Outputs []*CompactSaplingOutput `protobuf:"bytes,5,rep,name=outputs" json:"outputs,omitempty"`
 	Actions []*CompactOrchardAction `protobuf:"bytes,6,rep,name=actions" json:"actions,omitempty"`
+	// lightwalletd --coinbase-markers only: this is its block's coinbase transaction
+	Coinbase bool `protobuf:"varint,7,opt,name=coinbase" json:"coinbase,omitempty"`
 }
 
 func (m *CompactTx) Reset()                    { *m = CompactTx{} }
@@ -170,6 +206,13 @@ func (m *CompactTx) GetActions() []*CompactOrchardAction {
 	return nil
 }
 
+func (m *CompactTx) GetCoinbase() bool {
+	if m != nil {
+		return m.Coinbase
+	}
+	return false
+}
+
 // CompactSaplingSpend is a Sapling Spend Description as described in 7.3 of the Zcash
 // protocol specification.
 type CompactSaplingSpend struct {
@@ -264,44 +307,82 @@ func (m *CompactOrchardAction) GetCiphertext() []byte {
 	return nil
 }
 
+// ChainMetadata gives the sizes of the note commitment trees as of the end
+// of a block (including its commitments), for wallets building witnesses.
+// A size is zero if pirated didn't report it.
+type ChainMetadata struct {
+	SaplingCommitmentTreeSize uint32 `protobuf:"varint,1,opt,name=saplingCommitmentTreeSize" json:"saplingCommitmentTreeSize,omitempty"`
+	OrchardCommitmentTreeSize uint32 `protobuf:"varint,2,opt,name=orchardCommitmentTreeSize" json:"orchardCommitmentTreeSize,omitempty"`
+}
+
+func (m *ChainMetadata) Reset()         { *m = ChainMetadata{} }
+func (m *ChainMetadata) String() string { return proto.CompactTextString(m) }
+func (*ChainMetadata) ProtoMessage()    {}
+func (*ChainMetadata) Descriptor() ([]byte, []int) {
+	return file_compact_formats_proto_rawDesc, []int{5}
+}
+
+func (m *ChainMetadata) GetSaplingCommitmentTreeSize() uint32 {
+	if m != nil {
+		return m.SaplingCommitmentTreeSize
+	}
+	return 0
+}
+
+func (m *ChainMetadata) GetOrchardCommitmentTreeSize() uint32 {
+	if m != nil {
+		return m.OrchardCommitmentTreeSize
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*CompactBlock)(nil), "pirate.wallet.sdk.rpc.CompactBlock")
 	proto.RegisterType((*CompactTx)(nil), "pirate.wallet.sdk.rpc.CompactTx")
 	proto.RegisterType((*CompactSaplingSpend)(nil), "pirate.wallet.sdk.rpc.CompactSaplingSpend")
 	proto.RegisterType((*CompactSaplingOutput)(nil), "pirate.wallet.sdk.rpc.CompactSaplingOutput")
 	proto.RegisterType((*CompactOrchardAction)(nil), "pirate.wallet.sdk.rpc.CompactOrchardAction")
+	proto.RegisterType((*ChainMetadata)(nil), "pirate.wallet.sdk.rpc.ChainMetadata")
 }
 
 func init() { proto.RegisterFile("compact_formats.proto", file_compact_formats_proto_rawDesc) }
 
 var file_compact_formats_proto_rawDesc = []byte{
-	// 439 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x52, 0xdd, 0x6a, 0x14, 0x31,
-	0x14, 0x76, 0x66, 0x67, 0xa7, 0xf6, 0xb8, 0x15, 0x89, 0x6d, 0x09, 0x2a, 0x32, 0x0c, 0x08, 0x8b,
-	0xc2, 0x08, 0xf5, 0x09, 0x5c, 0x11, 0x04, 0x2f, 0x0a, 0xa9, 0x78, 0xd1, 0x1b, 0x89, 0x99, 0x33,
-	0x9d, 0xb0, 0xf3, 0x13, 0x92, 0x6c, 0x1d, 0x5f, 0xc1, 0x37, 0xf0, 0x55, 0x7c, 0x14, 0x9f, 0x46,
-	0x92, 0xc9, 0x8e, 0xdd, 0xb2, 0x94, 0x5e, 0xe5, 0xe4, 0xe3, 0x7c, 0x3f, 0xe7, 0x70, 0xe0, 0x44,
-	0xf4, 0xad, 0xe2, 0xc2, 0x7e, 0xab, 0x7a, 0xdd, 0x72, 0x6b, 0x0a, 0xa5, 0x7b, 0xdb, 0x93, 0x13,
-	0x25, 0x35, 0xb7, 0x58, 0xfc, 0xe0, 0x4d, 0x83, 0xb6, 0x30, 0xe5, 0xba, 0xd0, 0x4a, 0xe4, 0x7f,
-	0x23, 0x58, 0x7c, 0x18, 0x09, 0xab, 0xa6, 0x17, 0x6b, 0x92, 0xc3, 0xc2, 0x13, 0xbe, 0xa2, 0x36,
-	0xb2, 0xef, 0x68, 0x94, 0x45, 0xcb, 0x23, 0xb6, 0x83, 0x91, 0x53, 0x48, 0x6b, 0x94, 0x57, 0xb5,
-	0xa5, 0x71, 0x16, 0x2d, 0x13, 0x16, 0x7e, 0x84, 0x40, 0x52, 0x73, 0x53, 0xd3, 0x59, 0x16, 0x2d,
-	0x17, 0xcc, 0xd7, 0xe4, 0x19, 0x3c, 0x54, 0x1a, 0xaf, 0x3f, 0x39, 0x3c, 0xf1, 0xf8, 0xf4, 0x77,
-	0xfd, 0x56, 0xb6, 0x48, 0xe7, 0xde, 0xc3, 0xd7, 0xa3, 0x36, 0x2f, 0x51, 0xd3, 0xd4, 0x77, 0x87,
-	0x1f, 0x39, 0x83, 0xd9, 0xb5, 0x1d, 0xe8, 0x41, 0x36, 0x5b, 0x3e, 0x3a, 0xcb, 0x8a, 0xbd, 0xd3,
-	0x14, 0x61, 0x92, 0x2f, 0x03, 0x73, 0xcd, 0xf9, 0xef, 0x18, 0x0e, 0x27, 0x88, 0x1c, 0xc3, 0x5c,
-	0x76, 0x25, 0x0e, 0x7e, 0xa4, 0x84, 0x8d, 0x9f, 0x29, 0x73, 0x7c, 0x23, 0xf3, 0x13, 0x98, 0x55,
-	0x88, 0x7e, 0x8c, 0x23, 0xe6, 0x4a, 0xb2, 0x82, 0xd4, 0x28, 0xec, 0x4a, 0x43, 0x13, 0x1f, 0xe0,
-	0xf5, 0xdd, 0x01, 0x2e, 0xb8, 0x6a, 0x64, 0x77, 0x75, 0xe1, 0x28, 0x2c, 0x30, 0xc9, 0x47, 0x38,
-	0xe8, 0x37, 0x56, 0x6d, 0xac, 0xa1, 0x73, 0x2f, 0xf2, 0xe6, 0x5e, 0x22, 0xe7, 0x9e, 0xc3, 0xb6,
-	0x5c, 0x27, 0xc3, 0x85, 0x95, 0x7d, 0x67, 0x68, 0x7a, 0x1f, 0x99, 0x73, 0x2d, 0x6a, 0xae, 0xcb,
-	0xf7, 0x9e, 0xc3, 0xb6, 0xdc, 0xfc, 0x15, 0x3c, 0xdd, 0x13, 0x96, 0x3c, 0x86, 0xb8, 0xab, 0xfc,
-	0x86, 0x16, 0x2c, 0xee, 0xaa, 0xfc, 0x12, 0x8e, 0xf7, 0xc5, 0x71, 0x2b, 0x12, 0xed, 0x26, 0x34,
-	0xba, 0xd2, 0x21, 0xa8, 0xd6, 0x61, 0x8f, 0xae, 0x24, 0x2f, 0x01, 0x84, 0x54, 0x35, 0x6a, 0x8b,
-	0x83, 0x0d, 0x47, 0x71, 0x03, 0xc9, 0x7f, 0x45, 0x93, 0xf8, 0x4e, 0x48, 0xf2, 0x02, 0x0e, 0xbb,
-	0x4d, 0xd3, 0xc8, 0x4a, 0xa2, 0x0e, 0x16, 0xff, 0x81, 0xd1, 0x7a, 0xd8, 0x1a, 0x89, 0x76, 0x70,
-	0x37, 0x8b, 0xaa, 0xc6, 0x16, 0x35, 0x6f, 0x3e, 0xe3, 0xcf, 0x60, 0xb5, 0x83, 0xdd, 0x0a, 0x93,
-	0xdc, 0x0e, 0xb3, 0x7a, 0x7e, 0x79, 0xda, 0xb8, 0x23, 0x1e, 0x97, 0x58, 0xbe, 0x1d, 0x5f, 0xad,
-	0xc4, 0x9f, 0xf8, 0xc1, 0xf7, 0xd4, 0x9f, 0xff, 0xbb, 0x7f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xf6,
-	0x79, 0x69, 0x05, 0x5c, 0x03, 0x00, 0x00,
+	// 562 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x5f, 0x6f, 0xd3, 0x3e,
+	0x14, 0xfd, 0x25, 0xcd, 0xba, 0xcd, 0x6b, 0x7f, 0x42, 0x66, 0x9b, 0xcc, 0x1f, 0xa1, 0x28, 0x02,
+	0x29, 0x02, 0x29, 0x48, 0xe3, 0x95, 0x17, 0x3a, 0x21, 0x21, 0x10, 0x9a, 0xe4, 0x4e, 0x3c, 0xec,
+	0x05, 0x79, 0xce, 0xed, 0x62, 0x35, 0xb1, 0x8d, 0xe3, 0x8c, 0xc0, 0x47, 0x80, 0xcf, 0xc3, 0x0b,
+	0x9f, 0x8d, 0x07, 0x64, 0x27, 0xed, 0x5a, 0x68, 0xd1, 0x9e, 0x72, 0xef, 0xd1, 0x3d, 0xf7, 0xde,
+	0x73, 0x62, 0x1b, 0x1d, 0x71, 0x55, 0x69, 0xc6, 0xed, 0xc7, 0x99, 0x32, 0x15, 0xb3, 0x75, 0xa6,
+	0x8d, 0xb2, 0x0a, 0x1f, 0x69, 0x61, 0x98, 0x85, 0xec, 0x33, 0x2b, 0x4b, 0xb0, 0x59, 0x9d, 0xcf,
+	0x33, 0xa3, 0x79, 0xf2, 0x2b, 0x44, 0xa3, 0xd3, 0x8e, 0x30, 0x29, 0x15, 0x9f, 0xe3, 0x04, 0x8d,
+	0x3c, 0xe1, 0x03, 0x98, 0x5a, 0x28, 0x49, 0x82, 0x38, 0x48, 0xc7, 0x74, 0x0d, 0xc3, 0xc7, 0x68,
+	0x58, 0x80, 0xb8, 0x2a, 0x2c, 0x09, 0xe3, 0x20, 0x8d, 0x68, 0x9f, 0x61, 0x8c, 0xa2, 0x82, 0xd5,
+	0x05, 0x19, 0xc4, 0x41, 0x3a, 0xa2, 0x3e, 0xc6, 0xf7, 0xd1, 0x9e, 0x36, 0x70, 0xfd, 0xc6, 0xe1,
+	0x91, 0xc7, 0x97, 0xb9, 0xab, 0xb7, 0xa2, 0x02, 0xb2, 0xe3, 0x67, 0xf8, 0xb8, 0xeb, 0xcd, 0x72,
+	0x30, 0x64, 0xe8, 0xab, 0xfb, 0x0c, 0x9f, 0xa0, 0xc1, 0xb5, 0x6d, 0xc9, 0x6e, 0x3c, 0x48, 0x0f,
+	0x4e, 0xe2, 0x6c, 0xa3, 0x9a, 0xac, 0x57, 0x72, 0xde, 0x52, 0x57, 0x8c, 0x1f, 0xa2, 0x7d, 0xae,
+	0xa4, 0x15, 0xb2, 0x81, 0x9c, 0xec, 0xc5, 0x41, 0xba, 0x47, 0x6f, 0x00, 0xb7, 0x59, 0x0d, 0x9f,
+	0x1a, 0x90, 0x1c, 0xc8, 0xbe, 0xd7, 0xb1, 0xcc, 0xf1, 0x5b, 0x34, 0xe6, 0x05, 0x13, 0xf2, 0x3d,
+	0x58, 0x96, 0x33, 0xcb, 0x08, 0x8a, 0x83, 0xf4, 0xe0, 0xe4, 0xf1, 0xb6, 0xb9, 0xab, 0xb5, 0x74,
+	0x9d, 0xea, 0xe6, 0x28, 0xa3, 0x0b, 0x26, 0x21, 0x27, 0x07, 0x7e, 0x89, 0x65, 0x9e, 0xfc, 0x08,
+	0xd1, 0xfe, 0x72, 0x69, 0x7c, 0x88, 0x76, 0x84, 0xcc, 0xa1, 0xf5, 0xa6, 0x47, 0xb4, 0x4b, 0x96,
+	0xae, 0x86, 0x2b, 0xae, 0xde, 0x41, 0x83, 0x19, 0x80, 0x37, 0x7a, 0x4c, 0x5d, 0x88, 0x27, 0x68,
+	0x58, 0x6b, 0x90, 0x79, 0x4d, 0x22, 0x6f, 0xd1, 0xd3, 0x7f, 0x5b, 0x34, 0x65, 0xba, 0x14, 0xf2,
+	0x6a, 0xea, 0x28, 0xb4, 0x67, 0xe2, 0xd7, 0x68, 0x57, 0x35, 0x56, 0x37, 0xb6, 0x26, 0x3b, 0xbe,
+	0xc9, 0xb3, 0x5b, 0x35, 0x39, 0xf3, 0x1c, 0xba, 0xe0, 0xba, 0x36, 0x8c, 0x5b, 0xa1, 0x64, 0x4d,
+	0x86, 0xb7, 0x69, 0x73, 0x66, 0x78, 0xc1, 0x4c, 0xfe, 0xca, 0x73, 0xe8, 0x82, 0xeb, 0x7c, 0xe3,
+	0x4a, 0xc8, 0x4b, 0x56, 0x03, 0xd9, 0xed, 0x7c, 0x5b, 0xe4, 0xc9, 0x13, 0x74, 0x77, 0x83, 0x10,
+	0xfc, 0x3f, 0x0a, 0xe5, 0xcc, 0xbb, 0x37, 0xa2, 0xa1, 0x9c, 0x25, 0x17, 0xe8, 0x70, 0xd3, 0xaa,
+	0xce, 0x3e, 0x5e, 0x35, 0x7d, 0xa1, 0x0b, 0x1d, 0x02, 0x7a, 0xde, 0x7b, 0xec, 0x42, 0xfc, 0x08,
+	0x21, 0x2e, 0x74, 0x01, 0xc6, 0x42, 0x6b, 0xfb, 0x23, 0xbd, 0x82, 0x24, 0xdf, 0x02, 0x74, 0xb8,
+	0x49, 0x80, 0x3b, 0x75, 0xb2, 0x29, 0x4b, 0x31, 0x13, 0x60, 0xfa, 0x11, 0x37, 0x40, 0x37, 0xba,
+	0x5d, 0x0c, 0xe2, 0x55, 0xeb, 0x6e, 0x1c, 0xe8, 0x02, 0x2a, 0x30, 0xac, 0x7c, 0x07, 0x5f, 0xfa,
+	0x51, 0x6b, 0xd8, 0x1f, 0xcb, 0x44, 0x7f, 0x2d, 0xf3, 0x3d, 0x40, 0xe3, 0xb5, 0x43, 0x88, 0x5f,
+	0xa2, 0x7b, 0x75, 0xa7, 0xf9, 0x54, 0x55, 0x95, 0xb0, 0x15, 0x48, 0x7b, 0x6e, 0x00, 0xa6, 0xe2,
+	0x2b, 0xf4, 0x97, 0x7a, 0x7b, 0x81, 0x63, 0xab, 0x4e, 0xd4, 0x06, 0x76, 0xd8, 0xb1, 0xb7, 0x16,
+	0x4c, 0x1e, 0x5c, 0x1c, 0x97, 0xee, 0x41, 0xe8, 0x7e, 0x77, 0xfe, 0xbc, 0xfb, 0x1a, 0xcd, 0x7f,
+	0x86, 0xff, 0x5d, 0x0e, 0xfd, 0x53, 0xf2, 0xe2, 0xf7, 0x00, 0x31, 0x94, 0x1e, 0xe8, 0xa8, 0x04,
+	0x00, 0x00,
 }
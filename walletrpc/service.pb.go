@@ -36,6 +36,24 @@ It has these top-level messages:
 	GetAddressUtxosReplyList
 	PriceRequest
 	PriceResponse
+	TreeStateRange
+	ChainStats
+	TxConstructionParams
+	GetMempoolStreamArg
+	CheckTransactionResponse
+	AddressClassification
+	BloomFilter
+	ConfigSetting
+	ServerConfig
+	TransparentInput
+	TransparentOutput
+	ExtendedTx
+	ExtendedBlock
+	BlockHash
+	RawRPCRequest
+	RawRPCReply
+	ServerCapabilities
+	ShieldedStats
 */
 package walletrpc
 
@@ -55,7 +73,9 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 // A BlockID message contains identifiers to select a block: a height or a
-// hash. Specification by hash is not implemented, but may be in the future.
+// hash. The hash is in the internal byte order of CompactBlock.hash (the
+// reverse of the order pirated shows), for GetBlock, GetBlockRange and
+// GetTreeState alike, as GetLatestBlock returns it.
 type BlockID struct {
 	Height uint64 `protobuf:"varint,1,opt,name=height" json:"height,omitempty"`
 	Hash   []byte `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
@@ -81,10 +101,20 @@ func (m *BlockID) GetHash() []byte {
 }
 
 // BlockRange specifies a series of blocks from start to end inclusive.
-// Both BlockIDs must be heights; specification by hash is not yet supported.
+// The end must be a height; the start may be a hash (see below).
+// If start is greater than end, the blocks are sent in descending order;
+// but start == end+1 is the empty range (as requested by a wallet that has
+// already synced to end), which replies with no blocks.
 type BlockRange struct {
-	Start *BlockID `protobuf:"bytes,1,opt,name=start" json:"start,omitempty"`
-	End   *BlockID `protobuf:"bytes,2,opt,name=end" json:"end,omitempty"`
+	// If start has a hash, the range resumes after the block with that hash
+	// (ascending only), and its height is ignored.
+	Start           *BlockID     `protobuf:"bytes,1,opt,name=start" json:"start,omitempty"`
+	End             *BlockID     `protobuf:"bytes,2,opt,name=end" json:"end,omitempty"`
+	OmitCiphertext  bool         `protobuf:"varint,3,opt,name=omitCiphertext" json:"omitCiphertext,omitempty"`
+	SequenceNumbers bool         `protobuf:"varint,4,opt,name=sequenceNumbers" json:"sequenceNumbers,omitempty"`
+	Filter          *BloomFilter `protobuf:"bytes,5,opt,name=filter" json:"filter,omitempty"`
+	// omit the transactions these shortened txids select, as for GetMempoolTx (decided within each block)
+	Exclude [][]byte `protobuf:"bytes,6,rep,name=exclude" json:"exclude,omitempty"`
 }
 
 func (m *BlockRange) Reset()                    { *m = BlockRange{} }
@@ -106,6 +136,34 @@ func (m *BlockRange) GetEnd() *BlockID {
 	return nil
 }
 
+func (m *BlockRange) GetOmitCiphertext() bool {
+	if m != nil {
+		return m.OmitCiphertext
+	}
+	return false
+}
+
+func (m *BlockRange) GetSequenceNumbers() bool {
+	if m != nil {
+		return m.SequenceNumbers
+	}
+	return false
+}
+
+func (m *BlockRange) GetFilter() *BloomFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+func (m *BlockRange) GetExclude() [][]byte {
+	if m != nil {
+		return m.Exclude
+	}
+	return nil
+}
+
 // A TxFilter contains the information needed to identify a particular
 // transaction: either a block and an index, or a direct transaction hash.
 // Currently, only specification by hash is supported.
@@ -143,10 +201,12 @@ func (m *TxFilter) GetHash() []byte {
 
 // RawTransaction contains the complete transaction data. It also optionally includes
 // the block height in which the transaction was included, or, when returned
-// by GetMempoolStream(), the latest block height.
+// by GetMempoolStream(), the latest block height and a sequence number.
 type RawTransaction struct {
-	Data   []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
-	Height uint64 `protobuf:"varint,2,opt,name=height" json:"height,omitempty"`
+	Data        []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Height      uint64 `protobuf:"varint,2,opt,name=height" json:"height,omitempty"`
+	Sequence    uint64 `protobuf:"varint,3,opt,name=sequence" json:"sequence,omitempty"`
+	CursorReset bool   `protobuf:"varint,4,opt,name=cursorReset" json:"cursorReset,omitempty"`
 }
 
 func (m *RawTransaction) Reset()                    { *m = RawTransaction{} }
@@ -168,12 +228,29 @@ func (m *RawTransaction) GetHeight() uint64 {
 	return 0
 }
 
+func (m *RawTransaction) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *RawTransaction) GetCursorReset() bool {
+	if m != nil {
+		return m.CursorReset
+	}
+	return false
+}
+
 // A SendResponse encodes an error code and a string. It is currently used
 // only by SendTransaction(). If error code is zero, the operation was
 // successful; if non-zero, it and the message specify the failure.
 type SendResponse struct {
 	ErrorCode    int32  `protobuf:"varint,1,opt,name=errorCode" json:"errorCode,omitempty"`
 	ErrorMessage string `protobuf:"bytes,2,opt,name=errorMessage" json:"errorMessage,omitempty"`
+	// Only if the server waits for a sent transaction to reach pirated's
+	// mempool: "in_mempool", or "not_seen" (a warning; it may yet arrive).
+	MempoolStatus string `protobuf:"bytes,3,opt,name=mempoolStatus" json:"mempoolStatus,omitempty"`
 }
 
 func (m *SendResponse) Reset()                    { *m = SendResponse{} }
@@ -195,6 +272,13 @@ func (m *SendResponse) GetErrorMessage() string {
 	return ""
 }
 
+func (m *SendResponse) GetMempoolStatus() string {
+	if m != nil {
+		return m.MempoolStatus
+	}
+	return ""
+}
+
 // Chainspec is a placeholder to allow specification of a particular chain fork.
 type ChainSpec struct {
 }
@@ -230,6 +314,23 @@ type LightdInfo struct {
 	EstimatedHeight         uint64 `protobuf:"varint,12,opt,name=estimatedHeight" json:"estimatedHeight,omitempty"`
 	PiratedBuild            string `protobuf:"bytes,13,opt,name=piratedBuild" json:"piratedBuild,omitempty"`
 	PiratedSubversion       string `protobuf:"bytes,14,opt,name=piratedSubversion" json:"piratedSubversion,omitempty"`
+	TreeStateBridgeSupport  bool   `protobuf:"varint,15,opt,name=treeStateBridgeSupport" json:"treeStateBridgeSupport,omitempty"`
+	MinProtocolVersion      uint32 `protobuf:"varint,16,opt,name=minProtocolVersion" json:"minProtocolVersion,omitempty"`
+	MaxProtocolVersion      uint32 `protobuf:"varint,17,opt,name=maxProtocolVersion" json:"maxProtocolVersion,omitempty"`
+	// informational, set by the server's operator
+	Extra map[string]string `protobuf:"bytes,18,rep,name=extra" json:"extra,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// GetBlockRange serves no blocks below this height (0 if it serves all)
+	DeepHistoryHeight uint64 `protobuf:"varint,19,opt,name=deepHistoryHeight" json:"deepHistoryHeight,omitempty"`
+	// pirated is unreachable, so this (and cached data) may be stale
+	Degraded bool `protobuf:"varint,20,opt,name=degraded" json:"degraded,omitempty"`
+	// how long pirated has been unreachable, if degraded
+	StaleSeconds uint64 `protobuf:"varint,21,opt,name=staleSeconds" json:"staleSeconds,omitempty"`
+	// the next network upgrade to activate, if one is scheduled
+	NextUpgradeName string `protobuf:"bytes,22,opt,name=nextUpgradeName" json:"nextUpgradeName,omitempty"`
+	// its activation height
+	NextUpgradeHeight uint64 `protobuf:"varint,23,opt,name=nextUpgradeHeight" json:"nextUpgradeHeight,omitempty"`
+	// the tip is within the warning window of it; wallets should prompt to update
+	UpgradeImminent bool `protobuf:"varint,24,opt,name=upgradeImminent" json:"upgradeImminent,omitempty"`
 }
 
 func (m *LightdInfo) Reset()                    { *m = LightdInfo{} }
@@ -335,6 +436,76 @@ func (m *LightdInfo) GetPiratedSubversion() string {
 	return ""
 }
 
+func (m *LightdInfo) GetTreeStateBridgeSupport() bool {
+	if m != nil {
+		return m.TreeStateBridgeSupport
+	}
+	return false
+}
+
+func (m *LightdInfo) GetMinProtocolVersion() uint32 {
+	if m != nil {
+		return m.MinProtocolVersion
+	}
+	return 0
+}
+
+func (m *LightdInfo) GetMaxProtocolVersion() uint32 {
+	if m != nil {
+		return m.MaxProtocolVersion
+	}
+	return 0
+}
+
+func (m *LightdInfo) GetExtra() map[string]string {
+	if m != nil {
+		return m.Extra
+	}
+	return nil
+}
+
+func (m *LightdInfo) GetDeepHistoryHeight() uint64 {
+	if m != nil {
+		return m.DeepHistoryHeight
+	}
+	return 0
+}
+
+func (m *LightdInfo) GetDegraded() bool {
+	if m != nil {
+		return m.Degraded
+	}
+	return false
+}
+
+func (m *LightdInfo) GetStaleSeconds() uint64 {
+	if m != nil {
+		return m.StaleSeconds
+	}
+	return 0
+}
+
+func (m *LightdInfo) GetNextUpgradeName() string {
+	if m != nil {
+		return m.NextUpgradeName
+	}
+	return ""
+}
+
+func (m *LightdInfo) GetNextUpgradeHeight() uint64 {
+	if m != nil {
+		return m.NextUpgradeHeight
+	}
+	return 0
+}
+
+func (m *LightdInfo) GetUpgradeImminent() bool {
+	if m != nil {
+		return m.UpgradeImminent
+	}
+	return false
+}
+
 // TransparentAddressBlockFilter restricts the results to the given address
 // or block range.
 type TransparentAddressBlockFilter struct {
@@ -479,6 +650,9 @@ type TreeState struct {
 	Time        uint32 `protobuf:"varint,4,opt,name=time" json:"time,omitempty"`
 	SaplingTree string `protobuf:"bytes,5,opt,name=saplingTree" json:"saplingTree,omitempty"`
 	OrchardTree string `protobuf:"bytes,6,opt,name=orchardTree" json:"orchardTree,omitempty"`
+	SproutTree  string `protobuf:"bytes,7,opt,name=sproutTree" json:"sproutTree,omitempty"`
+	SaplingRoot string `protobuf:"bytes,8,opt,name=saplingRoot" json:"saplingRoot,omitempty"`
+	OrchardRoot string `protobuf:"bytes,9,opt,name=orchardRoot" json:"orchardRoot,omitempty"`
 }
 
 func (m *TreeState) Reset()                    { *m = TreeState{} }
@@ -528,12 +702,35 @@ func (m *TreeState) GetOrchardTree() string {
 	return ""
 }
 
+func (m *TreeState) GetSproutTree() string {
+	if m != nil {
+		return m.SproutTree
+	}
+	return ""
+}
+
+func (m *TreeState) GetSaplingRoot() string {
+	if m != nil {
+		return m.SaplingRoot
+	}
+	return ""
+}
+
+func (m *TreeState) GetOrchardRoot() string {
+	if m != nil {
+		return m.OrchardRoot
+	}
+	return ""
+}
+
 // Results are sorted by height, which makes it easy to issue another
 // request that picks up from where the previous left off.
 type GetAddressUtxosArg struct {
 	Addresses   []string `protobuf:"bytes,1,rep,name=addresses" json:"addresses,omitempty"`
 	StartHeight uint64   `protobuf:"varint,2,opt,name=startHeight" json:"startHeight,omitempty"`
 	MaxEntries  uint32   `protobuf:"varint,3,opt,name=maxEntries" json:"maxEntries,omitempty"`
+	// omit UTXOs with fewer confirmations (a UTXO in the tip block has one)
+	MinConfirmations int32 `protobuf:"varint,4,opt,name=minConfirmations" json:"minConfirmations,omitempty"`
 }
 
 func (m *GetAddressUtxosArg) Reset()                    { *m = GetAddressUtxosArg{} }
@@ -562,6 +759,13 @@ func (m *GetAddressUtxosArg) GetMaxEntries() uint32 {
 	return 0
 }
 
+func (m *GetAddressUtxosArg) GetMinConfirmations() int32 {
+	if m != nil {
+		return m.MinConfirmations
+	}
+	return 0
+}
+
 type GetAddressUtxosReply struct {
 	Address  string `protobuf:"bytes,6,opt,name=address" json:"address,omitempty"`
 	Txid     []byte `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
@@ -696,6 +900,719 @@ func (m *PriceResponse) GetPrice() float64 {
 	return 0
 }
 
+// TreeStateRange selects the tree states at every step-th height from
+// startHeight to endHeight inclusive.
+type TreeStateRange struct {
+	StartHeight uint64 `protobuf:"varint,1,opt,name=startHeight" json:"startHeight,omitempty"`
+	EndHeight   uint64 `protobuf:"varint,2,opt,name=endHeight" json:"endHeight,omitempty"`
+	Step        uint32 `protobuf:"varint,3,opt,name=step" json:"step,omitempty"`
+}
+
+func (m *TreeStateRange) Reset()                    { *m = TreeStateRange{} }
+func (m *TreeStateRange) String() string            { return proto.CompactTextString(m) }
+func (*TreeStateRange) ProtoMessage()               {}
+func (*TreeStateRange) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{21} }
+
+func (m *TreeStateRange) GetStartHeight() uint64 {
+	if m != nil {
+		return m.StartHeight
+	}
+	return 0
+}
+
+func (m *TreeStateRange) GetEndHeight() uint64 {
+	if m != nil {
+		return m.EndHeight
+	}
+	return 0
+}
+
+func (m *TreeStateRange) GetStep() uint32 {
+	if m != nil {
+		return m.Step
+	}
+	return 0
+}
+
+// ChainStats contains chain-level statistics, for block explorers.
+type ChainStats struct {
+	Height        uint64  `protobuf:"varint,1,opt,name=height" json:"height,omitempty"`
+	Difficulty    float64 `protobuf:"fixed64,2,opt,name=difficulty" json:"difficulty,omitempty"`
+	Transactions  uint64  `protobuf:"varint,3,opt,name=transactions" json:"transactions,omitempty"`
+	CoinSupplyZat int64   `protobuf:"varint,4,opt,name=coinSupplyZat" json:"coinSupplyZat,omitempty"`
+}
+
+func (m *ChainStats) Reset()                    { *m = ChainStats{} }
+func (m *ChainStats) String() string            { return proto.CompactTextString(m) }
+func (*ChainStats) ProtoMessage()               {}
+func (*ChainStats) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{22} }
+
+func (m *ChainStats) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *ChainStats) GetDifficulty() float64 {
+	if m != nil {
+		return m.Difficulty
+	}
+	return 0
+}
+
+func (m *ChainStats) GetTransactions() uint64 {
+	if m != nil {
+		return m.Transactions
+	}
+	return 0
+}
+
+func (m *ChainStats) GetCoinSupplyZat() int64 {
+	if m != nil {
+		return m.CoinSupplyZat
+	}
+	return 0
+}
+
+// TxConstructionParams contains what a wallet needs to build a transaction
+// that is valid for the next block.
+type TxConstructionParams struct {
+	ConsensusBranchId string `protobuf:"bytes,1,opt,name=consensusBranchId" json:"consensusBranchId,omitempty"`
+	ExpiryDelta       uint32 `protobuf:"varint,2,opt,name=expiryDelta" json:"expiryDelta,omitempty"`
+	Height            uint64 `protobuf:"varint,3,opt,name=height" json:"height,omitempty"`
+}
+
+func (m *TxConstructionParams) Reset()         { *m = TxConstructionParams{} }
+func (m *TxConstructionParams) String() string { return proto.CompactTextString(m) }
+func (*TxConstructionParams) ProtoMessage()    {}
+func (*TxConstructionParams) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDesc, []int{23}
+}
+
+func (m *TxConstructionParams) GetConsensusBranchId() string {
+	if m != nil {
+		return m.ConsensusBranchId
+	}
+	return ""
+}
+
+func (m *TxConstructionParams) GetExpiryDelta() uint32 {
+	if m != nil {
+		return m.ExpiryDelta
+	}
+	return 0
+}
+
+func (m *TxConstructionParams) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+// GetMempoolStreamArg allows a client that reconnects to GetMempoolStream()
+// to receive only the transactions it hasn't already received.
+type GetMempoolStreamArg struct {
+	Cursor uint64 `protobuf:"varint,1,opt,name=cursor" json:"cursor,omitempty"`
+}
+
+func (m *GetMempoolStreamArg) Reset()         { *m = GetMempoolStreamArg{} }
+func (m *GetMempoolStreamArg) String() string { return proto.CompactTextString(m) }
+func (*GetMempoolStreamArg) ProtoMessage()    {}
+func (*GetMempoolStreamArg) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDesc, []int{24}
+}
+
+func (m *GetMempoolStreamArg) GetCursor() uint64 {
+	if m != nil {
+		return m.Cursor
+	}
+	return 0
+}
+
+// CheckTransactionResponse reports whether the node would accept a
+// transaction into its mempool (without broadcasting it).
+type CheckTransactionResponse struct {
+	Accepted bool   `protobuf:"varint,1,opt,name=accepted" json:"accepted,omitempty"`
+	Reason   string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *CheckTransactionResponse) Reset()         { *m = CheckTransactionResponse{} }
+func (m *CheckTransactionResponse) String() string { return proto.CompactTextString(m) }
+func (*CheckTransactionResponse) ProtoMessage()    {}
+func (*CheckTransactionResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDesc, []int{25}
+}
+
+func (m *CheckTransactionResponse) GetAccepted() bool {
+	if m != nil {
+		return m.Accepted
+	}
+	return false
+}
+
+func (m *CheckTransactionResponse) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+// AddressClassification is the type of an address, and the network it
+// belongs to, as determined by the node.
+type AddressClassification struct {
+	Valid   bool   `protobuf:"varint,1,opt,name=valid" json:"valid,omitempty"`
+	Type    string `protobuf:"bytes,2,opt,name=type" json:"type,omitempty"`
+	Network string `protobuf:"bytes,3,opt,name=network" json:"network,omitempty"`
+}
+
+func (m *AddressClassification) Reset()         { *m = AddressClassification{} }
+func (m *AddressClassification) String() string { return proto.CompactTextString(m) }
+func (*AddressClassification) ProtoMessage()    {}
+func (*AddressClassification) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDesc, []int{26}
+}
+
+func (m *AddressClassification) GetValid() bool {
+	if m != nil {
+		return m.Valid
+	}
+	return false
+}
+
+func (m *AddressClassification) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *AddressClassification) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
+// A BloomFilter (as in BIP 37) lets a wallet receive only the transactions
+// that spend or create notes it knows about. A transaction matches if any of
+// its Sapling spend nullifiers, Sapling output commitments (cmu), Orchard
+// action nullifiers, or Orchard note commitments (cmx) is in the filter;
+// non-matching transactions are omitted from each CompactBlock (false
+// positives are possible, but a match is never omitted). Since a wallet can't
+// know the commitments of notes it hasn't yet received, a filter can't be
+// used to discover new incoming notes. Each element is hashed with
+// MurmurHash3 (x86, 32-bit) using the seed i*0xFBA4C795+tweak for i in
+// [0, hashFunctions), and the hash modulo the number of bits selects bit
+// (hash%8) of byte (hash/8) of data.
+type BloomFilter struct {
+	Data          []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	HashFunctions uint32 `protobuf:"varint,2,opt,name=hashFunctions" json:"hashFunctions,omitempty"`
+	Tweak         uint32 `protobuf:"varint,3,opt,name=tweak" json:"tweak,omitempty"`
+}
+
+func (m *BloomFilter) Reset()                    { *m = BloomFilter{} }
+func (m *BloomFilter) String() string            { return proto.CompactTextString(m) }
+func (*BloomFilter) ProtoMessage()               {}
+func (*BloomFilter) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{27} }
+
+func (m *BloomFilter) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *BloomFilter) GetHashFunctions() uint32 {
+	if m != nil {
+		return m.HashFunctions
+	}
+	return 0
+}
+
+func (m *BloomFilter) GetTweak() uint32 {
+	if m != nil {
+		return m.Tweak
+	}
+	return 0
+}
+
+// ConfigSetting is one setting of the server's configuration.
+type ConfigSetting struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *ConfigSetting) Reset()                    { *m = ConfigSetting{} }
+func (m *ConfigSetting) String() string            { return proto.CompactTextString(m) }
+func (*ConfigSetting) ProtoMessage()               {}
+func (*ConfigSetting) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{28} }
+
+func (m *ConfigSetting) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ConfigSetting) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+// ServerConfig is the server's effective configuration, with secrets (such
+// as the pirated rpc password) redacted.
+type ServerConfig struct {
+	ChainName string           `protobuf:"bytes,1,opt,name=chainName" json:"chainName,omitempty"`
+	Version   string           `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	Settings  []*ConfigSetting `protobuf:"bytes,3,rep,name=settings" json:"settings,omitempty"`
+}
+
+func (m *ServerConfig) Reset()                    { *m = ServerConfig{} }
+func (m *ServerConfig) String() string            { return proto.CompactTextString(m) }
+func (*ServerConfig) ProtoMessage()               {}
+func (*ServerConfig) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{29} }
+
+func (m *ServerConfig) GetChainName() string {
+	if m != nil {
+		return m.ChainName
+	}
+	return ""
+}
+
+func (m *ServerConfig) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *ServerConfig) GetSettings() []*ConfigSetting {
+	if m != nil {
+		return m.Settings
+	}
+	return nil
+}
+
+// TransparentInput summarizes a transparent input: the output it spends,
+// and (unless it's a coinbase input) that output's address and value.
+type TransparentInput struct {
+	PrevTxid  []byte `protobuf:"bytes,1,opt,name=prevTxid,proto3" json:"prevTxid,omitempty"`
+	PrevIndex uint32 `protobuf:"varint,2,opt,name=prevIndex,proto3" json:"prevIndex,omitempty"`
+	Address   string `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	ValueZat  uint64 `protobuf:"varint,4,opt,name=valueZat,proto3" json:"valueZat,omitempty"`
+}
+
+func (m *TransparentInput) Reset()                    { *m = TransparentInput{} }
+func (m *TransparentInput) String() string            { return proto.CompactTextString(m) }
+func (*TransparentInput) ProtoMessage()               {}
+func (*TransparentInput) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{30} }
+
+func (m *TransparentInput) GetPrevTxid() []byte {
+	if m != nil {
+		return m.PrevTxid
+	}
+	return nil
+}
+
+func (m *TransparentInput) GetPrevIndex() uint32 {
+	if m != nil {
+		return m.PrevIndex
+	}
+	return 0
+}
+
+func (m *TransparentInput) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *TransparentInput) GetValueZat() uint64 {
+	if m != nil {
+		return m.ValueZat
+	}
+	return 0
+}
+
+// TransparentOutput summarizes a transparent output.
+type TransparentOutput struct {
+	ValueZat uint64 `protobuf:"varint,1,opt,name=valueZat,proto3" json:"valueZat,omitempty"`
+	Script   []byte `protobuf:"bytes,2,opt,name=script,proto3" json:"script,omitempty"`
+	Address  string `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+}
+
+func (m *TransparentOutput) Reset()                    { *m = TransparentOutput{} }
+func (m *TransparentOutput) String() string            { return proto.CompactTextString(m) }
+func (*TransparentOutput) ProtoMessage()               {}
+func (*TransparentOutput) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{31} }
+
+func (m *TransparentOutput) GetValueZat() uint64 {
+	if m != nil {
+		return m.ValueZat
+	}
+	return 0
+}
+
+func (m *TransparentOutput) GetScript() []byte {
+	if m != nil {
+		return m.Script
+	}
+	return nil
+}
+
+func (m *TransparentOutput) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+// ExtendedTx is the transparent part of a transaction.
+type ExtendedTx struct {
+	Index uint64               `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Hash  []byte               `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	Vin   []*TransparentInput  `protobuf:"bytes,3,rep,name=vin" json:"vin,omitempty"`
+	Vout  []*TransparentOutput `protobuf:"bytes,4,rep,name=vout" json:"vout,omitempty"`
+}
+
+func (m *ExtendedTx) Reset()                    { *m = ExtendedTx{} }
+func (m *ExtendedTx) String() string            { return proto.CompactTextString(m) }
+func (*ExtendedTx) ProtoMessage()               {}
+func (*ExtendedTx) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{32} }
+
+func (m *ExtendedTx) GetIndex() uint64 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *ExtendedTx) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *ExtendedTx) GetVin() []*TransparentInput {
+	if m != nil {
+		return m.Vin
+	}
+	return nil
+}
+
+func (m *ExtendedTx) GetVout() []*TransparentOutput {
+	if m != nil {
+		return m.Vout
+	}
+	return nil
+}
+
+// ExtendedBlock is a compact block, with the transparent inputs and outputs
+// of its transactions (for explorers).
+type ExtendedBlock struct {
+	Block          *CompactBlock `protobuf:"bytes,1,opt,name=block" json:"block,omitempty"`
+	TransparentTxs []*ExtendedTx `protobuf:"bytes,2,rep,name=transparentTxs" json:"transparentTxs,omitempty"`
+}
+
+func (m *ExtendedBlock) Reset()                    { *m = ExtendedBlock{} }
+func (m *ExtendedBlock) String() string            { return proto.CompactTextString(m) }
+func (*ExtendedBlock) ProtoMessage()               {}
+func (*ExtendedBlock) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{33} }
+
+func (m *ExtendedBlock) GetBlock() *CompactBlock {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+func (m *ExtendedBlock) GetTransparentTxs() []*ExtendedTx {
+	if m != nil {
+		return m.TransparentTxs
+	}
+	return nil
+}
+
+// BlockHash is just the hash of a block, little-endian, as in BlockID.
+type BlockHash struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *BlockHash) Reset()                    { *m = BlockHash{} }
+func (m *BlockHash) String() string            { return proto.CompactTextString(m) }
+func (*BlockHash) ProtoMessage()               {}
+func (*BlockHash) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{34} }
+
+func (m *BlockHash) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+// RawRPCRequest is a pirated rpc, for the RawPiratedRPC admin rpc.
+type RawRPCRequest struct {
+	// such as "getblockchaininfo"
+	Method string `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	// each one JSON, such as "123" or "\"abc\""
+	Params []string `protobuf:"bytes,2,rep,name=params" json:"params,omitempty"`
+}
+
+func (m *RawRPCRequest) Reset()                    { *m = RawRPCRequest{} }
+func (m *RawRPCRequest) String() string            { return proto.CompactTextString(m) }
+func (*RawRPCRequest) ProtoMessage()               {}
+func (*RawRPCRequest) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{35} }
+
+func (m *RawRPCRequest) GetMethod() string {
+	if m != nil {
+		return m.Method
+	}
+	return ""
+}
+
+func (m *RawRPCRequest) GetParams() []string {
+	if m != nil {
+		return m.Params
+	}
+	return nil
+}
+
+// RawRPCReply is the (JSON) result of a pirated rpc.
+type RawRPCReply struct {
+	Result string `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+}
+
+func (m *RawRPCReply) Reset()                    { *m = RawRPCReply{} }
+func (m *RawRPCReply) String() string            { return proto.CompactTextString(m) }
+func (*RawRPCReply) ProtoMessage()               {}
+func (*RawRPCReply) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{36} }
+
+func (m *RawRPCReply) GetResult() string {
+	if m != nil {
+		return m.Result
+	}
+	return ""
+}
+
+// ServerCapabilities describes the optional features this lightwalletd
+// supports, as it's configured, and its limits (zero means unlimited), so
+// that a wallet can adapt to it.
+type ServerCapabilities struct {
+	// oldest client protocol version accepted
+	MinProtocolVersion uint32 `protobuf:"varint,1,opt,name=minProtocolVersion,proto3" json:"minProtocolVersion,omitempty"`
+	// current (newest) protocol version
+	MaxProtocolVersion uint32 `protobuf:"varint,2,opt,name=maxProtocolVersion,proto3" json:"maxProtocolVersion,omitempty"`
+	// GetBlockExtended is enabled
+	BlockExtended bool `protobuf:"varint,3,opt,name=blockExtended,proto3" json:"blockExtended,omitempty"`
+	// tree states include the bridge (Orchard) format
+	TreeStateBridge bool `protobuf:"varint,4,opt,name=treeStateBridge,proto3" json:"treeStateBridge,omitempty"`
+	// tree states are indexed (GetTreeState needn't ask pirated)
+	TreeStateIndex bool `protobuf:"varint,5,opt,name=treeStateIndex,proto3" json:"treeStateIndex,omitempty"`
+	// GetTransaction serves unconfirmed transactions
+	MempoolLookup bool `protobuf:"varint,6,opt,name=mempoolLookup,proto3" json:"mempoolLookup,omitempty"`
+	// no blocks are served below Sapling activation
+	SaplingOnly bool `protobuf:"varint,7,opt,name=saplingOnly,proto3" json:"saplingOnly,omitempty"`
+	// the (testing-only) Ping rpc is enabled
+	Ping bool `protobuf:"varint,8,opt,name=ping,proto3" json:"ping,omitempty"`
+	// GetBlockRange serves no blocks below this height
+	DeepHistoryHeight uint64 `protobuf:"varint,9,opt,name=deepHistoryHeight,proto3" json:"deepHistoryHeight,omitempty"`
+	// GetBlockRange splits blocks with more shielded elements
+	MaxBlockElements uint32 `protobuf:"varint,10,opt,name=maxBlockElements,proto3" json:"maxBlockElements,omitempty"`
+	// t-addresses per balance or UTXO request
+	MaxTaddresses uint32 `protobuf:"varint,11,opt,name=maxTaddresses,proto3" json:"maxTaddresses,omitempty"`
+	// tree states per GetTreeStateRange request
+	MaxTreeStateRange uint32 `protobuf:"varint,12,opt,name=maxTreeStateRange,proto3" json:"maxTreeStateRange,omitempty"`
+	// bytes of a GetBlockRange bloom filter
+	MaxBloomFilterSize    uint32 `protobuf:"varint,13,opt,name=maxBloomFilterSize,proto3" json:"maxBloomFilterSize,omitempty"`
+	MaxBloomHashFunctions uint32 `protobuf:"varint,14,opt,name=maxBloomHashFunctions,proto3" json:"maxBloomHashFunctions,omitempty"`
+	// bytes of a SendTransaction or CheckTransaction transaction
+	MaxTxSize uint32 `protobuf:"varint,15,opt,name=maxTxSize,proto3" json:"maxTxSize,omitempty"`
+	// blocks per GetShieldedStats request
+	MaxShieldedStatsRange uint32 `protobuf:"varint,16,opt,name=maxShieldedStatsRange,proto3" json:"maxShieldedStatsRange,omitempty"`
+}
+
+func (m *ServerCapabilities) Reset()                    { *m = ServerCapabilities{} }
+func (m *ServerCapabilities) String() string            { return proto.CompactTextString(m) }
+func (*ServerCapabilities) ProtoMessage()               {}
+func (*ServerCapabilities) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{37} }
+
+func (m *ServerCapabilities) GetMinProtocolVersion() uint32 {
+	if m != nil {
+		return m.MinProtocolVersion
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxProtocolVersion() uint32 {
+	if m != nil {
+		return m.MaxProtocolVersion
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetBlockExtended() bool {
+	if m != nil {
+		return m.BlockExtended
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetTreeStateBridge() bool {
+	if m != nil {
+		return m.TreeStateBridge
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetTreeStateIndex() bool {
+	if m != nil {
+		return m.TreeStateIndex
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetMempoolLookup() bool {
+	if m != nil {
+		return m.MempoolLookup
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetSaplingOnly() bool {
+	if m != nil {
+		return m.SaplingOnly
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetPing() bool {
+	if m != nil {
+		return m.Ping
+	}
+	return false
+}
+
+func (m *ServerCapabilities) GetDeepHistoryHeight() uint64 {
+	if m != nil {
+		return m.DeepHistoryHeight
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxBlockElements() uint32 {
+	if m != nil {
+		return m.MaxBlockElements
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxTaddresses() uint32 {
+	if m != nil {
+		return m.MaxTaddresses
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxTreeStateRange() uint32 {
+	if m != nil {
+		return m.MaxTreeStateRange
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxBloomFilterSize() uint32 {
+	if m != nil {
+		return m.MaxBloomFilterSize
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxBloomHashFunctions() uint32 {
+	if m != nil {
+		return m.MaxBloomHashFunctions
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxTxSize() uint32 {
+	if m != nil {
+		return m.MaxTxSize
+	}
+	return 0
+}
+
+func (m *ServerCapabilities) GetMaxShieldedStatsRange() uint32 {
+	if m != nil {
+		return m.MaxShieldedStatsRange
+	}
+	return 0
+}
+
+// ShieldedStats counts the shielded elements in the blocks from startHeight
+// to endHeight inclusive.
+type ShieldedStats struct {
+	StartHeight uint64 `protobuf:"varint,1,opt,name=startHeight,proto3" json:"startHeight,omitempty"`
+	EndHeight   uint64 `protobuf:"varint,2,opt,name=endHeight,proto3" json:"endHeight,omitempty"`
+	// transactions with shielded elements
+	Transactions   uint64 `protobuf:"varint,3,opt,name=transactions,proto3" json:"transactions,omitempty"`
+	SaplingSpends  uint64 `protobuf:"varint,4,opt,name=saplingSpends,proto3" json:"saplingSpends,omitempty"`
+	SaplingOutputs uint64 `protobuf:"varint,5,opt,name=saplingOutputs,proto3" json:"saplingOutputs,omitempty"`
+	OrchardActions uint64 `protobuf:"varint,6,opt,name=orchardActions,proto3" json:"orchardActions,omitempty"`
+}
+
+func (m *ShieldedStats) Reset()                    { *m = ShieldedStats{} }
+func (m *ShieldedStats) String() string            { return proto.CompactTextString(m) }
+func (*ShieldedStats) ProtoMessage()               {}
+func (*ShieldedStats) Descriptor() ([]byte, []int) { return file_service_proto_rawDesc, []int{38} }
+
+func (m *ShieldedStats) GetStartHeight() uint64 {
+	if m != nil {
+		return m.StartHeight
+	}
+	return 0
+}
+
+func (m *ShieldedStats) GetEndHeight() uint64 {
+	if m != nil {
+		return m.EndHeight
+	}
+	return 0
+}
+
+func (m *ShieldedStats) GetTransactions() uint64 {
+	if m != nil {
+		return m.Transactions
+	}
+	return 0
+}
+
+func (m *ShieldedStats) GetSaplingSpends() uint64 {
+	if m != nil {
+		return m.SaplingSpends
+	}
+	return 0
+}
+
+func (m *ShieldedStats) GetSaplingOutputs() uint64 {
+	if m != nil {
+		return m.SaplingOutputs
+	}
+	return 0
+}
+
+func (m *ShieldedStats) GetOrchardActions() uint64 {
+	if m != nil {
+		return m.OrchardActions
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*BlockID)(nil), "pirate.wallet.sdk.rpc.BlockID")
 	proto.RegisterType((*BlockRange)(nil), "pirate.wallet.sdk.rpc.BlockRange")
@@ -705,6 +1622,7 @@ func init() {
 	proto.RegisterType((*ChainSpec)(nil), "pirate.wallet.sdk.rpc.ChainSpec")
 	proto.RegisterType((*Empty)(nil), "pirate.wallet.sdk.rpc.Empty")
 	proto.RegisterType((*LightdInfo)(nil), "pirate.wallet.sdk.rpc.LightdInfo")
+	proto.RegisterMapType((map[string]string)(nil), "pirate.wallet.sdk.rpc.LightdInfo.ExtraEntry")
 	proto.RegisterType((*TransparentAddressBlockFilter)(nil), "pirate.wallet.sdk.rpc.TransparentAddressBlockFilter")
 	proto.RegisterType((*Duration)(nil), "pirate.wallet.sdk.rpc.Duration")
 	proto.RegisterType((*PingResponse)(nil), "pirate.wallet.sdk.rpc.PingResponse")
@@ -718,90 +1636,192 @@ func init() {
 	proto.RegisterType((*GetAddressUtxosReplyList)(nil), "pirate.wallet.sdk.rpc.GetAddressUtxosReplyList")
 	proto.RegisterType((*PriceRequest)(nil), "pirate.wallet.sdk.rpc.PriceRequest")
 	proto.RegisterType((*PriceResponse)(nil), "pirate.wallet.sdk.rpc.PriceResponse")
+	proto.RegisterType((*TreeStateRange)(nil), "pirate.wallet.sdk.rpc.TreeStateRange")
+	proto.RegisterType((*ChainStats)(nil), "pirate.wallet.sdk.rpc.ChainStats")
+	proto.RegisterType((*TxConstructionParams)(nil), "pirate.wallet.sdk.rpc.TxConstructionParams")
+	proto.RegisterType((*GetMempoolStreamArg)(nil), "pirate.wallet.sdk.rpc.GetMempoolStreamArg")
+	proto.RegisterType((*CheckTransactionResponse)(nil), "pirate.wallet.sdk.rpc.CheckTransactionResponse")
+	proto.RegisterType((*AddressClassification)(nil), "pirate.wallet.sdk.rpc.AddressClassification")
+	proto.RegisterType((*BloomFilter)(nil), "pirate.wallet.sdk.rpc.BloomFilter")
+	proto.RegisterType((*ConfigSetting)(nil), "pirate.wallet.sdk.rpc.ConfigSetting")
+	proto.RegisterType((*ServerConfig)(nil), "pirate.wallet.sdk.rpc.ServerConfig")
+	proto.RegisterType((*TransparentInput)(nil), "pirate.wallet.sdk.rpc.TransparentInput")
+	proto.RegisterType((*TransparentOutput)(nil), "pirate.wallet.sdk.rpc.TransparentOutput")
+	proto.RegisterType((*ExtendedTx)(nil), "pirate.wallet.sdk.rpc.ExtendedTx")
+	proto.RegisterType((*ExtendedBlock)(nil), "pirate.wallet.sdk.rpc.ExtendedBlock")
+	proto.RegisterType((*BlockHash)(nil), "pirate.wallet.sdk.rpc.BlockHash")
+	proto.RegisterType((*RawRPCRequest)(nil), "pirate.wallet.sdk.rpc.RawRPCRequest")
+	proto.RegisterType((*RawRPCReply)(nil), "pirate.wallet.sdk.rpc.RawRPCReply")
+	proto.RegisterType((*ServerCapabilities)(nil), "pirate.wallet.sdk.rpc.ServerCapabilities")
+	proto.RegisterType((*ShieldedStats)(nil), "pirate.wallet.sdk.rpc.ShieldedStats")
 }
 
 func init() { proto.RegisterFile("service.proto", file_service_proto_rawDesc) }
 
 var file_service_proto_rawDesc = []byte{
-	// 1269 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x57, 0x6d, 0x73, 0x13, 0xb7,
-	0x13, 0xb7, 0x71, 0x1c, 0xc7, 0x1b, 0x87, 0x07, 0xfd, 0x81, 0xff, 0x8d, 0x0b, 0x34, 0x15, 0x65,
-	0x26, 0x2d, 0x9d, 0xc0, 0x50, 0x3a, 0xe5, 0x45, 0xdf, 0x24, 0x81, 0x06, 0x66, 0x80, 0x52, 0xc5,
-	0xbc, 0x09, 0x33, 0x65, 0x94, 0xbb, 0xc5, 0x56, 0x73, 0xbe, 0xbb, 0x4a, 0x72, 0x70, 0xbe, 0x50,
-	0x67, 0xfa, 0x15, 0xfa, 0x31, 0xfa, 0x69, 0xfa, 0xb2, 0xa3, 0x95, 0x6c, 0x9f, 0x03, 0xe7, 0x38,
-	0xaf, 0x7c, 0xbb, 0x5a, 0xfd, 0x76, 0xf5, 0xdb, 0x07, 0xc9, 0xb0, 0x61, 0x50, 0x9f, 0xa8, 0x18,
-	0xb7, 0x0b, 0x9d, 0xdb, 0x9c, 0xdd, 0x28, 0x94, 0x96, 0x16, 0xb7, 0x3f, 0xca, 0x34, 0x45, 0xbb,
-	0x6d, 0x92, 0xe3, 0x6d, 0x5d, 0xc4, 0xdd, 0x1b, 0x71, 0x3e, 0x2c, 0x64, 0x6c, 0xdf, 0x7f, 0xc8,
-	0xf5, 0x50, 0x5a, 0xe3, 0xad, 0xf9, 0x0f, 0xd0, 0xda, 0x4d, 0xf3, 0xf8, 0xf8, 0xc5, 0x53, 0x76,
-	0x13, 0x56, 0x07, 0xa8, 0xfa, 0x03, 0x1b, 0xd5, 0x37, 0xeb, 0x5b, 0x2b, 0x22, 0x48, 0x8c, 0xc1,
-	0xca, 0x40, 0x9a, 0x41, 0x74, 0x69, 0xb3, 0xbe, 0xd5, 0x11, 0xf4, 0xcd, 0x2d, 0x00, 0x6d, 0x13,
-	0x32, 0xeb, 0x23, 0x7b, 0x0c, 0x4d, 0x63, 0xa5, 0xf6, 0x1b, 0xd7, 0x1f, 0xdd, 0xd9, 0xfe, 0x6c,
-	0x08, 0xdb, 0xc1, 0x91, 0xf0, 0xc6, 0xec, 0x21, 0x34, 0x30, 0x4b, 0x08, 0xf6, 0xfc, 0x3d, 0xce,
-	0x94, 0xff, 0x0e, 0x6b, 0xbd, 0xf1, 0xcf, 0x2a, 0xb5, 0xa8, 0x9d, 0xcf, 0x23, 0xb7, 0xb6, 0xac,
-	0x4f, 0x32, 0x66, 0xd7, 0xa1, 0xa9, 0xb2, 0x04, 0xc7, 0xe4, 0x75, 0x45, 0x78, 0x61, 0x7a, 0xc2,
-	0x46, 0xe9, 0x84, 0x3f, 0xc1, 0x65, 0x21, 0x3f, 0xf6, 0xb4, 0xcc, 0x8c, 0x8c, 0xad, 0xca, 0x33,
-	0x67, 0x95, 0x48, 0x2b, 0xc9, 0x61, 0x47, 0xd0, 0x77, 0x89, 0xb3, 0x4b, 0x65, 0xce, 0xf8, 0x1b,
-	0xe8, 0x1c, 0x60, 0x96, 0x08, 0x34, 0x45, 0x9e, 0x19, 0x64, 0xb7, 0xa0, 0x8d, 0x5a, 0xe7, 0x7a,
-	0x2f, 0x4f, 0x90, 0x00, 0x9a, 0x62, 0xa6, 0x60, 0x1c, 0x3a, 0x24, 0xbc, 0x42, 0x63, 0x64, 0x1f,
-	0x09, 0xab, 0x2d, 0xe6, 0x74, 0x7c, 0x1d, 0xda, 0x7b, 0x03, 0xa9, 0xb2, 0x83, 0x02, 0x63, 0xde,
-	0x82, 0xe6, 0xb3, 0x61, 0x61, 0x4f, 0xf9, 0xbf, 0x0d, 0x80, 0x97, 0xce, 0x63, 0xf2, 0x22, 0xfb,
-	0x90, 0xb3, 0x08, 0x5a, 0x27, 0xa8, 0x8d, 0xca, 0x33, 0x72, 0xd2, 0x16, 0x13, 0xd1, 0x05, 0x7a,
-	0x82, 0x59, 0x92, 0xeb, 0x00, 0x1e, 0x24, 0xe7, 0xda, 0xca, 0x24, 0xd1, 0x07, 0xa3, 0xa2, 0xc8,
-	0xb5, 0x25, 0x0a, 0xd6, 0xc4, 0x9c, 0xce, 0x05, 0x1f, 0x3b, 0xd7, 0xaf, 0xe5, 0x10, 0xa3, 0x15,
-	0xda, 0x3e, 0x53, 0xb0, 0x27, 0xf0, 0x7f, 0x23, 0x8b, 0x54, 0x65, 0xfd, 0x9d, 0xd8, 0xaa, 0x13,
-	0xe9, 0xb8, 0x7a, 0xee, 0x39, 0x69, 0x12, 0x27, 0x55, 0xcb, 0xec, 0x3b, 0xb8, 0x16, 0x3b, 0x76,
-	0x32, 0x33, 0x32, 0xbb, 0x5a, 0x66, 0xf1, 0xe0, 0x45, 0x12, 0xad, 0x12, 0xfe, 0xa7, 0x0b, 0x6c,
-	0x13, 0xd6, 0x29, 0x87, 0x01, 0xbb, 0x45, 0xd8, 0x65, 0x95, 0x8b, 0xb3, 0xaf, 0xec, 0x5e, 0x3e,
-	0x1c, 0x2a, 0x1b, 0xad, 0xf9, 0x38, 0xa7, 0x0a, 0xc7, 0xc0, 0x11, 0x61, 0x45, 0x6d, 0xcf, 0x80,
-	0x97, 0xdc, 0xae, 0xa3, 0x91, 0x4a, 0x93, 0xa7, 0xd2, 0x62, 0x04, 0x7e, 0xd7, 0x54, 0x31, 0x5d,
-	0x7d, 0x6b, 0x50, 0x47, 0xeb, 0xa5, 0x55, 0xa7, 0x60, 0x5b, 0x70, 0x05, 0x8d, 0x55, 0x43, 0x69,
-	0x31, 0x09, 0x71, 0x75, 0x28, 0xae, 0xb3, 0x6a, 0xc7, 0xb3, 0x2f, 0xd0, 0x64, 0xd7, 0xed, 0x8e,
-	0x36, 0x7c, 0x8a, 0xcb, 0x3a, 0xc7, 0x47, 0x90, 0x0f, 0x46, 0x47, 0x93, 0x3c, 0x5e, 0xf6, 0x7c,
-	0x7c, 0xb2, 0xc0, 0x35, 0xdc, 0xa6, 0xea, 0x2c, 0xa4, 0xc6, 0xcc, 0xee, 0x24, 0x89, 0x46, 0x63,
-	0xa8, 0xdc, 0x43, 0x87, 0x44, 0xd0, 0x92, 0x5e, 0x3b, 0x29, 0x86, 0x20, 0xb2, 0x1f, 0xa1, 0xa9,
-	0x5d, 0xe3, 0x86, 0xde, 0xfb, 0x6a, 0x51, 0xef, 0x50, 0x87, 0x0b, 0x6f, 0xcf, 0xbf, 0x85, 0xb5,
-	0xa7, 0x23, 0x4d, 0x39, 0x64, 0x77, 0x00, 0x54, 0x66, 0x51, 0x9f, 0xc8, 0xf4, 0xad, 0xf7, 0xd0,
-	0x10, 0x25, 0x0d, 0x7f, 0x02, 0x9d, 0x37, 0x2a, 0xeb, 0x4f, 0x5b, 0xe0, 0x3a, 0x34, 0x31, 0xb3,
-	0xfa, 0x34, 0x98, 0x7a, 0xc1, 0x35, 0x15, 0x8e, 0x95, 0x6f, 0x9f, 0x86, 0xa0, 0x6f, 0x7e, 0x17,
-	0x5a, 0xe1, 0x38, 0xd5, 0x67, 0xe0, 0xf7, 0x61, 0x3d, 0x18, 0xbd, 0x54, 0x86, 0x72, 0x1f, 0x56,
-	0xd0, 0x99, 0x36, 0x5c, 0x9e, 0xa6, 0x0a, 0x7e, 0x0f, 0x5a, 0xbb, 0x32, 0x95, 0x59, 0x8c, 0xac,
-	0x0b, 0x6b, 0x27, 0x32, 0x1d, 0xe1, 0xa1, 0xb4, 0x21, 0x92, 0xa9, 0xcc, 0x6f, 0x43, 0xeb, 0xd9,
-	0x38, 0x4e, 0x47, 0x09, 0xba, 0xb8, 0xec, 0x58, 0x25, 0x04, 0xd5, 0x11, 0xf4, 0xcd, 0xff, 0xaa,
-	0x43, 0xbb, 0xa7, 0x11, 0x0f, 0xac, 0xab, 0x8c, 0x08, 0x5a, 0x19, 0xda, 0x8f, 0xb9, 0x3e, 0x9e,
-	0x84, 0x16, 0xc4, 0xaa, 0xa1, 0x30, 0x37, 0x66, 0xda, 0x7e, 0xcc, 0x90, 0x1f, 0x15, 0xda, 0x6a,
-	0x43, 0xd0, 0xb7, 0xab, 0xf4, 0xd0, 0x32, 0xce, 0x1b, 0x75, 0x51, 0x5b, 0x94, 0x55, 0xce, 0x22,
-	0xd7, 0xf1, 0x40, 0xea, 0x84, 0x2c, 0x7c, 0xcf, 0x94, 0x55, 0xdc, 0x02, 0xdb, 0xc7, 0x49, 0x55,
-	0xbc, 0xb5, 0xe3, 0xdc, 0xec, 0xe8, 0xfe, 0x62, 0x96, 0xc8, 0xaf, 0x9b, 0xcc, 0xcf, 0xcb, 0xc1,
-	0x97, 0x55, 0x2e, 0xe7, 0x43, 0x39, 0x7e, 0x96, 0x59, 0xad, 0xd0, 0xd0, 0x39, 0x36, 0x44, 0x49,
-	0xc3, 0xff, 0xac, 0xc3, 0xf5, 0x33, 0x6e, 0x05, 0x16, 0xe9, 0x69, 0x39, 0x8f, 0xab, 0xf3, 0xb5,
-	0x38, 0x23, 0xba, 0x3e, 0x21, 0x7a, 0x7e, 0x4a, 0x37, 0x27, 0x53, 0xfa, 0x26, 0xac, 0x9a, 0x58,
-	0xab, 0xc2, 0x86, 0x39, 0x1d, 0xa4, 0xb9, 0x8c, 0xae, 0xcc, 0x67, 0xb4, 0x94, 0x8a, 0xe6, 0xdc,
-	0x7c, 0x3e, 0x86, 0xe8, 0x73, 0x71, 0x52, 0x29, 0xfd, 0x02, 0x1d, 0x59, 0x5a, 0x20, 0x9e, 0xd6,
-	0x1f, 0xdd, 0xaf, 0x68, 0x92, 0xcf, 0xc1, 0x88, 0x39, 0x00, 0xfe, 0x1c, 0x3a, 0x6f, 0xb4, 0x8a,
-	0x51, 0xe0, 0x1f, 0x23, 0xf4, 0xb5, 0xea, 0xf2, 0x6c, 0xac, 0x1c, 0x16, 0xe1, 0xae, 0x9d, 0x29,
-	0xdc, 0x71, 0xe2, 0x91, 0xd6, 0x98, 0xc5, 0xa7, 0x61, 0x56, 0x4f, 0x65, 0xfe, 0x1e, 0x36, 0x02,
-	0xd2, 0xec, 0x5e, 0x99, 0x87, 0x6a, 0x2c, 0x09, 0xe5, 0x38, 0x2e, 0x1c, 0x14, 0x91, 0x59, 0x17,
-	0x5e, 0x78, 0xf4, 0x4f, 0x07, 0xae, 0xed, 0xf9, 0x87, 0x42, 0x6f, 0x7c, 0x60, 0x35, 0xca, 0x21,
-	0x6a, 0xd6, 0x83, 0xcb, 0xfb, 0x68, 0x5f, 0x4a, 0x8b, 0xc6, 0xd2, 0x50, 0x60, 0x9b, 0x15, 0x6c,
-	0x4c, 0xaf, 0xa8, 0xee, 0x39, 0x17, 0x32, 0xaf, 0xb1, 0x5f, 0x61, 0x6d, 0x1f, 0x03, 0xde, 0x39,
-	0xd6, 0xdd, 0xbb, 0x55, 0xfe, 0x7c, 0xac, 0x64, 0xc6, 0x6b, 0xec, 0x1d, 0x6c, 0x4c, 0x20, 0xfd,
-	0xcb, 0xe4, 0xfc, 0xd1, 0xb6, 0x24, 0xf4, 0xc3, 0x3a, 0x7b, 0x07, 0x1d, 0x97, 0x6c, 0x21, 0x04,
-	0xe5, 0x80, 0x55, 0x6d, 0x2c, 0xe7, 0xba, 0xfb, 0xf5, 0x62, 0x23, 0x9f, 0x46, 0x8a, 0xfc, 0x7f,
-	0xfb, 0x68, 0xf7, 0x28, 0x3b, 0x25, 0x1f, 0xb7, 0x2a, 0xb6, 0xd3, 0xed, 0xbf, 0x34, 0xf8, 0x21,
-	0xe5, 0xaf, 0xfc, 0x96, 0xf9, 0xb2, 0x62, 0xe7, 0xe4, 0x79, 0xd5, 0xbd, 0x57, 0x61, 0x30, 0xff,
-	0x26, 0xe2, 0x35, 0xf6, 0x1e, 0xae, 0xb8, 0x97, 0x4e, 0x19, 0x7c, 0xb9, 0xbd, 0x95, 0xc4, 0x97,
-	0x1f, 0x4e, 0xbc, 0xc6, 0x0c, 0x5c, 0x75, 0xc1, 0x87, 0x8e, 0xea, 0x8d, 0x55, 0x62, 0xd8, 0xe3,
-	0xaa, 0xf0, 0x17, 0x5d, 0x88, 0x4b, 0x9f, 0xe9, 0x61, 0x9d, 0x1d, 0xd2, 0xf8, 0x9c, 0x38, 0x9d,
-	0xdc, 0x1d, 0xbc, 0x02, 0xa0, 0x74, 0x11, 0x55, 0xd7, 0xbd, 0xc7, 0xe0, 0x35, 0xf6, 0x1b, 0xcd,
-	0x9e, 0x33, 0xd8, 0xbe, 0xd7, 0x2a, 0xfb, 0x20, 0x78, 0x38, 0x1f, 0x7d, 0xab, 0xce, 0x7a, 0x54,
-	0xa7, 0xaf, 0x70, 0x58, 0xe4, 0x79, 0xda, 0x1b, 0x57, 0x62, 0x86, 0xab, 0xae, 0xbb, 0xb9, 0xb8,
-	0x01, 0x7a, 0xe3, 0x50, 0xfd, 0x57, 0x67, 0xa8, 0x21, 0xda, 0xc5, 0xd5, 0x79, 0x01, 0xba, 0x05,
-	0x85, 0x3c, 0xbb, 0x5b, 0xcf, 0x1b, 0x07, 0x9b, 0x95, 0xf9, 0x0f, 0x08, 0xbc, 0xc6, 0x72, 0xb8,
-	0x72, 0x66, 0x36, 0xb3, 0x6f, 0x96, 0x9b, 0xe1, 0x3b, 0xba, 0xdf, 0x7d, 0x70, 0x81, 0x71, 0xef,
-	0xf2, 0x4e, 0x85, 0x7a, 0xe3, 0xcc, 0x6a, 0xa0, 0xe9, 0x02, 0x6e, 0x2f, 0x72, 0xcb, 0x04, 0xe6,
-	0xdc, 0xc4, 0x2b, 0xfd, 0x05, 0x58, 0x9c, 0x93, 0xaa, 0x79, 0x38, 0x03, 0xe0, 0x35, 0xf6, 0x1a,
-	0x56, 0xdc, 0xcb, 0xad, 0x72, 0x48, 0x4c, 0x9e, 0x80, 0x95, 0x1d, 0x5c, 0x7e, 0xf7, 0xf1, 0xda,
-	0xee, 0x17, 0x87, 0x37, 0x53, 0x87, 0xef, 0xad, 0x92, 0x07, 0xfe, 0x57, 0x17, 0xf1, 0xdf, 0x97,
-	0x6a, 0x47, 0xab, 0xf4, 0x3f, 0xf4, 0xfb, 0xff, 0x02, 0x00, 0x00, 0xff, 0xff, 0x29, 0xae, 0x80,
-	0x2c, 0xc6, 0x0e, 0x00, 0x00,
+	// 2616 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x5a, 0xcf, 0x73, 0x1b, 0xb7,
+	0xf5, 0xe7, 0x8a, 0xa2, 0x24, 0x3e, 0x89, 0xb2, 0x8c, 0x58, 0x0a, 0x47, 0xdf, 0xc4, 0x51, 0x10,
+	0xf9, 0x5b, 0xe5, 0x47, 0x95, 0x8c, 0x9b, 0xb6, 0x4e, 0xa6, 0x33, 0xad, 0x25, 0x3b, 0xb6, 0x66,
+	0x1c, 0x47, 0x85, 0xe4, 0xb6, 0xe3, 0x4c, 0xea, 0x42, 0xbb, 0x10, 0xb5, 0xd5, 0x72, 0x77, 0x8b,
+	0x05, 0x25, 0x2a, 0x87, 0x1e, 0x7a, 0xea, 0xa5, 0xbd, 0xf5, 0xd6, 0x43, 0x4f, 0xbd, 0xb6, 0xe7,
+	0xfe, 0x1d, 0xfd, 0x27, 0xfa, 0x4f, 0x74, 0x3a, 0xef, 0x01, 0x4b, 0xee, 0x92, 0x5c, 0x92, 0x6e,
+	0x4f, 0x5a, 0x7c, 0xf0, 0xf0, 0xf0, 0xf0, 0xf0, 0xf0, 0xc1, 0x7b, 0xa0, 0xa0, 0x95, 0x29, 0x7d,
+	0x15, 0xfa, 0x6a, 0x3f, 0xd5, 0x89, 0x49, 0xd8, 0x66, 0x1a, 0x6a, 0x69, 0xd4, 0xfe, 0xb5, 0x8c,
+	0x22, 0x65, 0xf6, 0xb3, 0xe0, 0x72, 0x5f, 0xa7, 0xfe, 0xf6, 0xa6, 0x9f, 0x74, 0x53, 0xe9, 0x9b,
+	0x57, 0xe7, 0x89, 0xee, 0x4a, 0x93, 0x59, 0x69, 0xfe, 0x7d, 0x58, 0x3e, 0x88, 0x12, 0xff, 0xf2,
+	0xe8, 0x11, 0xdb, 0x82, 0xa5, 0x0b, 0x15, 0x76, 0x2e, 0x4c, 0xdb, 0xdb, 0xf1, 0xf6, 0x16, 0x85,
+	0x6b, 0x31, 0x06, 0x8b, 0x17, 0x32, 0xbb, 0x68, 0x2f, 0xec, 0x78, 0x7b, 0x6b, 0x82, 0xbe, 0xf9,
+	0x9f, 0x17, 0x00, 0x68, 0x9c, 0x90, 0x71, 0x47, 0xb1, 0x4f, 0xa1, 0x91, 0x19, 0xa9, 0xed, 0xc8,
+	0xd5, 0xfb, 0x77, 0xf7, 0x27, 0xda, 0xb0, 0xef, 0x66, 0x12, 0x56, 0x98, 0x7d, 0x02, 0x75, 0x15,
+	0x07, 0xed, 0x85, 0xb9, 0xc6, 0xa0, 0x28, 0xfb, 0x7f, 0x58, 0x4f, 0xba, 0xa1, 0x39, 0x0c, 0xd3,
+	0x0b, 0xa5, 0x8d, 0xea, 0x9b, 0x76, 0x7d, 0xc7, 0xdb, 0x5b, 0x11, 0x23, 0x28, 0xdb, 0x83, 0x5b,
+	0x99, 0xfa, 0x4d, 0x4f, 0xc5, 0xbe, 0x7a, 0xde, 0xeb, 0x9e, 0x29, 0x9d, 0xb5, 0x17, 0x49, 0x70,
+	0x14, 0x66, 0x9f, 0xc3, 0xd2, 0x79, 0x18, 0x19, 0xa5, 0xdb, 0x0d, 0x32, 0x83, 0x57, 0x9b, 0x91,
+	0x74, 0xbf, 0x20, 0x49, 0xe1, 0x46, 0xb0, 0x36, 0x2c, 0xab, 0xbe, 0x1f, 0xf5, 0x02, 0xd5, 0x5e,
+	0xda, 0xa9, 0xef, 0xad, 0x89, 0xbc, 0xc9, 0x7f, 0x0d, 0x2b, 0xa7, 0x7d, 0x2b, 0x8d, 0xbe, 0x39,
+	0xc3, 0x35, 0xcc, 0xeb, 0x1b, 0x12, 0x66, 0x77, 0xa0, 0x11, 0xc6, 0x81, 0xea, 0x93, 0x77, 0x16,
+	0x85, 0x6d, 0x0c, 0xb6, 0xa2, 0x5e, 0xd8, 0x8a, 0x6f, 0x61, 0x5d, 0xc8, 0xeb, 0x53, 0x2d, 0xe3,
+	0x4c, 0xfa, 0x26, 0x4c, 0x62, 0x94, 0x0a, 0xa4, 0x91, 0x34, 0xe1, 0x9a, 0xa0, 0xef, 0xc2, 0xe6,
+	0x2e, 0x94, 0x36, 0x77, 0x1b, 0x56, 0x72, 0x97, 0x90, 0xd6, 0x45, 0x31, 0x68, 0xb3, 0x1d, 0x58,
+	0xf5, 0x7b, 0x3a, 0x4b, 0xb4, 0x50, 0x99, 0x32, 0xce, 0x83, 0x45, 0x88, 0x5f, 0xc1, 0xda, 0x89,
+	0x8a, 0x03, 0xa1, 0xb2, 0x34, 0x89, 0x33, 0xc5, 0xde, 0x82, 0xa6, 0xd2, 0x3a, 0xd1, 0x87, 0x49,
+	0xa0, 0x68, 0xfa, 0x86, 0x18, 0x02, 0x8c, 0xc3, 0x1a, 0x35, 0xbe, 0x54, 0x59, 0x26, 0x3b, 0x8a,
+	0x2c, 0x69, 0x8a, 0x12, 0xc6, 0x76, 0xa1, 0xd5, 0x55, 0xdd, 0x34, 0x49, 0xa2, 0x13, 0x23, 0x4d,
+	0x2f, 0x23, 0xa3, 0x9a, 0xa2, 0x0c, 0xf2, 0x55, 0x68, 0x1e, 0x5e, 0xc8, 0x30, 0x3e, 0x49, 0x95,
+	0xcf, 0x97, 0xa1, 0xf1, 0xb8, 0x9b, 0x9a, 0x1b, 0xfe, 0xef, 0x65, 0x80, 0x67, 0xb8, 0xaa, 0xe0,
+	0x28, 0x3e, 0x4f, 0x70, 0x7b, 0xae, 0x94, 0xce, 0xc2, 0x24, 0x26, 0x53, 0x9a, 0x22, 0x6f, 0xa2,
+	0x33, 0xae, 0x54, 0x1c, 0x24, 0xda, 0x99, 0xe0, 0x5a, 0x68, 0xa0, 0x91, 0x41, 0xa0, 0x4f, 0x7a,
+	0x69, 0x9a, 0xe8, 0x3c, 0xb8, 0x4a, 0x18, 0x2e, 0xd1, 0xc7, 0xa9, 0x9f, 0xcb, 0xae, 0x22, 0x97,
+	0x34, 0xc5, 0x10, 0x60, 0x0f, 0xe0, 0xcd, 0x4c, 0xa6, 0x51, 0x18, 0x77, 0x1e, 0xfa, 0x26, 0xbc,
+	0x92, 0xb8, 0x1f, 0x4f, 0xad, 0xdf, 0x1b, 0xe4, 0xdd, 0xaa, 0x6e, 0xf6, 0x11, 0xdc, 0xf6, 0xd1,
+	0x87, 0x71, 0xd6, 0xcb, 0x0e, 0xb4, 0x8c, 0xfd, 0x8b, 0xa3, 0xa0, 0xbd, 0x44, 0xfa, 0xc7, 0x3b,
+	0x70, 0x6b, 0x28, 0x4e, 0x9c, 0xee, 0x65, 0xd2, 0x5d, 0x84, 0xd0, 0xce, 0x4e, 0x68, 0x0e, 0x93,
+	0x6e, 0x37, 0x34, 0xed, 0x15, 0x6b, 0xe7, 0x00, 0x40, 0x0f, 0x9c, 0x91, 0xae, 0x76, 0xd3, 0x7a,
+	0xc0, 0xb6, 0x70, 0xd4, 0x59, 0x2f, 0x8c, 0x82, 0x47, 0xd2, 0xa8, 0x36, 0xd8, 0x51, 0x03, 0x60,
+	0xd0, 0xfb, 0x22, 0x53, 0xba, 0xbd, 0x5a, 0xe8, 0x45, 0x00, 0x0f, 0x9d, 0xca, 0x4c, 0xd8, 0x95,
+	0x46, 0x05, 0xce, 0xae, 0x35, 0xb2, 0x6b, 0x14, 0x46, 0x3f, 0xdb, 0x43, 0x10, 0x1c, 0xe0, 0xe8,
+	0x76, 0xcb, 0x06, 0x42, 0x11, 0x43, 0x7f, 0xb8, 0xf6, 0x49, 0xef, 0x2c, 0xdf, 0xc7, 0x75, 0xeb,
+	0x8f, 0xb1, 0x0e, 0xf6, 0x03, 0xd8, 0x32, 0x5a, 0x29, 0x0c, 0x0f, 0x75, 0xa0, 0xc3, 0xa0, 0xa3,
+	0xf2, 0x3d, 0xbc, 0x45, 0x7b, 0x58, 0xd1, 0xcb, 0xf6, 0x81, 0x75, 0xc3, 0xf8, 0x18, 0xa9, 0xd0,
+	0x4f, 0xa2, 0x9f, 0xb9, 0x69, 0x36, 0x76, 0xbc, 0xbd, 0x96, 0x98, 0xd0, 0x43, 0xf2, 0xb2, 0x3f,
+	0x2a, 0x7f, 0xdb, 0xc9, 0x8f, 0xf5, 0xb0, 0x03, 0x68, 0xa8, 0xbe, 0xd1, 0xb2, 0xcd, 0x76, 0xea,
+	0x7b, 0xab, 0xf7, 0x3f, 0xaa, 0x38, 0xfc, 0xc3, 0xa8, 0xdd, 0x7f, 0x8c, 0xe2, 0x8f, 0x63, 0xa3,
+	0x6f, 0x84, 0x1d, 0x8a, 0x9e, 0x08, 0x94, 0x4a, 0x9f, 0x86, 0x99, 0x49, 0xf4, 0x8d, 0xf3, 0xec,
+	0x1b, 0xe4, 0xd9, 0xf1, 0x0e, 0x3c, 0xd0, 0x81, 0xea, 0x68, 0x19, 0xa8, 0xa0, 0x7d, 0x87, 0xd6,
+	0x3e, 0x68, 0xa3, 0xdf, 0x33, 0x23, 0x23, 0x75, 0xa2, 0xfc, 0x24, 0x0e, 0xb2, 0xf6, 0x26, 0x29,
+	0x29, 0x61, 0xb8, 0x8b, 0xb1, 0xea, 0x9b, 0x17, 0x29, 0x8d, 0xa1, 0x28, 0xdf, 0x22, 0xaf, 0x8f,
+	0xc2, 0x68, 0x57, 0x01, 0x72, 0x76, 0xbd, 0x69, 0xed, 0x1a, 0xeb, 0x40, 0xbd, 0x3d, 0x0b, 0x1c,
+	0x75, 0xbb, 0x61, 0xac, 0x62, 0xd3, 0x6e, 0x5b, 0x4a, 0x1e, 0x81, 0xb7, 0x1f, 0x00, 0x0c, 0x9d,
+	0xc0, 0x36, 0xa0, 0x7e, 0xa9, 0x6e, 0xdc, 0x09, 0xc6, 0x4f, 0xa4, 0xc6, 0x2b, 0x19, 0xf5, 0x72,
+	0xfe, 0xb0, 0x8d, 0xcf, 0x17, 0x1e, 0x78, 0x5c, 0xc3, 0xdb, 0xc4, 0x83, 0xa9, 0xd4, 0x2a, 0x36,
+	0x0f, 0x83, 0x40, 0xab, 0x2c, 0x23, 0x62, 0xfd, 0x62, 0xc0, 0xd8, 0xd2, 0xa2, 0x39, 0x25, 0xb8,
+	0x26, 0xfb, 0x21, 0x34, 0x34, 0x5e, 0x65, 0xee, 0x36, 0x7a, 0x77, 0x1a, 0x4b, 0xd3, 0x9d, 0x27,
+	0xac, 0x3c, 0xff, 0x00, 0x56, 0x1e, 0xf5, 0x34, 0x9d, 0x64, 0x76, 0x17, 0x20, 0x8c, 0x8d, 0xd2,
+	0x57, 0x32, 0x7a, 0x61, 0x67, 0xa8, 0x8b, 0x02, 0xc2, 0x1f, 0xc0, 0xda, 0x71, 0x18, 0x77, 0x06,
+	0x74, 0x79, 0x07, 0x1a, 0x0a, 0x17, 0xe9, 0x44, 0x6d, 0x03, 0xe9, 0x5b, 0xf5, 0x43, 0x4b, 0xd4,
+	0x75, 0x41, 0xdf, 0xfc, 0x3d, 0x58, 0x76, 0xcb, 0xa9, 0x5e, 0x03, 0xff, 0x10, 0x56, 0x9d, 0xd0,
+	0xb3, 0x30, 0x23, 0x06, 0x70, 0x3d, 0x0a, 0x45, 0xeb, 0x78, 0x5a, 0x07, 0x00, 0xbf, 0x07, 0xcb,
+	0x07, 0x32, 0x92, 0xc8, 0xf3, 0xdb, 0xb0, 0x42, 0x3e, 0x7c, 0x29, 0x8d, 0xb3, 0x64, 0xd0, 0xe6,
+	0x6f, 0xc3, 0xf2, 0x63, 0x7b, 0xa9, 0xa1, 0x5d, 0xa6, 0x1f, 0x06, 0xa4, 0x6a, 0x4d, 0xd0, 0x37,
+	0xff, 0xc3, 0x02, 0x34, 0x4f, 0xf3, 0xa3, 0x85, 0xa6, 0xc5, 0xca, 0x5c, 0x27, 0xfa, 0x32, 0x37,
+	0xcd, 0x35, 0x2b, 0xaf, 0x9f, 0xe2, 0x85, 0xd6, 0xb4, 0x17, 0x1a, 0xcd, 0x13, 0x3a, 0x72, 0x6d,
+	0x09, 0xfa, 0x46, 0xbe, 0x73, 0xc4, 0x89, 0xb3, 0x11, 0x97, 0x36, 0x45, 0x11, 0x42, 0x89, 0x44,
+	0xfb, 0x17, 0x52, 0x07, 0x24, 0x61, 0x99, 0xb3, 0x08, 0xe1, 0xee, 0x64, 0xa9, 0x4e, 0x7a, 0x86,
+	0x04, 0x96, 0x49, 0xa0, 0x80, 0x14, 0xe6, 0x10, 0x49, 0x92, 0x73, 0x66, 0x11, 0x2a, 0xcc, 0x41,
+	0x12, 0xcd, 0xd2, 0x1c, 0x08, 0xf1, 0xbf, 0x78, 0xc0, 0x9e, 0xa8, 0x3c, 0xf4, 0x5e, 0x98, 0x7e,
+	0x92, 0x3d, 0xd4, 0x9d, 0xe9, 0x5b, 0x41, 0x13, 0x1b, 0xa9, 0xcd, 0xd3, 0xa2, 0x87, 0x8a, 0x10,
+	0x9a, 0xde, 0x95, 0x7d, 0x3c, 0x10, 0xa1, 0xb2, 0x57, 0x62, 0x4b, 0x14, 0x10, 0xf6, 0x01, 0x6c,
+	0x74, 0xc3, 0xf8, 0x30, 0x89, 0xcf, 0x43, 0x4c, 0xee, 0xc2, 0x24, 0xb6, 0x09, 0x4f, 0x43, 0x8c,
+	0xe1, 0xfc, 0xaf, 0x1e, 0xdc, 0x19, 0x31, 0x51, 0xa8, 0x34, 0xba, 0x29, 0x06, 0xd6, 0x52, 0xf9,
+	0x70, 0x0c, 0x77, 0xde, 0xcb, 0x77, 0xbe, 0x9c, 0xa0, 0x34, 0xf2, 0x04, 0x65, 0x0b, 0x96, 0x32,
+	0x5f, 0x87, 0xa9, 0x71, 0x29, 0x8a, 0x6b, 0x95, 0x42, 0x6c, 0xb1, 0x1c, 0x62, 0x85, 0xd8, 0x68,
+	0x14, 0x63, 0x83, 0x5f, 0x42, 0x7b, 0x92, 0x9d, 0x14, 0xdb, 0x5f, 0xc1, 0x9a, 0x2c, 0x74, 0x90,
+	0x4f, 0x57, 0xef, 0x7f, 0x58, 0x71, 0x6a, 0x27, 0xa9, 0x11, 0x25, 0x05, 0xfc, 0x29, 0xac, 0x1d,
+	0xeb, 0xd0, 0x57, 0x02, 0x93, 0x1f, 0x7b, 0x78, 0x30, 0xf0, 0x32, 0x23, 0xbb, 0xa9, 0xcb, 0x87,
+	0x87, 0x00, 0x2e, 0xc7, 0xef, 0x69, 0xad, 0x62, 0xff, 0xc6, 0xb1, 0xd0, 0xa0, 0xcd, 0x5f, 0x41,
+	0xcb, 0x69, 0x1a, 0x26, 0x45, 0x65, 0x55, 0xf5, 0x39, 0x55, 0xa1, 0x8f, 0x53, 0x54, 0x45, 0xce,
+	0xf4, 0x84, 0x6d, 0xf0, 0x00, 0xd6, 0x07, 0x47, 0xce, 0xa6, 0xdf, 0x23, 0x01, 0xe4, 0x8d, 0x07,
+	0x10, 0x26, 0x66, 0x71, 0x50, 0x0a, 0xb0, 0x21, 0x80, 0xfb, 0x9b, 0x19, 0x95, 0xba, 0xc0, 0xa2,
+	0x6f, 0xfe, 0x47, 0x0f, 0xc0, 0xe6, 0x58, 0x46, 0x9a, 0xac, 0xb2, 0x38, 0xb8, 0x0b, 0x10, 0x84,
+	0xe7, 0xe7, 0xa1, 0xdf, 0x8b, 0x8c, 0x5d, 0x80, 0x27, 0x0a, 0x08, 0xa5, 0x54, 0xc3, 0xd4, 0x34,
+	0x73, 0x39, 0x66, 0x09, 0xc3, 0x9c, 0xcf, 0x4f, 0xc2, 0x18, 0xef, 0xe4, 0xe8, 0x66, 0x18, 0x21,
+	0x65, 0x90, 0xff, 0x16, 0xee, 0x9c, 0xf6, 0x0f, 0x93, 0x38, 0x33, 0xba, 0x47, 0x03, 0x8f, 0xa5,
+	0x96, 0xdd, 0x6c, 0x72, 0xe2, 0xe4, 0x4d, 0x49, 0x9c, 0x54, 0x3f, 0x0d, 0xf5, 0xcd, 0x23, 0x15,
+	0x19, 0x49, 0x06, 0xb7, 0x44, 0x11, 0x2a, 0xac, 0xb4, 0x5e, 0x0a, 0xc7, 0xef, 0xc2, 0x1b, 0x4f,
+	0x94, 0xf9, 0x32, 0xcf, 0x43, 0xb5, 0x92, 0x5d, 0x3c, 0xda, 0x5b, 0xb0, 0x64, 0x33, 0xe2, 0xdc,
+	0x31, 0xb6, 0xc5, 0x9f, 0x43, 0xfb, 0xf0, 0x42, 0xf9, 0x97, 0x85, 0xc4, 0x7c, 0x10, 0x11, 0xdb,
+	0xb0, 0x22, 0x7d, 0x5f, 0xa5, 0x46, 0x59, 0x4b, 0x57, 0xc4, 0xa0, 0x8d, 0xfa, 0xb4, 0x92, 0x59,
+	0x12, 0xe7, 0xb9, 0xa9, 0x6d, 0xf1, 0xaf, 0x61, 0xd3, 0xc5, 0xf0, 0x61, 0x24, 0xb3, 0x2c, 0x3c,
+	0x0f, 0x7d, 0x7b, 0xe9, 0xd8, 0xeb, 0x30, 0xcc, 0x35, 0xd9, 0x06, 0x1d, 0xd9, 0x9b, 0x34, 0xbf,
+	0x23, 0xe9, 0xbb, 0x48, 0xcf, 0xf5, 0x12, 0x3d, 0xf3, 0x6f, 0x60, 0xb5, 0x50, 0xe0, 0x4c, 0x2c,
+	0x20, 0x76, 0xa1, 0x85, 0xec, 0xfc, 0x45, 0x2f, 0x76, 0x3b, 0x69, 0x5d, 0x57, 0x06, 0xd1, 0x18,
+	0x73, 0xad, 0xe4, 0xa5, 0x0b, 0x25, 0xdb, 0xe0, 0x9f, 0x41, 0x8b, 0x38, 0xa8, 0x73, 0xa2, 0x8c,
+	0x09, 0xe3, 0x0e, 0x4e, 0x10, 0x63, 0x66, 0x61, 0xb7, 0x89, 0xbe, 0x27, 0x5f, 0xeb, 0xfc, 0xf7,
+	0x1e, 0x96, 0x18, 0xfa, 0x4a, 0x69, 0xab, 0xa1, 0x9c, 0x7f, 0x7b, 0xa3, 0xf9, 0x77, 0x21, 0xe7,
+	0x5f, 0x28, 0xe7, 0xfc, 0x3f, 0xc1, 0x42, 0x87, 0x66, 0xc7, 0x20, 0x44, 0xb6, 0xd8, 0xad, 0x60,
+	0x8b, 0x92, 0xa9, 0x62, 0x30, 0x8a, 0xff, 0xce, 0x83, 0x8d, 0x42, 0x7a, 0x71, 0x14, 0xa7, 0x3d,
+	0x22, 0xb6, 0x54, 0xab, 0xab, 0xd3, 0x21, 0x3d, 0x0e, 0xda, 0x68, 0x2a, 0x7e, 0x1f, 0x0d, 0x68,
+	0xb2, 0x25, 0x86, 0x40, 0x91, 0x6e, 0xeb, 0x65, 0xba, 0x1d, 0x25, 0xcb, 0xc5, 0xc2, 0x7d, 0x2c,
+	0xe1, 0x76, 0xc1, 0x86, 0xaf, 0x7a, 0xc6, 0x19, 0x51, 0xba, 0xc0, 0x17, 0xcb, 0xec, 0xea, 0x18,
+	0x79, 0xa1, 0xc4, 0xc8, 0x95, 0xd3, 0xf3, 0xbf, 0x79, 0x94, 0x80, 0xa9, 0x38, 0x50, 0xc1, 0x69,
+	0x7f, 0x48, 0xf4, 0xde, 0xa4, 0x4a, 0xb4, 0xf0, 0x28, 0xc0, 0x3e, 0x83, 0xfa, 0x55, 0x18, 0x3b,
+	0xef, 0x7e, 0xa7, 0xc2, 0xbb, 0xa3, 0x1e, 0x14, 0x38, 0x86, 0xfd, 0x08, 0x16, 0xaf, 0x92, 0x1e,
+	0x2e, 0x17, 0xc7, 0xee, 0xcd, 0x1e, 0x6b, 0x57, 0x2e, 0x68, 0x14, 0xff, 0x93, 0x07, 0xad, 0xdc,
+	0x62, 0xca, 0xd0, 0xd8, 0x67, 0xe5, 0xa2, 0xfb, 0xbd, 0xca, 0xad, 0xa6, 0x37, 0x11, 0x1a, 0x93,
+	0x57, 0xde, 0x47, 0xb0, 0x6e, 0x86, 0xf3, 0x9c, 0xf6, 0x31, 0xd2, 0xeb, 0x53, 0x52, 0xc2, 0xa1,
+	0xab, 0xc4, 0xc8, 0x40, 0xfe, 0x0e, 0x34, 0x49, 0xf5, 0x53, 0x97, 0xd6, 0x90, 0xc7, 0xbc, 0x42,
+	0xed, 0xfe, 0x63, 0x68, 0x09, 0x79, 0x2d, 0x8e, 0x0f, 0xf3, 0x6b, 0x67, 0x0b, 0x96, 0xba, 0xca,
+	0x5c, 0x24, 0x39, 0x83, 0xb9, 0x16, 0xe2, 0x29, 0xd1, 0x1d, 0x19, 0xd3, 0x14, 0xae, 0xc5, 0xef,
+	0xc1, 0x6a, 0xae, 0x00, 0xaf, 0x70, 0x22, 0x8f, 0xac, 0x17, 0x99, 0x7c, 0xb8, 0x6d, 0xf1, 0xbf,
+	0x37, 0x80, 0xb9, 0x53, 0x24, 0x53, 0x79, 0x16, 0x46, 0xa1, 0xc1, 0xb4, 0x61, 0x72, 0xf5, 0xe3,
+	0xbd, 0x66, 0xf5, 0xb3, 0x50, 0x59, 0xfd, 0xec, 0x42, 0x8b, 0x7c, 0x9a, 0xbb, 0xc8, 0x15, 0xd4,
+	0x65, 0x10, 0x2b, 0x83, 0x91, 0xea, 0x2c, 0x7f, 0xac, 0x19, 0x81, 0xf1, 0xf9, 0x67, 0x00, 0xd9,
+	0x53, 0xd5, 0xb0, 0xcf, 0x3f, 0x65, 0xb4, 0xf0, 0x88, 0xf0, 0x2c, 0x49, 0x2e, 0x7b, 0x29, 0xe5,
+	0x33, 0x2b, 0xa2, 0x0c, 0x16, 0xf2, 0xbd, 0xaf, 0xe2, 0xe8, 0x86, 0x12, 0xc2, 0x15, 0x51, 0x84,
+	0x70, 0xcb, 0xd2, 0x30, 0xee, 0x50, 0x2a, 0xb8, 0x22, 0xe8, 0x7b, 0x72, 0x35, 0xd6, 0xac, 0xaa,
+	0xc6, 0x30, 0x31, 0x93, 0x7d, 0x0a, 0x82, 0xc7, 0x91, 0xea, 0xaa, 0xd8, 0x64, 0x54, 0x56, 0xb7,
+	0xc4, 0x18, 0x4e, 0x56, 0xcb, 0xfe, 0xe9, 0x30, 0x51, 0x5c, 0xb5, 0x0c, 0x5b, 0x02, 0x71, 0x7e,
+	0x04, 0x4a, 0x09, 0x00, 0xd5, 0xd9, 0x2d, 0x31, 0xde, 0xe1, 0x76, 0xac, 0xc0, 0xed, 0x27, 0xe1,
+	0xb7, 0xaa, 0xdd, 0x1a, 0xec, 0xd8, 0x48, 0x0f, 0xfb, 0x14, 0x36, 0x73, 0xf4, 0x69, 0x89, 0xed,
+	0xd7, 0x69, 0xc8, 0xe4, 0x4e, 0x24, 0x3a, 0x9c, 0xba, 0x4f, 0xca, 0x6f, 0x59, 0xa2, 0x1b, 0x00,
+	0x4e, 0xe7, 0xc9, 0x45, 0xa8, 0xa2, 0x40, 0x05, 0x68, 0x5c, 0x66, 0xad, 0xde, 0x18, 0xe8, 0x1c,
+	0xef, 0xe4, 0xff, 0xf2, 0xa0, 0x55, 0x82, 0xff, 0xe7, 0x2c, 0x67, 0xce, 0x54, 0xc4, 0x05, 0xc0,
+	0x49, 0xaa, 0xb0, 0x44, 0xb6, 0xfc, 0x5b, 0x06, 0x31, 0x0e, 0xf3, 0x30, 0x21, 0x1a, 0xca, 0x5c,
+	0xe6, 0x3a, 0x82, 0xa2, 0x9c, 0x2b, 0x0e, 0x1e, 0xba, 0x39, 0x97, 0xac, 0x5c, 0x19, 0xbd, 0xff,
+	0xcf, 0x4d, 0xb8, 0xed, 0xa8, 0xe8, 0xb4, 0x6f, 0x53, 0x0b, 0xa5, 0xd9, 0xd7, 0xf0, 0xe6, 0x13,
+	0x65, 0x9e, 0x85, 0x46, 0xfd, 0x9c, 0x18, 0x87, 0xa2, 0xe5, 0x89, 0x4e, 0x7a, 0x29, 0x9b, 0xf1,
+	0x88, 0xb8, 0x3d, 0xa3, 0x9f, 0xd7, 0xd8, 0x29, 0xac, 0xa3, 0x72, 0x69, 0x54, 0x66, 0x15, 0xb3,
+	0x9d, 0x2a, 0x8e, 0xcc, 0x1f, 0xda, 0xe6, 0xd0, 0xfa, 0x0b, 0xd8, 0x78, 0xa2, 0xcc, 0x41, 0xae,
+	0x93, 0x78, 0x6f, 0xb6, 0xde, 0x9d, 0x69, 0x7a, 0x51, 0x07, 0xaf, 0xb1, 0x9f, 0xc2, 0xca, 0x13,
+	0xe7, 0x82, 0x99, 0xab, 0x9f, 0x87, 0xed, 0x79, 0x8d, 0x7d, 0x0d, 0xad, 0x5c, 0xa5, 0x3d, 0x2c,
+	0xb3, 0x8b, 0xfe, 0x39, 0x55, 0x7f, 0xe2, 0xb1, 0x97, 0xd6, 0x13, 0x25, 0xa2, 0x9b, 0x65, 0xf7,
+	0xee, 0x8c, 0x1b, 0x66, 0x68, 0xf8, 0x1a, 0x56, 0x34, 0x42, 0x08, 0x2a, 0x34, 0x58, 0x95, 0x51,
+	0xc5, 0x82, 0x66, 0x7b, 0x77, 0xba, 0x90, 0xcd, 0x4c, 0x49, 0x39, 0xa6, 0xb9, 0x87, 0x54, 0x82,
+	0x14, 0xe6, 0x78, 0xab, 0xca, 0x36, 0x7c, 0x79, 0x9d, 0x5b, 0xf9, 0x4b, 0x8a, 0xba, 0xe2, 0x5b,
+	0xf5, 0x3b, 0x55, 0x57, 0xbd, 0x7b, 0x3e, 0xdf, 0xbe, 0x57, 0x21, 0x50, 0x7e, 0xf3, 0xe6, 0x35,
+	0xf6, 0x0a, 0x6e, 0xe1, 0x5b, 0x74, 0x51, 0xf9, 0x7c, 0x63, 0x2b, 0x37, 0xb5, 0xf8, 0xb4, 0xcd,
+	0x6b, 0x2c, 0x82, 0x8d, 0xd1, 0x8c, 0x7e, 0xde, 0x19, 0x3e, 0xae, 0x3c, 0x03, 0x93, 0x2b, 0x04,
+	0x5e, 0x63, 0x19, 0x05, 0x50, 0x4e, 0xfc, 0x98, 0x4f, 0x66, 0xec, 0xd3, 0xd9, 0x79, 0xd1, 0xf8,
+	0xa3, 0xd7, 0xdc, 0x1e, 0xa4, 0xa8, 0x65, 0x85, 0x49, 0xf3, 0xf7, 0xa1, 0xaa, 0xdf, 0x44, 0x0a,
+	0x8f, 0x4d, 0xd5, 0xdc, 0x60, 0x75, 0xf0, 0x1a, 0xfb, 0x25, 0xb4, 0xc7, 0x75, 0x5b, 0xb2, 0x63,
+	0x77, 0xa7, 0xcf, 0x30, 0x5b, 0xfb, 0x9e, 0xc7, 0x24, 0xdc, 0x72, 0x95, 0xd1, 0x8d, 0x1b, 0x36,
+	0x53, 0xed, 0x47, 0xd3, 0xfb, 0xcb, 0x85, 0x16, 0x91, 0xe6, 0xda, 0xb0, 0x04, 0x3c, 0xed, 0x57,
+	0xea, 0x77, 0x2f, 0x66, 0xdb, 0x3b, 0xd3, 0xd9, 0xe2, 0xb4, 0x4f, 0x4e, 0x0f, 0x61, 0x63, 0xa8,
+	0xd5, 0x39, 0xe4, 0x83, 0xea, 0x97, 0x8c, 0xd1, 0x0a, 0xf4, 0x75, 0xf6, 0x57, 0xd0, 0x02, 0x86,
+	0x0f, 0x76, 0xb3, 0x18, 0x69, 0xa7, 0x32, 0xe0, 0x9c, 0x06, 0x5e, 0x63, 0xbf, 0x82, 0xdb, 0x45,
+	0x9d, 0x96, 0x4a, 0xef, 0xcd, 0x1a, 0x68, 0xe9, 0x74, 0x0e, 0xfd, 0x9f, 0x78, 0x2c, 0x81, 0x5b,
+	0x23, 0x2f, 0x38, 0xec, 0xfd, 0xf9, 0x5e, 0x7a, 0xd0, 0x3d, 0x1f, 0xbf, 0xc6, 0xa3, 0x10, 0x86,
+	0x32, 0x9d, 0xbd, 0xcd, 0x91, 0x5e, 0xb7, 0x2d, 0xaf, 0x31, 0xed, 0xeb, 0xbc, 0x45, 0xb9, 0xbd,
+	0x69, 0xd1, 0x75, 0x3f, 0xf8, 0xfd, 0x6a, 0x3a, 0xe5, 0xbe, 0x3b, 0xf3, 0xa7, 0x04, 0x5e, 0x73,
+	0x3a, 0x0b, 0xcf, 0x38, 0xff, 0x9d, 0xce, 0xa1, 0x02, 0x5e, 0x63, 0xdf, 0x50, 0xb8, 0x96, 0x53,
+	0xb3, 0x39, 0x6e, 0xce, 0xaa, 0x2b, 0xa2, 0xa4, 0x88, 0xd7, 0xd8, 0x39, 0x65, 0x3d, 0x13, 0x5f,
+	0x7a, 0xa6, 0x1b, 0xff, 0x61, 0xe5, 0x4d, 0x32, 0xae, 0x8a, 0xd7, 0xd8, 0x19, 0xed, 0xf1, 0x84,
+	0xa2, 0x68, 0xfa, 0x2c, 0xef, 0x57, 0xde, 0x15, 0xa3, 0x8a, 0x78, 0x8d, 0x1d, 0x43, 0x13, 0xdd,
+	0xef, 0x1e, 0x2e, 0xa6, 0xea, 0x7d, 0x6f, 0xba, 0x5e, 0x52, 0x61, 0x73, 0x16, 0x21, 0xaf, 0x8f,
+	0x49, 0x34, 0x10, 0xc7, 0x87, 0x6c, 0xb7, 0xfa, 0xf0, 0x0f, 0xcb, 0xca, 0x6d, 0x3e, 0x43, 0x8a,
+	0x62, 0x90, 0x3d, 0x87, 0x45, 0xfc, 0x79, 0xa2, 0xf2, 0x4e, 0xce, 0x7f, 0xe7, 0xa8, 0x34, 0xb6,
+	0xf8, 0xe3, 0x06, 0xaf, 0x1d, 0xfc, 0xdf, 0xcb, 0xad, 0x08, 0xa3, 0xd1, 0x4a, 0x05, 0x1f, 0xdb,
+	0xbf, 0x3a, 0xf5, 0xff, 0xb1, 0x50, 0x3b, 0x5b, 0xa2, 0xff, 0x3f, 0xf8, 0xde, 0x7f, 0x06, 0x00,
+	0x5e, 0xa9, 0xd3, 0x4e, 0xbe, 0x20, 0x00, 0x00,
 }
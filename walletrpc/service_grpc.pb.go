@@ -25,10 +25,15 @@ type CompactTxStreamerClient interface {
 	GetLiteWalletBlockGroup(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*BlockID, error)
 	// Return the height of the tip of the best chain
 	GetLatestBlock(ctx context.Context, in *ChainSpec, opts ...grpc.CallOption) (*BlockID, error)
+	// Return just the hash of the tip of the best chain
+	GetBestBlockHash(ctx context.Context, in *ChainSpec, opts ...grpc.CallOption) (*BlockHash, error)
 	// Return the compact block corresponding to the given block identifier
 	GetBlock(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CompactBlock, error)
 	// Return a list of consecutive compact blocks
 	GetBlockRange(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeClient, error)
+	// Return the compact block, with its transactions' transparent inputs
+	// and outputs; requires lightwalletd --block-extended
+	GetBlockExtended(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*ExtendedBlock, error)
 	// Get the historical and current prices
 	GetARRRPrice(ctx context.Context, in *PriceRequest, opts ...grpc.CallOption) (*PriceResponse, error)
 	GetCurrentARRRPrice(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*PriceResponse, error)
@@ -36,10 +41,14 @@ type CompactTxStreamerClient interface {
 	GetTransaction(ctx context.Context, in *TxFilter, opts ...grpc.CallOption) (*RawTransaction, error)
 	// Submit the given transaction to the Zcash network
 	SendTransaction(ctx context.Context, in *RawTransaction, opts ...grpc.CallOption) (*SendResponse, error)
+	// Check whether the given transaction would be accepted, without submitting it
+	CheckTransaction(ctx context.Context, in *RawTransaction, opts ...grpc.CallOption) (*CheckTransactionResponse, error)
 	// Return the txids corresponding to the given t-address within the given block range
 	GetTaddressTxids(ctx context.Context, in *TransparentAddressBlockFilter, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressTxidsClient, error)
 	GetTaddressBalance(ctx context.Context, in *AddressList, opts ...grpc.CallOption) (*Balance, error)
 	GetTaddressBalanceStream(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressBalanceStreamClient, error)
+	// Return the type of the given (transparent or shielded) address
+	ClassifyAddress(ctx context.Context, in *Address, opts ...grpc.CallOption) (*AddressClassification, error)
 	// Return the compact transactions currently in the mempool; the results
 	// can be a few seconds out of date. If the Exclude list is empty, return
 	// all transactions; otherwise return all *except* those in the Exclude list
@@ -52,16 +61,35 @@ type CompactTxStreamerClient interface {
 	GetMempoolTx(ctx context.Context, in *Exclude, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxClient, error)
 	// Return a stream of current Mempool transactions. This will keep the output stream open while
 	// there are mempool transactions. It will close the returned stream when a new block is mined.
-	GetMempoolStream(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error)
+	// If the cursor is no longer known, a transaction with only cursorReset set is sent first.
+	GetMempoolStream(ctx context.Context, in *GetMempoolStreamArg, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error)
 	// GetTreeState returns the note commitment tree state corresponding to the given block.
 	// See section 3.7 of the Zcash protocol specification. It returns several other useful
 	// values also (even though they can be obtained using GetBlock).
 	// The block can be specified by either height or hash.
 	GetTreeState(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*TreeState, error)
+	// Return the tree states at every step-th height within the given range
+	GetTreeStateRange(ctx context.Context, in *TreeStateRange, opts ...grpc.CallOption) (CompactTxStreamer_GetTreeStateRangeClient, error)
 	GetAddressUtxos(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (*GetAddressUtxosReplyList, error)
 	GetAddressUtxosStream(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (CompactTxStreamer_GetAddressUtxosStreamClient, error)
 	// Return information about this lightwalletd instance and the blockchain
 	GetLightdInfo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*LightdInfo, error)
+	// Return chain-level statistics (height, difficulty, transactions, coin supply)
+	GetChainStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ChainStats, error)
+	// Return the numbers of shielded spends, outputs and actions in the
+	// given range of blocks (only its heights are used)
+	GetShieldedStats(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (*ShieldedStats, error)
+	// Return the consensus branch ID and expiry delta for new transactions
+	GetTxConstructionParams(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TxConstructionParams, error)
+	// Return the optional features this server supports, and its limits
+	GetServerCapabilities(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerCapabilities, error)
+	// Return the server's configuration (an admin rpc, only for clients on
+	// the same host)
+	GetConfig(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerConfig, error)
+	// Make the given pirated rpc, if lightwalletd --rpc-passthrough allows
+	// it, and return its result (an admin rpc, only for clients on the
+	// same host)
+	RawPiratedRPC(ctx context.Context, in *RawRPCRequest, opts ...grpc.CallOption) (*RawRPCReply, error)
 	// Testing-only, requires lightwalletd --ping-very-insecure (do not enable in production)
 	Ping(ctx context.Context, in *Duration, opts ...grpc.CallOption) (*PingResponse, error)
 }
@@ -92,6 +120,15 @@ func (c *compactTxStreamerClient) GetLatestBlock(ctx context.Context, in *ChainS
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetBestBlockHash(ctx context.Context, in *ChainSpec, opts ...grpc.CallOption) (*BlockHash, error) {
+	out := new(BlockHash)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBestBlockHash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetBlock(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CompactBlock, error) {
 	out := new(CompactBlock)
 	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlock", in, out, opts...)
@@ -133,6 +170,15 @@ func (x *compactTxStreamerGetBlockRangeClient) Recv() (*CompactBlock, error) {
 	return m, nil
 }
 
+func (c *compactTxStreamerClient) GetBlockExtended(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*ExtendedBlock, error) {
+	out := new(ExtendedBlock)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlockExtended", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetARRRPrice(ctx context.Context, in *PriceRequest, opts ...grpc.CallOption) (*PriceResponse, error) {
 	out := new(PriceResponse)
 	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetARRRPrice", in, out, opts...)
@@ -169,6 +215,15 @@ func (c *compactTxStreamerClient) SendTransaction(ctx context.Context, in *RawTr
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) CheckTransaction(ctx context.Context, in *RawTransaction, opts ...grpc.CallOption) (*CheckTransactionResponse, error) {
+	out := new(CheckTransactionResponse)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/CheckTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetTaddressTxids(ctx context.Context, in *TransparentAddressBlockFilter, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressTxidsClient, error) {
 	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[1], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetTaddressTxids", opts...)
 	if err != nil {
@@ -244,6 +299,15 @@ func (x *compactTxStreamerGetTaddressBalanceStreamClient) CloseAndRecv() (*Balan
 	return m, nil
 }
 
+func (c *compactTxStreamerClient) ClassifyAddress(ctx context.Context, in *Address, opts ...grpc.CallOption) (*AddressClassification, error) {
+	out := new(AddressClassification)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/ClassifyAddress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetMempoolTx(ctx context.Context, in *Exclude, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxClient, error) {
 	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[3], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetMempoolTx", opts...)
 	if err != nil {
@@ -276,7 +340,7 @@ func (x *compactTxStreamerGetMempoolTxClient) Recv() (*CompactTx, error) {
 	return m, nil
 }
 
-func (c *compactTxStreamerClient) GetMempoolStream(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error) {
+func (c *compactTxStreamerClient) GetMempoolStream(ctx context.Context, in *GetMempoolStreamArg, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error) {
 	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[4], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetMempoolStream", opts...)
 	if err != nil {
 		return nil, err
@@ -317,6 +381,38 @@ func (c *compactTxStreamerClient) GetTreeState(ctx context.Context, in *BlockID,
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetTreeStateRange(ctx context.Context, in *TreeStateRange, opts ...grpc.CallOption) (CompactTxStreamer_GetTreeStateRangeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[5], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetTreeStateRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetTreeStateRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_GetTreeStateRangeClient interface {
+	Recv() (*TreeState, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetTreeStateRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetTreeStateRangeClient) Recv() (*TreeState, error) {
+	m := new(TreeState)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *compactTxStreamerClient) GetAddressUtxos(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (*GetAddressUtxosReplyList, error) {
 	out := new(GetAddressUtxosReplyList)
 	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxos", in, out, opts...)
@@ -327,7 +423,7 @@ func (c *compactTxStreamerClient) GetAddressUtxos(ctx context.Context, in *GetAd
 }
 
 func (c *compactTxStreamerClient) GetAddressUtxosStream(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (CompactTxStreamer_GetAddressUtxosStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[5], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxosStream", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[6], "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxosStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -367,6 +463,60 @@ func (c *compactTxStreamerClient) GetLightdInfo(ctx context.Context, in *Empty,
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetChainStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ChainStats, error) {
+	out := new(ChainStats)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetChainStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) GetShieldedStats(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (*ShieldedStats, error) {
+	out := new(ShieldedStats)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetShieldedStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) GetTxConstructionParams(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TxConstructionParams, error) {
+	out := new(TxConstructionParams)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetTxConstructionParams", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) GetServerCapabilities(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerCapabilities, error) {
+	out := new(ServerCapabilities)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetServerCapabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) GetConfig(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerConfig, error) {
+	out := new(ServerConfig)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) RawPiratedRPC(ctx context.Context, in *RawRPCRequest, opts ...grpc.CallOption) (*RawRPCReply, error) {
+	out := new(RawRPCReply)
+	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/RawPiratedRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) Ping(ctx context.Context, in *Duration, opts ...grpc.CallOption) (*PingResponse, error) {
 	out := new(PingResponse)
 	err := c.cc.Invoke(ctx, "/pirate.wallet.sdk.rpc.CompactTxStreamer/Ping", in, out, opts...)
@@ -383,10 +533,15 @@ type CompactTxStreamerServer interface {
 	GetLiteWalletBlockGroup(context.Context, *BlockID) (*BlockID, error)
 	// Return the height of the tip of the best chain
 	GetLatestBlock(context.Context, *ChainSpec) (*BlockID, error)
+	// Return just the hash of the tip of the best chain
+	GetBestBlockHash(context.Context, *ChainSpec) (*BlockHash, error)
 	// Return the compact block corresponding to the given block identifier
 	GetBlock(context.Context, *BlockID) (*CompactBlock, error)
 	// Return a list of consecutive compact blocks
 	GetBlockRange(*BlockRange, CompactTxStreamer_GetBlockRangeServer) error
+	// Return the compact block, with its transactions' transparent inputs
+	// and outputs; requires lightwalletd --block-extended
+	GetBlockExtended(context.Context, *BlockID) (*ExtendedBlock, error)
 	// Get the historical and current prices
 	GetARRRPrice(context.Context, *PriceRequest) (*PriceResponse, error)
 	GetCurrentARRRPrice(context.Context, *Empty) (*PriceResponse, error)
@@ -394,10 +549,14 @@ type CompactTxStreamerServer interface {
 	GetTransaction(context.Context, *TxFilter) (*RawTransaction, error)
 	// Submit the given transaction to the Zcash network
 	SendTransaction(context.Context, *RawTransaction) (*SendResponse, error)
+	// Check whether the given transaction would be accepted, without submitting it
+	CheckTransaction(context.Context, *RawTransaction) (*CheckTransactionResponse, error)
 	// Return the txids corresponding to the given t-address within the given block range
 	GetTaddressTxids(*TransparentAddressBlockFilter, CompactTxStreamer_GetTaddressTxidsServer) error
 	GetTaddressBalance(context.Context, *AddressList) (*Balance, error)
 	GetTaddressBalanceStream(CompactTxStreamer_GetTaddressBalanceStreamServer) error
+	// Return the type of the given (transparent or shielded) address
+	ClassifyAddress(context.Context, *Address) (*AddressClassification, error)
 	// Return the compact transactions currently in the mempool; the results
 	// can be a few seconds out of date. If the Exclude list is empty, return
 	// all transactions; otherwise return all *except* those in the Exclude list
@@ -410,16 +569,35 @@ type CompactTxStreamerServer interface {
 	GetMempoolTx(*Exclude, CompactTxStreamer_GetMempoolTxServer) error
 	// Return a stream of current Mempool transactions. This will keep the output stream open while
 	// there are mempool transactions. It will close the returned stream when a new block is mined.
-	GetMempoolStream(*Empty, CompactTxStreamer_GetMempoolStreamServer) error
+	// If the cursor is no longer known, a transaction with only cursorReset set is sent first.
+	GetMempoolStream(*GetMempoolStreamArg, CompactTxStreamer_GetMempoolStreamServer) error
 	// GetTreeState returns the note commitment tree state corresponding to the given block.
 	// See section 3.7 of the Zcash protocol specification. It returns several other useful
 	// values also (even though they can be obtained using GetBlock).
 	// The block can be specified by either height or hash.
 	GetTreeState(context.Context, *BlockID) (*TreeState, error)
+	// Return the tree states at every step-th height within the given range
+	GetTreeStateRange(*TreeStateRange, CompactTxStreamer_GetTreeStateRangeServer) error
 	GetAddressUtxos(context.Context, *GetAddressUtxosArg) (*GetAddressUtxosReplyList, error)
 	GetAddressUtxosStream(*GetAddressUtxosArg, CompactTxStreamer_GetAddressUtxosStreamServer) error
 	// Return information about this lightwalletd instance and the blockchain
 	GetLightdInfo(context.Context, *Empty) (*LightdInfo, error)
+	// Return chain-level statistics (height, difficulty, transactions, coin supply)
+	GetChainStats(context.Context, *Empty) (*ChainStats, error)
+	// Return the numbers of shielded spends, outputs and actions in the
+	// given range of blocks (only its heights are used)
+	GetShieldedStats(context.Context, *BlockRange) (*ShieldedStats, error)
+	// Return the consensus branch ID and expiry delta for new transactions
+	GetTxConstructionParams(context.Context, *Empty) (*TxConstructionParams, error)
+	// Return the optional features this server supports, and its limits
+	GetServerCapabilities(context.Context, *Empty) (*ServerCapabilities, error)
+	// Return the server's configuration (an admin rpc, only for clients on
+	// the same host)
+	GetConfig(context.Context, *Empty) (*ServerConfig, error)
+	// Make the given pirated rpc, if lightwalletd --rpc-passthrough allows
+	// it, and return its result (an admin rpc, only for clients on the
+	// same host)
+	RawPiratedRPC(context.Context, *RawRPCRequest) (*RawRPCReply, error)
 	// Testing-only, requires lightwalletd --ping-very-insecure (do not enable in production)
 	Ping(context.Context, *Duration) (*PingResponse, error)
 	mustEmbedUnimplementedCompactTxStreamerServer()
@@ -435,12 +613,18 @@ func (UnimplementedCompactTxStreamerServer) GetLiteWalletBlockGroup(context.Cont
 func (UnimplementedCompactTxStreamerServer) GetLatestBlock(context.Context, *ChainSpec) (*BlockID, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLatestBlock not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetBestBlockHash(context.Context, *ChainSpec) (*BlockHash, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBestBlockHash not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetBlock(context.Context, *BlockID) (*CompactBlock, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
 }
 func (UnimplementedCompactTxStreamerServer) GetBlockRange(*BlockRange, CompactTxStreamer_GetBlockRangeServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetBlockRange not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetBlockExtended(context.Context, *BlockID) (*ExtendedBlock, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockExtended not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetARRRPrice(context.Context, *PriceRequest) (*PriceResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetARRRPrice not implemented")
 }
@@ -453,6 +637,9 @@ func (UnimplementedCompactTxStreamerServer) GetTransaction(context.Context, *TxF
 func (UnimplementedCompactTxStreamerServer) SendTransaction(context.Context, *RawTransaction) (*SendResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendTransaction not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) CheckTransaction(context.Context, *RawTransaction) (*CheckTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckTransaction not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetTaddressTxids(*TransparentAddressBlockFilter, CompactTxStreamer_GetTaddressTxidsServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetTaddressTxids not implemented")
 }
@@ -462,15 +649,21 @@ func (UnimplementedCompactTxStreamerServer) GetTaddressBalance(context.Context,
 func (UnimplementedCompactTxStreamerServer) GetTaddressBalanceStream(CompactTxStreamer_GetTaddressBalanceStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetTaddressBalanceStream not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) ClassifyAddress(context.Context, *Address) (*AddressClassification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClassifyAddress not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetMempoolTx(*Exclude, CompactTxStreamer_GetMempoolTxServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetMempoolTx not implemented")
 }
-func (UnimplementedCompactTxStreamerServer) GetMempoolStream(*Empty, CompactTxStreamer_GetMempoolStreamServer) error {
+func (UnimplementedCompactTxStreamerServer) GetMempoolStream(*GetMempoolStreamArg, CompactTxStreamer_GetMempoolStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetMempoolStream not implemented")
 }
 func (UnimplementedCompactTxStreamerServer) GetTreeState(context.Context, *BlockID) (*TreeState, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTreeState not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetTreeStateRange(*TreeStateRange, CompactTxStreamer_GetTreeStateRangeServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetTreeStateRange not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetAddressUtxos(context.Context, *GetAddressUtxosArg) (*GetAddressUtxosReplyList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAddressUtxos not implemented")
 }
@@ -480,6 +673,24 @@ func (UnimplementedCompactTxStreamerServer) GetAddressUtxosStream(*GetAddressUtx
 func (UnimplementedCompactTxStreamerServer) GetLightdInfo(context.Context, *Empty) (*LightdInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLightdInfo not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetChainStats(context.Context, *Empty) (*ChainStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChainStats not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetShieldedStats(context.Context, *BlockRange) (*ShieldedStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShieldedStats not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetTxConstructionParams(context.Context, *Empty) (*TxConstructionParams, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTxConstructionParams not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetServerCapabilities(context.Context, *Empty) (*ServerCapabilities, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServerCapabilities not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetConfig(context.Context, *Empty) (*ServerConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) RawPiratedRPC(context.Context, *RawRPCRequest) (*RawRPCReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RawPiratedRPC not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) Ping(context.Context, *Duration) (*PingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
@@ -532,6 +743,24 @@ func _CompactTxStreamer_GetLatestBlock_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetBestBlockHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChainSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetBestBlockHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBestBlockHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetBestBlockHash(ctx, req.(*ChainSpec))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(BlockID)
 	if err := dec(in); err != nil {
@@ -571,6 +800,24 @@ func (x *compactTxStreamerGetBlockRangeServer) Send(m *CompactBlock) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _CompactTxStreamer_GetBlockExtended_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetBlockExtended(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetBlockExtended",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetBlockExtended(ctx, req.(*BlockID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetARRRPrice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PriceRequest)
 	if err := dec(in); err != nil {
@@ -643,6 +890,24 @@ func _CompactTxStreamer_SendTransaction_Handler(srv interface{}, ctx context.Con
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_CheckTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RawTransaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).CheckTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/CheckTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).CheckTransaction(ctx, req.(*RawTransaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetTaddressTxids_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(TransparentAddressBlockFilter)
 	if err := stream.RecvMsg(m); err != nil {
@@ -708,6 +973,24 @@ func (x *compactTxStreamerGetTaddressBalanceStreamServer) Recv() (*Address, erro
 	return m, nil
 }
 
+func _CompactTxStreamer_ClassifyAddress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Address)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).ClassifyAddress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/ClassifyAddress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).ClassifyAddress(ctx, req.(*Address))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetMempoolTx_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(Exclude)
 	if err := stream.RecvMsg(m); err != nil {
@@ -730,7 +1013,7 @@ func (x *compactTxStreamerGetMempoolTxServer) Send(m *CompactTx) error {
 }
 
 func _CompactTxStreamer_GetMempoolStream_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(Empty)
+	m := new(GetMempoolStreamArg)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -768,6 +1051,27 @@ func _CompactTxStreamer_GetTreeState_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetTreeStateRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TreeStateRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).GetTreeStateRange(m, &compactTxStreamerGetTreeStateRangeServer{stream})
+}
+
+type CompactTxStreamer_GetTreeStateRangeServer interface {
+	Send(*TreeState) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetTreeStateRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetTreeStateRangeServer) Send(m *TreeState) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _CompactTxStreamer_GetAddressUtxos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetAddressUtxosArg)
 	if err := dec(in); err != nil {
@@ -825,6 +1129,114 @@ func _CompactTxStreamer_GetLightdInfo_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetChainStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetChainStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetChainStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetChainStats(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetShieldedStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockRange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetShieldedStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetShieldedStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetShieldedStats(ctx, req.(*BlockRange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetTxConstructionParams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetTxConstructionParams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetTxConstructionParams",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetTxConstructionParams(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetServerCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetServerCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetServerCapabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetServerCapabilities(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetConfig(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_RawPiratedRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RawRPCRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).RawPiratedRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pirate.wallet.sdk.rpc.CompactTxStreamer/RawPiratedRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).RawPiratedRPC(ctx, req.(*RawRPCRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Duration)
 	if err := dec(in); err != nil {
@@ -858,10 +1270,18 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLatestBlock",
 			Handler:    _CompactTxStreamer_GetLatestBlock_Handler,
 		},
+		{
+			MethodName: "GetBestBlockHash",
+			Handler:    _CompactTxStreamer_GetBestBlockHash_Handler,
+		},
 		{
 			MethodName: "GetBlock",
 			Handler:    _CompactTxStreamer_GetBlock_Handler,
 		},
+		{
+			MethodName: "GetBlockExtended",
+			Handler:    _CompactTxStreamer_GetBlockExtended_Handler,
+		},
 		{
 			MethodName: "GetARRRPrice",
 			Handler:    _CompactTxStreamer_GetARRRPrice_Handler,
@@ -878,10 +1298,18 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendTransaction",
 			Handler:    _CompactTxStreamer_SendTransaction_Handler,
 		},
+		{
+			MethodName: "CheckTransaction",
+			Handler:    _CompactTxStreamer_CheckTransaction_Handler,
+		},
 		{
 			MethodName: "GetTaddressBalance",
 			Handler:    _CompactTxStreamer_GetTaddressBalance_Handler,
 		},
+		{
+			MethodName: "ClassifyAddress",
+			Handler:    _CompactTxStreamer_ClassifyAddress_Handler,
+		},
 		{
 			MethodName: "GetTreeState",
 			Handler:    _CompactTxStreamer_GetTreeState_Handler,
@@ -894,6 +1322,30 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLightdInfo",
 			Handler:    _CompactTxStreamer_GetLightdInfo_Handler,
 		},
+		{
+			MethodName: "GetChainStats",
+			Handler:    _CompactTxStreamer_GetChainStats_Handler,
+		},
+		{
+			MethodName: "GetShieldedStats",
+			Handler:    _CompactTxStreamer_GetShieldedStats_Handler,
+		},
+		{
+			MethodName: "GetTxConstructionParams",
+			Handler:    _CompactTxStreamer_GetTxConstructionParams_Handler,
+		},
+		{
+			MethodName: "GetServerCapabilities",
+			Handler:    _CompactTxStreamer_GetServerCapabilities_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _CompactTxStreamer_GetConfig_Handler,
+		},
+		{
+			MethodName: "RawPiratedRPC",
+			Handler:    _CompactTxStreamer_RawPiratedRPC_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _CompactTxStreamer_Ping_Handler,
@@ -925,6 +1377,11 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _CompactTxStreamer_GetMempoolStream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "GetTreeStateRange",
+			Handler:       _CompactTxStreamer_GetTreeStateRange_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "GetAddressUtxosStream",
 			Handler:       _CompactTxStreamer_GetAddressUtxosStream_Handler,